@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAccessRequests(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		admin, manager, owner, peer, stranger := s.user("admin"), s.user("manager"), s.user("owner"), s.user("peer"), s.user("stranger")
+
+		team := s.do("POST", "/teams", manager, "MANAGER", map[string]interface{}{
+			"teamName": "research" + s.suffix,
+			"managers": []map[string]string{{"managerId": manager, "managerName": "Manager"}},
+			"members":  []map[string]string{{"memberId": owner, "memberName": "Owner"}, {"memberId": peer, "memberName": "Peer"}},
+		}).expect(t, http.StatusCreated, "create team").id(t, "teamId")
+		folder := s.do("POST", "/folders", owner, "MEMBER", map[string]string{"name": "findings"}).
+			expect(t, http.StatusCreated, "create folder").id(t, "id")
+		note := s.do("POST", "/folders/"+folder+"/notes", owner, "MEMBER", map[string]string{"title": "results", "body": "pending"}).
+			expect(t, http.StatusCreated, "create note").id(t, "id")
+		inbox := func(userID, role string) int {
+			t.Helper()
+			return len(s.do("GET", "/me/access-requests", userID, role, nil).expect(t, http.StatusOK, "inbox").list("accessRequests"))
+		}
+
+		// Users on no team with the owner cannot learn the folder exists
+		s.do("POST", "/folders/"+folder+"/access-requests", stranger, "MEMBER", map[string]string{"access": "read"}).
+			expect(t, http.StatusNotFound, "stranger requests access")
+		read := s.do("POST", "/folders/"+folder+"/access-requests", peer, "MEMBER", map[string]string{"access": "read", "message": "for the review"}).
+			expect(t, http.StatusCreated, "request read access").id(t, "id")
+		s.do("POST", "/folders/"+folder+"/access-requests", peer, "MEMBER", map[string]string{"access": "read"}).
+			expect(t, http.StatusConflict, "request again while pending")
+		if n := inbox(owner, "MEMBER"); n != 1 {
+			t.Errorf("owner inbox lists %d requests, want 1", n)
+		}
+
+		s.do("POST", "/access-requests/"+read+"/approve", peer, "MEMBER", nil).expect(t, http.StatusNotFound, "requester approves")
+		s.do("POST", "/access-requests/"+read+"/approve", owner, "MEMBER", nil).expect(t, http.StatusOK, "owner approves")
+		s.do("POST", "/access-requests/"+read+"/approve", owner, "MEMBER", nil).expect(t, http.StatusConflict, "approve twice")
+		s.do("GET", "/folders/"+folder, peer, "MEMBER", nil).expect(t, http.StatusOK, "folder after approval")
+
+		write := s.do("POST", "/folders/"+folder+"/access-requests", peer, "MEMBER", map[string]string{"access": "write"}).
+			expect(t, http.StatusCreated, "request write access").id(t, "id")
+		rejected := s.do("POST", "/access-requests/"+write+"/reject", owner, "MEMBER", nil).expect(t, http.StatusOK, "owner rejects")
+		if rejected.str("status") != "rejected" {
+			t.Errorf("rejected request = %s", rejected.raw)
+		}
+		s.do("PUT", "/notes/"+note, peer, "MEMBER", map[string]string{"title": "results", "body": "in"}).
+			expect(t, http.StatusForbidden, "update after rejection")
+
+		// A share the policies refuse leaves the request pending, with nothing shared
+		s.do("PUT", "/admin/sharing-policies/teams/"+team, admin, "ADMIN", map[string]interface{}{"directoryUsersOnly": true}).
+			expect(t, http.StatusOK, "set team policy")
+		write = s.do("POST", "/folders/"+folder+"/access-requests", peer, "MEMBER", map[string]string{"access": "write"}).
+			expect(t, http.StatusCreated, "request write access again").id(t, "id")
+		s.do("POST", "/access-requests/"+write+"/approve", owner, "MEMBER", nil).expect(t, http.StatusForbidden, "approve against the policy")
+		if n := inbox(owner, "MEMBER"); n != 1 {
+			t.Errorf("owner inbox lists %d requests after a refused share, want 1", n)
+		}
+		s.do("PUT", "/notes/"+note, peer, "MEMBER", map[string]string{"title": "results", "body": "in"}).
+			expect(t, http.StatusForbidden, "update after a refused share")
+
+		// An approval only a manager may grant is handed on to the managers, still pending
+		s.do("PUT", "/admin/sharing-policies/teams/"+team, admin, "ADMIN", map[string]interface{}{"writeRequiresManager": true}).
+			expect(t, http.StatusOK, "set team policy")
+		handed := s.do("POST", "/access-requests/"+write+"/approve", owner, "MEMBER", nil).
+			expect(t, http.StatusAccepted, "owner approves write")
+		if handed.str("status") != "pending" || handed.str("sharedBy") != owner {
+			t.Errorf("handed-off request = %s", handed.raw)
+		}
+		s.do("PUT", "/notes/"+note, peer, "MEMBER", map[string]string{"title": "results", "body": "in"}).
+			expect(t, http.StatusForbidden, "update while held")
+		if n := inbox(owner, "MEMBER"); n != 0 {
+			t.Errorf("owner inbox lists %d requests after the hand-off, want 0", n)
+		}
+		s.do("POST", "/access-requests/"+write+"/approve", owner, "MEMBER", nil).expect(t, http.StatusNotFound, "owner approves again")
+
+		s.do("POST", "/access-requests/"+write+"/approve", manager, "MANAGER", nil).expect(t, http.StatusOK, "manager approves")
+		s.do("PUT", "/notes/"+note, peer, "MEMBER", map[string]string{"title": "results", "body": "in"}).
+			expect(t, http.StatusOK, "update after approval")
+	})
+}
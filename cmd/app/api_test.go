@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFolderAndNoteLifecycle(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		owner, reader := s.user("owner"), s.user("reader")
+
+		folder := s.do("POST", "/folders", owner, "MEMBER", map[string]string{"name": "plans"}).
+			expect(t, http.StatusCreated, "create folder").id(t, "id")
+		note := s.do("POST", "/folders/"+folder+"/notes", owner, "MEMBER", map[string]string{"title": "q3", "body": "ship it"}).
+			expect(t, http.StatusCreated, "create note").id(t, "id")
+
+		s.do("GET", "/folders/"+folder, reader, "MEMBER", nil).expect(t, http.StatusNotFound, "folder before sharing")
+		s.do("GET", "/notes/"+note, reader, "MEMBER", nil).expect(t, http.StatusNotFound, "note before sharing")
+
+		s.do("POST", "/folders/"+folder+"/share", owner, "MEMBER", map[string]string{"userId": reader, "access": "read"}).
+			expect(t, http.StatusOK, "share folder")
+		s.do("GET", "/folders/"+folder, reader, "MEMBER", nil).expect(t, http.StatusOK, "shared folder")
+		// Sharing a folder shares the notes already in it
+		got := s.do("GET", "/notes/"+note, reader, "MEMBER", nil).expect(t, http.StatusOK, "note in shared folder")
+		if got.str("body") != "ship it" {
+			t.Errorf("shared note body = %q", got.str("body"))
+		}
+		s.do("PUT", "/notes/"+note, reader, "MEMBER", map[string]string{"title": "q3", "body": "scrap it"}).
+			expect(t, http.StatusForbidden, "update with read access")
+
+		s.do("DELETE", "/folders/"+folder+"/share/"+reader, owner, "MEMBER", nil).expect(t, http.StatusOK, "revoke folder share")
+		s.do("GET", "/folders/"+folder, reader, "MEMBER", nil).expect(t, http.StatusNotFound, "folder after revoking")
+
+		s.do("DELETE", "/folders/"+folder, reader, "MEMBER", nil)
+		s.do("GET", "/folders/"+folder, owner, "MEMBER", nil).expect(t, http.StatusOK, "folder after a stranger's delete")
+		s.do("DELETE", "/folders/"+folder, owner, "MEMBER", nil).expect(t, http.StatusOK, "delete folder")
+		s.do("GET", "/notes/"+note, owner, "MEMBER", nil).expect(t, http.StatusNotFound, "note of deleted folder")
+	})
+}
+
+func TestTeamRosterAndAssets(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		manager, alice, bob := s.user("manager"), s.user("alice"), s.user("bob")
+
+		team := s.do("POST", "/teams", manager, "MANAGER", map[string]interface{}{
+			"teamName": "platform" + s.suffix,
+			"managers": []map[string]string{{"managerId": manager, "managerName": "Manager"}},
+			"members":  []map[string]string{{"memberId": alice, "memberName": "Alice"}},
+		}).expect(t, http.StatusCreated, "create team").id(t, "teamId")
+
+		s.do("POST", "/teams/"+team+"/members", alice, "MEMBER", map[string]string{"memberId": bob}).
+			expect(t, http.StatusForbidden, "member adds a member")
+		s.do("POST", "/teams/"+team+"/members", manager, "MANAGER", map[string]string{"memberId": bob, "memberName": "Bob"}).
+			expect(t, http.StatusCreated, "manager adds a member")
+
+		export := s.do("GET", "/teams/"+team+"/roster/export", manager, "MANAGER", nil).expect(t, http.StatusOK, "export roster")
+		for _, id := range []string{manager, alice, bob} {
+			if !strings.Contains(string(export.raw), id) {
+				t.Errorf("roster export is missing %s: %s", id, export.raw)
+			}
+		}
+
+		s.do("POST", "/folders", alice, "MEMBER", map[string]string{"name": "alice's notes"}).expect(t, http.StatusCreated, "create folder")
+		assets := s.do("GET", "/teams/"+team+"/assets", manager, "MANAGER", nil).expect(t, http.StatusOK, "team assets")
+		if n := len(assets.list("ownedFolders")); n != 1 {
+			t.Errorf("team assets list %d owned folders, want 1: %s", n, assets.raw)
+		}
+		s.do("GET", "/teams/"+team+"/assets", alice, "MEMBER", nil).expect(t, http.StatusForbidden, "member reads team assets")
+
+		s.do("DELETE", "/teams/"+team+"/members/"+bob, manager, "MANAGER", nil).expect(t, http.StatusOK, "remove member")
+		export = s.do("GET", "/teams/"+team+"/roster/export", manager, "MANAGER", nil).expect(t, http.StatusOK, "export roster")
+		if strings.Contains(string(export.raw), bob) {
+			t.Errorf("roster export still lists %s: %s", bob, export.raw)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		owner, other := s.user("owner"), s.user("other")
+		create := func(userID, key, name string) response {
+			t.Helper()
+			req := s.newRequest("POST", "/folders", map[string]string{"name": name})
+			req.Header.Set("Authorization", "Bearer "+s.token(userID, "MEMBER"))
+			req.Header.Set("Idempotency-Key", key)
+			return s.send(req)
+		}
+
+		first := create(owner, "create-plans", "plans").expect(t, http.StatusCreated, "create folder")
+		retry := create(owner, "create-plans", "plans").expect(t, http.StatusCreated, "retry with the same key")
+		if retry.header.Get("Idempotent-Replayed") != "true" {
+			t.Errorf("retry was not marked as replayed: %v", retry.header)
+		}
+		if retry.id(t, "id") != first.id(t, "id") {
+			t.Errorf("retry created folder %s, want the replayed %s", retry.id(t, "id"), first.id(t, "id"))
+		}
+
+		create(owner, "create-plans", "other plans").expect(t, http.StatusUnprocessableEntity, "same key, different body")
+
+		// Keys are scoped to the caller
+		theirs := create(other, "create-plans", "plans").expect(t, http.StatusCreated, "another user's key")
+		if theirs.header.Get("Idempotent-Replayed") != "" || theirs.id(t, "id") == first.id(t, "id") {
+			t.Errorf("another user's request replayed the owner's response: %s", theirs.raw)
+		}
+
+		// A request that fails validation is recorded and replayed like any other answer
+		create(owner, "empty", "").expect(t, http.StatusBadRequest, "invalid create")
+		replayed := create(owner, "empty", "").expect(t, http.StatusBadRequest, "retry of the invalid create")
+		if replayed.header.Get("Idempotent-Replayed") != "true" {
+			t.Errorf("retried client error was not replayed")
+		}
+	})
+}
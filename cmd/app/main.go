@@ -1,74 +1,277 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"os"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
-	"team-service/internal/delivery/http"
+	delivery "team-service/internal/delivery/http"
 	"team-service/internal/delivery/http/handlers"
+	httpmiddleware "team-service/internal/delivery/http/middleware"
+	"team-service/internal/entities"
 	"team-service/internal/repository"
 	"team-service/internal/usecases"
+	"team-service/pkg/auth"
+	"team-service/pkg/config"
 	"team-service/pkg/db"
 	"team-service/pkg/logger"
+	"team-service/pkg/metrics"
+	"team-service/pkg/middleware"
+	"team-service/pkg/ratelimit"
+	"team-service/pkg/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"gorm.io/gorm"
 )
 
 func main() {
+	configPath := flag.String("config", config.DefaultPath, "path to the YAML configuration file")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flag.Parse()
+
 	// Load .env file
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("No .env file found or error loading .env file")
 	}
 
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal("Failed to load configuration: ", err)
+	}
+
+	if *printConfig {
+		out, err := cfg.Redacted().YAML()
+		if err != nil {
+			log.Fatal("Failed to render configuration: ", err)
+		}
+		fmt.Print(out)
+		return
+	}
+
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run wires the service, serves until SIGINT/SIGTERM and then shuts down in order:
+// stop taking traffic, drain in-flight requests, stop background workers, flush spans, close the pool.
+func run(cfg *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := logger.SetupLogger(cfg.Logging); err != nil {
+		return fmt.Errorf("setup logger: %w", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("setup tracing: %w", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Logger.Error().Err(err).Msg("Failed to flush traces")
+		}
+	}()
+
 	// Setup database
-	dsn := os.Getenv("DATABASE_DSN")
-	database, err := db.SetupDatabase(dsn)
+	database, err := db.SetupDatabase(cfg.Database)
 	if err != nil {
-		log.Fatal("Failed to setup database: ", err)
+		return fmt.Errorf("setup database: %w", err)
 	}
+	defer func() {
+		if err := db.Close(database); err != nil {
+			logger.Logger.Error().Err(err).Msg("Failed to close database pool")
+		}
+	}()
 
-	logger.SetupLogger()
+	// Background workers run until shutdown and are awaited before the pool closes
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	startWorker := func(name string, fn func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			fn(workerCtx)
+			logger.Logger.Info().Str("worker", name).Msg("Background worker stopped")
+		}()
+	}
+	defer func() {
+		stopWorkers()
+		workers.Wait()
+	}()
+
+	verifier, err := auth.NewVerifier(ctx, cfg.Auth)
+	if err != nil {
+		return fmt.Errorf("setup token verification: %w", err)
+	}
+
+	r, healthHandler, err := newEngine(cfg, database, verifier, startWorker)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Server.Port,
+		Handler:           r,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Logger.Info().Str("addr", cfg.Server.Port).Msg("Server starting")
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	logger.Logger.Info().Dur("timeout", cfg.Server.ShutdownTimeout).Msg("Shutdown signal received, draining requests")
+	healthHandler.SetDraining()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Logger.Error().Err(err).Msg("Server did not drain before the shutdown timeout")
+	}
 
+	logger.Logger.Info().Msg("Server stopped")
+	return nil
+}
+
+// newEngine wires the repositories, services and handlers onto database and builds the HTTP
+// engine serving them. Background workers are handed to startWorker; the health handler is
+// returned so shutdown can report draining.
+func newEngine(cfg *config.Config, database *gorm.DB, verifier *auth.Verifier, startWorker func(name string, fn func(context.Context))) (*gin.Engine, *handlers.HealthHandler, error) {
 	// Initialize repositories
 	folderRepo := repository.NewFolderRepository(database)
 	noteRepo := repository.NewNoteRepository(database)
 	shareRepo := repository.NewShareRepository(database)
 	teamRepo := repository.NewTeamRepository(database)
+	tokenRepo := repository.NewAPITokenRepository(database)
+	sessionRepo := repository.NewSessionRepository(database)
+	userRepo := repository.NewUserRepository(database)
+	auditRepo := repository.NewAuditRepository(database)
+	idempotencyRepo := repository.NewIdempotencyRepository(database)
+	invitationRepo := repository.NewInvitationRepository(database)
+	joinRequestRepo := repository.NewJoinRequestRepository(database)
+	teamRoleRepo := repository.NewTeamRoleRepository(database)
+	usageRepo := repository.NewUsageRepository(database)
+	accessRequestRepo := repository.NewAccessRequestRepository(database)
+	sharingPolicyRepo := repository.NewSharingPolicyRepository(database)
 
 	// Initialize use cases/services
-	folderService := usecases.NewFolderService(folderRepo, noteRepo, shareRepo, database)
-	noteService := usecases.NewNoteService(noteRepo, folderRepo, shareRepo, database)
-	shareService := usecases.NewShareService(shareRepo, folderRepo, noteRepo, teamRepo, database)
-	teamService := usecases.NewTeamService(teamRepo)
+	quotaService := usecases.NewQuotaService(usageRepo, userRepo, quotaPolicy(cfg.Quotas))
+	folderService := usecases.NewFolderService(folderRepo, noteRepo, shareRepo, teamRepo, quotaService, database)
+	noteService := usecases.NewNoteService(noteRepo, folderRepo, shareRepo, teamRepo, quotaService, database)
+	sharingPolicyService := usecases.NewSharingPolicyService(sharingPolicyRepo, teamRepo, userRepo)
+	shareService := usecases.NewShareService(shareRepo, folderRepo, noteRepo, teamRepo, accessRequestRepo, sharingPolicyService, database)
+	accessRequestService := usecases.NewAccessRequestService(accessRequestRepo, folderRepo, noteRepo, shareRepo, teamRepo, shareService, database)
+	teamService := usecases.NewTeamService(teamRepo, joinRequestRepo, userRepo, teamRoleRepo, database)
+	tokenService := usecases.NewTokenService(tokenRepo)
+	sessionService := usecases.NewSessionService(sessionRepo, userRepo, cfg.Auth.SessionCacheTTL)
+	idempotencyService := usecases.NewIdempotencyService(idempotencyRepo, cfg.Idempotency.TTL)
+	invitationService := usecases.NewInvitationService(invitationRepo, teamRepo, userRepo, database)
+	adminService := usecases.NewAdminService(teamRepo, userRepo, folderRepo, noteRepo, shareRepo, auditRepo, sessionService, quotaService, database)
 
 	// Initialize handlers
 	folderHandler := handlers.NewFolderHandler(folderService)
 	noteHandler := handlers.NewNoteHandler(noteService)
 	shareHandler := handlers.NewShareHandler(shareService)
 	teamHandler := handlers.NewTeamHandler(teamService)
+	tokenHandler := handlers.NewTokenHandler(tokenService)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
+	adminHandler := handlers.NewAdminHandler(adminService)
+	invitationHandler := handlers.NewInvitationHandler(invitationService)
+	usageHandler := handlers.NewUsageHandler(quotaService)
+	accessRequestHandler := handlers.NewAccessRequestHandler(accessRequestService)
+	sharingPolicyHandler := handlers.NewSharingPolicyHandler(sharingPolicyService)
+	healthHandler := handlers.NewHealthHandler(database)
+
+	// SCIM provisioning is off unless a dedicated token is configured
+	var scimHandler *handlers.SCIMHandler
+	if cfg.SCIM.Token != "" {
+		scimHandler = handlers.NewSCIMHandler(usecases.NewSCIMService(userRepo, teamRepo, sessionService, database))
+	}
+
+	// Rate limiting; "memory" is the only rate_limit.store shipped so far
+	rateStore := ratelimit.NewMemoryStore()
+	rateLimiter := middleware.NewRateLimiter(rateStore, cfg.RateLimit)
+	startWorker("rate-limit-sweeper", func(ctx context.Context) {
+		runEvery(ctx, time.Minute, func(context.Context) { rateStore.Sweep() })
+	})
 
 	// Initialize router
-	router := http.NewRouter(folderHandler, noteHandler, shareHandler, teamHandler)
+	router := delivery.NewRouter(folderHandler, noteHandler, shareHandler, teamHandler, tokenHandler, sessionHandler, adminHandler, invitationHandler, usageHandler, accessRequestHandler, sharingPolicyHandler, scimHandler, healthHandler,
+		httpmiddleware.AuthMiddleware(verifier, tokenService, sessionService), httpmiddleware.SCIMAuth(cfg.SCIM.Token), httpmiddleware.Audit(adminService), rateLimiter.Group,
+		rateLimiter.Client(), httpmiddleware.Idempotent(idempotencyService))
 
-	// Setup Gin engine
-	r := gin.Default()
+	startWorker("revocation-cleanup", func(ctx context.Context) {
+		runEvery(ctx, time.Hour, func(ctx context.Context) {
+			purged, err := sessionService.PurgeExpiredRevocations(ctx)
+			if err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to purge expired token revocations")
+				return
+			}
+			if purged > 0 {
+				logger.Logger.Info().Int64("purged", purged).Msg("Purged expired token revocations")
+			}
+		})
+	})
 
-	r.Use(func(c *gin.Context) {
-		start := time.Now()
-		c.Next()
-		latency := time.Since(start)
-
-		logger.Logger.Info().
-			Str("method", c.Request.Method).
-			Str("path", c.Request.URL.Path).
-			Int("status", c.Writer.Status()).
-			Dur("latency", latency).
-			Msg("Incoming request")
+	startWorker("share-expiry-cleanup", func(ctx context.Context) {
+		runEvery(ctx, time.Hour, func(ctx context.Context) {
+			purged, err := shareService.PurgeExpiredShares(ctx)
+			if err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to purge expired shares")
+				return
+			}
+			if purged > 0 {
+				logger.Logger.Info().Int64("purged", purged).Msg("Purged expired shares")
+			}
+		})
+	})
+
+	startWorker("idempotency-cleanup", func(ctx context.Context) {
+		runEvery(ctx, time.Hour, func(ctx context.Context) {
+			purged, err := idempotencyService.PurgeExpired(ctx)
+			if err != nil {
+				logger.Logger.Error().Err(err).Msg("Failed to purge expired idempotency keys")
+				return
+			}
+			if purged > 0 {
+				logger.Logger.Info().Int64("purged", purged).Msg("Purged expired idempotency keys")
+			}
+		})
 	})
 
+	// Setup Gin engine
+	r := gin.New()
+	// ClientIP keys the pre-auth rate limits; only configured proxies may set X-Forwarded-For
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, nil, fmt.Errorf("set trusted proxies: %w", err)
+	}
+	// Tracing runs first so the request logger can stamp trace IDs on every line
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName), middleware.RequestLogger(), gin.Recovery())
+	if cfg.Metrics.Enabled {
+		r.Use(metrics.Middleware())
+	}
+
 	// Add database to context
 	r.Use(func(c *gin.Context) {
 		c.Set("db", database)
@@ -78,12 +281,73 @@ func main() {
 	// Setup routes
 	router.SetupRoutes(r)
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = ":8080"
+	if cfg.Metrics.Enabled {
+		metricsHandler := metrics.Handler(cfg.Metrics.Token)
+		if cfg.Metrics.ListenAddr == "" {
+			r.GET(cfg.Metrics.Path, gin.WrapH(metricsHandler))
+		} else {
+			mux := http.NewServeMux()
+			mux.Handle(cfg.Metrics.Path, metricsHandler)
+			metricsServer := &http.Server{
+				Addr:              cfg.Metrics.ListenAddr,
+				Handler:           mux,
+				ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			}
+			startWorker("metrics-listener", func(ctx context.Context) {
+				serveUntilDone(ctx, metricsServer, cfg.Server.ShutdownTimeout)
+			})
+		}
+	}
+
+	return r, healthHandler, nil
+}
+
+// runEvery calls fn on every tick until ctx is cancelled
+func runEvery(ctx context.Context, interval time.Duration, fn func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn(ctx)
+		}
+	}
+}
+
+// serveUntilDone runs an auxiliary listener until ctx is cancelled, then drains it
+func serveUntilDone(ctx context.Context, server *http.Server, timeout time.Duration) {
+	go func() {
+		logger.Logger.Info().Str("addr", server.Addr).Msg("Listener starting")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Logger.Error().Err(err).Str("addr", server.Addr).Msg("Listener failed")
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Logger.Error().Err(err).Str("addr", server.Addr).Msg("Listener did not drain before the shutdown timeout")
 	}
+}
 
-	log.Printf("Server starting on port %s", port)
-	r.Run(port)
+// quotaPolicy converts the quotas section of the configuration for the quota service
+func quotaPolicy(cfg config.QuotaConfig) usecases.QuotaPolicy {
+	limits := func(l config.QuotaLimitsConfig) entities.QuotaLimits {
+		return entities.QuotaLimits{MaxNotes: l.MaxNotes, MaxBytes: l.MaxBytes, MaxFolders: l.MaxFolders}
+	}
+	policy := usecases.QuotaPolicy{
+		Roles:       make(map[string]entities.QuotaLimits, len(cfg.Roles)),
+		TeamDefault: limits(cfg.TeamDefault),
+		Teams:       make(map[uint]entities.QuotaLimits, len(cfg.Teams)),
+	}
+	for role, l := range cfg.Roles {
+		policy.Roles[role] = limits(l)
+	}
+	for teamID, l := range cfg.Teams {
+		policy.Teams[teamID] = limits(l)
+	}
+	return policy
 }
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"team-service/pkg/auth"
+	"team-service/pkg/config"
+	"team-service/pkg/db"
+	"team-service/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	testTokenSecret = "test-access-token-secret"
+	testSCIMToken   = "test-scim-token-0123456789abcdef0123"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if err := logger.SetupLogger(config.LoggingConfig{Level: "error", Outputs: []string{"stdout"}}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// testServer is the service wired as run wires it, on a database of its own, and driven through
+// its HTTP handler
+type testServer struct {
+	t      *testing.T
+	engine http.Handler
+	// suffix keeps the users and teams of one test apart from other runs on a shared database
+	suffix string
+}
+
+// forEachBackend runs fn against a fresh SQLite database and, when TEST_POSTGRES_DSN is set,
+// against that Postgres database
+func forEachBackend(t *testing.T, fn func(t *testing.T, s *testServer)) {
+	t.Run("sqlite", func(t *testing.T) {
+		fn(t, newTestServer(t, "sqlite://"+filepath.Join(t.TempDir(), "test.db")))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_POSTGRES_DSN")
+		if dsn == "" {
+			t.Skip("TEST_POSTGRES_DSN is not set")
+		}
+		fn(t, newTestServer(t, dsn))
+	})
+}
+
+func newTestServer(t *testing.T, dsn string) *testServer {
+	t.Helper()
+	t.Setenv("DATABASE_DSN", dsn)
+	t.Setenv("ACCESS_TOKEN_SECRET", testTokenSecret)
+	t.Setenv("AUTH_MODE", "hmac")
+	t.Setenv("SCIM_TOKEN", testSCIMToken)
+	t.Setenv("METRICS_TOKEN", "test-metrics-token")
+	t.Setenv("TRACING_ENABLED", "false")
+	t.Setenv("RATE_LIMIT_ENABLED", "false")
+
+	cfg, err := config.Load(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	database, err := db.SetupDatabase(cfg.Database)
+	if err != nil {
+		t.Fatalf("setup database: %v", err)
+	}
+	t.Cleanup(func() { db.Close(database) })
+	// Lookups that find nothing are expected; keep them out of the test output
+	database.Logger = gormlogger.Discard
+
+	verifier, err := auth.NewVerifier(context.Background(), cfg.Auth)
+	if err != nil {
+		t.Fatalf("setup token verification: %v", err)
+	}
+	// Periodic cleanups are not started; tests drive the service through requests only
+	engine, _, err := newEngine(cfg, database, verifier, func(string, func(context.Context)) {})
+	if err != nil {
+		t.Fatalf("setup engine: %v", err)
+	}
+
+	return &testServer{t: t, engine: engine, suffix: fmt.Sprintf("-%d", time.Now().UnixNano())}
+}
+
+// user returns a user ID unique to this test server
+func (s *testServer) user(name string) string {
+	return name + s.suffix
+}
+
+// token mints an access token for userID with the given global role
+func (s *testServer) token(userID, role string) string {
+	s.t.Helper()
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		UserID: userID,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        fmt.Sprintf("%s-%d", userID, now.UnixNano()),
+			IssuedAt:  jwt.NewNumericDate(now.Add(-time.Second)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}).SignedString([]byte(testTokenSecret))
+	if err != nil {
+		s.t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+// response is a recorded response with its JSON body decoded
+type response struct {
+	status int
+	header http.Header
+	body   map[string]interface{}
+	raw    []byte
+}
+
+// do sends a request authorized as userID with the role, or anonymously for an empty userID,
+// and decodes the JSON answer. body is encoded as JSON unless it is already raw bytes.
+func (s *testServer) do(method, path, userID, role string, body interface{}) response {
+	s.t.Helper()
+	req := s.newRequest(method, path, body)
+	if userID != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token(userID, role))
+	}
+	return s.send(req)
+}
+
+func (s *testServer) newRequest(method, path string, body interface{}) *http.Request {
+	s.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatalf("encode %s %s: %v", method, path, err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+func (s *testServer) send(req *http.Request) response {
+	s.t.Helper()
+	rec := httptest.NewRecorder()
+	s.engine.ServeHTTP(rec, req)
+
+	res := response{status: rec.Code, header: rec.Header(), raw: rec.Body.Bytes()}
+	if len(res.raw) > 0 && res.raw[0] == '{' {
+		if err := json.Unmarshal(res.raw, &res.body); err != nil {
+			s.t.Fatalf("%s %s: decode response: %v", req.Method, req.URL, err)
+		}
+	}
+	return res
+}
+
+// expect fails the test unless the response has the status
+func (r response) expect(t *testing.T, status int, what string) response {
+	t.Helper()
+	if r.status != status {
+		t.Fatalf("%s: status %d, want %d: %s", what, r.status, status, r.raw)
+	}
+	return r
+}
+
+// id returns a numeric field of the body as a path segment
+func (r response) id(t *testing.T, field string) string {
+	t.Helper()
+	v, ok := r.body[field].(float64)
+	if !ok {
+		t.Fatalf("response has no numeric %q: %s", field, r.raw)
+	}
+	return fmt.Sprint(int64(v))
+}
+
+// str returns a string field of the body
+func (r response) str(field string) string {
+	s, _ := r.body[field].(string)
+	return s
+}
+
+// list returns an array field of the body
+func (r response) list(field string) []interface{} {
+	l, _ := r.body[field].([]interface{})
+	return l
+}
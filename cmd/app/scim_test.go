@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// scimFixture is a recorded exchange between an identity provider and the SCIM endpoints. Steps
+// are replayed in order; "${suffix}" and "${name}" for values captured by earlier steps are
+// substituted anywhere in a step before it runs.
+type scimFixture struct {
+	Description string            `json:"description"`
+	Steps       []json.RawMessage `json:"steps"`
+}
+
+type scimStep struct {
+	Name    string `json:"name"`
+	Request struct {
+		Method  string            `json:"method"`
+		Path    string            `json:"path"`
+		Query   map[string]string `json:"query"`
+		Headers map[string]string `json:"headers"`
+		Body    json.RawMessage   `json:"body"`
+	} `json:"request"`
+	Response struct {
+		Status  int               `json:"status"`
+		Headers map[string]string `json:"headers"`
+		// Body lists the fields that are checked; fields it leaves out may hold anything
+		Body json.RawMessage `json:"body"`
+	} `json:"response"`
+	// Capture names top-level fields of the response body for later steps
+	Capture map[string]string `json:"capture"`
+}
+
+func TestSCIMFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "scim", "*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no SCIM fixtures found: %v", err)
+	}
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fixture scimFixture
+		if err := json.Unmarshal(raw, &fixture); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, s *testServer) {
+				s.replay(t, fixture)
+			})
+		})
+	}
+}
+
+// replay runs the steps of a fixture, stopping at the first one that does not match
+func (s *testServer) replay(t *testing.T, fixture scimFixture) {
+	vars := map[string]string{"suffix": s.suffix}
+	for i, raw := range fixture.Steps {
+		var step scimStep
+		if err := json.Unmarshal([]byte(substitute(string(raw), vars)), &step); err != nil {
+			t.Fatalf("step %d: %v", i+1, err)
+		}
+		what := fmt.Sprintf("step %d (%s)", i+1, step.Name)
+
+		path := step.Request.Path
+		if len(step.Request.Query) > 0 {
+			query := url.Values{}
+			for k, v := range step.Request.Query {
+				query.Set(k, v)
+			}
+			path += "?" + query.Encode()
+		}
+		var body interface{}
+		if len(step.Request.Body) > 0 {
+			body = []byte(step.Request.Body)
+		}
+		req := s.newRequest(step.Request.Method, path, body)
+		req.Header.Set("Authorization", "Bearer "+testSCIMToken)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/scim+json")
+		}
+		for k, v := range step.Request.Headers {
+			req.Header.Set(k, v)
+		}
+
+		res := s.send(req)
+		if res.status != step.Response.Status {
+			t.Fatalf("%s: status %d, want %d: %s", what, res.status, step.Response.Status, res.raw)
+		}
+		for k, want := range step.Response.Headers {
+			if got := res.header.Get(k); got != want {
+				t.Errorf("%s: header %s = %q, want %q", what, k, got, want)
+			}
+		}
+
+		var actual interface{}
+		if len(res.raw) > 0 {
+			if err := json.Unmarshal(res.raw, &actual); err != nil {
+				t.Fatalf("%s: decode response: %v: %s", what, err, res.raw)
+			}
+		}
+		if len(step.Response.Body) > 0 {
+			var expected interface{}
+			if err := json.Unmarshal(step.Response.Body, &expected); err != nil {
+				t.Fatalf("%s: decode expected body: %v", what, err)
+			}
+			if diffs := matchJSON("body", expected, actual); len(diffs) > 0 {
+				t.Fatalf("%s:\n  %s\nresponse: %s", what, strings.Join(diffs, "\n  "), res.raw)
+			}
+		}
+
+		for name, field := range step.Capture {
+			object, _ := actual.(map[string]interface{})
+			value, ok := object[field]
+			if !ok {
+				t.Fatalf("%s: cannot capture %s, response has no %q: %s", what, name, field, res.raw)
+			}
+			vars[name] = fmt.Sprint(value)
+		}
+	}
+}
+
+// substitute replaces ${name} with the variable, escaped for use inside a JSON string
+func substitute(raw string, vars map[string]string) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		quoted, _ := json.Marshal(vars[name])
+		pairs = append(pairs, "${"+name+"}", string(quoted[1:len(quoted)-1]))
+	}
+	return strings.NewReplacer(pairs...).Replace(raw)
+}
+
+// matchJSON lists where actual differs from expected. Objects in expected only name the fields
+// that are compared, and a null field must be absent or null; arrays must match element by
+// element.
+func matchJSON(path string, expected, actual interface{}) []string {
+	switch want := expected.(type) {
+	case map[string]interface{}:
+		got, ok := actual.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: got %v, want an object", path, actual)}
+		}
+		var diffs []string
+		for key, value := range want {
+			field, present := got[key]
+			if !present && value != nil {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: missing", path, key))
+				continue
+			}
+			diffs = append(diffs, matchJSON(path+"."+key, value, field)...)
+		}
+		sort.Strings(diffs)
+		return diffs
+	case []interface{}:
+		got, ok := actual.([]interface{})
+		if !ok || len(got) != len(want) {
+			return []string{fmt.Sprintf("%s: got %v, want %d elements", path, actual, len(want))}
+		}
+		var diffs []string
+		for i := range want {
+			diffs = append(diffs, matchJSON(fmt.Sprintf("%s[%d]", path, i), want[i], got[i])...)
+		}
+		return diffs
+	default:
+		if !reflect.DeepEqual(expected, actual) {
+			return []string{fmt.Sprintf("%s: got %v, want %v", path, actual, expected)}
+		}
+		return nil
+	}
+}
+
+// TestSCIMGroupSyncKeepsManagers checks that replacing a group's members leaves the managers
+// the team was given in the app on it, with their role
+func TestSCIMGroupSyncKeepsManagers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		manager, ada, alan := s.user("manager"), s.user("ada"), s.user("alan")
+		scim := func(method, path string, body interface{}) response {
+			t.Helper()
+			req := s.newRequest(method, path, body)
+			req.Header.Set("Authorization", "Bearer "+testSCIMToken)
+			return s.send(req)
+		}
+
+		team := s.do("POST", "/teams", manager, "MANAGER", map[string]interface{}{
+			"teamName": "design" + s.suffix,
+			"managers": []map[string]string{{"managerId": manager}},
+			"members":  []map[string]string{{"memberId": ada}},
+		}).expect(t, http.StatusCreated, "create team").id(t, "teamId")
+		// The manager is left out of the directory; provisioned users start as MEMBERs
+		for _, id := range []string{ada, alan} {
+			scim("POST", "/scim/v2/Users", map[string]interface{}{"schemas": []string{"urn:ietf:params:scim:schemas:core:2.0:User"}, "userName": id}).
+				expect(t, http.StatusCreated, "provision "+id)
+		}
+
+		group := scim("PUT", "/scim/v2/Groups/"+team, map[string]interface{}{
+			"schemas":     []string{"urn:ietf:params:scim:schemas:core:2.0:Group"},
+			"displayName": "design" + s.suffix,
+			"members":     []map[string]string{{"value": alan}},
+		}).expect(t, http.StatusOK, "replace group members")
+
+		var members []string
+		for _, m := range group.list("members") {
+			members = append(members, m.(map[string]interface{})["value"].(string))
+		}
+		if want := []string{alan, manager}; !reflect.DeepEqual(members, want) {
+			t.Errorf("group members = %v, want %v", members, want)
+		}
+		// The manager can still administer the team
+		s.do("POST", "/teams/"+team+"/members", manager, "MANAGER", map[string]string{"memberId": ada}).
+			expect(t, http.StatusCreated, "manager adds a member after the sync")
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestWriteSharesHeldForManagers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *testServer) {
+		admin, manager, owner, peer := s.user("admin"), s.user("manager"), s.user("owner"), s.user("peer")
+
+		team := s.do("POST", "/teams", manager, "MANAGER", map[string]interface{}{
+			"teamName": "legal" + s.suffix,
+			"managers": []map[string]string{{"managerId": manager, "managerName": "Manager"}},
+			"members":  []map[string]string{{"memberId": owner, "memberName": "Owner"}, {"memberId": peer, "memberName": "Peer"}},
+		}).expect(t, http.StatusCreated, "create team").id(t, "teamId")
+		s.do("PUT", "/admin/sharing-policies/teams/"+team, admin, "ADMIN", map[string]interface{}{"writeRequiresManager": true}).
+			expect(t, http.StatusOK, "set team policy")
+
+		folder := s.do("POST", "/folders", owner, "MEMBER", map[string]string{"name": "contracts"}).
+			expect(t, http.StatusCreated, "create folder").id(t, "id")
+		note := s.do("POST", "/folders/"+folder+"/notes", owner, "MEMBER", map[string]string{"title": "nda", "body": "draft"}).
+			expect(t, http.StatusCreated, "create note").id(t, "id")
+		s.do("POST", "/folders/"+folder+"/share", owner, "MEMBER", map[string]string{"userId": peer, "access": "read"}).
+			expect(t, http.StatusOK, "read share under the policy")
+		s.do("PUT", "/notes/"+note, peer, "MEMBER", map[string]string{"title": "nda", "body": "signed"}).
+			expect(t, http.StatusForbidden, "update with read access")
+
+		res := s.do("POST", "/folders/"+folder+"/share", owner, "MEMBER", map[string]string{"userId": peer, "access": "write"}).
+			expect(t, http.StatusAccepted, "write share under the policy")
+		held, _ := res.body["accessRequest"].(map[string]interface{})
+		if held["sharedBy"] != owner || held["status"] != "pending" {
+			t.Fatalf("held share = %v, want pending and shared by %s", held, owner)
+		}
+		request := fmt.Sprint(held["id"])
+
+		if n := len(s.do("GET", "/me/access-requests", owner, "MEMBER", nil).expect(t, http.StatusOK, "owner inbox").list("accessRequests")); n != 0 {
+			t.Errorf("owner inbox lists %d requests, want 0", n)
+		}
+		if n := len(s.do("GET", "/me/access-requests", manager, "MANAGER", nil).expect(t, http.StatusOK, "manager inbox").list("accessRequests")); n != 1 {
+			t.Errorf("manager inbox lists %d requests, want 1", n)
+		}
+		s.do("POST", "/access-requests/"+request+"/approve", owner, "MEMBER", nil).expect(t, http.StatusNotFound, "owner approves own held share")
+
+		decided := s.do("POST", "/access-requests/"+request+"/approve", manager, "MANAGER", nil).expect(t, http.StatusOK, "manager approves")
+		if decided.str("status") != "approved" || decided.str("decidedBy") != manager {
+			t.Errorf("approved share = %s", decided.raw)
+		}
+		s.do("PUT", "/notes/"+note, peer, "MEMBER", map[string]string{"title": "nda", "body": "signed"}).
+			expect(t, http.StatusOK, "update with the approved write share")
+	})
+}
@@ -0,0 +1,208 @@
+// Command sync-directory reconciles LDIF exports of users and groups into the user directory,
+// teams and rosters.
+//
+//	sync-directory [-config path] [-dry-run] [-max-removals n] [-force] [-report file.json] export.ldif...
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"team-service/internal/repository"
+	"team-service/internal/usecases"
+	"team-service/pkg/config"
+	"team-service/pkg/db"
+	"team-service/pkg/ldif"
+
+	"github.com/joho/godotenv"
+)
+
+// exitAborted is returned when a safeguard stopped the run before anything was written
+const exitAborted = 2
+
+func main() {
+	configPath := flag.String("config", config.DefaultPath, "path to the YAML configuration file")
+	dryRun := flag.Bool("dry-run", false, "report the changes without writing them")
+	maxRemovals := flag.Int("max-removals", -1, "abort when more users, teams and roster entries would be removed or downgraded (default directory_sync.max_removals)")
+	force := flag.Bool("force", false, "apply the run even past the removal threshold or when the export has no users")
+	reportPath := flag.String("report", "", "also write the run report as JSON to this file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] export.ldif...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found or error loading .env file")
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal("Failed to load configuration: ", err)
+	}
+
+	snapshot, err := readExports(flag.Args(), mappingFrom(cfg.DirectorySync))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := usecases.DirectorySyncOptions{DryRun: *dryRun, MaxRemovals: cfg.DirectorySync.MaxRemovals, Force: *force}
+	if *maxRemovals >= 0 {
+		opts.MaxRemovals = *maxRemovals
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	database, err := db.SetupDatabase(cfg.Database)
+	if err != nil {
+		log.Fatal("Failed to set up database: ", err)
+	}
+	defer db.Close(database)
+
+	service := usecases.NewDirectorySyncService(repository.NewUserRepository(database), repository.NewTeamRepository(database), database)
+	report, err := service.Sync(ctx, snapshot, opts)
+	if report != nil {
+		warnSessionCache(report, cfg.Auth.SessionCacheTTL)
+		printReport(os.Stdout, report, len(flag.Args()))
+		if *reportPath != "" {
+			if err := writeReport(*reportPath, report); err != nil {
+				log.Printf("Failed to write report: %v", err)
+			}
+		}
+	}
+	switch {
+	case errors.Is(err, usecases.ErrTooManyRemovals), errors.Is(err, usecases.ErrEmptyDirectory):
+		log.Printf("Aborted, nothing was written: %v (rerun with -force to apply anyway)", err)
+		db.Close(database)
+		os.Exit(exitAborted)
+	case err != nil:
+		db.Close(database)
+		log.Fatal("Directory sync failed: ", err)
+	}
+}
+
+// readExports parses every file and maps the combined entries, so users and groups may be
+// exported separately
+func readExports(paths []string, mapping usecases.DirectoryMapping) (*usecases.DirectorySnapshot, error) {
+	var entries []ldif.Entry
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := ldif.Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, parsed...)
+	}
+
+	snapshot, err := usecases.MapDirectoryEntries(entries, mapping)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func mappingFrom(cfg config.DirectorySyncConfig) usecases.DirectoryMapping {
+	roles := make(map[string]string, len(cfg.RoleMap))
+	for value, role := range cfg.RoleMap {
+		roles[strings.ToLower(strings.TrimSpace(value))] = role
+	}
+	a := cfg.Attributes
+	return usecases.DirectoryMapping{
+		UserObjectClasses:  cfg.UserObjectClasses,
+		GroupObjectClasses: cfg.GroupObjectClasses,
+		UserID:             a.UserID,
+		Name:               a.Name,
+		GivenName:          a.GivenName,
+		FamilyName:         a.FamilyName,
+		Email:              a.Email,
+		Role:               a.Role,
+		ExternalID:         a.ExternalID,
+		GroupName:          a.GroupName,
+		GroupMembers:       a.GroupMembers,
+		GroupManagers:      a.GroupManagers,
+		RoleMap:            roles,
+		DefaultRole:        cfg.DefaultRole,
+	}
+}
+
+// warnSessionCache notes that running replicas still honour cached sessions of users the run
+// deactivated or downgraded. This process cannot reach their caches.
+func warnSessionCache(r *usecases.DirectorySyncReport, ttl time.Duration) {
+	n := len(r.Users.Deactivated) + len(r.Users.Downgraded)
+	if n == 0 || r.Aborted || ttl <= 0 {
+		return
+	}
+	verb := "keep"
+	if r.DryRun {
+		verb = "would keep"
+	}
+	r.Warnings = append(r.Warnings, fmt.Sprintf(
+		"%d deactivated or downgraded user(s) %s their access and role on running replicas for up to %s (auth.session_cache_ttl); revoke their sessions to cut them off sooner",
+		n, verb, ttl))
+}
+
+func printReport(w io.Writer, r *usecases.DirectorySyncReport, files int) {
+	mode := "applied"
+	switch {
+	case r.Aborted:
+		mode = "aborted"
+	case r.DryRun:
+		mode = "dry run"
+	}
+	fmt.Fprintf(w, "Directory sync (%s) from %d file(s): %d users, %d groups\n", mode, files, r.Users.InExport, r.Teams.InExport)
+	fmt.Fprintf(w, "Users:    %d created, %d updated, %d reactivated, %d deactivated, %d downgraded, %d skipped, %d unchanged\n",
+		len(r.Users.Created), len(r.Users.Updated), len(r.Users.Reactivated), len(r.Users.Deactivated), len(r.Users.Downgraded), len(r.Users.Skipped), r.Users.Unchanged)
+	fmt.Fprintf(w, "Teams:    %d created, %d renamed, %d deleted, %d skipped, %d unchanged\n",
+		len(r.Teams.Created), len(r.Teams.Renamed), len(r.Teams.Deleted), len(r.Teams.Skipped), r.Teams.Unchanged)
+
+	var added, removed, changed int
+	for _, diff := range r.Rosters {
+		added += len(diff.Additions)
+		removed += len(diff.Removals)
+		changed += len(diff.RoleChanges)
+	}
+	fmt.Fprintf(w, "Rosters:  %d added, %d removed, %d role changes across %d team(s)\n", added, removed, changed, len(r.Rosters))
+	fmt.Fprintf(w, "Removals: %d (limit %d)\n", r.Removals, r.MaxRemovals)
+
+	for _, id := range r.Users.Deactivated {
+		fmt.Fprintf(w, "  - deactivate user %s\n", id)
+	}
+	for _, id := range r.Users.Downgraded {
+		fmt.Fprintf(w, "  - downgrade user %s\n", id)
+	}
+	for _, t := range r.Teams.Deleted {
+		fmt.Fprintf(w, "  - delete team %d %q\n", t.TeamID, t.Name)
+	}
+	for _, t := range r.Teams.Skipped {
+		fmt.Fprintf(w, "  ! keep team %d %q: %s\n", t.TeamID, t.Name, t.Reason)
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+}
+
+func writeReport(path string, r *usecases.DirectorySyncReport) error {
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0o644)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"team-service/internal/usecases"
+)
+
+func TestWarnSessionCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		report usecases.DirectorySyncReport
+		ttl    time.Duration
+		want   string
+	}{
+		{
+			name:   "deactivations",
+			report: usecases.DirectorySyncReport{Users: usecases.DirectoryUserReport{Deactivated: []string{"ada"}, Downgraded: []string{"alan"}}},
+			ttl:    30 * time.Second,
+			want:   "2 deactivated or downgraded user(s) keep their access and role on running replicas for up to 30s",
+		},
+		{
+			name:   "dry run",
+			report: usecases.DirectorySyncReport{DryRun: true, Users: usecases.DirectoryUserReport{Deactivated: []string{"ada"}}},
+			ttl:    time.Minute,
+			want:   "1 deactivated or downgraded user(s) would keep",
+		},
+		{
+			name:   "nothing removed",
+			report: usecases.DirectorySyncReport{Users: usecases.DirectoryUserReport{Created: []string{"ada"}}},
+			ttl:    30 * time.Second,
+		},
+		{
+			name:   "aborted",
+			report: usecases.DirectorySyncReport{Aborted: true, Users: usecases.DirectoryUserReport{Deactivated: []string{"ada"}}},
+			ttl:    30 * time.Second,
+		},
+		{
+			name:   "cache disabled",
+			report: usecases.DirectorySyncReport{Users: usecases.DirectoryUserReport{Deactivated: []string{"ada"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := tt.report
+			warnSessionCache(&report, tt.ttl)
+			if tt.want == "" {
+				if len(report.Warnings) != 0 {
+					t.Errorf("warnings = %q, want none", report.Warnings)
+				}
+				return
+			}
+			if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], tt.want) {
+				t.Fatalf("warnings = %q, want one containing %q", report.Warnings, tt.want)
+			}
+			var out bytes.Buffer
+			printReport(&out, &report, 1)
+			if !strings.Contains(out.String(), "warning: "+report.Warnings[0]) {
+				t.Errorf("printed report does not show the warning:\n%s", out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"team-service/internal/entities"
+	"team-service/internal/usecases"
+	"team-service/pkg/logger"
+	"team-service/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccessRequestHandler struct {
+	accessRequestService usecases.AccessRequestService
+}
+
+func NewAccessRequestHandler(accessRequestService usecases.AccessRequestService) *AccessRequestHandler {
+	return &AccessRequestHandler{
+		accessRequestService: accessRequestService,
+	}
+}
+
+type RequestAccessRequest struct {
+	Access  string `json:"access" binding:"required,oneof=read write"`
+	Message string `json:"message"`
+}
+
+func (h *AccessRequestHandler) RequestFolderAccess(c *gin.Context) {
+	folderID, err := strconv.ParseUint(c.Param("folderId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid folder ID")
+		return
+	}
+	h.requestAccess(c, entities.AssetFolder, uint(folderID))
+}
+
+func (h *AccessRequestHandler) RequestNoteAccess(c *gin.Context) {
+	noteID, err := strconv.ParseUint(c.Param("noteId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid note ID")
+		return
+	}
+	h.requestAccess(c, entities.AssetNote, uint(noteID))
+}
+
+func (h *AccessRequestHandler) requestAccess(c *gin.Context, assetType string, assetID uint) {
+	var req RequestAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	request, err := h.accessRequestService.RequestAccess(c.Request.Context(), assetType, assetID, c.GetString("userId"), req.Access, req.Message)
+	if err != nil {
+		h.respondError(c, err, "Failed to request access")
+		return
+	}
+
+	response.Success(c, http.StatusCreated, request)
+}
+
+func (h *AccessRequestHandler) Inbox(c *gin.Context) {
+	status := c.DefaultQuery("status", entities.AccessRequestPending)
+	if status == "all" {
+		status = ""
+	}
+
+	requests, err := h.accessRequestService.Inbox(c.Request.Context(), c.GetString("userId"), status)
+	if err != nil {
+		h.respondError(c, err, "Failed to list access requests")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"accessRequests": requests})
+}
+
+func (h *AccessRequestHandler) ApproveAccessRequest(c *gin.Context) {
+	h.decideAccessRequest(c, true)
+}
+
+func (h *AccessRequestHandler) RejectAccessRequest(c *gin.Context) {
+	h.decideAccessRequest(c, false)
+}
+
+func (h *AccessRequestHandler) decideAccessRequest(c *gin.Context, approve bool) {
+	requestID, err := strconv.ParseUint(c.Param("requestId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid access request ID")
+		return
+	}
+
+	request, err := h.accessRequestService.DecideAccessRequest(c.Request.Context(), uint(requestID), c.GetString("userId"), approve)
+	if err != nil {
+		h.respondError(c, err, "Failed to decide access request")
+		return
+	}
+	// An approval handed on to the team managers is still pending
+	if request.Status == entities.AccessRequestPending {
+		response.Success(c, http.StatusAccepted, request)
+		return
+	}
+
+	response.Success(c, http.StatusOK, request)
+}
+
+func (h *AccessRequestHandler) respondError(c *gin.Context, err error, message string) {
+	var validationErr *usecases.ValidationError
+	var policyErr *usecases.SharingPolicyError
+	switch {
+	case errors.As(err, &validationErr):
+		response.ErrorWithDetails(c, http.StatusBadRequest, "Invalid access request", validationErr.Problems)
+	case errors.As(err, &policyErr):
+		response.ErrorWithDetails(c, http.StatusForbidden, "Sharing policy violation", policyErr.Violations)
+	case errors.Is(err, usecases.ErrAssetNotFound),
+		errors.Is(err, usecases.ErrAccessRequestNotFound):
+		response.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, usecases.ErrAccessRequestExists),
+		errors.Is(err, usecases.ErrAccessAlreadyGranted),
+		errors.Is(err, usecases.ErrAccessRequestNotPending):
+		response.Error(c, http.StatusConflict, err.Error())
+	default:
+		logger.FromContext(c).Error().Err(err).Msg(message)
+		response.Error(c, http.StatusInternalServerError, message)
+	}
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"team-service/internal/repository"
+	"team-service/internal/usecases"
+	"team-service/pkg/logger"
+	"team-service/pkg/response"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type AdminHandler struct {
+	adminService usecases.AdminService
+}
+
+func NewAdminHandler(adminService usecases.AdminService) *AdminHandler {
+	return &AdminHandler{
+		adminService: adminService,
+	}
+}
+
+type ChangeRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type TransferRequest struct {
+	NewOwnerID string `json:"newOwnerId" binding:"required"`
+}
+
+func (h *AdminHandler) ListTeams(c *gin.Context) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	teams, total, err := h.adminService.ListTeams(c.Request.Context(), limit, offset)
+	if err != nil {
+		h.respondError(c, err, "Failed to list teams")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"teams": teams, "total": total, "limit": limit, "offset": offset})
+}
+
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	users, total, err := h.adminService.ListUsers(c.Request.Context(), limit, offset)
+	if err != nil {
+		h.respondError(c, err, "Failed to list users")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"users": users, "total": total, "limit": limit, "offset": offset})
+}
+
+func (h *AdminHandler) ChangeUserRole(c *gin.Context) {
+	var req ChangeRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.adminService.ChangeUserRole(c.Request.Context(), c.Param("userId"), req.Role)
+	if err != nil {
+		h.respondError(c, err, "Failed to change role")
+		return
+	}
+
+	response.Success(c, http.StatusOK, user)
+}
+
+func (h *AdminHandler) GetFolder(c *gin.Context) {
+	folderID, err := strconv.ParseUint(c.Param("folderId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid folder ID")
+		return
+	}
+
+	folder, err := h.adminService.GetFolder(c.Request.Context(), uint(folderID))
+	if err != nil {
+		h.respondError(c, err, "Failed to get folder")
+		return
+	}
+
+	response.Success(c, http.StatusOK, folder)
+}
+
+func (h *AdminHandler) GetNote(c *gin.Context) {
+	noteID, err := strconv.ParseUint(c.Param("noteId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid note ID")
+		return
+	}
+
+	note, err := h.adminService.GetNote(c.Request.Context(), uint(noteID))
+	if err != nil {
+		h.respondError(c, err, "Failed to get note")
+		return
+	}
+
+	response.Success(c, http.StatusOK, note)
+}
+
+func (h *AdminHandler) TransferFolder(c *gin.Context) {
+	folderID, err := strconv.ParseUint(c.Param("folderId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid folder ID")
+		return
+	}
+
+	var req TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	folder, err := h.adminService.TransferFolder(c.Request.Context(), uint(folderID), req.NewOwnerID)
+	if err != nil {
+		h.respondError(c, err, "Failed to transfer folder")
+		return
+	}
+
+	response.Success(c, http.StatusOK, folder)
+}
+
+func (h *AdminHandler) TransferNote(c *gin.Context) {
+	noteID, err := strconv.ParseUint(c.Param("noteId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid note ID")
+		return
+	}
+
+	var req TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	note, err := h.adminService.TransferNote(c.Request.Context(), uint(noteID), req.NewOwnerID)
+	if err != nil {
+		h.respondError(c, err, "Failed to transfer note")
+		return
+	}
+
+	response.Success(c, http.StatusOK, note)
+}
+
+func (h *AdminHandler) RevokeFolderShare(c *gin.Context) {
+	folderID, err := strconv.ParseUint(c.Param("folderId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid folder ID")
+		return
+	}
+
+	if err := h.adminService.RevokeFolderShare(c.Request.Context(), uint(folderID), c.Param("userId")); err != nil {
+		h.respondError(c, err, "Failed to revoke folder share")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"message": "Folder share revoked"})
+}
+
+func (h *AdminHandler) RevokeNoteShare(c *gin.Context) {
+	noteID, err := strconv.ParseUint(c.Param("noteId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid note ID")
+		return
+	}
+
+	if err := h.adminService.RevokeNoteShare(c.Request.Context(), uint(noteID), c.Param("userId")); err != nil {
+		h.respondError(c, err, "Failed to revoke note share")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"message": "Note share revoked"})
+}
+
+func (h *AdminHandler) GetStats(c *gin.Context) {
+	stats, err := h.adminService.GetStats(c.Request.Context())
+	if err != nil {
+		h.respondError(c, err, "Failed to get stats")
+		return
+	}
+
+	response.Success(c, http.StatusOK, stats)
+}
+
+func (h *AdminHandler) ListAuditLog(c *gin.Context) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	filter := repository.AuditFilter{
+		ActorID:      c.Query("actorId"),
+		Action:       c.Query("action"),
+		ElevatedOnly: c.Query("elevated") == "true",
+		Limit:        limit,
+		Offset:       offset,
+	}
+
+	entries, total, err := h.adminService.ListAuditLog(c.Request.Context(), filter)
+	if err != nil {
+		h.respondError(c, err, "Failed to list audit log")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"entries": entries, "total": total, "limit": limit, "offset": offset})
+}
+
+func (h *AdminHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, usecases.ErrInvalidAdminRequest):
+		response.Error(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, usecases.ErrAdminNotFound):
+		response.Error(c, http.StatusNotFound, err.Error())
+	default:
+		logger.FromContext(c).Error().Err(err).Msg(message)
+		response.Error(c, http.StatusInternalServerError, message)
+	}
+}
+
+// parsePage reads limit and offset query parameters, writing a 400 when they are invalid
+func parsePage(c *gin.Context) (int, int, bool) {
+	limit, offset := defaultPageSize, 0
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			response.Error(c, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxPageSize))
+			return 0, 0, false
+		}
+		limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			response.Error(c, http.StatusBadRequest, "offset must be a non-negative integer")
+			return 0, 0, false
+		}
+		offset = n
+	}
+
+	return limit, offset, true
+}
+
+// parseInstant reads an optional RFC 3339 timestamp or YYYY-MM-DD date (midnight UTC) from the
+// query string. It writes a 400 response and reports false when the value is malformed.
+func parseInstant(c *gin.Context, name string) (*time.Time, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, true
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return &t, true
+		}
+	}
+	response.Error(c, http.StatusBadRequest, name+" must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	return nil, false
+}
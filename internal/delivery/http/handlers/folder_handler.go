@@ -1,11 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"team-service/internal/usecases"
-	"team-service/pkg/response"
 	"team-service/pkg/logger"
+	"team-service/pkg/response"
 
 	"github.com/gin-gonic/gin"
 )
@@ -37,9 +38,12 @@ func (h *FolderHandler) CreateFolder(c *gin.Context) {
 		return
 	}
 
-	folder, err := h.folderService.CreateFolder(req.Name, userID)
+	folder, err := h.folderService.CreateFolder(c.Request.Context(), req.Name, userID, c.GetString("role"))
+	if respondQuotaExceeded(c, err) {
+		return
+	}
 	if err != nil {
-		logger.Logger.Error().Msg("Failed to create folder")
+		logger.FromContext(c).Error().Err(err).Msg("Failed to create folder")
 		response.Error(c, http.StatusInternalServerError, "Failed to create folder")
 		return
 	}
@@ -57,7 +61,7 @@ func (h *FolderHandler) GetFolder(c *gin.Context) {
 		return
 	}
 
-	folder, err := h.folderService.GetFolder(uint(folderID), userID)
+	folder, err := h.folderService.GetFolder(c.Request.Context(), uint(folderID), userID)
 	if err != nil {
 		response.Error(c, http.StatusNotFound, "Folder not found or access denied")
 		return
@@ -82,7 +86,7 @@ func (h *FolderHandler) UpdateFolder(c *gin.Context) {
 		return
 	}
 
-	folder, err := h.folderService.UpdateFolder(uint(folderID), req.Name, userID)
+	folder, err := h.folderService.UpdateFolder(c.Request.Context(), uint(folderID), req.Name, userID)
 	if err != nil {
 		response.Error(c, http.StatusForbidden, err.Error())
 		return
@@ -101,11 +105,59 @@ func (h *FolderHandler) DeleteFolder(c *gin.Context) {
 		return
 	}
 
-	err = h.folderService.DeleteFolder(uint(folderID), userID)
+	err = h.folderService.DeleteFolder(c.Request.Context(), uint(folderID), userID)
 	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to delete folder")
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	response.Success(c, http.StatusOK, gin.H{"message": "Folder and its notes deleted successfully"})
 }
+
+func (h *FolderHandler) CreateTeamFolder(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	var req CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	folder, err := h.folderService.CreateTeamFolder(c.Request.Context(), uint(teamID), req.Name, c.GetString("userId"))
+	if errors.Is(err, usecases.ErrTeamNotFound) {
+		response.Error(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if respondQuotaExceeded(c, err) {
+		return
+	}
+	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to create team folder")
+		response.Error(c, http.StatusInternalServerError, "Failed to create folder")
+		return
+	}
+
+	response.Success(c, http.StatusCreated, folder)
+}
+
+func (h *FolderHandler) ListTeamFolders(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	folders, err := h.folderService.ListTeamFolders(c.Request.Context(), uint(teamID))
+	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to list team folders")
+		response.Error(c, http.StatusInternalServerError, "Failed to list folders")
+		return
+	}
+
+	response.Success(c, http.StatusOK, folders)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"team-service/pkg/db"
+	"team-service/pkg/logger"
+	"team-service/pkg/response"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type HealthHandler struct {
+	db       *gorm.DB
+	draining atomic.Bool
+}
+
+func NewHealthHandler(database *gorm.DB) *HealthHandler {
+	return &HealthHandler{
+		db: database,
+	}
+}
+
+// SetDraining makes readiness fail so load balancers stop routing new traffic during shutdown
+func (h *HealthHandler) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Livez reports that the process is up and serving HTTP
+func (h *HealthHandler) Livez(c *gin.Context) {
+	response.Success(c, http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the service can take traffic: not shutting down,
+// database reachable and migrated to at least the expected schema version
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	if h.draining.Load() {
+		response.Error(c, http.StatusServiceUnavailable, "shutting down")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	if err := db.CheckReady(ctx, h.db); err != nil {
+		// The probe is unauthenticated; the cause goes to the log only
+		logger.FromContext(c).Warn().Err(err).Msg("Readiness check failed")
+		response.Error(c, http.StatusServiceUnavailable, "not ready")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{
+		"status":        "ok",
+		"schemaVersion": db.SchemaVersion,
+	})
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"team-service/internal/delivery/http/middleware"
+	"team-service/internal/entities"
+	"team-service/internal/usecases"
+	"team-service/pkg/logger"
+	"team-service/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InvitationHandler struct {
+	invitationService usecases.InvitationService
+}
+
+func NewInvitationHandler(invitationService usecases.InvitationService) *InvitationHandler {
+	return &InvitationHandler{
+		invitationService: invitationService,
+	}
+}
+
+type CreateInvitationRequest struct {
+	UserID        string `json:"userId"`
+	Email         string `json:"email"`
+	Role          string `json:"role"`
+	ExpiresInDays int    `json:"expiresInDays" binding:"min=0"`
+}
+
+type RespondInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+// createdInvitationResponse is the only response that ever contains the invitation token
+type createdInvitationResponse struct {
+	*entities.TeamInvitation
+	Token string `json:"token"`
+}
+
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	invitation, token, err := h.invitationService.Invite(c.Request.Context(), uint(teamID), c.GetString("userId"), req.UserID, req.Email, req.Role, req.ExpiresInDays, middleware.TeamPermissions(c))
+	if err != nil {
+		h.respondError(c, err, "Failed to create invitation")
+		return
+	}
+
+	response.Success(c, http.StatusCreated, createdInvitationResponse{TeamInvitation: invitation, Token: token})
+}
+
+func (h *InvitationHandler) ListTeamInvitations(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	invitations, err := h.invitationService.ListTeamInvitations(c.Request.Context(), uint(teamID))
+	if err != nil {
+		h.respondError(c, err, "Failed to list invitations")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"invitations": invitations})
+}
+
+func (h *InvitationHandler) RescindInvitation(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+	invitationID, err := strconv.ParseUint(c.Param("invitationId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid invitation ID")
+		return
+	}
+
+	if err := h.invitationService.Rescind(c.Request.Context(), uint(teamID), uint(invitationID)); err != nil {
+		h.respondError(c, err, "Failed to rescind invitation")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"message": "Invitation rescinded"})
+}
+
+func (h *InvitationHandler) Inbox(c *gin.Context) {
+	invitations, err := h.invitationService.Inbox(c.Request.Context(), c.GetString("userId"))
+	if err != nil {
+		h.respondError(c, err, "Failed to list invitations")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"invitations": invitations})
+}
+
+func (h *InvitationHandler) AcceptInvitation(c *gin.Context) {
+	invitationID, req, ok := bindInvitationResponse(c)
+	if !ok {
+		return
+	}
+
+	invitation, err := h.invitationService.Accept(c.Request.Context(), invitationID, c.GetString("userId"), req.Token)
+	if err != nil {
+		h.respondError(c, err, "Failed to accept invitation")
+		return
+	}
+
+	response.Success(c, http.StatusOK, invitation)
+}
+
+func (h *InvitationHandler) DeclineInvitation(c *gin.Context) {
+	invitationID, req, ok := bindInvitationResponse(c)
+	if !ok {
+		return
+	}
+
+	invitation, err := h.invitationService.Decline(c.Request.Context(), invitationID, c.GetString("userId"), req.Token)
+	if err != nil {
+		h.respondError(c, err, "Failed to decline invitation")
+		return
+	}
+
+	response.Success(c, http.StatusOK, invitation)
+}
+
+// bindInvitationResponse reads the invitation ID and the optional token body shared by accept and decline
+func bindInvitationResponse(c *gin.Context) (uint, RespondInvitationRequest, bool) {
+	var req RespondInvitationRequest
+	invitationID, err := strconv.ParseUint(c.Param("invitationId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid invitation ID")
+		return 0, req, false
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Error(c, http.StatusBadRequest, err.Error())
+			return 0, req, false
+		}
+	}
+	return uint(invitationID), req, true
+}
+
+func (h *InvitationHandler) respondError(c *gin.Context, err error, message string) {
+	var validationErr *usecases.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		response.ErrorWithDetails(c, http.StatusBadRequest, "Invalid invitation", validationErr.Problems)
+	case errors.Is(err, usecases.ErrInvalidInvitation):
+		response.Error(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, usecases.ErrInvitationNotFound):
+		response.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, usecases.ErrPermissionEscalation):
+		response.Error(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, usecases.ErrInvitationNotPending),
+		errors.Is(err, usecases.ErrInvitationExists),
+		errors.Is(err, usecases.ErrAlreadyOnTeam):
+		response.Error(c, http.StatusConflict, err.Error())
+	default:
+		logger.FromContext(c).Error().Err(err).Msg(message)
+		response.Error(c, http.StatusInternalServerError, message)
+	}
+}
@@ -46,9 +46,12 @@ func (h *NoteHandler) CreateNote(c *gin.Context) {
 		return
 	}
 
-	note, err := h.noteService.CreateNote(req.Title, req.Body, uint(folderID), userID)
+	note, err := h.noteService.CreateNote(c.Request.Context(), req.Title, req.Body, uint(folderID), userID, c.GetString("role"))
+	if respondQuotaExceeded(c, err) {
+		return
+	}
 	if err != nil {
-		logger.Logger.Error().Msg("Failed to create note")
+		logger.FromContext(c).Warn().Err(err).Uint64("folderId", folderID).Msg("Failed to create note")
 		response.Error(c, http.StatusForbidden, err.Error())
 		return
 	}
@@ -66,7 +69,7 @@ func (h *NoteHandler) GetNote(c *gin.Context) {
 		return
 	}
 
-	note, err := h.noteService.GetNote(uint(noteID), userID)
+	note, err := h.noteService.GetNote(c.Request.Context(), uint(noteID), userID)
 	if err != nil {
 		response.Error(c, http.StatusNotFound, "Note not found or access denied")
 		return
@@ -91,7 +94,10 @@ func (h *NoteHandler) UpdateNote(c *gin.Context) {
 		return
 	}
 
-	note, err := h.noteService.UpdateNote(uint(noteID), req.Title, req.Body, userID)
+	note, err := h.noteService.UpdateNote(c.Request.Context(), uint(noteID), req.Title, req.Body, userID, c.GetString("role"))
+	if respondQuotaExceeded(c, err) {
+		return
+	}
 	if err != nil {
 		response.Error(c, http.StatusForbidden, err.Error())
 		return
@@ -110,8 +116,9 @@ func (h *NoteHandler) DeleteNote(c *gin.Context) {
 		return
 	}
 
-	err = h.noteService.DeleteNote(uint(noteID), userID)
+	err = h.noteService.DeleteNote(c.Request.Context(), uint(noteID), userID)
 	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to delete note")
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"team-service/internal/usecases"
+	"team-service/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scimContentType is the media type of every SCIM response (RFC 7644 §3.1)
+const scimContentType = "application/scim+json"
+
+type SCIMHandler struct {
+	scimService usecases.SCIMService
+}
+
+func NewSCIMHandler(scimService usecases.SCIMService) *SCIMHandler {
+	return &SCIMHandler{
+		scimService: scimService,
+	}
+}
+
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	query, ok := scimQuery(c)
+	if !ok {
+		return
+	}
+	list, err := h.scimService.ListUsers(c.Request.Context(), query)
+	if err != nil {
+		h.respondError(c, err, "Failed to list users")
+		return
+	}
+	scimJSON(c, http.StatusOK, list)
+}
+
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, err := h.scimService.GetUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.respondError(c, err, "Failed to get user")
+		return
+	}
+	scimJSON(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	var req usecases.SCIMUser
+	if !bindSCIM(c, &req) {
+		return
+	}
+	user, err := h.scimService.CreateUser(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, err, "Failed to create user")
+		return
+	}
+	c.Header("Location", user.Meta.Location)
+	scimJSON(c, http.StatusCreated, user)
+}
+
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	var req usecases.SCIMUser
+	if !bindSCIM(c, &req) {
+		return
+	}
+	user, err := h.scimService.ReplaceUser(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		h.respondError(c, err, "Failed to replace user")
+		return
+	}
+	scimJSON(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	var req usecases.SCIMPatch
+	if !bindSCIM(c, &req) {
+		return
+	}
+	user, err := h.scimService.PatchUser(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		h.respondError(c, err, "Failed to patch user")
+		return
+	}
+	scimJSON(c, http.StatusOK, user)
+}
+
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	if err := h.scimService.DeleteUser(c.Request.Context(), c.Param("id")); err != nil {
+		h.respondError(c, err, "Failed to delete user")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	query, ok := scimQuery(c)
+	if !ok {
+		return
+	}
+	list, err := h.scimService.ListGroups(c.Request.Context(), query, wantsMembers(c))
+	if err != nil {
+		h.respondError(c, err, "Failed to list groups")
+		return
+	}
+	scimJSON(c, http.StatusOK, list)
+}
+
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	group, err := h.scimService.GetGroup(c.Request.Context(), c.Param("id"), wantsMembers(c))
+	if err != nil {
+		h.respondError(c, err, "Failed to get group")
+		return
+	}
+	scimJSON(c, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	var req usecases.SCIMGroup
+	if !bindSCIM(c, &req) {
+		return
+	}
+	group, err := h.scimService.CreateGroup(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, err, "Failed to create group")
+		return
+	}
+	c.Header("Location", group.Meta.Location)
+	scimJSON(c, http.StatusCreated, group)
+}
+
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	var req usecases.SCIMGroup
+	if !bindSCIM(c, &req) {
+		return
+	}
+	group, err := h.scimService.ReplaceGroup(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		h.respondError(c, err, "Failed to replace group")
+		return
+	}
+	scimJSON(c, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	var req usecases.SCIMPatch
+	if !bindSCIM(c, &req) {
+		return
+	}
+	group, err := h.scimService.PatchGroup(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		h.respondError(c, err, "Failed to patch group")
+		return
+	}
+	scimJSON(c, http.StatusOK, group)
+}
+
+func (h *SCIMHandler) DeleteGroup(c *gin.Context) {
+	if err := h.scimService.DeleteGroup(c.Request.Context(), c.Param("id")); err != nil {
+		h.respondError(c, err, "Failed to delete group")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ServiceProviderConfig advertises the supported protocol features
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	unsupported := gin.H{"supported": false}
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": 200},
+		"changePassword": unsupported,
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "The dedicated SCIM token configured as scim.token",
+			"primary":     true,
+		}},
+	})
+}
+
+// ResourceTypes lists the provisioned resource types
+func (h *SCIMHandler) ResourceTypes(c *gin.Context) {
+	resourceTypes := []gin.H{
+		{
+			"schemas":  []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   usecases.SCIMSchemaUser,
+		},
+		{
+			"schemas":  []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   usecases.SCIMSchemaGroup,
+		},
+	}
+	scimJSON(c, http.StatusOK, usecases.SCIMListResponse{
+		Schemas:      []string{usecases.SCIMSchemaListResponse},
+		TotalResults: int64(len(resourceTypes)),
+		StartIndex:   1,
+		ItemsPerPage: len(resourceTypes),
+		Resources:    resourceTypes,
+	})
+}
+
+func (h *SCIMHandler) respondError(c *gin.Context, err error, message string) {
+	var scimErr *usecases.SCIMError
+	if errors.As(err, &scimErr) {
+		scimErrorResponse(c, scimErr.Status, scimErr.ScimType, scimErr.Detail)
+		return
+	}
+	logger.FromContext(c).Error().Err(err).Msg(message)
+	scimErrorResponse(c, http.StatusInternalServerError, "", message)
+}
+
+// scimQuery reads filter, startIndex and count, rejecting malformed numbers
+func scimQuery(c *gin.Context) (usecases.SCIMQuery, bool) {
+	query := usecases.SCIMQuery{Filter: c.Query("filter"), StartIndex: 1}
+	if v := c.Query("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			scimErrorResponse(c, http.StatusBadRequest, "invalidValue", "startIndex must be an integer")
+			return query, false
+		}
+		query.StartIndex = n
+	}
+	if v := c.Query("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			scimErrorResponse(c, http.StatusBadRequest, "invalidValue", "count must be an integer")
+			return query, false
+		}
+		query.Count = &n
+	}
+	return query, true
+}
+
+// wantsMembers reports whether the caller did not exclude members, which identity providers
+// do to avoid loading large groups
+func wantsMembers(c *gin.Context) bool {
+	for _, attr := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			return false
+		}
+	}
+	return true
+}
+
+func bindSCIM(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		scimErrorResponse(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return false
+	}
+	return true
+}
+
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to encode SCIM response")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, scimContentType, data)
+}
+
+func scimErrorResponse(c *gin.Context, status int, scimType, detail string) {
+	body := gin.H{
+		"schemas": []string{usecases.SCIMSchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	scimJSON(c, status, body)
+}
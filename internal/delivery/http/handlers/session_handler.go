@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"team-service/internal/usecases"
+	"team-service/pkg/logger"
+	"team-service/pkg/response"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionHandler struct {
+	sessionService usecases.SessionService
+}
+
+func NewSessionHandler(sessionService usecases.SessionService) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+	}
+}
+
+type RevokeTokenRequest struct {
+	JTI       string     `json:"jti" binding:"required"`
+	UserID    string     `json:"userId"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// Logout revokes the access token used for this request
+func (h *SessionHandler) Logout(c *gin.Context) {
+	jti := c.GetString("jti")
+	if jti == "" {
+		response.Error(c, http.StatusBadRequest, "Token has no jti claim and cannot be revoked individually")
+		return
+	}
+
+	userID := c.GetString("userId")
+	expiresAt := c.GetTime("tokenExpiresAt")
+	if err := h.sessionService.RevokeToken(c.Request.Context(), jti, userID, "logout", userID, expiresAt); err != nil {
+		h.respondError(c, err, "Failed to revoke session")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+func (h *SessionHandler) RevokeToken(c *gin.Context) {
+	adminID := c.GetString("userId")
+
+	var req RevokeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+
+	if err := h.sessionService.RevokeToken(c.Request.Context(), req.JTI, req.UserID, req.Reason, adminID, expiresAt); err != nil {
+		h.respondError(c, err, "Failed to revoke token")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+func (h *SessionHandler) RevokeUserSessions(c *gin.Context) {
+	adminID := c.GetString("userId")
+	userID := c.Param("userId")
+
+	validAfter, err := h.sessionService.RevokeUserSessions(c.Request.Context(), userID, adminID)
+	if err != nil {
+		h.respondError(c, err, "Failed to revoke sessions")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{
+		"message":    "Sessions revoked",
+		"userId":     userID,
+		"validAfter": validAfter,
+	})
+}
+
+func (h *SessionHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, usecases.ErrInvalidSession):
+		response.Error(c, http.StatusBadRequest, err.Error())
+	default:
+		logger.FromContext(c).Error().Err(err).Msg(message)
+		response.Error(c, http.StatusInternalServerError, message)
+	}
+}
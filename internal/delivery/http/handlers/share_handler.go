@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"team-service/internal/usecases"
+	"team-service/pkg/logger"
 	"team-service/pkg/response"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,13 +23,15 @@ func NewShareHandler(shareService usecases.ShareService) *ShareHandler {
 }
 
 type ShareFolderRequest struct {
-	UserID string `json:"userId" binding:"required"`
-	Access string `json:"access" binding:"required,oneof=read write"`
+	UserID    string     `json:"userId" binding:"required"`
+	Access    string     `json:"access" binding:"required,oneof=read write"`
+	ExpiresAt *time.Time `json:"expiresAt"`
 }
 
 type ShareNoteRequest struct {
-	UserID string `json:"userId" binding:"required"`
-	Access string `json:"access" binding:"required,oneof=read write"`
+	UserID    string     `json:"userId" binding:"required"`
+	Access    string     `json:"access" binding:"required,oneof=read write"`
+	ExpiresAt *time.Time `json:"expiresAt"`
 }
 
 func (h *ShareHandler) ShareFolder(c *gin.Context) {
@@ -45,11 +50,19 @@ func (h *ShareHandler) ShareFolder(c *gin.Context) {
 		return
 	}
 
-	err = h.shareService.ShareFolder(uint(folderID), req.UserID, req.Access, userID)
+	held, err := h.shareService.ShareFolder(c.Request.Context(), uint(folderID), req.UserID, req.Access, userID, req.ExpiresAt)
+	if respondPolicyError(c, err) {
+		return
+	}
 	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to share folder")
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if held != nil {
+		response.Success(c, http.StatusAccepted, gin.H{"message": "Write access needs a team manager's approval", "accessRequest": held})
+		return
+	}
 
 	response.Success(c, http.StatusOK, gin.H{"message": "Folder shared successfully"})
 }
@@ -65,8 +78,9 @@ func (h *ShareHandler) RevokeFolderShare(c *gin.Context) {
 		return
 	}
 
-	err = h.shareService.RevokeFolderShare(uint(folderID), targetUserID, userID)
+	err = h.shareService.RevokeFolderShare(c.Request.Context(), uint(folderID), targetUserID, userID)
 	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to revoke folder share")
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -90,11 +104,19 @@ func (h *ShareHandler) ShareNote(c *gin.Context) {
 		return
 	}
 
-	err = h.shareService.ShareNote(uint(noteID), req.UserID, req.Access, userID)
+	held, err := h.shareService.ShareNote(c.Request.Context(), uint(noteID), req.UserID, req.Access, userID, req.ExpiresAt)
+	if respondPolicyError(c, err) {
+		return
+	}
 	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to share note")
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if held != nil {
+		response.Success(c, http.StatusAccepted, gin.H{"message": "Write access needs a team manager's approval", "accessRequest": held})
+		return
+	}
 
 	response.Success(c, http.StatusOK, gin.H{"message": "Note shared successfully"})
 }
@@ -110,8 +132,9 @@ func (h *ShareHandler) RevokeNoteShare(c *gin.Context) {
 		return
 	}
 
-	err = h.shareService.RevokeNoteShare(uint(noteID), targetUserID, userID)
+	err = h.shareService.RevokeNoteShare(c.Request.Context(), uint(noteID), targetUserID, userID)
 	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to revoke note share")
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -128,8 +151,15 @@ func (h *ShareHandler) GetTeamAssets(c *gin.Context) {
 		return
 	}
 
-	assets, err := h.shareService.GetTeamAssets(uint(teamID))
+	includeDescendants, _ := strconv.ParseBool(c.DefaultQuery("includeDescendants", "false"))
+	asOf, ok := parseInstant(c, "asOf")
+	if !ok {
+		return
+	}
+
+	assets, err := h.shareService.GetTeamAssets(c.Request.Context(), uint(teamID), includeDescendants, asOf)
 	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to fetch team assets")
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -140,11 +170,30 @@ func (h *ShareHandler) GetTeamAssets(c *gin.Context) {
 func (h *ShareHandler) GetUserAssets(c *gin.Context) {
 	targetUserID := c.Param("userId")
 
-	assets, err := h.shareService.GetUserAssets(targetUserID)
+	assets, err := h.shareService.GetUserAssets(c.Request.Context(), targetUserID)
 	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to fetch user assets")
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	response.Success(c, http.StatusOK, assets)
 }
+
+// respondPolicyError answers 403 for shares refused by a sharing policy and 400 for invalid
+// share requests, reporting false for any other error
+func respondPolicyError(c *gin.Context, err error) bool {
+	var policyErr *usecases.SharingPolicyError
+	var validationErr *usecases.ValidationError
+	switch {
+	case errors.As(err, &policyErr):
+		response.ErrorWithDetails(c, http.StatusForbidden, "Sharing policy violation", policyErr.Violations)
+	case errors.As(err, &validationErr):
+		response.ErrorWithDetails(c, http.StatusBadRequest, "Invalid share", validationErr.Problems)
+	case errors.Is(err, usecases.ErrAccessRequestExists):
+		response.Error(c, http.StatusConflict, err.Error())
+	default:
+		return false
+	}
+	return true
+}
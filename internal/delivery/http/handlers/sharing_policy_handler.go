@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"team-service/internal/entities"
+	"team-service/internal/usecases"
+	"team-service/pkg/logger"
+	"team-service/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SharingPolicyHandler struct {
+	policyService usecases.SharingPolicyService
+}
+
+func NewSharingPolicyHandler(policyService usecases.SharingPolicyService) *SharingPolicyHandler {
+	return &SharingPolicyHandler{
+		policyService: policyService,
+	}
+}
+
+// SharingPolicyRequest replaces every rule of a policy; omitted rules are switched off
+type SharingPolicyRequest struct {
+	WithinTeams          bool `json:"withinTeams"`
+	DirectoryUsersOnly   bool `json:"directoryUsersOnly"`
+	WriteRequiresManager bool `json:"writeRequiresManager"`
+	MaxShareDays         int  `json:"maxShareDays"`
+}
+
+func (h *SharingPolicyHandler) ListPolicies(c *gin.Context) {
+	policies, err := h.policyService.ListPolicies(c.Request.Context())
+	if err != nil {
+		h.respondError(c, err, "Failed to list sharing policies")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"policies": policies})
+}
+
+func (h *SharingPolicyHandler) GetPolicy(c *gin.Context) {
+	teamID, ok := policyTeamID(c)
+	if !ok {
+		return
+	}
+
+	policy, err := h.policyService.GetPolicy(c.Request.Context(), teamID)
+	if err != nil {
+		h.respondError(c, err, "Failed to get sharing policy")
+		return
+	}
+
+	response.Success(c, http.StatusOK, policy)
+}
+
+func (h *SharingPolicyHandler) SetPolicy(c *gin.Context) {
+	teamID, ok := policyTeamID(c)
+	if !ok {
+		return
+	}
+
+	var req SharingPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rules := entities.SharingPolicy{
+		WithinTeams:          req.WithinTeams,
+		DirectoryUsersOnly:   req.DirectoryUsersOnly,
+		WriteRequiresManager: req.WriteRequiresManager,
+		MaxShareDays:         req.MaxShareDays,
+	}
+	policy, err := h.policyService.SetPolicy(c.Request.Context(), teamID, rules, c.GetString("userId"))
+	if err != nil {
+		h.respondError(c, err, "Failed to set sharing policy")
+		return
+	}
+
+	response.Success(c, http.StatusOK, policy)
+}
+
+func (h *SharingPolicyHandler) DeletePolicy(c *gin.Context) {
+	teamID, ok := policyTeamID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.policyService.DeletePolicy(c.Request.Context(), teamID); err != nil {
+		h.respondError(c, err, "Failed to delete sharing policy")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"message": "Sharing policy deleted"})
+}
+
+func (h *SharingPolicyHandler) respondError(c *gin.Context, err error, message string) {
+	var validationErr *usecases.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		response.ErrorWithDetails(c, http.StatusBadRequest, "Invalid sharing policy", validationErr.Problems)
+	case errors.Is(err, usecases.ErrSharingPolicyNotFound),
+		errors.Is(err, usecases.ErrTeamNotFound):
+		response.Error(c, http.StatusNotFound, err.Error())
+	default:
+		logger.FromContext(c).Error().Err(err).Msg(message)
+		response.Error(c, http.StatusInternalServerError, message)
+	}
+}
+
+// policyTeamID reads the team of a /teams/:teamId policy route, or the global policy for
+// routes without one, writing a 400 when the team ID is invalid
+func policyTeamID(c *gin.Context) (uint, bool) {
+	raw := c.Param("teamId")
+	if raw == "" {
+		return entities.GlobalSharingPolicy, true
+	}
+	teamID, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil || uint(teamID) == entities.GlobalSharingPolicy {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return 0, false
+	}
+	return uint(teamID), true
+}
@@ -1,15 +1,25 @@
 package handlers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"team-service/internal/delivery/http/middleware"
 	"team-service/internal/entities"
 	"team-service/internal/usecases"
+	"team-service/pkg/logger"
 	"team-service/pkg/response"
 
 	"github.com/gin-gonic/gin"
 )
 
+// maxRosterUploadBytes caps roster imports; 1 MiB holds well over the row limit
+const maxRosterUploadBytes = 1 << 20
+
 type TeamHandler struct {
 	teamService usecases.TeamService
 }
@@ -43,8 +53,14 @@ func (h *TeamHandler) CreateTeam(c *gin.Context) {
 		return
 	}
 
-	result, err := h.teamService.CreateTeam(req.TeamName, req.Managers, req.Members)
+	result, err := h.teamService.CreateTeam(c.Request.Context(), req.TeamName, req.Managers, req.Members, c.GetString("userId"), c.GetString("role"))
+	var validationErr *usecases.ValidationError
+	if errors.As(err, &validationErr) {
+		response.ErrorWithDetails(c, http.StatusBadRequest, "Invalid team", validationErr.Problems)
+		return
+	}
 	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to create team")
 		response.Error(c, http.StatusInternalServerError, "Failed to create team")
 		return
 	}
@@ -66,8 +82,13 @@ func (h *TeamHandler) AddMember(c *gin.Context) {
 		return
 	}
 
-	err = h.teamService.AddMember(uint(teamID), req.MemberId)
+	err = h.teamService.AddMember(c.Request.Context(), uint(teamID), req.MemberId, c.GetString("userId"))
+	if errors.Is(err, usecases.ErrAlreadyOnTeam) {
+		response.Error(c, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to add member")
 		response.ErrorWithDetails(c, http.StatusInternalServerError, "Failed to add member", err.Error())
 		return
 	}
@@ -85,9 +106,9 @@ func (h *TeamHandler) DeleteMember(c *gin.Context) {
 		return
 	}
 
-	err = h.teamService.DeleteMember(uint(teamID), memberID)
+	err = h.teamService.DeleteMember(c.Request.Context(), uint(teamID), memberID, c.GetString("userId"), middleware.TeamPermissions(c))
 	if err != nil {
-		response.ErrorWithDetails(c, http.StatusInternalServerError, "Failed to remove member", err.Error())
+		h.respondError(c, err, "Failed to remove member")
 		return
 	}
 
@@ -108,9 +129,9 @@ func (h *TeamHandler) AddManager(c *gin.Context) {
 		return
 	}
 
-	err = h.teamService.AddManager(uint(teamID), req.ManagerId)
+	err = h.teamService.AddManager(c.Request.Context(), uint(teamID), req.ManagerId, c.GetString("userId"), middleware.TeamPermissions(c))
 	if err != nil {
-		response.ErrorWithDetails(c, http.StatusInternalServerError, "Failed to add manager", err.Error())
+		h.respondError(c, err, "Failed to add manager")
 		return
 	}
 
@@ -127,11 +148,486 @@ func (h *TeamHandler) DeleteManager(c *gin.Context) {
 		return
 	}
 
-	err = h.teamService.DeleteManager(uint(teamID), managerID)
+	err = h.teamService.DeleteManager(c.Request.Context(), uint(teamID), managerID, c.GetString("userId"), middleware.TeamPermissions(c))
 	if err != nil {
-		response.ErrorWithDetails(c, http.StatusInternalServerError, "Failed to remove manager", err.Error())
+		h.respondError(c, err, "Failed to remove manager")
 		return
 	}
 
 	response.Success(c, http.StatusOK, gin.H{"message": "Manager removed successfully"})
 }
+
+type CreateSubTeamRequest struct {
+	TeamName string             `json:"teamName" binding:"required"`
+	Managers []entities.Manager `json:"managers"`
+	Members  []entities.Member  `json:"members"`
+}
+
+// MoveTeamRequest names the new parent; null makes the team a root team
+type MoveTeamRequest struct {
+	ParentTeamID *uint `json:"parentTeamId"`
+}
+
+type UpdateTeamSettingsRequest struct {
+	MembershipPolicy string `json:"membershipPolicy" binding:"required"`
+}
+
+type JoinTeamRequest struct {
+	Message string `json:"message"`
+}
+
+func (h *TeamHandler) GetSettings(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	team, err := h.teamService.GetSettings(c.Request.Context(), uint(teamID))
+	if err != nil {
+		h.respondError(c, err, "Failed to load team settings")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"teamId": team.TeamId, "membershipPolicy": team.MembershipPolicy})
+}
+
+func (h *TeamHandler) UpdateSettings(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	var req UpdateTeamSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	team, err := h.teamService.SetMembershipPolicy(c.Request.Context(), uint(teamID), req.MembershipPolicy)
+	if err != nil {
+		h.respondError(c, err, "Failed to update team settings")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"teamId": team.TeamId, "membershipPolicy": team.MembershipPolicy})
+}
+
+func (h *TeamHandler) RequestToJoin(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	var req JoinTeamRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	request, err := h.teamService.RequestToJoin(c.Request.Context(), uint(teamID), c.GetString("userId"), req.Message)
+	if err != nil {
+		h.respondError(c, err, "Failed to request to join team")
+		return
+	}
+
+	response.Success(c, http.StatusCreated, request)
+}
+
+func (h *TeamHandler) ListJoinRequests(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	status := c.DefaultQuery("status", entities.JoinRequestPending)
+	if status == "all" {
+		status = ""
+	}
+
+	requests, err := h.teamService.ListJoinRequests(c.Request.Context(), uint(teamID), status)
+	if err != nil {
+		h.respondError(c, err, "Failed to list join requests")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"joinRequests": requests})
+}
+
+func (h *TeamHandler) ApproveJoinRequest(c *gin.Context) {
+	h.decideJoinRequest(c, true)
+}
+
+func (h *TeamHandler) RejectJoinRequest(c *gin.Context) {
+	h.decideJoinRequest(c, false)
+}
+
+func (h *TeamHandler) decideJoinRequest(c *gin.Context, approve bool) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+	requestID, err := strconv.ParseUint(c.Param("requestId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid join request ID")
+		return
+	}
+
+	request, err := h.teamService.DecideJoinRequest(c.Request.Context(), uint(teamID), uint(requestID), c.GetString("userId"), approve)
+	if err != nil {
+		h.respondError(c, err, "Failed to decide join request")
+		return
+	}
+
+	response.Success(c, http.StatusOK, request)
+}
+
+func (h *TeamHandler) CreateSubTeam(c *gin.Context) {
+	parentID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	var req CreateSubTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.teamService.CreateSubTeam(c.Request.Context(), uint(parentID), req.TeamName, req.Managers, req.Members, c.GetString("userId"), middleware.TeamPermissions(c))
+	if err != nil {
+		h.respondError(c, err, "Failed to create sub-team")
+		return
+	}
+
+	response.Success(c, http.StatusCreated, result)
+}
+
+func (h *TeamHandler) MoveTeam(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	var req MoveTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	team, err := h.teamService.MoveTeam(c.Request.Context(), uint(teamID), req.ParentTeamID, c.GetString("userId"), c.GetString("role"))
+	if err != nil {
+		h.respondError(c, err, "Failed to move team")
+		return
+	}
+
+	response.Success(c, http.StatusOK, team)
+}
+
+func (h *TeamHandler) ListAncestors(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	teams, err := h.teamService.ListAncestors(c.Request.Context(), uint(teamID))
+	if err != nil {
+		h.respondError(c, err, "Failed to list ancestor teams")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"teams": teams})
+}
+
+func (h *TeamHandler) ListDescendants(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	teams, err := h.teamService.ListDescendants(c.Request.Context(), uint(teamID))
+	if err != nil {
+		h.respondError(c, err, "Failed to list sub-teams")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"teams": teams})
+}
+
+func (h *TeamHandler) TeamHistory(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+	at, ok := parseInstant(c, "at")
+	if !ok {
+		return
+	}
+
+	history, err := h.teamService.TeamHistory(c.Request.Context(), uint(teamID), at)
+	if err != nil {
+		h.respondError(c, err, "Failed to load team history")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"history": history})
+}
+
+func (h *TeamHandler) UserTeamHistory(c *gin.Context) {
+	at, ok := parseInstant(c, "at")
+	if !ok {
+		return
+	}
+
+	history, err := h.teamService.UserTeamHistory(c.Request.Context(), c.Param("userId"), at)
+	if err != nil {
+		h.respondError(c, err, "Failed to load team history")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"history": history})
+}
+
+// ImportRoster accepts the roster as a CSV request body or as the "file" field of a
+// multipart form; ?dryRun=true only reports the changes
+func (h *TeamHandler) ImportRoster(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRosterUploadBytes)
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "A CSV file is required in the \"file\" field")
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "Failed to read the uploaded file")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	entries, err := usecases.ParseRosterCSV(body)
+	var validationErr *usecases.ValidationError
+	if errors.As(err, &validationErr) {
+		response.ErrorWithDetails(c, http.StatusBadRequest, "Invalid roster", validationErr.Problems)
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		response.Error(c, http.StatusRequestEntityTooLarge, "Roster file is too large")
+		return
+	}
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	diff, err := h.teamService.ImportRoster(c.Request.Context(), uint(teamID), entries, c.GetString("userId"), middleware.TeamPermissions(c), dryRun)
+	if err != nil {
+		h.respondError(c, err, "Failed to import roster")
+		return
+	}
+
+	response.Success(c, http.StatusOK, diff)
+}
+
+// ExportRoster returns the roster as CSV, or as JSON with ?format=json
+func (h *TeamHandler) ExportRoster(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		response.Error(c, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+
+	entries, err := h.teamService.ExportRoster(c.Request.Context(), uint(teamID))
+	if err != nil {
+		h.respondError(c, err, "Failed to export roster")
+		return
+	}
+
+	if format == "json" {
+		response.Success(c, http.StatusOK, gin.H{"teamId": teamID, "roster": entries})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := usecases.WriteRosterCSV(&buf, entries); err != nil {
+		h.respondError(c, err, "Failed to export roster")
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="team-%d-roster.csv"`, teamID))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+type TeamRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func (h *TeamHandler) ListRoles(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	roles, err := h.teamService.ListRoles(c.Request.Context(), uint(teamID))
+	if err != nil {
+		h.respondError(c, err, "Failed to list team roles")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"builtin": builtinRoles(), "roles": roles})
+}
+
+func (h *TeamHandler) CreateRole(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	var req TeamRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	role, err := h.teamService.CreateRole(c.Request.Context(), uint(teamID), req.Name, req.Description, req.Permissions, c.GetString("userId"), middleware.TeamPermissions(c))
+	if err != nil {
+		h.respondError(c, err, "Failed to create team role")
+		return
+	}
+
+	response.Success(c, http.StatusCreated, role)
+}
+
+func (h *TeamHandler) UpdateRole(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	var req TeamRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	role, err := h.teamService.UpdateRole(c.Request.Context(), uint(teamID), c.Param("roleName"), req.Description, req.Permissions, middleware.TeamPermissions(c))
+	if err != nil {
+		h.respondError(c, err, "Failed to update team role")
+		return
+	}
+
+	response.Success(c, http.StatusOK, role)
+}
+
+func (h *TeamHandler) DeleteRole(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	if err := h.teamService.DeleteRole(c.Request.Context(), uint(teamID), c.Param("roleName")); err != nil {
+		h.respondError(c, err, "Failed to delete team role")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+func (h *TeamHandler) AssignRole(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	memberID := c.Param("memberId")
+	if err := h.teamService.AssignRole(c.Request.Context(), uint(teamID), memberID, req.Role, c.GetString("userId"), middleware.TeamPermissions(c)); err != nil {
+		h.respondError(c, err, "Failed to assign team role")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"message": "Role assigned"})
+}
+
+// builtinRoles describes the MANAGER and MEMBER roles every team has
+func builtinRoles() []gin.H {
+	roles := make([]gin.H, 0, 2)
+	for _, name := range []string{entities.RosterRoleManager, entities.RosterRoleMember} {
+		perms, _ := entities.BuiltinRolePermissions(name)
+		roles = append(roles, gin.H{"name": name, "permissions": perms})
+	}
+	return roles
+}
+
+func (h *TeamHandler) respondError(c *gin.Context, err error, message string) {
+	var validationErr *usecases.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		response.ErrorWithDetails(c, http.StatusBadRequest, "Invalid request", validationErr.Problems)
+	case errors.Is(err, usecases.ErrInvalidMembershipPolicy),
+		errors.Is(err, usecases.ErrTeamCycle),
+		errors.Is(err, usecases.ErrTeamTooDeep):
+		response.Error(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, usecases.ErrJoinNotAllowed),
+		errors.Is(err, usecases.ErrTeamMoveForbidden),
+		errors.Is(err, usecases.ErrPermissionEscalation):
+		response.Error(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, usecases.ErrTeamNotFound),
+		errors.Is(err, usecases.ErrJoinRequestNotFound),
+		errors.Is(err, usecases.ErrTeamRoleNotFound),
+		errors.Is(err, usecases.ErrNotOnTeam):
+		response.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, usecases.ErrAlreadyOnTeam),
+		errors.Is(err, usecases.ErrJoinRequestExists),
+		errors.Is(err, usecases.ErrJoinRequestNotPending),
+		errors.Is(err, usecases.ErrTeamRoleExists),
+		errors.Is(err, usecases.ErrTeamRoleInUse),
+		errors.Is(err, usecases.ErrRosterChanged):
+		response.Error(c, http.StatusConflict, err.Error())
+	default:
+		logger.FromContext(c).Error().Err(err).Msg(message)
+		response.Error(c, http.StatusInternalServerError, message)
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"team-service/internal/entities"
+	"team-service/internal/usecases"
+	"team-service/pkg/logger"
+	"team-service/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TokenHandler struct {
+	tokenService usecases.TokenService
+}
+
+func NewTokenHandler(tokenService usecases.TokenService) *TokenHandler {
+	return &TokenHandler{
+		tokenService: tokenService,
+	}
+}
+
+type CreateTokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"min=0"`
+}
+
+type CreateServiceKeyRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	PrincipalID   string   `json:"principalId"`
+	Role          string   `json:"role" binding:"omitempty,oneof=MEMBER MANAGER"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"min=0"`
+}
+
+// createdTokenResponse is the only response that ever contains the plaintext token
+type createdTokenResponse struct {
+	*entities.APIToken
+	Token string `json:"token"`
+}
+
+func (h *TokenHandler) CreatePersonalToken(c *gin.Context) {
+	userID := c.GetString("userId")
+	role := c.GetString("role")
+
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, raw, err := h.tokenService.CreatePersonalToken(c.Request.Context(), userID, role, req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		h.respondError(c, err, "Failed to create token")
+		return
+	}
+
+	response.Success(c, http.StatusCreated, createdTokenResponse{APIToken: token, Token: raw})
+}
+
+func (h *TokenHandler) ListPersonalTokens(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	tokens, err := h.tokenService.ListPersonalTokens(c.Request.Context(), userID)
+	if err != nil {
+		h.respondError(c, err, "Failed to list tokens")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"tokens": tokens})
+}
+
+func (h *TokenHandler) RevokePersonalToken(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	tokenID, err := strconv.ParseUint(c.Param("tokenId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+
+	if err := h.tokenService.RevokePersonalToken(c.Request.Context(), uint(tokenID), userID); err != nil {
+		h.respondError(c, err, "Failed to revoke token")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+func (h *TokenHandler) CreateServiceKey(c *gin.Context) {
+	adminID := c.GetString("userId")
+
+	var req CreateServiceKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, raw, err := h.tokenService.CreateServiceKey(c.Request.Context(), adminID, req.Name, req.PrincipalID, req.Role, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		h.respondError(c, err, "Failed to create service key")
+		return
+	}
+
+	response.Success(c, http.StatusCreated, createdTokenResponse{APIToken: token, Token: raw})
+}
+
+func (h *TokenHandler) ListServiceKeys(c *gin.Context) {
+	keys, err := h.tokenService.ListServiceKeys(c.Request.Context())
+	if err != nil {
+		h.respondError(c, err, "Failed to list service keys")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"serviceKeys": keys})
+}
+
+func (h *TokenHandler) RevokeServiceKey(c *gin.Context) {
+	tokenID, err := strconv.ParseUint(c.Param("tokenId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+
+	if err := h.tokenService.RevokeServiceKey(c.Request.Context(), uint(tokenID)); err != nil {
+		h.respondError(c, err, "Failed to revoke service key")
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{"message": "Service key revoked"})
+}
+
+func (h *TokenHandler) respondError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, usecases.ErrInvalidToken):
+		response.Error(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, usecases.ErrTokenNotFound):
+		response.Error(c, http.StatusNotFound, err.Error())
+	default:
+		logger.FromContext(c).Error().Err(err).Msg(message)
+		response.Error(c, http.StatusInternalServerError, message)
+	}
+}
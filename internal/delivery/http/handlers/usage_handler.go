@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"team-service/internal/usecases"
+	"team-service/pkg/logger"
+	"team-service/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UsageHandler struct {
+	quotaService usecases.QuotaService
+}
+
+func NewUsageHandler(quotaService usecases.QuotaService) *UsageHandler {
+	return &UsageHandler{
+		quotaService: quotaService,
+	}
+}
+
+func (h *UsageHandler) MyUsage(c *gin.Context) {
+	report, err := h.quotaService.UserUsage(c.Request.Context(), c.GetString("userId"), c.GetString("role"))
+	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to get usage")
+		response.Error(c, http.StatusInternalServerError, "Failed to get usage")
+		return
+	}
+
+	response.Success(c, http.StatusOK, report)
+}
+
+func (h *UsageHandler) TeamUsage(c *gin.Context) {
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	report, err := h.quotaService.TeamUsage(c.Request.Context(), uint(teamID))
+	if err != nil {
+		logger.FromContext(c).Error().Err(err).Msg("Failed to get team usage")
+		response.Error(c, http.StatusInternalServerError, "Failed to get usage")
+		return
+	}
+
+	response.Success(c, http.StatusOK, report)
+}
+
+// respondQuotaExceeded answers 507 when storage runs out and 403 for any other quota,
+// reporting false if err is not a quota error
+func respondQuotaExceeded(c *gin.Context, err error) bool {
+	var quotaErr *usecases.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	status := http.StatusForbidden
+	if quotaErr.Resource == usecases.QuotaResourceBytes {
+		status = http.StatusInsufficientStorage
+	}
+	response.ErrorWithDetails(c, status, "Quota exceeded", quotaErr)
+	return true
+}
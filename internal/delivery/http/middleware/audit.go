@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"team-service/internal/entities"
+	"team-service/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditRecorder persists audit log entries
+type AuditRecorder interface {
+	RecordAudit(ctx context.Context, entry *entities.AuditLog) error
+}
+
+// Elevate marks every request on the route as using elevated (ADMIN) access
+func Elevate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		markElevated(c)
+		c.Next()
+	}
+}
+
+// Audit records requests that used elevated access once they complete,
+// including those rejected by the handler
+func Audit(recorder AuditRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if !c.GetBool("elevated") {
+			return
+		}
+
+		params := make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+
+		entry := &entities.AuditLog{
+			ActorID:   c.GetString("userId"),
+			ActorRole: c.GetString("role"),
+			Action:    c.Request.Method + " " + c.FullPath(),
+			Params:    params,
+			Status:    c.Writer.Status(),
+			Elevated:  true,
+			RequestID: c.GetString("requestId"),
+		}
+		// The client may already be gone; the audit trail must still be written
+		if err := recorder.RecordAudit(context.WithoutCancel(c.Request.Context()), entry); err != nil {
+			logger.FromContext(c).Error().Err(err).Str("action", entry.Action).Msg("Failed to write audit log")
+		}
+	}
+}
+
+func markElevated(c *gin.Context) {
+	c.Set("elevated", true)
+	logger.AddField(c, "access", "elevated")
+}
@@ -0,0 +1,358 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/internal/usecases"
+	"team-service/pkg/auth"
+	"team-service/pkg/logger"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Authentication types recorded in the gin context under "authType"
+const (
+	AuthTypeJWT    = "jwt"
+	AuthTypeAPIKey = "api_key"
+	AuthTypeSCIM   = "scim"
+)
+
+// APIKeyAuthenticator resolves personal access tokens and service keys
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, raw string) (*entities.APIToken, error)
+}
+
+// SessionValidator checks a verified credential against revocations and the user directory
+// and returns the role the caller acts with
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, userID, role, jti string, issuedAt time.Time) (string, error)
+}
+
+// AuthMiddleware accepts either a JWT or an API token as the bearer credential
+func AuthMiddleware(verifier *auth.Verifier, apiKeys APIKeyAuthenticator, sessions SessionValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
+			return
+		}
+
+		// Bearer token
+		tokenParts := strings.Split(authHeader, " ")
+		if len(tokenParts) != 2 || strings.ToLower(tokenParts[0]) != "bearer" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization format"})
+			return
+		}
+
+		tokenStr := tokenParts[1]
+
+		if entities.IsAPIKey(tokenStr) {
+			token, err := apiKeys.AuthenticateAPIKey(c.Request.Context(), tokenStr)
+			if err != nil {
+				logger.FromContext(c).Debug().Err(err).Msg("Rejected API token")
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid, expired or revoked API token"})
+				return
+			}
+			role, ok := validateSession(c, sessions, token.UserID, token.Role, "", token.CreatedAt)
+			if !ok {
+				return
+			}
+			c.Set("userId", token.UserID)
+			c.Set("role", role)
+			c.Set("authType", AuthTypeAPIKey)
+			c.Set("tokenId", token.ID)
+			c.Set("scopes", token.Scopes)
+			logger.AddField(c, "userId", token.UserID)
+			c.Next()
+			return
+		}
+
+		// Verify signature, exp, nbf, iss and aud
+		claims, err := verifier.Verify(c.Request.Context(), tokenStr)
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has expired"})
+			return
+		}
+		if err != nil {
+			logger.FromContext(c).Debug().Err(err).Msg("Rejected access token")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+
+		// Check required claims
+		userId, role := claims.UserID, claims.Role
+		if userId == "" || role == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid user claims"})
+			return
+		}
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		role, ok := validateSession(c, sessions, userId, role, claims.ID, issuedAt)
+		if !ok {
+			return
+		}
+		c.Set("userId", userId)
+		c.Set("role", role)
+		c.Set("authType", AuthTypeJWT)
+		c.Set("jti", claims.ID)
+		if claims.ExpiresAt != nil {
+			c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+		}
+		logger.AddField(c, "userId", userId)
+		c.Next()
+	}
+}
+
+// validateSession aborts the request when the session was revoked or the user deactivated
+func validateSession(c *gin.Context, sessions SessionValidator, userID, role, jti string, issuedAt time.Time) (string, bool) {
+	effective, err := sessions.ValidateSession(c.Request.Context(), userID, role, jti, issuedAt)
+	switch {
+	case errors.Is(err, usecases.ErrSessionRevoked):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return "", false
+	case errors.Is(err, usecases.ErrUserInactive):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User account is deactivated"})
+		return "", false
+	case err != nil:
+		logger.FromContext(c).Error().Err(err).Msg("Failed to validate session")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate session"})
+		return "", false
+	}
+	if effective != role {
+		logger.FromContext(c).Debug().Str("claimedRole", role).Str("role", effective).Msg("Role claim overridden by directory")
+	}
+	return effective, true
+}
+
+// RequireScope limits API tokens to routes covered by their scopes.
+// Interactive JWT sessions are not scoped and always pass.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("authType") != AuthTypeAPIKey {
+			c.Next()
+			return
+		}
+		scopes, _ := c.Get("scopes")
+		granted, _ := scopes.([]string)
+		for _, s := range granted {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "API token is missing the required scope: " + scope,
+		})
+	}
+}
+
+// RequireUserSession rejects API tokens, so they cannot be used to mint or manage other tokens
+func RequireUserSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("authType") != AuthTypeJWT {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "This action requires a user session, not an API token",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "You are not allowed to perform this action",
+		})
+	}
+}
+
+// RequireSelfOrAdmin lets users reach routes about themselves, named by the param route
+// parameter. ADMINs may reach anyone's, which is marked as elevated access.
+func RequireSelfOrAdmin(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Param(param) == c.GetString("userId") {
+			c.Next()
+			return
+		}
+		if c.GetString("role") != "ADMIN" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "You can only view your own records",
+			})
+			return
+		}
+		markElevated(c)
+		c.Next()
+	}
+}
+
+func RequireNotMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if role == "MEMBER" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Members are not allowed to perform this action",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireTeamPermission lets callers through whose roles on the team named by the teamId route
+// parameter, or on one of its ancestors, grant permission. The resolved permissions are kept
+// under "teamPermissions" for handlers that guard against escalation. ADMINs hold every
+// permission on every team, which is marked as elevated access.
+func RequireTeamPermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+			return
+		}
+
+		if c.GetString("role") == "ADMIN" {
+			c.Set("teamPermissions", entities.TeamPermissions)
+			markElevated(c)
+			c.Next()
+			return
+		}
+
+		db := c.MustGet("db").(*gorm.DB)
+		perms, err := repository.NewTeamRepository(db).UserPermissions(c.Request.Context(), c.GetString("userId"), uint(teamID))
+		if err != nil {
+			logger.FromContext(c).Error().Err(err).Msg("Failed to resolve team permissions")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to verify team access",
+			})
+			return
+		}
+		c.Set("teamPermissions", perms)
+		if !HasTeamPermission(c, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Your role on this team does not grant " + permission,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireTeamMember lets through anyone on the roster of the team named by the teamId route
+// parameter, or of one of its ancestors, whatever their role. ADMINs pass as elevated access.
+func RequireTeamMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 32)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid team ID"})
+			return
+		}
+
+		if c.GetString("role") == "ADMIN" {
+			markElevated(c)
+			c.Next()
+			return
+		}
+
+		db := c.MustGet("db").(*gorm.DB)
+		onTeam, err := repository.NewTeamRepository(db).IsUserInTeamTree(c.Request.Context(), c.GetString("userId"), uint(teamID))
+		if err != nil {
+			logger.FromContext(c).Error().Err(err).Msg("Failed to verify team membership")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to verify team access",
+			})
+			return
+		}
+		if !onTeam {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "You are not on this team",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// TeamPermissions returns the caller's permissions on the team, as resolved by RequireTeamPermission
+func TeamPermissions(c *gin.Context) []string {
+	value, _ := c.Get("teamPermissions")
+	perms, _ := value.([]string)
+	return perms
+}
+
+// HasTeamPermission reports whether the permissions resolved by RequireTeamPermission include permission
+func HasTeamPermission(c *gin.Context, permission string) bool {
+	for _, p := range TeamPermissions(c) {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireAssetViewerOf guards asset reports about the user named by the param route parameter.
+// Users may see their own; anyone else needs assets:view on a team the user is on, directly or
+// through an ancestor team. ADMINs may see anyone's, which is marked as elevated access.
+func RequireAssetViewerOf(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userId")
+		targetID := c.Param(param)
+		if targetID == userID {
+			c.Next()
+			return
+		}
+		if c.GetString("role") == "ADMIN" {
+			markElevated(c)
+			c.Next()
+			return
+		}
+
+		db := c.MustGet("db").(*gorm.DB)
+		allowed, err := canViewAssetsOf(c.Request.Context(), repository.NewTeamRepository(db), userID, targetID)
+		if err != nil {
+			logger.FromContext(c).Error().Err(err).Msg("Failed to resolve team permissions")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to verify team access",
+			})
+			return
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "You cannot view this user's assets",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func canViewAssetsOf(ctx context.Context, teams repository.TeamRepository, userID, targetID string) (bool, error) {
+	rosters, err := teams.GetRostersByUser(ctx, targetID)
+	if err != nil {
+		return false, err
+	}
+	for _, roster := range rosters {
+		ok, err := teams.HasPermission(ctx, userID, roster.TeamId, entities.TeamPermViewAssets)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"team-service/internal/entities"
+	"team-service/internal/usecases"
+	"team-service/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader lets clients retry a create safely
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodyBytes  = 1 << 20
+)
+
+// IdempotencyStore claims idempotency keys and stores the responses to replay
+type IdempotencyStore interface {
+	Begin(ctx context.Context, userID, key, fingerprint string) (*entities.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, record *entities.IdempotencyRecord, status int, contentType, body string) error
+	Release(ctx context.Context, record *entities.IdempotencyRecord) error
+}
+
+// capturingWriter keeps a copy of the response body so it can be stored for replays
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotent replays the stored response when a request is retried with the same
+// Idempotency-Key and body. Keys are scoped per user; reusing one with a different request
+// is rejected with 422. Server errors release the key so the client can retry.
+// Requests without the header are passed through untouched.
+func Idempotent(store IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentBodyBytes+1))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		if len(body) > maxIdempotentBodyBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record, replay, err := store.Begin(c.Request.Context(), c.GetString("userId"), key, fingerprint(c, body))
+		switch {
+		case errors.Is(err, usecases.ErrIdempotencyMismatch):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, usecases.ErrIdempotencyInProgress):
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			logger.FromContext(c).Error().Err(err).Msg("Failed to claim idempotency key")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to process idempotency key"})
+			return
+		}
+
+		if replay {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.Status, record.ContentType, []byte(record.Body))
+			c.Abort()
+			return
+		}
+
+		writer := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		// Finish bookkeeping even if the client has gone away
+		ctx := context.WithoutCancel(c.Request.Context())
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			err = store.Release(ctx, record)
+		} else {
+			err = store.Complete(ctx, record, status, writer.Header().Get("Content-Type"), writer.body.String())
+		}
+		if err != nil {
+			logger.FromContext(c).Error().Err(err).Msg("Failed to record idempotent response")
+		}
+	}
+}
+
+// fingerprint identifies the request a key was first used with
+func fingerprint(c *gin.Context, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"team-service/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMRole is the role recorded for requests made by the SCIM provisioning client
+const SCIMRole = "SCIM"
+
+// SCIMAuth accepts only the dedicated SCIM bearer token. Provisioning acts on the whole
+// directory, so every request is marked as elevated access.
+func SCIMAuth(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		if token == "" || subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), expected) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:Error"},
+				"status":  "401",
+				"detail":  "Invalid SCIM bearer token",
+			})
+			return
+		}
+
+		c.Set("userId", "scim")
+		c.Set("role", SCIMRole)
+		c.Set("authType", AuthTypeSCIM)
+		logger.AddField(c, "userId", "scim")
+		markElevated(c)
+		c.Next()
+	}
+}
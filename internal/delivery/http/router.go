@@ -2,16 +2,32 @@ package http
 
 import (
 	"team-service/internal/delivery/http/handlers"
-	"team-service/pkg/middleware"
+	"team-service/internal/delivery/http/middleware"
+	"team-service/internal/entities"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Router struct {
-	folderHandler *handlers.FolderHandler
-	noteHandler   *handlers.NoteHandler
-	shareHandler  *handlers.ShareHandler
-	teamHandler   *handlers.TeamHandler
+	folderHandler     *handlers.FolderHandler
+	noteHandler       *handlers.NoteHandler
+	shareHandler      *handlers.ShareHandler
+	teamHandler       *handlers.TeamHandler
+	tokenHandler      *handlers.TokenHandler
+	sessionHandler    *handlers.SessionHandler
+	adminHandler      *handlers.AdminHandler
+	invitationHandler *handlers.InvitationHandler
+	usageHandler      *handlers.UsageHandler
+	accessHandler     *handlers.AccessRequestHandler
+	policyHandler     *handlers.SharingPolicyHandler
+	scimHandler       *handlers.SCIMHandler
+	healthHandler     *handlers.HealthHandler
+	auth              gin.HandlerFunc
+	scimAuth          gin.HandlerFunc
+	audit             gin.HandlerFunc
+	limit             func(group string) gin.HandlerFunc
+	limitClient       gin.HandlerFunc
+	idempotent        gin.HandlerFunc
 }
 
 func NewRouter(
@@ -19,61 +35,239 @@ func NewRouter(
 	noteHandler *handlers.NoteHandler,
 	shareHandler *handlers.ShareHandler,
 	teamHandler *handlers.TeamHandler,
+	tokenHandler *handlers.TokenHandler,
+	sessionHandler *handlers.SessionHandler,
+	adminHandler *handlers.AdminHandler,
+	invitationHandler *handlers.InvitationHandler,
+	usageHandler *handlers.UsageHandler,
+	accessHandler *handlers.AccessRequestHandler,
+	policyHandler *handlers.SharingPolicyHandler,
+	scimHandler *handlers.SCIMHandler,
+	healthHandler *handlers.HealthHandler,
+	auth gin.HandlerFunc,
+	scimAuth gin.HandlerFunc,
+	audit gin.HandlerFunc,
+	limit func(group string) gin.HandlerFunc,
+	limitClient gin.HandlerFunc,
+	idempotent gin.HandlerFunc,
 ) *Router {
 	return &Router{
-		folderHandler: folderHandler,
-		noteHandler:   noteHandler,
-		shareHandler:  shareHandler,
-		teamHandler:   teamHandler,
+		folderHandler:     folderHandler,
+		noteHandler:       noteHandler,
+		shareHandler:      shareHandler,
+		teamHandler:       teamHandler,
+		tokenHandler:      tokenHandler,
+		sessionHandler:    sessionHandler,
+		adminHandler:      adminHandler,
+		invitationHandler: invitationHandler,
+		usageHandler:      usageHandler,
+		accessHandler:     accessHandler,
+		policyHandler:     policyHandler,
+		scimHandler:       scimHandler,
+		healthHandler:     healthHandler,
+		auth:              auth,
+		scimAuth:          scimAuth,
+		audit:             audit,
+		limit:             limit,
+		limitClient:       limitClient,
+		idempotent:        idempotent,
 	}
 }
 
 func (r *Router) SetupRoutes(engine *gin.Engine) {
-	// Health check
-	engine.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	// Health checks
+	engine.GET("/livez", r.healthHandler.Livez)
+	engine.GET("/readyz", r.healthHandler.Readyz)
+	engine.GET("/health", r.healthHandler.Readyz)
 
-	// Asset routes (folders, notes, sharing)
+	// Asset routes (folders, notes, sharing). Every authenticated group is limited per client IP
+	// in front of authentication, then each route counts against exactly one per-user group.
 	assetRoutes := engine.Group("/")
-	assetRoutes.Use(middleware.AuthMiddleware())
+	assetRoutes.Use(r.limitClient, r.auth)
 	{
+		read := middleware.RequireScope(entities.ScopeNotesRead)
+		write := middleware.RequireScope(entities.ScopeNotesWrite)
+		share := middleware.RequireScope(entities.ScopeSharesWrite)
+		assets := assetRoutes.Group("", r.limit("default"))
+		sharing := assetRoutes.Group("", r.limit("sharing"))
+		reports := assetRoutes.Group("", r.limit("assets"))
+
 		// Folder Management
-		assetRoutes.POST("/folders", r.folderHandler.CreateFolder)
-		assetRoutes.GET("/folders/:folderId", r.folderHandler.GetFolder)
-		assetRoutes.PUT("/folders/:folderId", r.folderHandler.UpdateFolder)
-		assetRoutes.DELETE("/folders/:folderId", r.folderHandler.DeleteFolder)
+		assets.POST("/folders", write, r.idempotent, r.folderHandler.CreateFolder)
+		assets.GET("/folders/:folderId", read, r.folderHandler.GetFolder)
+		assets.PUT("/folders/:folderId", write, r.folderHandler.UpdateFolder)
+		assets.DELETE("/folders/:folderId", write, r.folderHandler.DeleteFolder)
+
+		// Team-owned folders: any member reads them, team:manage administers them
+		assets.GET("/teams/:teamId/folders", read, r.audit, middleware.RequireTeamMember(), r.folderHandler.ListTeamFolders)
+		assets.POST("/teams/:teamId/folders", write, r.audit, middleware.RequireTeamPermission(entities.TeamPermManageTeam), r.idempotent, r.folderHandler.CreateTeamFolder)
 
 		// Note Management
-		assetRoutes.POST("/folders/:folderId/notes", r.noteHandler.CreateNote)
-		assetRoutes.GET("/notes/:noteId", r.noteHandler.GetNote)
-		assetRoutes.PUT("/notes/:noteId", r.noteHandler.UpdateNote)
-		assetRoutes.DELETE("/notes/:noteId", r.noteHandler.DeleteNote)
+		assets.POST("/folders/:folderId/notes", write, r.idempotent, r.noteHandler.CreateNote)
+		assets.GET("/notes/:noteId", read, r.noteHandler.GetNote)
+		assets.PUT("/notes/:noteId", write, r.noteHandler.UpdateNote)
+		assets.DELETE("/notes/:noteId", write, r.noteHandler.DeleteNote)
 
 		// Sharing API
-		assetRoutes.POST("/folders/:folderId/share", r.shareHandler.ShareFolder)
-		assetRoutes.DELETE("/folders/:folderId/share/:userId", r.shareHandler.RevokeFolderShare)
-		assetRoutes.POST("/notes/:noteId/share", r.shareHandler.ShareNote)
-		assetRoutes.DELETE("/notes/:noteId/share/:userId", r.shareHandler.RevokeNoteShare)
-
-		// Manager-only APIs
-		assetRoutes.GET("/teams/:teamId/assets", r.shareHandler.GetTeamAssets)
-		assetRoutes.GET("/users/:userId/assets", r.shareHandler.GetUserAssets)
+		sharing.POST("/folders/:folderId/share", share, r.idempotent, r.shareHandler.ShareFolder)
+		sharing.DELETE("/folders/:folderId/share/:userId", share, r.shareHandler.RevokeFolderShare)
+		sharing.POST("/notes/:noteId/share", share, r.idempotent, r.shareHandler.ShareNote)
+		sharing.DELETE("/notes/:noteId/share/:userId", share, r.shareHandler.RevokeNoteShare)
+
+		// Access requests: ask for a share, and the inbox of requests on assets you may share
+		sharing.POST("/folders/:folderId/access-requests", read, r.idempotent, r.accessHandler.RequestFolderAccess)
+		sharing.POST("/notes/:noteId/access-requests", read, r.idempotent, r.accessHandler.RequestNoteAccess)
+		assets.GET("/me/access-requests", read, r.accessHandler.Inbox)
+		sharing.POST("/access-requests/:requestId/approve", share, r.accessHandler.ApproveAccessRequest)
+		sharing.POST("/access-requests/:requestId/reject", share, r.accessHandler.RejectAccessRequest)
+
+		// Asset reports, for team roles granting assets:view
+		reports.GET("/teams/:teamId/assets", read, r.audit, middleware.RequireTeamPermission(entities.TeamPermViewAssets), r.shareHandler.GetTeamAssets)
+		reports.GET("/users/:userId/assets", read, r.audit, middleware.RequireAssetViewerOf("userId"), r.shareHandler.GetUserAssets)
+
+		// Usage counters and the quotas that apply to them
+		assets.GET("/me/usage", read, r.usageHandler.MyUsage)
+		assets.GET("/teams/:teamId/usage", read, r.audit, middleware.RequireTeamMember(), r.usageHandler.TeamUsage)
+	}
+
+	// Personal access tokens can only be managed from an interactive session
+	tokenRoutes := engine.Group("/me/tokens")
+	tokenRoutes.Use(r.limitClient, r.auth, r.limit("tokens"), middleware.RequireUserSession())
+	{
+		tokenRoutes.POST("", r.tokenHandler.CreatePersonalToken)
+		tokenRoutes.GET("", r.tokenHandler.ListPersonalTokens)
+		tokenRoutes.DELETE("/:tokenId", r.tokenHandler.RevokePersonalToken)
+	}
+
+	// Invitations addressed to the caller and requests to join teams
+	inviteeRoutes := engine.Group("/")
+	inviteeRoutes.Use(r.limitClient, r.auth, r.limit("teams"), middleware.RequireUserSession())
+	{
+		inviteeRoutes.GET("/me/invitations", r.invitationHandler.Inbox)
+		inviteeRoutes.POST("/invitations/:invitationId/accept", r.invitationHandler.AcceptInvitation)
+		inviteeRoutes.POST("/invitations/:invitationId/decline", r.invitationHandler.DeclineInvitation)
+		inviteeRoutes.POST("/teams/:teamId/join-requests", r.idempotent, r.teamHandler.RequestToJoin)
+	}
+
+	// Session management
+	authRoutes := engine.Group("/auth")
+	authRoutes.Use(r.limitClient, r.auth, r.limit("default"), middleware.RequireUserSession())
+	{
+		authRoutes.POST("/logout", r.sessionHandler.Logout)
+	}
+
+	// Administration (admin only); every request is audited as elevated access
+	adminRoutes := engine.Group("/admin")
+	adminRoutes.Use(r.limitClient, r.auth, r.limit("admin"), middleware.RequireUserSession(), middleware.RequireRole("ADMIN"), middleware.Elevate(), r.audit)
+	{
+		adminRoutes.GET("/stats", r.adminHandler.GetStats)
+		adminRoutes.GET("/audit", r.adminHandler.ListAuditLog)
+		adminRoutes.GET("/teams", r.adminHandler.ListTeams)
+
+		adminRoutes.GET("/users", r.adminHandler.ListUsers)
+		adminRoutes.PUT("/users/:userId/role", r.adminHandler.ChangeUserRole)
+		adminRoutes.POST("/users/:userId/sessions/revoke", r.sessionHandler.RevokeUserSessions)
+		adminRoutes.POST("/tokens/revoke", r.sessionHandler.RevokeToken)
+
+		adminRoutes.GET("/folders/:folderId", r.adminHandler.GetFolder)
+		adminRoutes.POST("/folders/:folderId/transfer", r.adminHandler.TransferFolder)
+		adminRoutes.DELETE("/folders/:folderId/share/:userId", r.adminHandler.RevokeFolderShare)
+		adminRoutes.GET("/notes/:noteId", r.adminHandler.GetNote)
+		adminRoutes.POST("/notes/:noteId/transfer", r.adminHandler.TransferNote)
+		adminRoutes.DELETE("/notes/:noteId/share/:userId", r.adminHandler.RevokeNoteShare)
+
+		adminRoutes.GET("/sharing-policies", r.policyHandler.ListPolicies)
+		adminRoutes.GET("/sharing-policies/global", r.policyHandler.GetPolicy)
+		adminRoutes.PUT("/sharing-policies/global", r.policyHandler.SetPolicy)
+		adminRoutes.DELETE("/sharing-policies/global", r.policyHandler.DeletePolicy)
+		adminRoutes.GET("/sharing-policies/teams/:teamId", r.policyHandler.GetPolicy)
+		adminRoutes.PUT("/sharing-policies/teams/:teamId", r.policyHandler.SetPolicy)
+		adminRoutes.DELETE("/sharing-policies/teams/:teamId", r.policyHandler.DeletePolicy)
+	}
+
+	// Service keys for integrations (admin only)
+	serviceKeyRoutes := engine.Group("/service-keys")
+	serviceKeyRoutes.Use(r.limitClient, r.auth, r.limit("tokens"), middleware.RequireUserSession(), middleware.RequireRole("ADMIN"), middleware.Elevate(), r.audit)
+	{
+		serviceKeyRoutes.POST("", r.tokenHandler.CreateServiceKey)
+		serviceKeyRoutes.GET("", r.tokenHandler.ListServiceKeys)
+		serviceKeyRoutes.DELETE("/:tokenId", r.tokenHandler.RevokeServiceKey)
 	}
 
 	// Team routes
 	teamRoutes := engine.Group("/teams")
-	teamRoutes.Use(middleware.AuthMiddleware())
+	teamRoutes.Use(r.limitClient, r.auth, r.limit("teams"), middleware.RequireScope(entities.ScopeTeamsAdmin))
 	{
-		teamRoutes.POST("", middleware.RequireNotMember(), r.teamHandler.CreateTeam)
+		teamRoutes.POST("", middleware.RequireNotMember(), r.idempotent, r.teamHandler.CreateTeam)
+
+		// Each route needs a permission granted by the caller's role on the team or an ancestor
+		manageTeam := middleware.RequireTeamPermission(entities.TeamPermManageTeam)
+		manageRoster := middleware.RequireTeamPermission(entities.TeamPermManageRoster)
+		viewRoster := middleware.RequireTeamPermission(entities.TeamPermViewRoster)
 
 		protected := teamRoutes.Group("/:teamId")
-		protected.Use(middleware.RequireManagerOfTeam())
+		protected.Use(r.audit)
 		{
-			protected.POST("/members", r.teamHandler.AddMember)
-			protected.DELETE("/members/:memberId", r.teamHandler.DeleteMember)
-			protected.POST("/managers", r.teamHandler.AddManager)
-			protected.DELETE("/managers/:managerId", r.teamHandler.DeleteManager)
+			protected.POST("/members", manageRoster, r.teamHandler.AddMember)
+			protected.DELETE("/members/:memberId", manageRoster, r.teamHandler.DeleteMember)
+			protected.PUT("/members/:memberId/role", manageRoster, r.teamHandler.AssignRole)
+			protected.POST("/managers", manageTeam, r.teamHandler.AddManager)
+			protected.DELETE("/managers/:managerId", manageTeam, r.teamHandler.DeleteManager)
+
+			protected.GET("/roles", viewRoster, r.teamHandler.ListRoles)
+			protected.POST("/roles", manageTeam, r.teamHandler.CreateRole)
+			protected.PUT("/roles/:roleName", manageTeam, r.teamHandler.UpdateRole)
+			protected.DELETE("/roles/:roleName", manageTeam, r.teamHandler.DeleteRole)
+
+			protected.POST("/invitations", manageRoster, r.idempotent, r.invitationHandler.CreateInvitation)
+			protected.GET("/invitations", manageRoster, r.invitationHandler.ListTeamInvitations)
+			protected.DELETE("/invitations/:invitationId", manageRoster, r.invitationHandler.RescindInvitation)
+
+			protected.POST("/subteams", manageTeam, r.idempotent, r.teamHandler.CreateSubTeam)
+			protected.PUT("/parent", manageTeam, r.teamHandler.MoveTeam)
+			protected.GET("/ancestors", viewRoster, r.teamHandler.ListAncestors)
+			protected.GET("/descendants", viewRoster, r.teamHandler.ListDescendants)
+
+			protected.GET("/history", viewRoster, r.teamHandler.TeamHistory)
+			protected.POST("/roster/import", manageTeam, r.teamHandler.ImportRoster)
+			protected.GET("/roster/export", viewRoster, r.teamHandler.ExportRoster)
+
+			protected.GET("/settings", viewRoster, r.teamHandler.GetSettings)
+			protected.PUT("/settings", manageTeam, r.teamHandler.UpdateSettings)
+			protected.GET("/join-requests", manageRoster, r.teamHandler.ListJoinRequests)
+			protected.POST("/join-requests/:requestId/approve", manageRoster, r.teamHandler.ApproveJoinRequest)
+			protected.POST("/join-requests/:requestId/reject", manageRoster, r.teamHandler.RejectJoinRequest)
+		}
+	}
+
+	// A user's membership history across teams (the user themselves, or an ADMIN)
+	userTeamRoutes := engine.Group("/users/:userId/teams")
+	userTeamRoutes.Use(r.limitClient, r.auth, r.limit("teams"), middleware.RequireScope(entities.ScopeTeamsAdmin), r.audit, middleware.RequireSelfOrAdmin("userId"))
+	{
+		userTeamRoutes.GET("/history", r.teamHandler.UserTeamHistory)
+	}
+
+	// SCIM 2.0 provisioning, only served when a SCIM token is configured (scimHandler is nil otherwise)
+	if r.scimHandler != nil {
+		scimRoutes := engine.Group("/scim/v2")
+		scimRoutes.Use(r.limitClient, r.scimAuth, r.limit("scim"), r.audit)
+		{
+			scimRoutes.GET("/ServiceProviderConfig", r.scimHandler.ServiceProviderConfig)
+			scimRoutes.GET("/ResourceTypes", r.scimHandler.ResourceTypes)
+
+			scimRoutes.GET("/Users", r.scimHandler.ListUsers)
+			scimRoutes.POST("/Users", r.scimHandler.CreateUser)
+			scimRoutes.GET("/Users/:id", r.scimHandler.GetUser)
+			scimRoutes.PUT("/Users/:id", r.scimHandler.ReplaceUser)
+			scimRoutes.PATCH("/Users/:id", r.scimHandler.PatchUser)
+			scimRoutes.DELETE("/Users/:id", r.scimHandler.DeleteUser)
+
+			scimRoutes.GET("/Groups", r.scimHandler.ListGroups)
+			scimRoutes.POST("/Groups", r.scimHandler.CreateGroup)
+			scimRoutes.GET("/Groups/:id", r.scimHandler.GetGroup)
+			scimRoutes.PUT("/Groups/:id", r.scimHandler.ReplaceGroup)
+			scimRoutes.PATCH("/Groups/:id", r.scimHandler.PatchGroup)
+			scimRoutes.DELETE("/Groups/:id", r.scimHandler.DeleteGroup)
 		}
 	}
 }
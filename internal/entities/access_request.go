@@ -0,0 +1,38 @@
+package entities
+
+import "time"
+
+// Access request statuses
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestRejected = "rejected"
+)
+
+// Assets an access request can name
+const (
+	AssetFolder = "folder"
+	AssetNote   = "note"
+)
+
+// AccessRequest is a user's request for a share on a folder or note they cannot open. It is
+// decided by whoever may share the asset: its owner, or for team assets anyone with
+// assets:share. A user has at most one pending request per asset.
+//
+// A write share that a write_requires_manager policy holds back is kept as a request too, with
+// SharedBy set to whoever made the share. Those are decided by the managers of the asset's
+// teams instead.
+type AccessRequest struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	AssetType   string     `gorm:"index:idx_access_requests_asset;uniqueIndex:idx_access_requests_pending,where:status = 'pending'" json:"assetType"`
+	AssetID     uint       `gorm:"index:idx_access_requests_asset;uniqueIndex:idx_access_requests_pending,where:status = 'pending'" json:"assetId"`
+	RequesterID string     `gorm:"index;uniqueIndex:idx_access_requests_pending,where:status = 'pending'" json:"requesterId"`
+	Access      string     `json:"access"` // read or write
+	Message     string     `json:"message,omitempty"`
+	SharedBy    string     `gorm:"not null;default:''" json:"sharedBy,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"` // expiry asked for the held share
+	Status      string     `gorm:"index" json:"status"`
+	DecidedBy   string     `json:"decidedBy,omitempty"`
+	DecidedAt   *time.Time `json:"decidedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
@@ -0,0 +1,67 @@
+package entities
+
+import (
+	"strings"
+	"time"
+)
+
+// Token kinds
+const (
+	TokenKindPersonal = "personal"
+	TokenKindService  = "service"
+)
+
+// Plaintext prefixes that distinguish API tokens from JWTs in the Authorization header
+const (
+	PersonalTokenPrefix = "tsp_"
+	ServiceKeyPrefix    = "tss_"
+)
+
+// IsAPIKey reports whether a bearer credential is a personal access token or service key rather than a JWT
+func IsAPIKey(raw string) bool {
+	return strings.HasPrefix(raw, PersonalTokenPrefix) || strings.HasPrefix(raw, ServiceKeyPrefix)
+}
+
+// Scopes that can be granted to personal access tokens and service keys
+const (
+	ScopeNotesRead   = "notes:read"
+	ScopeNotesWrite  = "notes:write"
+	ScopeSharesWrite = "shares:write"
+	ScopeTeamsAdmin  = "teams:admin"
+)
+
+// ValidScopes lists every scope a token may carry
+var ValidScopes = []string{ScopeNotesRead, ScopeNotesWrite, ScopeSharesWrite, ScopeTeamsAdmin}
+
+// APIToken represents a personal access token or a service API key.
+// Only a hash of the secret is stored; the plaintext is returned once at creation.
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `json:"name"`
+	Kind       string     `gorm:"index" json:"kind"` // "personal" or "service"
+	UserID     string     `gorm:"index" json:"userId"`
+	Role       string     `json:"role"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `gorm:"uniqueIndex" json:"-"`
+	Scopes     []string   `gorm:"serializer:json" json:"scopes"`
+	CreatedBy  string     `json:"createdBy"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// HasScope reports whether the token was granted scope
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the token is neither revoked nor expired at now
+func (t *APIToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,17 @@
+package entities
+
+import "time"
+
+// AuditLog records an action taken by a user. Elevated marks access granted through
+// the ADMIN role rather than ownership or team membership.
+type AuditLog struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	ActorID   string            `gorm:"index" json:"actorId"`
+	ActorRole string            `json:"actorRole"`
+	Action    string            `gorm:"index" json:"action"` // "<METHOD> <route>"
+	Params    map[string]string `gorm:"serializer:json" json:"params,omitempty"`
+	Status    int               `json:"status"`
+	Elevated  bool              `gorm:"index" json:"elevated"`
+	RequestID string            `json:"requestId"`
+	CreatedAt time.Time         `gorm:"index" json:"createdAt"`
+}
@@ -2,12 +2,20 @@ package entities
 
 import "time"
 
-// Folder represents a folder entity
+// Folder represents a folder entity. A folder belongs either to a user (OwnerID) or to a team
+// (TeamID, with an empty OwnerID), so team folders outlive whoever created them.
 type Folder struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Name      string    `json:"name"`
 	OwnerID   string    `json:"ownerId"`
+	TeamID    *uint     `gorm:"index" json:"teamId,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 	Notes     []Note    `gorm:"foreignKey:FolderID" json:"notes,omitempty"`
 }
+
+// IsTeamOwned reports whether the folder belongs to a team rather than a user
+func (f *Folder) IsTeamOwned() bool {
+	return f.TeamID != nil
+}
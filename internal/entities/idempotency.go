@@ -0,0 +1,17 @@
+package entities
+
+import "time"
+
+// IdempotencyRecord remembers the outcome of a request sent with an Idempotency-Key so
+// retries get the original response. Status is zero while the first request is in flight.
+type IdempotencyRecord struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      string    `gorm:"uniqueIndex:idx_idempotency_user_key" json:"userId"`
+	Key         string    `gorm:"column:idempotency_key;uniqueIndex:idx_idempotency_user_key" json:"key"`
+	Fingerprint string    `json:"fingerprint"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"contentType"`
+	Body        string    `json:"-"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `gorm:"index" json:"expiresAt"`
+}
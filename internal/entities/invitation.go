@@ -0,0 +1,40 @@
+package entities
+
+import "time"
+
+// Invitation statuses. Pending invitations past their expiry are reported as expired.
+const (
+	InvitationPending   = "pending"
+	InvitationAccepted  = "accepted"
+	InvitationDeclined  = "declined"
+	InvitationRescinded = "rescinded"
+	InvitationExpired   = "expired"
+)
+
+// InvitationTokenPrefix marks the single-use tokens handed to invitees
+const InvitationTokenPrefix = "tsi_"
+
+// TeamInvitation offers a user a place on a team's roster. The invitee is named by user ID,
+// or by email when they have not signed in yet; either way the single-use token can redeem it.
+type TeamInvitation struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	TeamID       uint       `gorm:"index" json:"teamId"`
+	InviteeID    string     `gorm:"index" json:"inviteeId,omitempty"`
+	InviteeEmail string     `gorm:"index" json:"inviteeEmail,omitempty"`
+	Role         string     `json:"role"` // MANAGER or MEMBER
+	InvitedBy    string     `json:"invitedBy"`
+	TokenHash    string     `gorm:"uniqueIndex" json:"-"`
+	Status       string     `gorm:"index" json:"status"`
+	AcceptedBy   string     `json:"acceptedBy,omitempty"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	RespondedAt  *time.Time `json:"respondedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// EffectiveStatus reports a pending invitation past its expiry as expired
+func (i *TeamInvitation) EffectiveStatus(now time.Time) string {
+	if i.Status == InvitationPending && !now.Before(i.ExpiresAt) {
+		return InvitationExpired
+	}
+	return i.Status
+}
@@ -0,0 +1,23 @@
+package entities
+
+import "time"
+
+// Join request statuses
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
+
+// JoinRequest is a user's request to be added to a team's roster as a member.
+// A user has at most one pending request per team.
+type JoinRequest struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TeamID    uint       `gorm:"index;uniqueIndex:idx_join_requests_pending,where:status = 'pending'" json:"teamId"`
+	UserID    string     `gorm:"index;uniqueIndex:idx_join_requests_pending,where:status = 'pending'" json:"userId"`
+	Message   string     `json:"message,omitempty"`
+	Status    string     `gorm:"index" json:"status"`
+	DecidedBy string     `json:"decidedBy,omitempty"`
+	DecidedAt *time.Time `json:"decidedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
@@ -2,13 +2,20 @@ package entities
 
 import "time"
 
-// Note represents a note entity
+// Note represents a note entity. Notes created in a team folder belong to its team.
 type Note struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Title     string    `json:"title"`
 	Body      string    `json:"body"`
 	FolderID  uint      `json:"folderId"`
 	OwnerID   string    `json:"ownerId"`
+	TeamID    *uint     `gorm:"index" json:"teamId,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
+
+// IsTeamOwned reports whether the note belongs to a team rather than a user
+func (n *Note) IsTeamOwned() bool {
+	return n.TeamID != nil
+}
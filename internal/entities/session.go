@@ -0,0 +1,22 @@
+package entities
+
+import "time"
+
+// RevokedToken records a single access token, identified by its jti, that must no longer be accepted.
+// Rows can be purged once the token would have expired anyway.
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"primaryKey"`
+	UserID    string    `json:"userId" gorm:"index"`
+	Reason    string    `json:"reason"`
+	RevokedBy string    `json:"revokedBy"`
+	RevokedAt time.Time `json:"revokedAt"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"index"`
+}
+
+// SessionWatermark invalidates every token issued to a user before ValidAfter
+type SessionWatermark struct {
+	UserID     string    `json:"userId" gorm:"primaryKey"`
+	ValidAfter time.Time `json:"validAfter"`
+	UpdatedBy  string    `json:"updatedBy"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
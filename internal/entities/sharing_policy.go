@@ -0,0 +1,33 @@
+package entities
+
+import "time"
+
+// Sharing policy rules, as named in policy violations
+const (
+	SharingRuleWithinTeams          = "within_teams"
+	SharingRuleDirectoryUsersOnly   = "directory_users_only"
+	SharingRuleWriteRequiresManager = "write_requires_manager"
+	SharingRuleMaxShareDuration     = "max_share_duration"
+)
+
+// GlobalSharingPolicy is the TeamID of the policy that applies to every share
+const GlobalSharingPolicy uint = 0
+
+// SharingPolicy restricts the shares that can be made on assets of a team, or on every asset
+// for the global policy. A share must satisfy the global policy and the policies of every team
+// governing the asset.
+type SharingPolicy struct {
+	ID     uint `gorm:"primaryKey" json:"-"`
+	TeamID uint `gorm:"uniqueIndex" json:"teamId,omitempty"` // GlobalSharingPolicy for the global policy
+	// WithinTeams only allows sharing with users on a team with the owner, or on the owning team
+	WithinTeams bool `json:"withinTeams"`
+	// DirectoryUsersOnly only allows sharing with active users in the user directory
+	DirectoryUsersOnly bool `json:"directoryUsersOnly"`
+	// WriteRequiresManager only lets users with team:manage grant write access
+	WriteRequiresManager bool `json:"writeRequiresManager"`
+	// MaxShareDays caps how long a share lasts; 0 allows shares that never expire
+	MaxShareDays int       `json:"maxShareDays"`
+	UpdatedBy    string    `json:"updatedBy"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
@@ -2,12 +2,32 @@ package entities
 
 import "time"
 
+// Membership policies decide how users who are not on a team can join it
+const (
+	MembershipOpen       = "open"    // anyone can join directly
+	MembershipRequest    = "request" // join requests wait for a manager's approval
+	MembershipInviteOnly = "invite"  // only invitations add users
+)
+
 // Team represents a team entity
 type Team struct {
-	TeamId    uint      `json:"teamId" gorm:"primaryKey;autoIncrement;column:teamId"`
-	TeamName  string    `json:"teamName" gorm:"column:teamName"`
-	CreatedAt time.Time `json:"createdAt" gorm:"column:createdAt;autoCreateTime"`
-	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updatedAt;autoUpdateTime"`
+	TeamId           uint      `json:"teamId" gorm:"primaryKey;autoIncrement;column:teamId"`
+	TeamName         string    `json:"teamName" gorm:"column:teamName"`
+	CreatedBy        string    `json:"createdBy" gorm:"column:createdBy"`
+	ParentTeamID     *uint     `json:"parentTeamId" gorm:"column:parentTeamId;index"`
+	MembershipPolicy string    `json:"membershipPolicy" gorm:"column:membershipPolicy;not null;default:request"`
+	ExternalID       string    `json:"externalId,omitempty" gorm:"column:externalId;index"` // identity provider's group ID, set by SCIM
+	CreatedAt        time.Time `json:"createdAt" gorm:"column:createdAt;autoCreateTime"`
+	UpdatedAt        time.Time `json:"updatedAt" gorm:"column:updatedAt;autoUpdateTime"`
+}
+
+// IsValidMembershipPolicy reports whether policy is one of the known membership policies
+func IsValidMembershipPolicy(policy string) bool {
+	switch policy {
+	case MembershipOpen, MembershipRequest, MembershipInviteOnly:
+		return true
+	}
+	return false
 }
 
 func (Team) TableName() string {
@@ -33,11 +53,41 @@ type Member struct {
 // Roster represents team membership
 type Roster struct {
 	RosterId uint   `json:"rosterId" gorm:"primaryKey;autoIncrement;column:rosterId"`
-	TeamId   uint   `json:"teamId" gorm:"column:teamId"`
-	UserId   string `json:"userId" gorm:"column:userId"`
+	TeamId   uint   `json:"teamId" gorm:"column:teamId;uniqueIndex:idx_roster_team_user"`
+	UserId   string `json:"userId" gorm:"column:userId;uniqueIndex:idx_roster_team_user"`
 	IsLeader bool   `json:"isLeader" gorm:"column:isLeader"`
+	// Role is MANAGER, MEMBER or the name of a custom role defined on the team.
+	// IsLeader is kept for the MANAGER role.
+	Role string `json:"role" gorm:"column:role;not null;default:''"`
 }
 
 func (Roster) TableName() string {
 	return "Rosters"
 }
+
+// Built-in roster roles, also recorded in membership history
+const (
+	RosterRoleManager = "MANAGER"
+	RosterRoleMember  = "MEMBER"
+)
+
+// RosterInterval records one stretch of a user's time on a team. The interval is open
+// (LeftAt is nil) while the user is still on the roster.
+type RosterInterval struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TeamID    uint       `gorm:"index" json:"teamId"`
+	UserID    string     `gorm:"index" json:"userId"`
+	Role      string     `json:"role"`
+	JoinedAt  time.Time  `gorm:"index" json:"joinedAt"`
+	LeftAt    *time.Time `gorm:"index" json:"leftAt"`
+	AddedBy   string     `json:"addedBy,omitempty"`
+	RemovedBy string     `json:"removedBy,omitempty"`
+}
+
+// RosterRole names the role a roster row grants
+func RosterRole(isLeader bool) string {
+	if isLeader {
+		return RosterRoleManager
+	}
+	return RosterRoleMember
+}
@@ -0,0 +1,63 @@
+package entities
+
+import (
+	"regexp"
+	"time"
+)
+
+// Team permissions granted by roster roles. A permission held on a team also applies to
+// every team below it.
+const (
+	TeamPermManageTeam   = "team:manage"   // settings, sub-teams, moves, managers and role definitions
+	TeamPermManageRoster = "roster:manage" // members, invitations, join requests and role assignments
+	TeamPermViewRoster   = "roster:view"   // roster export, membership history, settings and the org tree
+	TeamPermViewAssets   = "assets:view"   // asset reports for the team and its members
+	TeamPermWriteAssets  = "assets:write"  // creating, editing and deleting notes in team folders
+	TeamPermShare        = "assets:share"  // sharing team folders and notes with other users
+)
+
+// TeamPermissions lists every team permission
+var TeamPermissions = []string{TeamPermManageTeam, TeamPermManageRoster, TeamPermViewRoster, TeamPermViewAssets, TeamPermWriteAssets, TeamPermShare}
+
+// IsValidTeamPermission reports whether permission is one of the team permissions
+func IsValidTeamPermission(permission string) bool {
+	for _, p := range TeamPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// BuiltinRolePermissions returns the permissions of the MANAGER and MEMBER roles every team has.
+// Managers hold every permission; plain members hold none.
+func BuiltinRolePermissions(role string) ([]string, bool) {
+	switch role {
+	case RosterRoleManager:
+		return TeamPermissions, true
+	case RosterRoleMember:
+		return []string{}, true
+	}
+	return nil, false
+}
+
+// teamRoleName keeps custom role names lower-case so they never collide with MANAGER and MEMBER
+var teamRoleName = regexp.MustCompile(`^[a-z][a-z0-9-]{1,31}$`)
+
+// IsValidTeamRoleName reports whether name can be used for a custom team role
+func IsValidTeamRoleName(name string) bool {
+	return teamRoleName.MatchString(name)
+}
+
+// TeamRole is a custom role defined on a team, such as "editor" or "roster-admin".
+// Roster entries refer to it by name.
+type TeamRole struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	TeamID      uint      `gorm:"uniqueIndex:idx_team_roles_team_name" json:"teamId"`
+	Name        string    `gorm:"uniqueIndex:idx_team_roles_team_name" json:"name"`
+	Description string    `json:"description,omitempty"`
+	Permissions []string  `gorm:"serializer:json" json:"permissions"`
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,44 @@
+package entities
+
+import "time"
+
+// Usage scopes: personal assets count against their owner, team-owned ones against the team
+const (
+	UsageScopeUser = "user"
+	UsageScopeTeam = "team"
+)
+
+// Usage holds the running asset counters of a user or a team. The counters are changed in the
+// same transaction as the notes and folders they count.
+type Usage struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	Scope     string    `gorm:"uniqueIndex:idx_usage_subject;not null" json:"scope"`
+	SubjectID string    `gorm:"uniqueIndex:idx_usage_subject;not null" json:"subjectId"`
+	Notes     int64     `gorm:"not null;default:0" json:"notes"`
+	Bytes     int64     `gorm:"not null;default:0" json:"bytes"`
+	Folders   int64     `gorm:"not null;default:0" json:"folders"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (Usage) TableName() string {
+	return "usage_counters"
+}
+
+// UsageDelta is a change to the counters; negative values release usage
+type UsageDelta struct {
+	Notes   int64
+	Bytes   int64
+	Folders int64
+}
+
+// IsZero reports whether the delta changes nothing
+func (d UsageDelta) IsZero() bool {
+	return d.Notes == 0 && d.Bytes == 0 && d.Folders == 0
+}
+
+// QuotaLimits caps the counters of a user or team; zero means unlimited
+type QuotaLimits struct {
+	MaxNotes   int64 `json:"maxNotes"`
+	MaxBytes   int64 `json:"maxBytes"`
+	MaxFolders int64 `json:"maxFolders"`
+}
@@ -1,8 +1,26 @@
 package entities
 
-// User represents a user in the system
+import "time"
+
+// Provisioning sources recorded on directory users. Users added by an ADMIN or
+// picked up from token claims have no source.
+const (
+	UserSourceSCIM = "scim"
+	UserSourceLDIF = "ldif"
+)
+
+// User represents a user in the directory.
+// When a user is present here, their role and active flag take precedence over token claims.
 type User struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Role string `json:"role"` // ADMIN, MANAGER, MEMBER
+	ID         string    `json:"id" gorm:"primaryKey"`
+	Name       string    `json:"name"`
+	GivenName  string    `json:"givenName,omitempty"`
+	FamilyName string    `json:"familyName,omitempty"`
+	Email      string    `json:"email"`
+	Role       string    `json:"role"` // ADMIN, MANAGER, MEMBER
+	Active     bool      `json:"active" gorm:"default:true"`
+	ExternalID string    `json:"externalId,omitempty" gorm:"index"` // identity provider's ID, set by provisioning
+	Source     string    `json:"source,omitempty" gorm:"index"`     // which provisioning manages the user
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
 }
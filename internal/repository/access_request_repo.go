@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"team-service/internal/entities"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AccessRequestRepository interface {
+	WithTx(tx *gorm.DB) AccessRequestRepository
+
+	Create(ctx context.Context, request *entities.AccessRequest) error
+	GetByID(ctx context.Context, id uint) (*entities.AccessRequest, error)
+	// Lock reads a request and locks its row until the surrounding transaction ends
+	Lock(ctx context.Context, id uint) (*entities.AccessRequest, error)
+	HasPending(ctx context.Context, assetType string, assetID uint, requesterID string) (bool, error)
+	// ListInbox returns the requests a user decides, newest first
+	ListInbox(ctx context.Context, inbox AccessRequestInbox) ([]entities.AccessRequest, error)
+	// Decide moves a pending request to status; it reports false if it was no longer pending
+	Decide(ctx context.Context, id uint, status, decidedBy string, at time.Time) (bool, error)
+	// HandOff keeps a pending request pending as a share made by sharedBy, held for the
+	// managers' approval
+	HandOff(ctx context.Context, id uint, sharedBy string) error
+}
+
+// AccessRequestInbox selects requests. Requests users made are selected on OwnerID's personal
+// assets and the assets of SharingTeamIDs; shares held for a manager on the assets of
+// ManagedTeamIDs and their members' personal assets. An empty Status selects all of them.
+type AccessRequestInbox struct {
+	OwnerID        string
+	SharingTeamIDs []uint
+	ManagedTeamIDs []uint
+	Status         string
+}
+
+type accessRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewAccessRequestRepository(db *gorm.DB) AccessRequestRepository {
+	return &accessRequestRepository{db: db}
+}
+
+func (r *accessRequestRepository) WithTx(tx *gorm.DB) AccessRequestRepository {
+	return &accessRequestRepository{db: tx}
+}
+
+func (r *accessRequestRepository) Create(ctx context.Context, request *entities.AccessRequest) error {
+	return r.db.WithContext(ctx).Create(request).Error
+}
+
+func (r *accessRequestRepository) GetByID(ctx context.Context, id uint) (*entities.AccessRequest, error) {
+	var request entities.AccessRequest
+	err := r.db.WithContext(ctx).First(&request, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *accessRequestRepository) Lock(ctx context.Context, id uint) (*entities.AccessRequest, error) {
+	var request entities.AccessRequest
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *accessRequestRepository) HasPending(ctx context.Context, assetType string, assetID uint, requesterID string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entities.AccessRequest{}).
+		Where("asset_type = ? AND asset_id = ? AND requester_id = ? AND status = ?", assetType, assetID, requesterID, entities.AccessRequestPending).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *accessRequestRepository) ListInbox(ctx context.Context, inbox AccessRequestInbox) ([]entities.AccessRequest, error) {
+	db := r.db.WithContext(ctx)
+	onAssets := func(where string, args ...interface{}) *gorm.DB {
+		folders := db.Model(&entities.Folder{}).Select("id").Where(where, args...)
+		notes := db.Model(&entities.Note{}).Select("id").Where(where, args...)
+		return db.Where("(asset_type = ? AND asset_id IN (?)) OR (asset_type = ? AND asset_id IN (?))",
+			entities.AssetFolder, folders, entities.AssetNote, notes)
+	}
+
+	// Team assets belong to the team, not to the member who created them
+	owned := "owner_id = ? AND team_id IS NULL"
+	args := []interface{}{inbox.OwnerID}
+	if len(inbox.SharingTeamIDs) > 0 {
+		owned = "(owner_id = ? AND team_id IS NULL) OR team_id IN ?"
+		args = append(args, inbox.SharingTeamIDs)
+	}
+	scope := db.Where("shared_by = ?", "").Where(onAssets(owned, args...))
+	if len(inbox.ManagedTeamIDs) > 0 {
+		members := db.Model(&entities.Roster{}).Select("userId").Where(map[string]interface{}{"teamId": inbox.ManagedTeamIDs})
+		managed := onAssets("team_id IN ? OR (team_id IS NULL AND owner_id IN (?))", inbox.ManagedTeamIDs, members)
+		scope = scope.Or(db.Where("shared_by <> ?", "").Where(managed))
+	}
+
+	var requests []entities.AccessRequest
+	query := db.Where(scope)
+	if inbox.Status != "" {
+		query = query.Where("status = ?", inbox.Status)
+	}
+	err := query.Order("id DESC").Find(&requests).Error
+	return requests, err
+}
+
+func (r *accessRequestRepository) Decide(ctx context.Context, id uint, status, decidedBy string, at time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&entities.AccessRequest{}).
+		Where("id = ? AND status = ?", id, entities.AccessRequestPending).
+		Updates(map[string]interface{}{"status": status, "decided_by": decidedBy, "decided_at": at})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *accessRequestRepository) HandOff(ctx context.Context, id uint, sharedBy string) error {
+	return r.db.WithContext(ctx).Model(&entities.AccessRequest{}).
+		Where("id = ? AND status = ?", id, entities.AccessRequestPending).
+		Update("shared_by", sharedBy).Error
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"team-service/internal/entities"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type APITokenRepository interface {
+	Create(ctx context.Context, token *entities.APIToken) error
+	GetByID(ctx context.Context, id uint) (*entities.APIToken, error)
+	GetByHash(ctx context.Context, hash string) (*entities.APIToken, error)
+	ListByUser(ctx context.Context, userID, kind string) ([]entities.APIToken, error)
+	ListByKind(ctx context.Context, kind string) ([]entities.APIToken, error)
+	Revoke(ctx context.Context, id uint, at time.Time) error
+	TouchLastUsed(ctx context.Context, id uint, at time.Time) error
+}
+
+type apiTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAPITokenRepository(db *gorm.DB) APITokenRepository {
+	return &apiTokenRepository{db: db}
+}
+
+func (r *apiTokenRepository) Create(ctx context.Context, token *entities.APIToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *apiTokenRepository) GetByID(ctx context.Context, id uint) (*entities.APIToken, error) {
+	var token entities.APIToken
+	err := r.db.WithContext(ctx).First(&token, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *apiTokenRepository) GetByHash(ctx context.Context, hash string) (*entities.APIToken, error) {
+	var token entities.APIToken
+	err := r.db.WithContext(ctx).Where("token_hash = ?", hash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *apiTokenRepository) ListByUser(ctx context.Context, userID, kind string) ([]entities.APIToken, error) {
+	var tokens []entities.APIToken
+	err := r.db.WithContext(ctx).Where("user_id = ? AND kind = ?", userID, kind).Order("id").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *apiTokenRepository) ListByKind(ctx context.Context, kind string) ([]entities.APIToken, error) {
+	var tokens []entities.APIToken
+	err := r.db.WithContext(ctx).Where("kind = ?", kind).Order("id").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *apiTokenRepository) Revoke(ctx context.Context, id uint, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&entities.APIToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at).Error
+}
+
+func (r *apiTokenRepository) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&entities.APIToken{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error
+}
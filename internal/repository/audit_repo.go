@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"team-service/internal/entities"
+
+	"gorm.io/gorm"
+)
+
+// AuditFilter narrows an audit log listing; empty fields match everything
+type AuditFilter struct {
+	ActorID      string
+	Action       string
+	ElevatedOnly bool
+	Limit        int
+	Offset       int
+}
+
+type AuditRepository interface {
+	Create(ctx context.Context, entry *entities.AuditLog) error
+	List(ctx context.Context, filter AuditFilter) ([]entities.AuditLog, int64, error)
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(ctx context.Context, entry *entities.AuditLog) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+func (r *auditRepository) List(ctx context.Context, filter AuditFilter) ([]entities.AuditLog, int64, error) {
+	query := r.db.WithContext(ctx).Model(&entities.AuditLog{})
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ElevatedOnly {
+		query = query.Where("elevated = ?", true)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []entities.AuditLog
+	err := query.Order("id DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&entries).Error
+	return entries, total, err
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Attribute filter operators, named after their SCIM counterparts
+const (
+	FilterEq      = "eq"
+	FilterNe      = "ne"
+	FilterCo      = "co"
+	FilterSw      = "sw"
+	FilterEw      = "ew"
+	FilterPresent = "pr"
+)
+
+// ErrUnsupportedFilter is returned for filters on fields or with operators a search cannot handle
+var ErrUnsupportedFilter = errors.New("unsupported filter")
+
+// AttrFilter compares one searchable field with a value; all filters of a search must match
+type AttrFilter struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// searchColumn describes how a searchable field maps onto a column
+type searchColumn struct {
+	name          string // quoted where the column is camelCase
+	caseExact     bool
+	boolean       bool
+	numericString bool // the field is exposed as a string but stored as an integer
+}
+
+// applyAttrFilters adds the filters to query, rejecting fields that are not searchable
+func applyAttrFilters(query *gorm.DB, filters []AttrFilter, columns map[string]searchColumn) (*gorm.DB, error) {
+	for _, f := range filters {
+		col, ok := columns[f.Field]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not searchable", ErrUnsupportedFilter, f.Field)
+		}
+
+		if f.Op == FilterPresent {
+			if col.boolean || col.numericString {
+				query = query.Where(col.name + " IS NOT NULL")
+			} else {
+				query = query.Where(col.name + " IS NOT NULL AND " + col.name + " <> ''")
+			}
+			continue
+		}
+
+		var value interface{} = f.Value
+		switch {
+		case col.boolean:
+			b, err := strconv.ParseBool(f.Value)
+			if err != nil || (f.Op != FilterEq && f.Op != FilterNe) {
+				return nil, fmt.Errorf("%w: %s only supports eq and ne with true or false", ErrUnsupportedFilter, f.Field)
+			}
+			value = b
+		case col.numericString:
+			n, err := strconv.ParseUint(f.Value, 10, 64)
+			if err != nil || (f.Op != FilterEq && f.Op != FilterNe) {
+				// No row can match an ID that is not a number
+				if f.Op == FilterNe {
+					continue
+				}
+				query = query.Where("1 = 0")
+				continue
+			}
+			value = n
+		}
+
+		column, placeholder := col.name, "?"
+		if !col.caseExact && !col.boolean && !col.numericString {
+			column, placeholder = "LOWER("+col.name+")", "LOWER(?)"
+		}
+
+		switch f.Op {
+		case FilterEq:
+			query = query.Where(column+" = "+placeholder, value)
+		case FilterNe:
+			query = query.Where(column+" <> "+placeholder, value)
+		case FilterCo:
+			query = query.Where(column+" LIKE "+placeholder+likeEscape, "%"+escapeLike(f.Value)+"%")
+		case FilterSw:
+			query = query.Where(column+" LIKE "+placeholder+likeEscape, escapeLike(f.Value)+"%")
+		case FilterEw:
+			query = query.Where(column+" LIKE "+placeholder+likeEscape, "%"+escapeLike(f.Value))
+		default:
+			return nil, fmt.Errorf("%w: operator %s", ErrUnsupportedFilter, f.Op)
+		}
+	}
+	return query, nil
+}
+
+// likeEscape makes backslash the LIKE escape character on every supported database
+const likeEscape = ` ESCAPE '\'`
+
+// escapeLike keeps LIKE wildcards in user input literal
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
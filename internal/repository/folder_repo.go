@@ -1,18 +1,22 @@
 package repository
 
 import (
+	"context"
 	"team-service/internal/entities"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type FolderRepository interface {
-	Create(folder *entities.Folder) error
-	GetByID(id uint) (*entities.Folder, error)
-	GetByIDWithAccess(id uint, userID string) (*entities.Folder, error)
-	Update(folder *entities.Folder) error
-	Delete(id uint) error
-	GetByOwnerID(ownerID string) ([]entities.Folder, error)
+	WithTx(tx *gorm.DB) FolderRepository
+	Create(ctx context.Context, folder *entities.Folder) error
+	GetByID(ctx context.Context, id uint) (*entities.Folder, error)
+	GetByIDWithAccess(ctx context.Context, id uint, userID string) (*entities.Folder, error)
+	Update(ctx context.Context, folder *entities.Folder) error
+	Delete(ctx context.Context, id uint) error
+	GetByOwnerID(ctx context.Context, ownerID string) ([]entities.Folder, error)
+	GetByTeamID(ctx context.Context, teamID uint) ([]entities.Folder, error)
 }
 
 type folderRepository struct {
@@ -23,28 +27,29 @@ func NewFolderRepository(db *gorm.DB) FolderRepository {
 	return &folderRepository{db: db}
 }
 
-func (r *folderRepository) Create(folder *entities.Folder) error {
-	return r.db.Create(folder).Error
+func (r *folderRepository) WithTx(tx *gorm.DB) FolderRepository {
+	return &folderRepository{db: tx}
 }
 
-func (r *folderRepository) GetByID(id uint) (*entities.Folder, error) {
+func (r *folderRepository) Create(ctx context.Context, folder *entities.Folder) error {
+	return r.db.WithContext(ctx).Create(folder).Error
+}
+
+func (r *folderRepository) GetByID(ctx context.Context, id uint) (*entities.Folder, error) {
 	var folder entities.Folder
-	err := r.db.Preload("Notes").First(&folder, id).Error
+	err := r.db.WithContext(ctx).Preload("Notes").First(&folder, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &folder, nil
 }
 
-func (r *folderRepository) GetByIDWithAccess(id uint, userID string) (*entities.Folder, error) {
+func (r *folderRepository) GetByIDWithAccess(ctx context.Context, id uint, userID string) (*entities.Folder, error) {
 	var folder entities.Folder
-	err := r.db.Preload("Notes").
-		Where(`
-			id = ? AND (
-				owner_id = ? OR 
-				id IN (SELECT folder_id FROM folder_shares WHERE user_id = ?)
-			)
-		`, id, userID, userID).
+	sharedFolderIDs := r.db.Model(&entities.FolderShare{}).Select("folder_id").Where("user_id = ?", userID).Where(unexpiredShare, time.Now())
+	err := r.db.WithContext(ctx).Preload("Notes").
+		Where("id = ?", id).
+		Where(r.db.Where("owner_id = ?", userID).Or("id IN (?)", sharedFolderIDs)).
 		First(&folder).Error
 	if err != nil {
 		return nil, err
@@ -52,16 +57,22 @@ func (r *folderRepository) GetByIDWithAccess(id uint, userID string) (*entities.
 	return &folder, nil
 }
 
-func (r *folderRepository) Update(folder *entities.Folder) error {
-	return r.db.Save(folder).Error
+func (r *folderRepository) Update(ctx context.Context, folder *entities.Folder) error {
+	return r.db.WithContext(ctx).Save(folder).Error
+}
+
+func (r *folderRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&entities.Folder{}, id).Error
 }
 
-func (r *folderRepository) Delete(id uint) error {
-	return r.db.Delete(&entities.Folder{}, id).Error
+func (r *folderRepository) GetByTeamID(ctx context.Context, teamID uint) ([]entities.Folder, error) {
+	var folders []entities.Folder
+	err := r.db.WithContext(ctx).Where("team_id = ?", teamID).Order("name").Find(&folders).Error
+	return folders, err
 }
 
-func (r *folderRepository) GetByOwnerID(ownerID string) ([]entities.Folder, error) {
+func (r *folderRepository) GetByOwnerID(ctx context.Context, ownerID string) ([]entities.Folder, error) {
 	var folders []entities.Folder
-	err := r.db.Where("owner_id = ?", ownerID).Find(&folders).Error
+	err := r.db.WithContext(ctx).Where("owner_id = ?", ownerID).Find(&folders).Error
 	return folders, err
 }
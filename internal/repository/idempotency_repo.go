@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"team-service/internal/entities"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyRepository interface {
+	// Insert claims the key; it reports false when a record for the user and key already exists
+	Insert(ctx context.Context, record *entities.IdempotencyRecord) (bool, error)
+	Get(ctx context.Context, userID, key string) (*entities.IdempotencyRecord, error)
+	Complete(ctx context.Context, id uint, status int, contentType, body string) error
+	Delete(ctx context.Context, id uint) error
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+func (r *idempotencyRepository) Insert(ctx context.Context, record *entities.IdempotencyRecord) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *idempotencyRepository) Get(ctx context.Context, userID, key string) (*entities.IdempotencyRecord, error) {
+	var record entities.IdempotencyRecord
+	err := r.db.WithContext(ctx).Where("user_id = ? AND idempotency_key = ?", userID, key).First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *idempotencyRepository) Complete(ctx context.Context, id uint, status int, contentType, body string) error {
+	return r.db.WithContext(ctx).Model(&entities.IdempotencyRecord{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": status, "content_type": contentType, "body": body}).Error
+}
+
+func (r *idempotencyRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&entities.IdempotencyRecord{}, id).Error
+}
+
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&entities.IdempotencyRecord{})
+	return result.RowsAffected, result.Error
+}
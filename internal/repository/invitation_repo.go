@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"team-service/internal/entities"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type InvitationRepository interface {
+	WithTx(tx *gorm.DB) InvitationRepository
+
+	Create(ctx context.Context, invitation *entities.TeamInvitation) error
+	GetByID(ctx context.Context, id uint) (*entities.TeamInvitation, error)
+	ListByTeam(ctx context.Context, teamID uint) ([]entities.TeamInvitation, error)
+	ListPendingForInvitee(ctx context.Context, userID, email string, now time.Time) ([]entities.TeamInvitation, error)
+	HasPending(ctx context.Context, teamID uint, inviteeID, email string, now time.Time) (bool, error)
+	// Respond moves a pending, unexpired invitation to status; it reports false if it was no longer pending
+	Respond(ctx context.Context, id uint, status, acceptedBy string, at time.Time) (bool, error)
+}
+
+type invitationRepository struct {
+	db *gorm.DB
+}
+
+func NewInvitationRepository(db *gorm.DB) InvitationRepository {
+	return &invitationRepository{db: db}
+}
+
+func (r *invitationRepository) WithTx(tx *gorm.DB) InvitationRepository {
+	return &invitationRepository{db: tx}
+}
+
+func (r *invitationRepository) Create(ctx context.Context, invitation *entities.TeamInvitation) error {
+	return r.db.WithContext(ctx).Create(invitation).Error
+}
+
+func (r *invitationRepository) GetByID(ctx context.Context, id uint) (*entities.TeamInvitation, error) {
+	var invitation entities.TeamInvitation
+	err := r.db.WithContext(ctx).First(&invitation, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *invitationRepository) ListByTeam(ctx context.Context, teamID uint) ([]entities.TeamInvitation, error) {
+	var invitations []entities.TeamInvitation
+	err := r.db.WithContext(ctx).Where("team_id = ?", teamID).Order("id DESC").Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *invitationRepository) ListPendingForInvitee(ctx context.Context, userID, email string, now time.Time) ([]entities.TeamInvitation, error) {
+	var invitations []entities.TeamInvitation
+	query := r.db.WithContext(ctx).Where("status = ? AND expires_at > ?", entities.InvitationPending, now)
+	if email != "" {
+		query = query.Where("invitee_id = ? OR LOWER(invitee_email) = LOWER(?)", userID, email)
+	} else {
+		query = query.Where("invitee_id = ?", userID)
+	}
+	err := query.Order("id DESC").Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *invitationRepository) HasPending(ctx context.Context, teamID uint, inviteeID, email string, now time.Time) (bool, error) {
+	query := r.db.WithContext(ctx).Model(&entities.TeamInvitation{}).
+		Where("team_id = ? AND status = ? AND expires_at > ?", teamID, entities.InvitationPending, now)
+	if inviteeID != "" {
+		query = query.Where("invitee_id = ?", inviteeID)
+	} else {
+		query = query.Where("LOWER(invitee_email) = LOWER(?)", email)
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	return count > 0, err
+}
+
+func (r *invitationRepository) Respond(ctx context.Context, id uint, status, acceptedBy string, at time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&entities.TeamInvitation{}).
+		Where("id = ? AND status = ? AND expires_at > ?", id, entities.InvitationPending, at).
+		Updates(map[string]interface{}{"status": status, "accepted_by": acceptedBy, "responded_at": at})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"team-service/internal/entities"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type JoinRequestRepository interface {
+	WithTx(tx *gorm.DB) JoinRequestRepository
+
+	Create(ctx context.Context, request *entities.JoinRequest) error
+	GetByID(ctx context.Context, id uint) (*entities.JoinRequest, error)
+	// ListByTeam returns the team's requests, newest first; an empty status lists all of them
+	ListByTeam(ctx context.Context, teamID uint, status string) ([]entities.JoinRequest, error)
+	HasPending(ctx context.Context, teamID uint, userID string) (bool, error)
+	// Decide moves a pending request to status; it reports false if it was no longer pending
+	Decide(ctx context.Context, id uint, status, decidedBy string, at time.Time) (bool, error)
+}
+
+type joinRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewJoinRequestRepository(db *gorm.DB) JoinRequestRepository {
+	return &joinRequestRepository{db: db}
+}
+
+func (r *joinRequestRepository) WithTx(tx *gorm.DB) JoinRequestRepository {
+	return &joinRequestRepository{db: tx}
+}
+
+func (r *joinRequestRepository) Create(ctx context.Context, request *entities.JoinRequest) error {
+	return r.db.WithContext(ctx).Create(request).Error
+}
+
+func (r *joinRequestRepository) GetByID(ctx context.Context, id uint) (*entities.JoinRequest, error) {
+	var request entities.JoinRequest
+	err := r.db.WithContext(ctx).First(&request, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *joinRequestRepository) ListByTeam(ctx context.Context, teamID uint, status string) ([]entities.JoinRequest, error) {
+	var requests []entities.JoinRequest
+	query := r.db.WithContext(ctx).Where("team_id = ?", teamID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("id DESC").Find(&requests).Error
+	return requests, err
+}
+
+func (r *joinRequestRepository) HasPending(ctx context.Context, teamID uint, userID string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entities.JoinRequest{}).
+		Where("team_id = ? AND user_id = ? AND status = ?", teamID, userID, entities.JoinRequestPending).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *joinRequestRepository) Decide(ctx context.Context, id uint, status, decidedBy string, at time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&entities.JoinRequest{}).
+		Where("id = ? AND status = ?", id, entities.JoinRequestPending).
+		Updates(map[string]interface{}{"status": status, "decided_by": decidedBy, "decided_at": at})
+	return result.RowsAffected > 0, result.Error
+}
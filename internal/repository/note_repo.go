@@ -1,19 +1,22 @@
 package repository
 
 import (
+	"context"
 	"team-service/internal/entities"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type NoteRepository interface {
-	Create(note *entities.Note) error
-	GetByID(id uint) (*entities.Note, error)
-	GetByIDWithAccess(id uint, userID string) (*entities.Note, error)
-	Update(note *entities.Note) error
-	Delete(id uint) error
-	GetByFolderID(folderID uint) ([]entities.Note, error)
-	GetByOwnerID(ownerID string) ([]entities.Note, error)
+	WithTx(tx *gorm.DB) NoteRepository
+	Create(ctx context.Context, note *entities.Note) error
+	GetByID(ctx context.Context, id uint) (*entities.Note, error)
+	GetByIDWithAccess(ctx context.Context, id uint, userID string) (*entities.Note, error)
+	Update(ctx context.Context, note *entities.Note) error
+	Delete(ctx context.Context, id uint) error
+	GetByFolderID(ctx context.Context, folderID uint) ([]entities.Note, error)
+	GetByOwnerID(ctx context.Context, ownerID string) ([]entities.Note, error)
 }
 
 type noteRepository struct {
@@ -24,49 +27,51 @@ func NewNoteRepository(db *gorm.DB) NoteRepository {
 	return &noteRepository{db: db}
 }
 
-func (r *noteRepository) Create(note *entities.Note) error {
-	return r.db.Create(note).Error
+func (r *noteRepository) WithTx(tx *gorm.DB) NoteRepository {
+	return &noteRepository{db: tx}
 }
 
-func (r *noteRepository) GetByID(id uint) (*entities.Note, error) {
+func (r *noteRepository) Create(ctx context.Context, note *entities.Note) error {
+	return r.db.WithContext(ctx).Create(note).Error
+}
+
+func (r *noteRepository) GetByID(ctx context.Context, id uint) (*entities.Note, error) {
 	var note entities.Note
-	err := r.db.First(&note, id).Error
+	err := r.db.WithContext(ctx).First(&note, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &note, nil
 }
 
-func (r *noteRepository) GetByIDWithAccess(id uint, userID string) (*entities.Note, error) {
+func (r *noteRepository) GetByIDWithAccess(ctx context.Context, id uint, userID string) (*entities.Note, error) {
 	var note entities.Note
-	err := r.db.Where(`
-		id = ? AND (
-			owner_id = ? OR 
-			id IN (SELECT note_id FROM note_shares WHERE user_id = ?)
-		)
-	`, id, userID, userID).First(&note).Error
+	sharedNoteIDs := r.db.Model(&entities.NoteShare{}).Select("note_id").Where("user_id = ?", userID).Where(unexpiredShare, time.Now())
+	err := r.db.WithContext(ctx).Where("id = ?", id).
+		Where(r.db.Where("owner_id = ?", userID).Or("id IN (?)", sharedNoteIDs)).
+		First(&note).Error
 	if err != nil {
 		return nil, err
 	}
 	return &note, nil
 }
 
-func (r *noteRepository) Update(note *entities.Note) error {
-	return r.db.Save(note).Error
+func (r *noteRepository) Update(ctx context.Context, note *entities.Note) error {
+	return r.db.WithContext(ctx).Save(note).Error
 }
 
-func (r *noteRepository) Delete(id uint) error {
-	return r.db.Delete(&entities.Note{}, id).Error
+func (r *noteRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&entities.Note{}, id).Error
 }
 
-func (r *noteRepository) GetByFolderID(folderID uint) ([]entities.Note, error) {
+func (r *noteRepository) GetByFolderID(ctx context.Context, folderID uint) ([]entities.Note, error) {
 	var notes []entities.Note
-	err := r.db.Where("folder_id = ?", folderID).Find(&notes).Error
+	err := r.db.WithContext(ctx).Where("folder_id = ?", folderID).Find(&notes).Error
 	return notes, err
 }
 
-func (r *noteRepository) GetByOwnerID(ownerID string) ([]entities.Note, error) {
+func (r *noteRepository) GetByOwnerID(ctx context.Context, ownerID string) ([]entities.Note, error) {
 	var notes []entities.Note
-	err := r.db.Where("owner_id = ?", ownerID).Find(&notes).Error
+	err := r.db.WithContext(ctx).Where("owner_id = ?", ownerID).Find(&notes).Error
 	return notes, err
 }
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"team-service/internal/entities"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SessionRepository interface {
+	RevokeToken(ctx context.Context, token *entities.RevokedToken) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	PurgeExpiredRevocations(ctx context.Context, before time.Time) (int64, error)
+	SetWatermark(ctx context.Context, watermark *entities.SessionWatermark) error
+	GetWatermark(ctx context.Context, userID string) (*entities.SessionWatermark, error)
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) RevokeToken(ctx context.Context, token *entities.RevokedToken) error {
+	// Revoking an already revoked jti is a no-op
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+}
+
+func (r *sessionRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entities.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *sessionRepository) PurgeExpiredRevocations(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&entities.RevokedToken{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *sessionRepository) SetWatermark(ctx context.Context, watermark *entities.SessionWatermark) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"valid_after", "updated_by", "updated_at"}),
+	}).Create(watermark).Error
+}
+
+func (r *sessionRepository) GetWatermark(ctx context.Context, userID string) (*entities.SessionWatermark, error) {
+	var watermark entities.SessionWatermark
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&watermark).Error
+	if err != nil {
+		return nil, err
+	}
+	return &watermark, nil
+}
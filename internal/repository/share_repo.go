@@ -1,31 +1,41 @@
 package repository
 
 import (
+	"context"
 	"team-service/internal/entities"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type ShareRepository interface {
+	WithTx(tx *gorm.DB) ShareRepository
+
 	// Folder sharing
-	CreateFolderShare(share *entities.FolderShare) error
-	UpdateFolderShare(share *entities.FolderShare) error
-	DeleteFolderShare(folderID uint, userID string) error
-	GetFolderShare(folderID uint, userID string) (*entities.FolderShare, error)
-	GetFolderShares(folderID uint) ([]entities.FolderShare, error)
+	CreateFolderShare(ctx context.Context, share *entities.FolderShare) error
+	UpdateFolderShare(ctx context.Context, share *entities.FolderShare) error
+	DeleteFolderShare(ctx context.Context, folderID uint, userID string) error
+	GetFolderShare(ctx context.Context, folderID uint, userID string) (*entities.FolderShare, error)
+	GetFolderShares(ctx context.Context, folderID uint) ([]entities.FolderShare, error)
 
 	// Note sharing
-	CreateNoteShare(share *entities.NoteShare) error
-	UpdateNoteShare(share *entities.NoteShare) error
-	DeleteNoteShare(noteID uint, userID string) error
-	GetNoteShare(noteID uint, userID string) (*entities.NoteShare, error)
-	GetNoteShares(noteID uint) ([]entities.NoteShare, error)
+	CreateNoteShare(ctx context.Context, share *entities.NoteShare) error
+	UpdateNoteShare(ctx context.Context, share *entities.NoteShare) error
+	DeleteNoteShare(ctx context.Context, noteID uint, userID string) error
+	GetNoteShare(ctx context.Context, noteID uint, userID string) (*entities.NoteShare, error)
+	GetNoteShares(ctx context.Context, noteID uint) ([]entities.NoteShare, error)
 
 	// Bulk operations
-	DeleteNoteSharesByNoteID(noteID uint) error
-	DeleteFolderSharesByFolderID(folderID uint) error
+	DeleteNoteSharesByNoteID(ctx context.Context, noteID uint) error
+	DeleteFolderSharesByFolderID(ctx context.Context, folderID uint) error
+	// DeleteExpired removes folder and note shares that expired before the given time
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
 }
 
+// unexpiredShare matches shares that still grant access; the Get methods and every access
+// check only see those
+const unexpiredShare = "expires_at IS NULL OR expires_at > ?"
+
 type shareRepository struct {
 	db *gorm.DB
 }
@@ -34,67 +44,86 @@ func NewShareRepository(db *gorm.DB) ShareRepository {
 	return &shareRepository{db: db}
 }
 
+func (r *shareRepository) WithTx(tx *gorm.DB) ShareRepository {
+	return &shareRepository{db: tx}
+}
+
 // Folder sharing methods
-func (r *shareRepository) CreateFolderShare(share *entities.FolderShare) error {
-	return r.db.Create(share).Error
+func (r *shareRepository) CreateFolderShare(ctx context.Context, share *entities.FolderShare) error {
+	return r.db.WithContext(ctx).Create(share).Error
 }
 
-func (r *shareRepository) UpdateFolderShare(share *entities.FolderShare) error {
-	return r.db.Save(share).Error
+func (r *shareRepository) UpdateFolderShare(ctx context.Context, share *entities.FolderShare) error {
+	return r.db.WithContext(ctx).Save(share).Error
 }
 
-func (r *shareRepository) DeleteFolderShare(folderID uint, userID string) error {
-	return r.db.Where("folder_id = ? AND user_id = ?", folderID, userID).Delete(&entities.FolderShare{}).Error
+func (r *shareRepository) DeleteFolderShare(ctx context.Context, folderID uint, userID string) error {
+	return r.db.WithContext(ctx).Where("folder_id = ? AND user_id = ?", folderID, userID).Delete(&entities.FolderShare{}).Error
 }
 
-func (r *shareRepository) GetFolderShare(folderID uint, userID string) (*entities.FolderShare, error) {
+func (r *shareRepository) GetFolderShare(ctx context.Context, folderID uint, userID string) (*entities.FolderShare, error) {
 	var share entities.FolderShare
-	err := r.db.Where("folder_id = ? AND user_id = ?", folderID, userID).First(&share).Error
+	err := r.db.WithContext(ctx).Where("folder_id = ? AND user_id = ?", folderID, userID).Where(unexpiredShare, time.Now()).First(&share).Error
 	if err != nil {
 		return nil, err
 	}
 	return &share, nil
 }
 
-func (r *shareRepository) GetFolderShares(folderID uint) ([]entities.FolderShare, error) {
+func (r *shareRepository) GetFolderShares(ctx context.Context, folderID uint) ([]entities.FolderShare, error) {
 	var shares []entities.FolderShare
-	err := r.db.Where("folder_id = ?", folderID).Find(&shares).Error
+	err := r.db.WithContext(ctx).Where("folder_id = ?", folderID).Where(unexpiredShare, time.Now()).Find(&shares).Error
 	return shares, err
 }
 
 // Note sharing methods
-func (r *shareRepository) CreateNoteShare(share *entities.NoteShare) error {
-	return r.db.Create(share).Error
+func (r *shareRepository) CreateNoteShare(ctx context.Context, share *entities.NoteShare) error {
+	return r.db.WithContext(ctx).Create(share).Error
 }
 
-func (r *shareRepository) UpdateNoteShare(share *entities.NoteShare) error {
-	return r.db.Save(share).Error
+func (r *shareRepository) UpdateNoteShare(ctx context.Context, share *entities.NoteShare) error {
+	return r.db.WithContext(ctx).Save(share).Error
 }
 
-func (r *shareRepository) DeleteNoteShare(noteID uint, userID string) error {
-	return r.db.Where("note_id = ? AND user_id = ?", noteID, userID).Delete(&entities.NoteShare{}).Error
+func (r *shareRepository) DeleteNoteShare(ctx context.Context, noteID uint, userID string) error {
+	return r.db.WithContext(ctx).Where("note_id = ? AND user_id = ?", noteID, userID).Delete(&entities.NoteShare{}).Error
 }
 
-func (r *shareRepository) GetNoteShare(noteID uint, userID string) (*entities.NoteShare, error) {
+func (r *shareRepository) GetNoteShare(ctx context.Context, noteID uint, userID string) (*entities.NoteShare, error) {
 	var share entities.NoteShare
-	err := r.db.Where("note_id = ? AND user_id = ?", noteID, userID).First(&share).Error
+	err := r.db.WithContext(ctx).Where("note_id = ? AND user_id = ?", noteID, userID).Where(unexpiredShare, time.Now()).First(&share).Error
 	if err != nil {
 		return nil, err
 	}
 	return &share, nil
 }
 
-func (r *shareRepository) GetNoteShares(noteID uint) ([]entities.NoteShare, error) {
+func (r *shareRepository) GetNoteShares(ctx context.Context, noteID uint) ([]entities.NoteShare, error) {
 	var shares []entities.NoteShare
-	err := r.db.Where("note_id = ?", noteID).Find(&shares).Error
+	err := r.db.WithContext(ctx).Where("note_id = ?", noteID).Where(unexpiredShare, time.Now()).Find(&shares).Error
 	return shares, err
 }
 
 // Bulk operations
-func (r *shareRepository) DeleteNoteSharesByNoteID(noteID uint) error {
-	return r.db.Where("note_id = ?", noteID).Delete(&entities.NoteShare{}).Error
+func (r *shareRepository) DeleteNoteSharesByNoteID(ctx context.Context, noteID uint) error {
+	return r.db.WithContext(ctx).Where("note_id = ?", noteID).Delete(&entities.NoteShare{}).Error
+}
+
+func (r *shareRepository) DeleteFolderSharesByFolderID(ctx context.Context, folderID uint) error {
+	return r.db.WithContext(ctx).Where("folder_id = ?", folderID).Delete(&entities.FolderShare{}).Error
 }
 
-func (r *shareRepository) DeleteFolderSharesByFolderID(folderID uint) error {
-	return r.db.Where("folder_id = ?", folderID).Delete(&entities.FolderShare{}).Error
+func (r *shareRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("expires_at <= ?", before).Delete(&entities.FolderShare{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+		result = tx.Where("expires_at <= ?", before).Delete(&entities.NoteShare{})
+		purged += result.RowsAffected
+		return result.Error
+	})
+	return purged, err
 }
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"team-service/internal/entities"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SharingPolicyRepository interface {
+	WithTx(tx *gorm.DB) SharingPolicyRepository
+	// Get returns the policy of a team, or the global policy for GlobalSharingPolicy
+	Get(ctx context.Context, teamID uint) (*entities.SharingPolicy, error)
+	// List returns every policy, the global one first
+	List(ctx context.Context) ([]entities.SharingPolicy, error)
+	// ListForTeams returns the policies of the given teams; include GlobalSharingPolicy for the global one
+	ListForTeams(ctx context.Context, teamIDs []uint) ([]entities.SharingPolicy, error)
+	// Save creates the team's policy or replaces its rules
+	Save(ctx context.Context, policy *entities.SharingPolicy) error
+	Delete(ctx context.Context, teamID uint) error
+}
+
+type sharingPolicyRepository struct {
+	db *gorm.DB
+}
+
+func NewSharingPolicyRepository(db *gorm.DB) SharingPolicyRepository {
+	return &sharingPolicyRepository{db: db}
+}
+
+func (r *sharingPolicyRepository) WithTx(tx *gorm.DB) SharingPolicyRepository {
+	return &sharingPolicyRepository{db: tx}
+}
+
+func (r *sharingPolicyRepository) Get(ctx context.Context, teamID uint) (*entities.SharingPolicy, error) {
+	var policy entities.SharingPolicy
+	err := r.db.WithContext(ctx).Where("team_id = ?", teamID).First(&policy).Error
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *sharingPolicyRepository) List(ctx context.Context) ([]entities.SharingPolicy, error) {
+	var policies []entities.SharingPolicy
+	err := r.db.WithContext(ctx).Order("team_id").Find(&policies).Error
+	return policies, err
+}
+
+func (r *sharingPolicyRepository) ListForTeams(ctx context.Context, teamIDs []uint) ([]entities.SharingPolicy, error) {
+	var policies []entities.SharingPolicy
+	err := r.db.WithContext(ctx).Where("team_id IN ?", teamIDs).Order("team_id").Find(&policies).Error
+	return policies, err
+}
+
+func (r *sharingPolicyRepository) Save(ctx context.Context, policy *entities.SharingPolicy) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "team_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"within_teams", "directory_users_only", "write_requires_manager", "max_share_days", "updated_by", "updated_at",
+		}),
+	}).Create(policy).Error
+}
+
+func (r *sharingPolicyRepository) Delete(ctx context.Context, teamID uint) error {
+	result := r.db.WithContext(ctx).Where("team_id = ?", teamID).Delete(&entities.SharingPolicy{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
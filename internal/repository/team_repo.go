@@ -1,27 +1,83 @@
 package repository
 
 import (
+	"context"
 	"team-service/internal/entities"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TeamRepository interface {
-	Create(team *entities.Team) error
-	GetByID(id uint) (*entities.Team, error)
-	Update(team *entities.Team) error
-	Delete(id uint) error
+	// WithTx returns a repository that runs its queries in tx
+	WithTx(tx *gorm.DB) TeamRepository
 
-	// Roster operations
-	CreateRoster(roster *entities.Roster) error
-	DeleteRoster(teamID uint, userID string, isLeader bool) error
-	GetRosterByTeamAndUser(teamID uint, userID string) (*entities.Roster, error)
-	GetTeamMembers(teamID uint) ([]entities.Roster, error)
-	IsUserManagerOfTeam(userID string, teamID uint) (bool, error)
-	IsUserMemberOfTeam(userID string, teamID uint) (bool, error)
-	GetUsersByTeamID(teamID uint) ([]string, error)
+	Create(ctx context.Context, team *entities.Team) error
+	GetByID(ctx context.Context, id uint) (*entities.Team, error)
+	Update(ctx context.Context, team *entities.Team) error
+	// LockTeams locks the teams' rows until the surrounding transaction ends. Rows are locked
+	// in ID order, so callers locking overlapping sets queue up instead of deadlocking.
+	LockTeams(ctx context.Context, ids []uint) error
+	Delete(ctx context.Context, id uint) error
+	List(ctx context.Context, limit, offset int) ([]entities.Team, int64, error)
+	GetByIDs(ctx context.Context, ids []uint) ([]entities.Team, error)
+	// Search lists teams matching every filter, ordered by ID. Searchable fields are
+	// id, displayName (the team name), externalId and createdBy.
+	Search(ctx context.Context, filters []AttrFilter, limit, offset int) ([]entities.Team, int64, error)
+
+	// Org tree. Both walks stop after MaxTeamDepth levels.
+	// AncestorIDs lists the team's parent, grandparent and so on, nearest first
+	AncestorIDs(ctx context.Context, teamID uint) ([]uint, error)
+	// DescendantIDs lists every team below the team, shallowest first
+	DescendantIDs(ctx context.Context, teamID uint) ([]uint, error)
+
+	// Roster operations. Every change also opens or closes the user's interval in the
+	// membership history, attributed to actorID.
+	CreateRoster(ctx context.Context, roster *entities.Roster, actorID string) error
+	// DeleteRoster returns gorm.ErrRecordNotFound when no such roster row exists
+	DeleteRoster(ctx context.Context, teamID uint, userID string, isLeader bool, actorID string) error
+	// UpdateRosterRole switches a user between member and manager, closing the interval for
+	// the old role and opening one for the new
+	UpdateRosterRole(ctx context.Context, teamID uint, userID string, isLeader bool, actorID string) error
+	// SetRosterRole gives a user on the roster a built-in or custom role. It returns
+	// gorm.ErrRecordNotFound when the user is not on the roster.
+	SetRosterRole(ctx context.Context, teamID uint, userID, role, actorID string) error
+	GetRosterByTeamAndUser(ctx context.Context, teamID uint, userID string) (*entities.Roster, error)
+	GetTeamMembers(ctx context.Context, teamID uint) ([]entities.Roster, error)
+	// LockRoster returns the team's roster with its rows locked until the surrounding
+	// transaction ends
+	LockRoster(ctx context.Context, teamID uint) ([]entities.Roster, error)
+	GetRostersByUser(ctx context.Context, userID string) ([]entities.Roster, error)
+	// UserPermissions is the union of the permissions granted by the user's roles on the team
+	// and on every ancestor team
+	UserPermissions(ctx context.Context, userID string, teamID uint) ([]string, error)
+	HasPermission(ctx context.Context, userID string, teamID uint, permission string) (bool, error)
+	CountRosterWithRole(ctx context.Context, teamID uint, role string) (int64, error)
+	IsUserMemberOfTeam(ctx context.Context, userID string, teamID uint) (bool, error)
+	// IsUserInTeamTree reports whether the user is on the roster of the team or of an ancestor
+	IsUserInTeamTree(ctx context.Context, userID string, teamID uint) (bool, error)
+	// OwnsFolders reports whether any team-owned folder belongs to the team
+	OwnsFolders(ctx context.Context, teamID uint) (bool, error)
+	GetUsersByTeamID(ctx context.Context, teamID uint) ([]string, error)
+	GetUsersByTeamIDs(ctx context.Context, teamIDs []uint) ([]string, error)
+
+	// Membership history
+	ListRosterIntervals(ctx context.Context, filter RosterIntervalFilter) ([]entities.RosterInterval, error)
+	GetUsersByTeamIDsAt(ctx context.Context, teamIDs []uint, at time.Time) ([]string, error)
 }
 
+// RosterIntervalFilter narrows membership history; zero values match everything.
+// At keeps only the intervals that cover that instant.
+type RosterIntervalFilter struct {
+	TeamID uint
+	UserID string
+	At     *time.Time
+}
+
+// MaxTeamDepth is the deepest an org tree may grow, counting the root team as level 1
+const MaxTeamDepth = 16
+
 type teamRepository struct {
 	db *gorm.DB
 }
@@ -30,71 +86,352 @@ func NewTeamRepository(db *gorm.DB) TeamRepository {
 	return &teamRepository{db: db}
 }
 
-func (r *teamRepository) Create(team *entities.Team) error {
-	return r.db.Create(team).Error
+func (r *teamRepository) WithTx(tx *gorm.DB) TeamRepository {
+	return &teamRepository{db: tx}
 }
 
-func (r *teamRepository) GetByID(id uint) (*entities.Team, error) {
+func (r *teamRepository) Create(ctx context.Context, team *entities.Team) error {
+	return r.db.WithContext(ctx).Create(team).Error
+}
+
+func (r *teamRepository) GetByID(ctx context.Context, id uint) (*entities.Team, error) {
 	var team entities.Team
-	err := r.db.First(&team, id).Error
+	err := r.db.WithContext(ctx).First(&team, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &team, nil
 }
 
-func (r *teamRepository) Update(team *entities.Team) error {
-	return r.db.Save(team).Error
+func (r *teamRepository) Update(ctx context.Context, team *entities.Team) error {
+	return r.db.WithContext(ctx).Save(team).Error
+}
+
+func (r *teamRepository) LockTeams(ctx context.Context, ids []uint) error {
+	var locked []uint
+	return r.db.WithContext(ctx).Model(&entities.Team{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where(map[string]interface{}{"teamId": ids}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "teamId"}}).
+		Pluck("teamId", &locked).Error
+}
+
+// Delete removes the team together with its custom role definitions
+func (r *teamRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("team_id = ?", id).Delete(&entities.TeamRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entities.Team{}, id).Error
+	})
+}
+
+func (r *teamRepository) List(ctx context.Context, limit, offset int) ([]entities.Team, int64, error) {
+	var total int64
+	if err := r.db.WithContext(ctx).Model(&entities.Team{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var teams []entities.Team
+	err := r.db.WithContext(ctx).Order(clause.OrderByColumn{Column: clause.Column{Name: "teamId"}}).Limit(limit).Offset(offset).Find(&teams).Error
+	return teams, total, err
+}
+
+func (r *teamRepository) GetByIDs(ctx context.Context, ids []uint) ([]entities.Team, error) {
+	var teams []entities.Team
+	if len(ids) == 0 {
+		return teams, nil
+	}
+	err := r.db.WithContext(ctx).Where(map[string]interface{}{"teamId": ids}).Find(&teams).Error
+	return teams, err
+}
+
+var teamSearchColumns = map[string]searchColumn{
+	"id":          {name: `"teamId"`, numericString: true},
+	"displayName": {name: `"teamName"`},
+	"externalId":  {name: `"externalId"`, caseExact: true},
+	"createdBy":   {name: `"createdBy"`, caseExact: true},
+}
+
+func (r *teamRepository) Search(ctx context.Context, filters []AttrFilter, limit, offset int) ([]entities.Team, int64, error) {
+	query, err := applyAttrFilters(r.db.WithContext(ctx).Model(&entities.Team{}), filters, teamSearchColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var teams []entities.Team
+	err = query.Order(clause.OrderByColumn{Column: clause.Column{Name: "teamId"}}).Limit(limit).Offset(offset).Find(&teams).Error
+	return teams, total, err
+}
+
+func (r *teamRepository) AncestorIDs(ctx context.Context, teamID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Raw(`
+		WITH RECURSIVE ancestors(id, depth) AS (
+			SELECT "parentTeamId", 1 FROM "Teams" WHERE "teamId" = ?
+			UNION ALL
+			SELECT t."parentTeamId", a.depth + 1 FROM "Teams" t JOIN ancestors a ON t."teamId" = a.id
+			WHERE a.depth < ?
+		)
+		SELECT id FROM ancestors WHERE id IS NOT NULL ORDER BY depth`, teamID, MaxTeamDepth).Scan(&ids).Error
+	return ids, err
 }
 
-func (r *teamRepository) Delete(id uint) error {
-	return r.db.Delete(&entities.Team{}, id).Error
+func (r *teamRepository) DescendantIDs(ctx context.Context, teamID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Raw(`
+		WITH RECURSIVE descendants(id, depth) AS (
+			SELECT "teamId", 1 FROM "Teams" WHERE "parentTeamId" = ?
+			UNION ALL
+			SELECT t."teamId", d.depth + 1 FROM "Teams" t JOIN descendants d ON t."parentTeamId" = d.id
+			WHERE d.depth < ?
+		)
+		SELECT id FROM descendants ORDER BY depth, id`, teamID, MaxTeamDepth).Scan(&ids).Error
+	return ids, err
 }
 
 // Roster operations
-func (r *teamRepository) CreateRoster(roster *entities.Roster) error {
-	return r.db.Create(roster).Error
+func (r *teamRepository) CreateRoster(ctx context.Context, roster *entities.Roster, actorID string) error {
+	if roster.Role == "" {
+		roster.Role = entities.RosterRole(roster.IsLeader)
+	}
+	roster.IsLeader = roster.Role == entities.RosterRoleManager
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(roster).Error; err != nil {
+			return err
+		}
+		return tx.Create(&entities.RosterInterval{
+			TeamID:   roster.TeamId,
+			UserID:   roster.UserId,
+			Role:     roster.Role,
+			JoinedAt: time.Now(),
+			AddedBy:  actorID,
+		}).Error
+	})
 }
 
-func (r *teamRepository) DeleteRoster(teamID uint, userID string, isLeader bool) error {
-	return r.db.Where(`"teamId" = ? AND "userId" = ? AND "isLeader" = ?`, teamID, userID, isLeader).Delete(&entities.Roster{}).Error
+func (r *teamRepository) DeleteRoster(ctx context.Context, teamID uint, userID string, isLeader bool, actorID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where(map[string]interface{}{"teamId": teamID, "userId": userID, "isLeader": isLeader}).Delete(&entities.Roster{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&entities.RosterInterval{}).
+			Where("team_id = ? AND user_id = ? AND left_at IS NULL", teamID, userID).
+			Updates(map[string]interface{}{"left_at": time.Now(), "removed_by": actorID}).Error
+	})
 }
 
-func (r *teamRepository) GetRosterByTeamAndUser(teamID uint, userID string) (*entities.Roster, error) {
+func (r *teamRepository) UpdateRosterRole(ctx context.Context, teamID uint, userID string, isLeader bool, actorID string) error {
+	return r.SetRosterRole(ctx, teamID, userID, entities.RosterRole(isLeader), actorID)
+}
+
+func (r *teamRepository) SetRosterRole(ctx context.Context, teamID uint, userID, role, actorID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entities.Roster{}).
+			Where(map[string]interface{}{"teamId": teamID, "userId": userID}).
+			Where(`"role" <> ?`, role).
+			Updates(map[string]interface{}{"role": role, "isLeader": role == entities.RosterRoleManager})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Either the user already has the role or they are not on the roster
+			var count int64
+			if err := tx.Model(&entities.Roster{}).Where(map[string]interface{}{"teamId": teamID, "userId": userID}).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			return nil
+		}
+
+		now := time.Now()
+		err := tx.Model(&entities.RosterInterval{}).
+			Where("team_id = ? AND user_id = ? AND left_at IS NULL", teamID, userID).
+			Updates(map[string]interface{}{"left_at": now, "removed_by": actorID}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&entities.RosterInterval{
+			TeamID:   teamID,
+			UserID:   userID,
+			Role:     role,
+			JoinedAt: now,
+			AddedBy:  actorID,
+		}).Error
+	})
+}
+
+func (r *teamRepository) GetRosterByTeamAndUser(ctx context.Context, teamID uint, userID string) (*entities.Roster, error) {
 	var roster entities.Roster
-	err := r.db.Where(`"teamId" = ? AND "userId" = ?`, teamID, userID).First(&roster).Error
+	err := r.db.WithContext(ctx).Where(map[string]interface{}{"teamId": teamID, "userId": userID}).First(&roster).Error
 	if err != nil {
 		return nil, err
 	}
 	return &roster, nil
 }
 
-func (r *teamRepository) GetTeamMembers(teamID uint) ([]entities.Roster, error) {
+func (r *teamRepository) GetTeamMembers(ctx context.Context, teamID uint) ([]entities.Roster, error) {
 	var rosters []entities.Roster
-	err := r.db.Where(`"teamId" = ?`, teamID).Find(&rosters).Error
+	err := r.db.WithContext(ctx).Where(map[string]interface{}{"teamId": teamID}).Find(&rosters).Error
 	return rosters, err
 }
 
-func (r *teamRepository) IsUserManagerOfTeam(userID string, teamID uint) (bool, error) {
-	var count int64
-	err := r.db.Model(&entities.Roster{}).Where(`"userId" = ? AND "teamId" = ? AND "isLeader" = TRUE`, userID, teamID).Count(&count).Error
+func (r *teamRepository) LockRoster(ctx context.Context, teamID uint) ([]entities.Roster, error) {
+	var rosters []entities.Roster
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where(map[string]interface{}{"teamId": teamID}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "rosterId"}}).
+		Find(&rosters).Error
+	return rosters, err
+}
+
+func (r *teamRepository) GetRostersByUser(ctx context.Context, userID string) ([]entities.Roster, error) {
+	var rosters []entities.Roster
+	err := r.db.WithContext(ctx).Where(map[string]interface{}{"userId": userID}).Find(&rosters).Error
+	return rosters, err
+}
+
+func (r *teamRepository) UserPermissions(ctx context.Context, userID string, teamID uint) ([]string, error) {
+	teamIDs, err := r.AncestorIDs(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	teamIDs = append(teamIDs, teamID)
+
+	var rosters []entities.Roster
+	if err := r.db.WithContext(ctx).Where(map[string]interface{}{"userId": userID, "teamId": teamIDs}).Find(&rosters).Error; err != nil {
+		return nil, err
+	}
+
+	granted := make(map[string]bool)
+	custom := make(map[uint][]string)
+	for _, roster := range rosters {
+		if perms, ok := entities.BuiltinRolePermissions(roster.Role); ok {
+			for _, p := range perms {
+				granted[p] = true
+			}
+			continue
+		}
+		custom[roster.TeamId] = append(custom[roster.TeamId], roster.Role)
+	}
+	for id, names := range custom {
+		var roles []entities.TeamRole
+		if err := r.db.WithContext(ctx).Where("team_id = ? AND name IN ?", id, names).Find(&roles).Error; err != nil {
+			return nil, err
+		}
+		for _, role := range roles {
+			for _, p := range role.Permissions {
+				granted[p] = true
+			}
+		}
+	}
+
+	// Keep the canonical order so responses are stable
+	perms := make([]string, 0, len(granted))
+	for _, p := range entities.TeamPermissions {
+		if granted[p] {
+			perms = append(perms, p)
+		}
+	}
+	return perms, nil
+}
+
+func (r *teamRepository) HasPermission(ctx context.Context, userID string, teamID uint, permission string) (bool, error) {
+	perms, err := r.UserPermissions(ctx, userID, teamID)
 	if err != nil {
 		return false, err
 	}
-	return count > 0, nil
+	for _, p := range perms {
+		if p == permission {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
-func (r *teamRepository) IsUserMemberOfTeam(userID string, teamID uint) (bool, error) {
+func (r *teamRepository) CountRosterWithRole(ctx context.Context, teamID uint, role string) (int64, error) {
 	var count int64
-	err := r.db.Model(&entities.Roster{}).Where(`"userId" = ? AND "teamId" = ?`, userID, teamID).Count(&count).Error
+	err := r.db.WithContext(ctx).Model(&entities.Roster{}).Where(map[string]interface{}{"teamId": teamID, "role": role}).Count(&count).Error
+	return count, err
+}
+
+func (r *teamRepository) IsUserMemberOfTeam(ctx context.Context, userID string, teamID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entities.Roster{}).Where(map[string]interface{}{"userId": userID, "teamId": teamID}).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
 	return count > 0, nil
 }
 
-func (r *teamRepository) GetUsersByTeamID(teamID uint) ([]string, error) {
+func (r *teamRepository) IsUserInTeamTree(ctx context.Context, userID string, teamID uint) (bool, error) {
+	teamIDs, err := r.AncestorIDs(ctx, teamID)
+	if err != nil {
+		return false, err
+	}
+	teamIDs = append(teamIDs, teamID)
+
+	var count int64
+	err = r.db.WithContext(ctx).Model(&entities.Roster{}).Where(map[string]interface{}{"userId": userID, "teamId": teamIDs}).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *teamRepository) OwnsFolders(ctx context.Context, teamID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entities.Folder{}).Where("team_id = ?", teamID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *teamRepository) GetUsersByTeamID(ctx context.Context, teamID uint) ([]string, error) {
+	var userIds []string
+	err := r.db.WithContext(ctx).Model(&entities.Roster{}).Where(map[string]interface{}{"teamId": teamID}).Pluck("userId", &userIds).Error
+	return userIds, err
+}
+
+func (r *teamRepository) ListRosterIntervals(ctx context.Context, filter RosterIntervalFilter) ([]entities.RosterInterval, error) {
+	query := r.db.WithContext(ctx)
+	if filter.TeamID != 0 {
+		query = query.Where("team_id = ?", filter.TeamID)
+	}
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.At != nil {
+		query = coveringInstant(query, *filter.At)
+	}
+
+	var intervals []entities.RosterInterval
+	err := query.Order("joined_at DESC, id DESC").Find(&intervals).Error
+	return intervals, err
+}
+
+func (r *teamRepository) GetUsersByTeamIDsAt(ctx context.Context, teamIDs []uint, at time.Time) ([]string, error) {
+	var userIds []string
+	err := coveringInstant(r.db.WithContext(ctx).Model(&entities.RosterInterval{}), at).
+		Where("team_id IN ?", teamIDs).
+		Distinct("user_id").Pluck("user_id", &userIds).Error
+	return userIds, err
+}
+
+// coveringInstant keeps the roster intervals that were open at the given instant
+func coveringInstant(query *gorm.DB, at time.Time) *gorm.DB {
+	return query.Where("joined_at <= ? AND (left_at IS NULL OR left_at > ?)", at, at)
+}
+
+func (r *teamRepository) GetUsersByTeamIDs(ctx context.Context, teamIDs []uint) ([]string, error) {
 	var userIds []string
-	err := r.db.Table("rosters").Where("team_id = ?", teamID).Pluck("user_id", &userIds).Error
+	err := r.db.WithContext(ctx).Model(&entities.Roster{}).Distinct("userId").Where(map[string]interface{}{"teamId": teamIDs}).Pluck("userId", &userIds).Error
 	return userIds, err
 }
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"team-service/internal/entities"
+
+	"gorm.io/gorm"
+)
+
+type TeamRoleRepository interface {
+	Create(ctx context.Context, role *entities.TeamRole) error
+	Get(ctx context.Context, teamID uint, name string) (*entities.TeamRole, error)
+	ListByTeam(ctx context.Context, teamID uint) ([]entities.TeamRole, error)
+	Update(ctx context.Context, role *entities.TeamRole) error
+	Delete(ctx context.Context, id uint) error
+}
+
+type teamRoleRepository struct {
+	db *gorm.DB
+}
+
+func NewTeamRoleRepository(db *gorm.DB) TeamRoleRepository {
+	return &teamRoleRepository{db: db}
+}
+
+func (r *teamRoleRepository) Create(ctx context.Context, role *entities.TeamRole) error {
+	return r.db.WithContext(ctx).Create(role).Error
+}
+
+func (r *teamRoleRepository) Get(ctx context.Context, teamID uint, name string) (*entities.TeamRole, error) {
+	var role entities.TeamRole
+	err := r.db.WithContext(ctx).Where("team_id = ? AND name = ?", teamID, name).First(&role).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *teamRoleRepository) ListByTeam(ctx context.Context, teamID uint) ([]entities.TeamRole, error) {
+	var roles []entities.TeamRole
+	err := r.db.WithContext(ctx).Where("team_id = ?", teamID).Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (r *teamRoleRepository) Update(ctx context.Context, role *entities.TeamRole) error {
+	return r.db.WithContext(ctx).Save(role).Error
+}
+
+func (r *teamRoleRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&entities.TeamRole{}, id).Error
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"team-service/internal/entities"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UsageRepository interface {
+	WithTx(tx *gorm.DB) UsageRepository
+
+	// Get returns zero counters for a subject that never had any usage
+	Get(ctx context.Context, scope, subjectID string) (*entities.Usage, error)
+	// Charge applies delta unless a growing counter would pass its limit, in which case it
+	// changes nothing and reports false. The check and the update are a single statement.
+	Charge(ctx context.Context, scope, subjectID string, delta entities.UsageDelta, limits entities.QuotaLimits) (bool, error)
+	// Adjust applies delta without checking any limit
+	Adjust(ctx context.Context, scope, subjectID string, delta entities.UsageDelta) error
+}
+
+type usageRepository struct {
+	db *gorm.DB
+}
+
+func NewUsageRepository(db *gorm.DB) UsageRepository {
+	return &usageRepository{db: db}
+}
+
+func (r *usageRepository) WithTx(tx *gorm.DB) UsageRepository {
+	return &usageRepository{db: tx}
+}
+
+func (r *usageRepository) Get(ctx context.Context, scope, subjectID string) (*entities.Usage, error) {
+	var usage entities.Usage
+	err := r.db.WithContext(ctx).Where("scope = ? AND subject_id = ?", scope, subjectID).First(&usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &entities.Usage{Scope: scope, SubjectID: subjectID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+func (r *usageRepository) Charge(ctx context.Context, scope, subjectID string, delta entities.UsageDelta, limits entities.QuotaLimits) (bool, error) {
+	if delta.IsZero() {
+		return true, nil
+	}
+	if err := r.ensure(ctx, scope, subjectID); err != nil {
+		return false, err
+	}
+
+	query := r.db.WithContext(ctx).Model(&entities.Usage{}).Where("scope = ? AND subject_id = ?", scope, subjectID)
+	if delta.Notes > 0 && limits.MaxNotes > 0 {
+		query = query.Where("notes + ? <= ?", delta.Notes, limits.MaxNotes)
+	}
+	if delta.Bytes > 0 && limits.MaxBytes > 0 {
+		query = query.Where("bytes + ? <= ?", delta.Bytes, limits.MaxBytes)
+	}
+	if delta.Folders > 0 && limits.MaxFolders > 0 {
+		query = query.Where("folders + ? <= ?", delta.Folders, limits.MaxFolders)
+	}
+	result := query.Updates(deltaColumns(delta))
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *usageRepository) Adjust(ctx context.Context, scope, subjectID string, delta entities.UsageDelta) error {
+	if delta.IsZero() {
+		return nil
+	}
+	if err := r.ensure(ctx, scope, subjectID); err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Model(&entities.Usage{}).
+		Where("scope = ? AND subject_id = ?", scope, subjectID).
+		Updates(deltaColumns(delta)).Error
+}
+
+// ensure creates the subject's counters on first use
+func (r *usageRepository) ensure(ctx context.Context, scope, subjectID string) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entities.Usage{Scope: scope, SubjectID: subjectID}).Error
+}
+
+func deltaColumns(delta entities.UsageDelta) map[string]interface{} {
+	return map[string]interface{}{
+		"notes":   gorm.Expr("notes + ?", delta.Notes),
+		"bytes":   gorm.Expr("bytes + ?", delta.Bytes),
+		"folders": gorm.Expr("folders + ?", delta.Folders),
+	}
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"team-service/internal/entities"
+
+	"gorm.io/gorm"
+)
+
+type UserRepository interface {
+	WithTx(tx *gorm.DB) UserRepository
+	GetByID(ctx context.Context, id string) (*entities.User, error)
+	GetByIDs(ctx context.Context, ids []string) ([]entities.User, error)
+	List(ctx context.Context, limit, offset int) ([]entities.User, int64, error)
+	// Search lists users matching every filter, ordered by ID. Searchable fields are
+	// id, userName (the ID), externalId, displayName, email, active and source.
+	Search(ctx context.Context, filters []AttrFilter, limit, offset int) ([]entities.User, int64, error)
+	Save(ctx context.Context, user *entities.User) error
+}
+
+type userRepository struct {
+	db *gorm.DB
+}
+
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &userRepository{db: db}
+}
+
+func (r *userRepository) WithTx(tx *gorm.DB) UserRepository {
+	return &userRepository{db: tx}
+}
+
+func (r *userRepository) GetByID(ctx context.Context, id string) (*entities.User, error) {
+	var user entities.User
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) GetByIDs(ctx context.Context, ids []string) ([]entities.User, error) {
+	var users []entities.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&users).Error
+	return users, err
+}
+
+var userSearchColumns = map[string]searchColumn{
+	"id":          {name: "id", caseExact: true},
+	"userName":    {name: "id"},
+	"externalId":  {name: "external_id", caseExact: true},
+	"displayName": {name: "name"},
+	"email":       {name: "email"},
+	"active":      {name: "active", boolean: true},
+	"source":      {name: "source", caseExact: true},
+}
+
+func (r *userRepository) Search(ctx context.Context, filters []AttrFilter, limit, offset int) ([]entities.User, int64, error) {
+	query, err := applyAttrFilters(r.db.WithContext(ctx).Model(&entities.User{}), filters, userSearchColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []entities.User
+	err = query.Order("id").Limit(limit).Offset(offset).Find(&users).Error
+	return users, total, err
+}
+
+func (r *userRepository) List(ctx context.Context, limit, offset int) ([]entities.User, int64, error) {
+	var total int64
+	if err := r.db.WithContext(ctx).Model(&entities.User{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []entities.User
+	err := r.db.WithContext(ctx).Order("id").Limit(limit).Offset(offset).Find(&users).Error
+	return users, total, err
+}
+
+// Save inserts the user or updates every column of an existing one
+func (r *userRepository) Save(ctx context.Context, user *entities.User) error {
+	return r.db.WithContext(ctx).Save(user).Error
+}
@@ -0,0 +1,386 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAssetNotFound is also returned for assets the requester may not learn about, so the
+	// response does not reveal whether they exist
+	ErrAssetNotFound           = errors.New("not found or access denied")
+	ErrAccessRequestExists     = errors.New("a pending access request already exists for this asset")
+	ErrAccessAlreadyGranted    = errors.New("you already have the requested access")
+	ErrAccessRequestNotFound   = errors.New("access request not found")
+	ErrAccessRequestNotPending = errors.New("access request has already been decided")
+)
+
+// maxAccessRequestMessageLength bounds the note a requester can leave for the owner
+const maxAccessRequestMessageLength = 500
+
+type AccessRequestService interface {
+	// RequestAccess asks for read or write access to a folder or note. Only users on a team
+	// with the owner, or on the owning team, can ask; for anyone else the asset does not exist.
+	RequestAccess(ctx context.Context, assetType string, assetID uint, requesterID, access, message string) (*entities.AccessRequest, error)
+	// Inbox lists requests on the assets the user may share: the ones they own and those of
+	// teams where they have assets:share. Shares held for a manager are listed for those with
+	// team:manage on the asset's team, or on a team of the asset's owner.
+	Inbox(ctx context.Context, userID, status string) ([]entities.AccessRequest, error)
+	// DecideAccessRequest approves or rejects a pending request; approval shares the asset.
+	// Approving a write share that needs a team manager hands the request on to the managers
+	// instead, and it stays pending.
+	DecideAccessRequest(ctx context.Context, requestID uint, deciderID string, approve bool) (*entities.AccessRequest, error)
+}
+
+type accessRequestService struct {
+	accessRequestRepo repository.AccessRequestRepository
+	folderRepo        repository.FolderRepository
+	noteRepo          repository.NoteRepository
+	shareRepo         repository.ShareRepository
+	teamRepo          repository.TeamRepository
+	shareService      ShareService
+	db                *gorm.DB
+}
+
+func NewAccessRequestService(accessRequestRepo repository.AccessRequestRepository, folderRepo repository.FolderRepository, noteRepo repository.NoteRepository, shareRepo repository.ShareRepository, teamRepo repository.TeamRepository, shareService ShareService, db *gorm.DB) AccessRequestService {
+	return &accessRequestService{
+		accessRequestRepo: accessRequestRepo,
+		folderRepo:        folderRepo,
+		noteRepo:          noteRepo,
+		shareRepo:         shareRepo,
+		teamRepo:          teamRepo,
+		shareService:      shareService,
+		db:                db,
+	}
+}
+
+// assetOwnership is who a folder or note belongs to
+type assetOwnership struct {
+	ownerID string
+	teamID  *uint
+}
+
+func (s *accessRequestService) RequestAccess(ctx context.Context, assetType string, assetID uint, requesterID, access, message string) (*entities.AccessRequest, error) {
+	ctx, span := tracing.Start(ctx, "AccessRequestService.RequestAccess",
+		attribute.String("asset.type", assetType), attribute.Int64("asset.id", int64(assetID)))
+	defer span.End()
+
+	message = strings.TrimSpace(message)
+	if len(message) > maxAccessRequestMessageLength {
+		v := &ValidationError{}
+		v.add("message", "must be at most %d characters", maxAccessRequestMessageLength)
+		return nil, v.err()
+	}
+
+	asset, err := s.getAsset(ctx, assetType, assetID)
+	if err != nil {
+		return nil, err
+	}
+	visible, err := s.visibleTo(ctx, asset, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, ErrAssetNotFound
+	}
+	granted, err := s.hasAccess(ctx, assetType, assetID, asset, requesterID, access)
+	if err != nil {
+		return nil, err
+	}
+	if granted {
+		return nil, ErrAccessAlreadyGranted
+	}
+
+	pending, err := s.accessRequestRepo.HasPending(ctx, assetType, assetID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrAccessRequestExists
+	}
+
+	request := &entities.AccessRequest{
+		AssetType:   assetType,
+		AssetID:     assetID,
+		RequesterID: requesterID,
+		Access:      access,
+		Message:     message,
+		Status:      entities.AccessRequestPending,
+	}
+	// The partial unique index catches a concurrent duplicate that slipped past the check
+	if err := s.accessRequestRepo.Create(ctx, request); errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrAccessRequestExists
+	} else if err != nil {
+		return nil, err
+	}
+
+	metrics.AccessRequests.WithLabelValues("requested").Inc()
+	return request, nil
+}
+
+func (s *accessRequestService) Inbox(ctx context.Context, userID, status string) ([]entities.AccessRequest, error) {
+	ctx, span := tracing.Start(ctx, "AccessRequestService.Inbox")
+	defer span.End()
+
+	sharing, err := s.teamsWith(ctx, userID, entities.TeamPermShare)
+	if err != nil {
+		return nil, err
+	}
+	managed, err := s.teamsWith(ctx, userID, entities.TeamPermManageTeam)
+	if err != nil {
+		return nil, err
+	}
+	return s.accessRequestRepo.ListInbox(ctx, repository.AccessRequestInbox{
+		OwnerID:        userID,
+		SharingTeamIDs: sharing,
+		ManagedTeamIDs: managed,
+		Status:         status,
+	})
+}
+
+func (s *accessRequestService) DecideAccessRequest(ctx context.Context, requestID uint, deciderID string, approve bool) (*entities.AccessRequest, error) {
+	ctx, span := tracing.Start(ctx, "AccessRequestService.DecideAccessRequest")
+	defer span.End()
+
+	request, err := s.accessRequestRepo.GetByID(ctx, requestID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAccessRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Requests outside the decider's inbox, including ones on deleted assets, are not found
+	asset, err := s.getAsset(ctx, request.AssetType, request.AssetID)
+	if errors.Is(err, ErrAssetNotFound) {
+		return nil, ErrAccessRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	if request.SharedBy != "" {
+		ok, err = s.manages(ctx, asset, deciderID)
+	} else {
+		ok, err = s.administers(ctx, asset, deciderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrAccessRequestNotFound
+	}
+	if request.Status != entities.AccessRequestPending {
+		return nil, ErrAccessRequestNotPending
+	}
+
+	status := entities.AccessRequestRejected
+	if approve {
+		status = entities.AccessRequestApproved
+	}
+	now := time.Now()
+	held := false
+	// The decision, the share and any hand-off commit together. The row lock makes a concurrent
+	// decision wait for this one and then find the request decided.
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		requests := s.accessRequestRepo.WithTx(tx)
+		locked, err := requests.Lock(ctx, request.ID)
+		if err != nil {
+			return err
+		}
+		if locked.Status != entities.AccessRequestPending {
+			return ErrAccessRequestNotPending
+		}
+		// Handed on to the managers since it was read, so no longer the decider's to decide
+		if locked.SharedBy != request.SharedBy {
+			return ErrAccessRequestNotFound
+		}
+
+		if approve {
+			// The share goes through the same checks as one made directly. A held share is made
+			// by whoever shared it, with the decider's approval.
+			sharerID, approverID := deciderID, ""
+			if request.SharedBy != "" {
+				sharerID, approverID = request.SharedBy, deciderID
+			}
+			err := s.shareService.ShareApproved(ctx, tx, request, sharerID, approverID)
+			// A write share the decider may not grant alone is held for the managers instead
+			if request.SharedBy == "" && needsManagerApproval(err) {
+				held = true
+				return requests.HandOff(ctx, request.ID, deciderID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		ok, err := requests.Decide(ctx, request.ID, status, deciderID, now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrAccessRequestNotPending
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if held {
+		request.SharedBy = deciderID
+		metrics.AccessRequests.WithLabelValues("held").Inc()
+		return request, nil
+	}
+	request.Status = status
+	request.DecidedBy = deciderID
+	request.DecidedAt = &now
+	metrics.AccessRequests.WithLabelValues(status).Inc()
+	return request, nil
+}
+
+func (s *accessRequestService) getAsset(ctx context.Context, assetType string, assetID uint) (*assetOwnership, error) {
+	var asset assetOwnership
+	switch assetType {
+	case entities.AssetFolder:
+		folder, err := s.folderRepo.GetByID(ctx, assetID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAssetNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		asset = assetOwnership{ownerID: folder.OwnerID, teamID: folder.TeamID}
+	case entities.AssetNote:
+		note, err := s.noteRepo.GetByID(ctx, assetID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAssetNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		asset = assetOwnership{ownerID: note.OwnerID, teamID: note.TeamID}
+	default:
+		return nil, ErrAssetNotFound
+	}
+	return &asset, nil
+}
+
+// visibleTo reports whether the user may learn the asset exists: they are on the owning team
+// or a team above it, or they share a team with the owner
+func (s *accessRequestService) visibleTo(ctx context.Context, asset *assetOwnership, userID string) (bool, error) {
+	if asset.teamID != nil {
+		return s.teamRepo.IsUserInTeamTree(ctx, userID, *asset.teamID)
+	}
+	return sharesTeam(ctx, s.teamRepo, asset.ownerID, userID)
+}
+
+// hasAccess reports whether the user can already use the asset at the requested level
+func (s *accessRequestService) hasAccess(ctx context.Context, assetType string, assetID uint, asset *assetOwnership, userID, access string) (bool, error) {
+	if asset.teamID != nil {
+		// Everyone who may see a team asset can read it
+		if access == "read" {
+			return true, nil
+		}
+		ok, err := s.teamRepo.HasPermission(ctx, userID, *asset.teamID, entities.TeamPermWriteAssets)
+		if err != nil || ok {
+			return ok, err
+		}
+	} else if asset.ownerID == userID {
+		return true, nil
+	}
+
+	var shared string
+	if assetType == entities.AssetFolder {
+		share, err := s.shareRepo.GetFolderShare(ctx, assetID, userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		shared = share.Access
+	} else {
+		share, err := s.shareRepo.GetNoteShare(ctx, assetID, userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		shared = share.Access
+	}
+	return shared == "write" || shared == access, nil
+}
+
+// administers reports whether the user may share the asset: its owner, or for team assets
+// anyone with assets:share
+func (s *accessRequestService) administers(ctx context.Context, asset *assetOwnership, userID string) (bool, error) {
+	if asset.teamID == nil {
+		return asset.ownerID == userID, nil
+	}
+	return s.teamRepo.HasPermission(ctx, userID, *asset.teamID, entities.TeamPermShare)
+}
+
+// manages reports whether the user may approve a share held for a manager: they have
+// team:manage on the asset's team, or on one of its owner's teams for personal assets
+func (s *accessRequestService) manages(ctx context.Context, asset *assetOwnership, userID string) (bool, error) {
+	if asset.teamID != nil {
+		return s.teamRepo.HasPermission(ctx, userID, *asset.teamID, entities.TeamPermManageTeam)
+	}
+	rosters, err := s.teamRepo.GetRostersByUser(ctx, asset.ownerID)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range rosters {
+		ok, err := s.teamRepo.HasPermission(ctx, userID, r.TeamId, entities.TeamPermManageTeam)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// teamsWith lists the teams on which the user has permission. Permissions granted on a team
+// extend to every team below it.
+func (s *accessRequestService) teamsWith(ctx context.Context, userID, permission string) ([]uint, error) {
+	rosters, err := s.teamRepo.GetRostersByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool)
+	var teamIDs []uint
+	for _, r := range rosters {
+		if seen[r.TeamId] {
+			continue
+		}
+		ok, err := s.teamRepo.HasPermission(ctx, userID, r.TeamId, permission)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		descendants, err := s.teamRepo.DescendantIDs(ctx, r.TeamId)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range append([]uint{r.TeamId}, descendants...) {
+			if !seen[id] {
+				seen[id] = true
+				teamIDs = append(teamIDs, id)
+			}
+		}
+	}
+	return teamIDs, nil
+}
@@ -0,0 +1,418 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidAdminRequest = errors.New("invalid admin request")
+	ErrAdminNotFound       = errors.New("not found")
+)
+
+// validRoles are the roles an ADMIN can assign in the user directory
+var validRoles = []string{"ADMIN", "MANAGER", "MEMBER"}
+
+// TeamDetails is a team together with its roster
+type TeamDetails struct {
+	entities.Team
+	Managers []string `json:"managers"`
+	Members  []string `json:"members"`
+}
+
+// FolderDetails is a folder with its notes and everyone it is shared with
+type FolderDetails struct {
+	entities.Folder
+	Shares []entities.FolderShare `json:"shares"`
+}
+
+// NoteDetails is a note with everyone it is shared with
+type NoteDetails struct {
+	entities.Note
+	Shares []entities.NoteShare `json:"shares"`
+}
+
+// Stats are platform-wide counts for the admin dashboard
+type Stats struct {
+	Teams           int64 `json:"teams"`
+	Managers        int64 `json:"managers"`
+	Members         int64 `json:"members"`
+	DirectoryUsers  int64 `json:"directoryUsers"`
+	InactiveUsers   int64 `json:"inactiveUsers"`
+	Folders         int64 `json:"folders"`
+	Notes           int64 `json:"notes"`
+	FolderShares    int64 `json:"folderShares"`
+	NoteShares      int64 `json:"noteShares"`
+	ActiveAPITokens int64 `json:"activeApiTokens"`
+}
+
+type AdminService interface {
+	ListTeams(ctx context.Context, limit, offset int) ([]TeamDetails, int64, error)
+	ListUsers(ctx context.Context, limit, offset int) ([]entities.User, int64, error)
+	ChangeUserRole(ctx context.Context, userID, role string) (*entities.User, error)
+	GetFolder(ctx context.Context, folderID uint) (*FolderDetails, error)
+	GetNote(ctx context.Context, noteID uint) (*NoteDetails, error)
+	TransferFolder(ctx context.Context, folderID uint, newOwnerID string) (*entities.Folder, error)
+	TransferNote(ctx context.Context, noteID uint, newOwnerID string) (*entities.Note, error)
+	RevokeFolderShare(ctx context.Context, folderID uint, userID string) error
+	RevokeNoteShare(ctx context.Context, noteID uint, userID string) error
+	GetStats(ctx context.Context) (*Stats, error)
+	ListAuditLog(ctx context.Context, filter repository.AuditFilter) ([]entities.AuditLog, int64, error)
+	RecordAudit(ctx context.Context, entry *entities.AuditLog) error
+}
+
+type adminService struct {
+	teamRepo       repository.TeamRepository
+	userRepo       repository.UserRepository
+	folderRepo     repository.FolderRepository
+	noteRepo       repository.NoteRepository
+	shareRepo      repository.ShareRepository
+	auditRepo      repository.AuditRepository
+	sessionService SessionService
+	quotas         QuotaService
+	db             *gorm.DB
+}
+
+func NewAdminService(
+	teamRepo repository.TeamRepository,
+	userRepo repository.UserRepository,
+	folderRepo repository.FolderRepository,
+	noteRepo repository.NoteRepository,
+	shareRepo repository.ShareRepository,
+	auditRepo repository.AuditRepository,
+	sessionService SessionService,
+	quotas QuotaService,
+	db *gorm.DB,
+) AdminService {
+	return &adminService{
+		teamRepo:       teamRepo,
+		userRepo:       userRepo,
+		folderRepo:     folderRepo,
+		noteRepo:       noteRepo,
+		shareRepo:      shareRepo,
+		auditRepo:      auditRepo,
+		sessionService: sessionService,
+		quotas:         quotas,
+		db:             db,
+	}
+}
+
+func (s *adminService) ListTeams(ctx context.Context, limit, offset int) ([]TeamDetails, int64, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ListTeams")
+	defer span.End()
+
+	teams, total, err := s.teamRepo.List(ctx, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]TeamDetails, 0, len(teams))
+	for _, team := range teams {
+		rosters, err := s.teamRepo.GetTeamMembers(ctx, team.TeamId)
+		if err != nil {
+			return nil, 0, err
+		}
+		details := TeamDetails{Team: team, Managers: []string{}, Members: []string{}}
+		for _, r := range rosters {
+			if r.IsLeader {
+				details.Managers = append(details.Managers, r.UserId)
+			} else {
+				details.Members = append(details.Members, r.UserId)
+			}
+		}
+		result = append(result, details)
+	}
+
+	return result, total, nil
+}
+
+func (s *adminService) ListUsers(ctx context.Context, limit, offset int) ([]entities.User, int64, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ListUsers")
+	defer span.End()
+
+	return s.userRepo.List(ctx, limit, offset)
+}
+
+// ChangeUserRole sets the user's role in the directory, adding them to it if needed.
+// The directory role takes precedence over token claims from the next request on.
+func (s *adminService) ChangeUserRole(ctx context.Context, userID, role string) (*entities.User, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ChangeUserRole")
+	defer span.End()
+
+	role = strings.ToUpper(strings.TrimSpace(role))
+	valid := false
+	for _, r := range validRoles {
+		if role == r {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: role must be one of %s", ErrInvalidAdminRequest, strings.Join(validRoles, ", "))
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user = &entities.User{ID: userID, Active: true}
+	} else if err != nil {
+		return nil, err
+	}
+	user.Role = role
+
+	if err := s.userRepo.Save(ctx, user); err != nil {
+		return nil, err
+	}
+
+	s.sessionService.ForgetUser(userID)
+	return user, nil
+}
+
+func (s *adminService) GetFolder(ctx context.Context, folderID uint) (*FolderDetails, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetFolder", attribute.Int64("folder.id", int64(folderID)))
+	defer span.End()
+
+	folder, err := s.folderRepo.GetByID(ctx, folderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("folder %w", ErrAdminNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := s.noteRepo.GetByFolderID(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	folder.Notes = notes
+
+	shares, err := s.shareRepo.GetFolderShares(ctx, folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FolderDetails{Folder: *folder, Shares: shares}, nil
+}
+
+func (s *adminService) GetNote(ctx context.Context, noteID uint) (*NoteDetails, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetNote", attribute.Int64("note.id", int64(noteID)))
+	defer span.End()
+
+	note, err := s.noteRepo.GetByID(ctx, noteID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("note %w", ErrAdminNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := s.shareRepo.GetNoteShares(ctx, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NoteDetails{Note: *note, Shares: shares}, nil
+}
+
+// TransferFolder hands the folder, and the notes in it the previous owner wrote, to a new owner.
+// Any share the new owner held becomes redundant and is dropped. A team folder and its notes
+// stop being team-owned. Usage moves with the assets; the new owner's quota is not enforced.
+func (s *adminService) TransferFolder(ctx context.Context, folderID uint, newOwnerID string) (*entities.Folder, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.TransferFolder", attribute.Int64("folder.id", int64(folderID)))
+	defer span.End()
+
+	if strings.TrimSpace(newOwnerID) == "" {
+		return nil, fmt.Errorf("%w: new owner is required", ErrInvalidAdminRequest)
+	}
+
+	folder, err := s.folderRepo.GetByID(ctx, folderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("folder %w", ErrAdminNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	previousOwner := folder.OwnerID
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var notes []entities.Note
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("folder_id = ? AND owner_id = ?", folderID, previousOwner).
+			Find(&notes).Error; err != nil {
+			return err
+		}
+
+		owner := map[string]interface{}{"owner_id": newOwnerID, "team_id": nil}
+		if err := tx.Model(&entities.Folder{}).Where("id = ?", folderID).Updates(owner).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entities.Note{}).
+			Where("folder_id = ? AND owner_id = ?", folderID, previousOwner).
+			Updates(owner).Error; err != nil {
+			return err
+		}
+		if err := s.moveUsage(ctx, tx, notes, 1, folder.OwnerID, folder.TeamID, newOwnerID); err != nil {
+			return err
+		}
+		if err := tx.Where("folder_id = ? AND user_id = ?", folderID, newOwnerID).Delete(&entities.FolderShare{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND note_id IN (?)", newOwnerID,
+			tx.Model(&entities.Note{}).Select("id").Where("folder_id = ? AND owner_id = ?", folderID, newOwnerID),
+		).Delete(&entities.NoteShare{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.folderRepo.GetByID(ctx, folderID)
+}
+
+func (s *adminService) TransferNote(ctx context.Context, noteID uint, newOwnerID string) (*entities.Note, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.TransferNote", attribute.Int64("note.id", int64(noteID)))
+	defer span.End()
+
+	if strings.TrimSpace(newOwnerID) == "" {
+		return nil, fmt.Errorf("%w: new owner is required", ErrInvalidAdminRequest)
+	}
+
+	note, err := s.noteRepo.GetByID(ctx, noteID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("note %w", ErrAdminNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(note, noteID).Error; err != nil {
+			return err
+		}
+		owner := map[string]interface{}{"owner_id": newOwnerID, "team_id": nil}
+		if err := tx.Model(&entities.Note{}).Where("id = ?", noteID).Updates(owner).Error; err != nil {
+			return err
+		}
+		if err := s.moveUsage(ctx, tx, []entities.Note{*note}, 0, note.OwnerID, note.TeamID, newOwnerID); err != nil {
+			return err
+		}
+		return tx.Where("note_id = ? AND user_id = ?", noteID, newOwnerID).Delete(&entities.NoteShare{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	note.OwnerID = newOwnerID
+	note.TeamID = nil
+	return note, nil
+}
+
+// moveUsage moves the usage of notes, and of folders owned by ownerID/teamID, to newOwnerID
+func (s *adminService) moveUsage(ctx context.Context, tx *gorm.DB, notes []entities.Note, folders int64, ownerID string, teamID *uint, newOwnerID string) error {
+	usage := noteUsage(notes, true)
+	gained := entities.UsageDelta{Folders: folders}
+	for _, n := range notes {
+		gained.Notes++
+		gained.Bytes += int64(len(n.Body))
+	}
+	from := ownerOf(ownerID, teamID)
+	released := usage[from]
+	released.Folders -= folders
+	usage[from] = released
+
+	to := ownerOf(newOwnerID, nil)
+	moved := usage[to]
+	moved.Notes += gained.Notes
+	moved.Bytes += gained.Bytes
+	moved.Folders += gained.Folders
+	usage[to] = moved
+	return adjustAll(ctx, s.quotas, tx, usage)
+}
+
+// RevokeFolderShare removes a folder share regardless of who owns the folder
+func (s *adminService) RevokeFolderShare(ctx context.Context, folderID uint, userID string) error {
+	ctx, span := tracing.Start(ctx, "AdminService.RevokeFolderShare", attribute.Int64("folder.id", int64(folderID)))
+	defer span.End()
+
+	if _, err := s.shareRepo.GetFolderShare(ctx, folderID, userID); errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("share %w", ErrAdminNotFound)
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.shareRepo.DeleteFolderShare(ctx, folderID, userID); err != nil {
+		return err
+	}
+
+	metrics.SharesRevoked.WithLabelValues("folder").Inc()
+	return nil
+}
+
+// RevokeNoteShare removes a note share regardless of who owns the note
+func (s *adminService) RevokeNoteShare(ctx context.Context, noteID uint, userID string) error {
+	ctx, span := tracing.Start(ctx, "AdminService.RevokeNoteShare", attribute.Int64("note.id", int64(noteID)))
+	defer span.End()
+
+	if _, err := s.shareRepo.GetNoteShare(ctx, noteID, userID); errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("share %w", ErrAdminNotFound)
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.shareRepo.DeleteNoteShare(ctx, noteID, userID); err != nil {
+		return err
+	}
+
+	metrics.SharesRevoked.WithLabelValues("note").Inc()
+	return nil
+}
+
+func (s *adminService) GetStats(ctx context.Context) (*Stats, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetStats")
+	defer span.End()
+
+	db := s.db.WithContext(ctx)
+	stats := &Stats{}
+	counts := []struct {
+		dest  *int64
+		query *gorm.DB
+	}{
+		{&stats.Teams, db.Model(&entities.Team{})},
+		{&stats.Managers, db.Model(&entities.Roster{}).Where(map[string]interface{}{"isLeader": true})},
+		{&stats.Members, db.Model(&entities.Roster{}).Where(map[string]interface{}{"isLeader": false})},
+		{&stats.DirectoryUsers, db.Model(&entities.User{})},
+		{&stats.InactiveUsers, db.Model(&entities.User{}).Where("active = ?", false)},
+		{&stats.Folders, db.Model(&entities.Folder{})},
+		{&stats.Notes, db.Model(&entities.Note{})},
+		{&stats.FolderShares, db.Model(&entities.FolderShare{})},
+		{&stats.NoteShares, db.Model(&entities.NoteShare{})},
+		{&stats.ActiveAPITokens, db.Model(&entities.APIToken{}).Where("revoked_at IS NULL AND expires_at > ?", time.Now())},
+	}
+	for _, c := range counts {
+		if err := c.query.Count(c.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+func (s *adminService) ListAuditLog(ctx context.Context, filter repository.AuditFilter) ([]entities.AuditLog, int64, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ListAuditLog")
+	defer span.End()
+
+	return s.auditRepo.List(ctx, filter)
+}
+
+func (s *adminService) RecordAudit(ctx context.Context, entry *entities.AuditLog) error {
+	return s.auditRepo.Create(ctx, entry)
+}
@@ -0,0 +1,689 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/pkg/ldif"
+	"team-service/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DirectorySyncActor creates synced teams and is recorded on the roster changes a sync makes
+const DirectorySyncActor = "directory-sync"
+
+var (
+	ErrTooManyRemovals = errors.New("directory sync would remove or downgrade more than the allowed number of users, teams and roster entries")
+	ErrEmptyDirectory  = errors.New("the export contains no users")
+)
+
+// DirectoryMapping says which LDAP attributes hold each directory field
+type DirectoryMapping struct {
+	UserObjectClasses  []string
+	GroupObjectClasses []string
+
+	UserID     string
+	Name       string
+	GivenName  string
+	FamilyName string
+	Email      string
+	Role       string
+	ExternalID string
+
+	GroupName     string
+	GroupMembers  []string
+	GroupManagers []string
+
+	// RoleMap maps lower-cased role attribute values to ADMIN, MANAGER or MEMBER
+	RoleMap     map[string]string
+	DefaultRole string
+}
+
+// DirectoryUser is a user as the export describes them. Role is empty when the mapping reads
+// no role attribute; the sync then leaves existing users' roles alone.
+type DirectoryUser struct {
+	ID         string
+	Name       string
+	GivenName  string
+	FamilyName string
+	Email      string
+	Role       string
+	ExternalID string
+}
+
+// DirectoryGroup is a group as the export describes it; members and managers are user IDs
+type DirectoryGroup struct {
+	ExternalID string
+	Name       string
+	Members    []string
+	Managers   []string
+}
+
+// DirectorySnapshot is the desired state of the directory read from one or more exports
+type DirectorySnapshot struct {
+	Users    []DirectoryUser
+	Groups   []DirectoryGroup
+	Warnings []string
+	// DefaultRole is given to new users the export assigns no role; MEMBER when empty
+	DefaultRole string
+}
+
+// rolePrecedence orders roles so a user matching several role values gets the strongest
+var rolePrecedence = map[string]int{"MEMBER": 1, "MANAGER": 2, "ADMIN": 3}
+
+// MapDirectoryEntries turns LDIF entries into a snapshot. Entries that are neither users nor
+// groups are ignored. Member references that do not resolve to a user in the export are
+// skipped with a warning; nested groups are not expanded.
+func MapDirectoryEntries(entries []ldif.Entry, m DirectoryMapping) (*DirectorySnapshot, error) {
+	snapshot := &DirectorySnapshot{DefaultRole: m.DefaultRole}
+	v := &ValidationError{}
+
+	userDNs := make(map[string]string)
+	groupDNs := make(map[string]bool)
+	userIDs := make(map[string]bool)
+	var groupEntries []*ldif.Entry
+
+	for i := range entries {
+		e := &entries[i]
+		switch {
+		case e.HasObjectClass(m.UserObjectClasses...):
+			id := strings.TrimSpace(e.Value(m.UserID))
+			if id == "" {
+				v.addLine(e.Line, m.UserID, "entry %s has no %s", e.DN, m.UserID)
+				continue
+			}
+			if userIDs[id] {
+				v.addLine(e.Line, m.UserID, "user %s appears more than once", id)
+				continue
+			}
+			userIDs[id] = true
+			userDNs[ldif.NormalizeDN(e.DN)] = id
+			snapshot.Users = append(snapshot.Users, mapDirectoryUser(e, id, m))
+		case e.HasObjectClass(m.GroupObjectClasses...):
+			groupDNs[ldif.NormalizeDN(e.DN)] = true
+			groupEntries = append(groupEntries, e)
+		}
+	}
+
+	externalIDs := make(map[string]bool)
+	for _, e := range groupEntries {
+		name := strings.TrimSpace(e.Value(m.GroupName))
+		if name == "" {
+			v.addLine(e.Line, m.GroupName, "group %s has no %s", e.DN, m.GroupName)
+			continue
+		}
+		group := DirectoryGroup{ExternalID: externalIDOf(e, m), Name: name}
+		if externalIDs[group.ExternalID] {
+			v.addLine(e.Line, m.ExternalID, "group %s appears more than once", e.DN)
+			continue
+		}
+		externalIDs[group.ExternalID] = true
+
+		resolve := func(attrs []string) []string {
+			seen := make(map[string]bool)
+			var ids []string
+			for _, attr := range attrs {
+				for _, ref := range e.Values(attr) {
+					ref = strings.TrimSpace(ref)
+					if ref == "" {
+						continue
+					}
+					id := ref
+					if strings.Contains(ref, "=") {
+						normalized := ldif.NormalizeDN(ref)
+						if groupDNs[normalized] {
+							snapshot.Warnings = append(snapshot.Warnings, fmt.Sprintf("group %s: nested group %s is not expanded", name, ref))
+							continue
+						}
+						id = userDNs[normalized]
+					}
+					if !userIDs[id] {
+						snapshot.Warnings = append(snapshot.Warnings, fmt.Sprintf("group %s: %s is not a user in the export", name, ref))
+						continue
+					}
+					if !seen[id] {
+						seen[id] = true
+						ids = append(ids, id)
+					}
+				}
+			}
+			sort.Strings(ids)
+			return ids
+		}
+		group.Members = resolve(m.GroupMembers)
+		group.Managers = resolve(m.GroupManagers)
+		snapshot.Groups = append(snapshot.Groups, group)
+	}
+
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(snapshot.Users, func(i, j int) bool { return snapshot.Users[i].ID < snapshot.Users[j].ID })
+	sort.Slice(snapshot.Groups, func(i, j int) bool { return snapshot.Groups[i].Name < snapshot.Groups[j].Name })
+	return snapshot, nil
+}
+
+func mapDirectoryUser(e *ldif.Entry, id string, m DirectoryMapping) DirectoryUser {
+	user := DirectoryUser{
+		ID:         id,
+		Name:       strings.TrimSpace(e.Value(m.Name)),
+		GivenName:  strings.TrimSpace(e.Value(m.GivenName)),
+		FamilyName: strings.TrimSpace(e.Value(m.FamilyName)),
+		Email:      strings.TrimSpace(e.Value(m.Email)),
+		ExternalID: externalIDOf(e, m),
+	}
+	if user.Name == "" {
+		user.Name = strings.TrimSpace(user.GivenName + " " + user.FamilyName)
+	}
+	if m.Role != "" {
+		user.Role = m.DefaultRole
+		best := 0
+		for _, value := range e.Values(m.Role) {
+			role, ok := m.RoleMap[strings.ToLower(strings.TrimSpace(value))]
+			if ok && rolePrecedence[role] > best {
+				user.Role, best = role, rolePrecedence[role]
+			}
+		}
+	}
+	return user
+}
+
+func externalIDOf(e *ldif.Entry, m DirectoryMapping) string {
+	if m.ExternalID != "" {
+		if id := strings.TrimSpace(e.Value(m.ExternalID)); id != "" {
+			return id
+		}
+	}
+	return e.DN
+}
+
+// DirectorySyncOptions controls a sync run
+type DirectorySyncOptions struct {
+	DryRun      bool
+	MaxRemovals int
+	// Force applies the run even past MaxRemovals or when the export has no users
+	Force bool
+}
+
+// DirectorySyncReport describes what a run changed, or would change on a dry run or when aborted
+type DirectorySyncReport struct {
+	DryRun      bool                    `json:"dryRun"`
+	Aborted     bool                    `json:"aborted,omitempty"`
+	StartedAt   time.Time               `json:"startedAt"`
+	FinishedAt  time.Time               `json:"finishedAt"`
+	Users       DirectoryUserReport     `json:"users"`
+	Teams       DirectoryTeamReport     `json:"teams"`
+	Rosters     []DirectoryRosterChange `json:"rosters"`
+	Removals    int                     `json:"removals"`
+	MaxRemovals int                     `json:"maxRemovals"`
+	Warnings    []string                `json:"warnings"`
+}
+
+// DirectoryUserReport summarises user changes. Downgraded users have their role lowered, which
+// counts as a removal; Skipped users are exported but managed by another source, such as SCIM.
+type DirectoryUserReport struct {
+	InExport    int                   `json:"inExport"`
+	Created     []string              `json:"created"`
+	Updated     []DirectoryUserChange `json:"updated"`
+	Reactivated []string              `json:"reactivated"`
+	Deactivated []string              `json:"deactivated"`
+	Downgraded  []string              `json:"downgraded"`
+	Skipped     []string              `json:"skipped"`
+	Unchanged   int                   `json:"unchanged"`
+}
+
+// DirectoryUserChange lists the fields a sync changed on an existing user
+type DirectoryUserChange struct {
+	UserID string   `json:"userId"`
+	Fields []string `json:"fields"`
+}
+
+// DirectoryTeamReport summarises team changes
+type DirectoryTeamReport struct {
+	InExport  int                   `json:"inExport"`
+	Created   []DirectoryTeamChange `json:"created"`
+	Renamed   []DirectoryTeamChange `json:"renamed"`
+	Deleted   []DirectoryTeamChange `json:"deleted"`
+	Skipped   []DirectoryTeamChange `json:"skipped"`
+	Unchanged int                   `json:"unchanged"`
+}
+
+// DirectoryTeamChange identifies a synced team; TeamID is 0 for teams a dry run would create
+type DirectoryTeamChange struct {
+	TeamID       uint   `json:"teamId,omitempty"`
+	ExternalID   string `json:"externalId"`
+	Name         string `json:"name"`
+	PreviousName string `json:"previousName,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// DirectoryRosterChange is the roster diff of one synced team
+type DirectoryRosterChange struct {
+	TeamID      uint               `json:"teamId,omitempty"`
+	Team        string             `json:"team"`
+	Additions   []RosterEntry      `json:"additions"`
+	Removals    []RosterEntry      `json:"removals"`
+	RoleChanges []RosterRoleChange `json:"roleChanges"`
+}
+
+type DirectorySyncService interface {
+	// Sync reconciles the directory, synced teams and their rosters with the snapshot in one
+	// transaction. Only users and teams the sync created or adopted are ever removed. When the
+	// run is aborted the report is returned together with ErrTooManyRemovals or ErrEmptyDirectory.
+	Sync(ctx context.Context, snapshot *DirectorySnapshot, opts DirectorySyncOptions) (*DirectorySyncReport, error)
+}
+
+type directorySyncService struct {
+	userRepo repository.UserRepository
+	teamRepo repository.TeamRepository
+	db       *gorm.DB
+}
+
+func NewDirectorySyncService(userRepo repository.UserRepository, teamRepo repository.TeamRepository, db *gorm.DB) DirectorySyncService {
+	return &directorySyncService{
+		userRepo: userRepo,
+		teamRepo: teamRepo,
+		db:       db,
+	}
+}
+
+// directoryPlan holds the writes behind a report
+type directoryPlan struct {
+	saveUsers   []*entities.User
+	createTeams []plannedTeam
+	renameTeams []*entities.Team
+	rosters     []plannedRoster
+	deleteTeams []plannedTeamDeletion
+}
+
+type plannedTeam struct {
+	team   *entities.Team
+	roster []entities.Roster
+	report int // index into report.Teams.Created
+	diff   int // index into report.Rosters
+}
+
+type plannedRoster struct {
+	teamID      uint
+	additions   []entities.Roster
+	removals    []entities.Roster
+	roleChanges []entities.Roster // with the new role
+}
+
+type plannedTeamDeletion struct {
+	team    *entities.Team
+	rosters []entities.Roster
+}
+
+func (s *directorySyncService) Sync(ctx context.Context, snapshot *DirectorySnapshot, opts DirectorySyncOptions) (*DirectorySyncReport, error) {
+	ctx, span := tracing.Start(ctx, "DirectorySyncService.Sync")
+	defer span.End()
+
+	report := &DirectorySyncReport{
+		DryRun:      opts.DryRun,
+		StartedAt:   time.Now(),
+		MaxRemovals: opts.MaxRemovals,
+		Warnings:    append([]string{}, snapshot.Warnings...),
+		Rosters:     []DirectoryRosterChange{},
+		Users: DirectoryUserReport{
+			InExport:    len(snapshot.Users),
+			Created:     []string{},
+			Updated:     []DirectoryUserChange{},
+			Reactivated: []string{},
+			Deactivated: []string{},
+			Downgraded:  []string{},
+			Skipped:     []string{},
+		},
+		Teams: DirectoryTeamReport{
+			InExport: len(snapshot.Groups),
+			Created:  []DirectoryTeamChange{},
+			Renamed:  []DirectoryTeamChange{},
+			Deleted:  []DirectoryTeamChange{},
+			Skipped:  []DirectoryTeamChange{},
+		},
+	}
+	finish := func(err error) (*DirectorySyncReport, error) {
+		report.FinishedAt = time.Now()
+		return report, err
+	}
+
+	if len(snapshot.Users) == 0 && !opts.Force {
+		report.Aborted = true
+		return finish(ErrEmptyDirectory)
+	}
+
+	plan := &directoryPlan{}
+	if err := s.planUsers(ctx, snapshot, plan, report); err != nil {
+		return nil, err
+	}
+	if err := s.planTeams(ctx, snapshot, plan, report); err != nil {
+		return nil, err
+	}
+
+	report.Removals = len(report.Users.Deactivated) + len(report.Users.Downgraded) + len(report.Teams.Deleted)
+	for _, r := range report.Rosters {
+		report.Removals += len(r.Removals)
+		for _, c := range r.RoleChanges {
+			if c.From == entities.RosterRoleManager {
+				report.Removals++
+			}
+		}
+	}
+	if report.Removals > opts.MaxRemovals && !opts.Force {
+		report.Aborted = true
+		return finish(ErrTooManyRemovals)
+	}
+	if opts.DryRun {
+		return finish(nil)
+	}
+
+	if err := s.apply(ctx, plan); err != nil {
+		return nil, err
+	}
+	for _, p := range plan.createTeams {
+		report.Teams.Created[p.report].TeamID = p.team.TeamId
+		report.Rosters[p.diff].TeamID = p.team.TeamId
+	}
+	return finish(nil)
+}
+
+// planUsers creates users missing from the directory, updates changed ones and deactivates
+// synced users that left the export. Existing users the export lists are adopted by the sync
+// unless another source manages them.
+func (s *directorySyncService) planUsers(ctx context.Context, snapshot *DirectorySnapshot, plan *directoryPlan, report *DirectorySyncReport) error {
+	ids := make([]string, len(snapshot.Users))
+	for i, u := range snapshot.Users {
+		ids[i] = u.ID
+	}
+	existing, err := s.userRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]*entities.User, len(existing))
+	for i := range existing {
+		byID[existing[i].ID] = &existing[i]
+	}
+
+	for _, u := range snapshot.Users {
+		user, ok := byID[u.ID]
+		if !ok {
+			role := u.Role
+			if role == "" {
+				role = snapshot.DefaultRole
+			}
+			if role == "" {
+				role = "MEMBER"
+			}
+			plan.saveUsers = append(plan.saveUsers, &entities.User{
+				ID:         u.ID,
+				Name:       u.Name,
+				GivenName:  u.GivenName,
+				FamilyName: u.FamilyName,
+				Email:      u.Email,
+				Role:       role,
+				Active:     true,
+				ExternalID: u.ExternalID,
+				Source:     entities.UserSourceLDIF,
+			})
+			report.Users.Created = append(report.Users.Created, u.ID)
+			continue
+		}
+		if user.Source != "" && user.Source != entities.UserSourceLDIF {
+			report.Users.Skipped = append(report.Users.Skipped, u.ID)
+			report.Warnings = append(report.Warnings, fmt.Sprintf("user %s is managed by %s and was left alone", u.ID, user.Source))
+			continue
+		}
+
+		var fields []string
+		set := func(field string, dst *string, value string) {
+			if *dst != value {
+				*dst = value
+				fields = append(fields, field)
+			}
+		}
+		set("name", &user.Name, u.Name)
+		set("givenName", &user.GivenName, u.GivenName)
+		set("familyName", &user.FamilyName, u.FamilyName)
+		set("email", &user.Email, u.Email)
+		if u.Role != "" {
+			if rolePrecedence[u.Role] < rolePrecedence[user.Role] {
+				report.Users.Downgraded = append(report.Users.Downgraded, u.ID)
+			}
+			set("role", &user.Role, u.Role)
+		}
+		set("externalId", &user.ExternalID, u.ExternalID)
+		set("source", &user.Source, entities.UserSourceLDIF)
+		reactivated := !user.Active
+		user.Active = true
+
+		if len(fields) == 0 && !reactivated {
+			report.Users.Unchanged++
+			continue
+		}
+		if len(fields) > 0 {
+			report.Users.Updated = append(report.Users.Updated, DirectoryUserChange{UserID: u.ID, Fields: fields})
+		}
+		if reactivated {
+			report.Users.Reactivated = append(report.Users.Reactivated, u.ID)
+		}
+		plan.saveUsers = append(plan.saveUsers, user)
+	}
+
+	synced, _, err := s.userRepo.Search(ctx, []repository.AttrFilter{
+		{Field: "source", Op: repository.FilterEq, Value: entities.UserSourceLDIF},
+		{Field: "active", Op: repository.FilterEq, Value: "true"},
+	}, -1, 0)
+	if err != nil {
+		return err
+	}
+	listed := toSet(ids)
+	for i := range synced {
+		if listed[synced[i].ID] {
+			continue
+		}
+		synced[i].Active = false
+		plan.saveUsers = append(plan.saveUsers, &synced[i])
+		report.Users.Deactivated = append(report.Users.Deactivated, synced[i].ID)
+	}
+	return nil
+}
+
+// planTeams creates a root team for each new group, renames changed ones, syncs their rosters
+// and deletes synced teams whose group is gone. Teams are matched on their external ID.
+func (s *directorySyncService) planTeams(ctx context.Context, snapshot *DirectorySnapshot, plan *directoryPlan, report *DirectorySyncReport) error {
+	teams, _, err := s.teamRepo.Search(ctx, []repository.AttrFilter{
+		{Field: "createdBy", Op: repository.FilterEq, Value: DirectorySyncActor},
+	}, -1, 0)
+	if err != nil {
+		return err
+	}
+	byExternalID := make(map[string]*entities.Team, len(teams))
+	for i := range teams {
+		byExternalID[teams[i].ExternalID] = &teams[i]
+	}
+
+	for _, g := range snapshot.Groups {
+		want := make(map[string]bool, len(g.Members)+len(g.Managers))
+		for _, id := range g.Members {
+			want[id] = false
+		}
+		for _, id := range g.Managers {
+			want[id] = true
+		}
+
+		team, ok := byExternalID[g.ExternalID]
+		if !ok {
+			p := plannedTeam{
+				team: &entities.Team{
+					TeamName:         g.Name,
+					CreatedBy:        DirectorySyncActor,
+					ExternalID:       g.ExternalID,
+					MembershipPolicy: entities.MembershipInviteOnly,
+				},
+				report: len(report.Teams.Created),
+				diff:   len(report.Rosters),
+			}
+			diff := DirectoryRosterChange{Team: g.Name, Additions: []RosterEntry{}, Removals: []RosterEntry{}, RoleChanges: []RosterRoleChange{}}
+			for _, id := range sortedKeys(want) {
+				p.roster = append(p.roster, entities.Roster{UserId: id, IsLeader: want[id]})
+				diff.Additions = append(diff.Additions, RosterEntry{UserID: id, Role: entities.RosterRole(want[id])})
+			}
+			plan.createTeams = append(plan.createTeams, p)
+			report.Teams.Created = append(report.Teams.Created, DirectoryTeamChange{ExternalID: g.ExternalID, Name: g.Name})
+			report.Rosters = append(report.Rosters, diff)
+			continue
+		}
+		delete(byExternalID, g.ExternalID)
+
+		if team.TeamName != g.Name {
+			report.Teams.Renamed = append(report.Teams.Renamed, DirectoryTeamChange{TeamID: team.TeamId, ExternalID: g.ExternalID, Name: g.Name, PreviousName: team.TeamName})
+			team.TeamName = g.Name
+			plan.renameTeams = append(plan.renameTeams, team)
+		} else {
+			report.Teams.Unchanged++
+		}
+
+		current, err := s.teamRepo.GetTeamMembers(ctx, team.TeamId)
+		if err != nil {
+			return err
+		}
+		p := plannedRoster{teamID: team.TeamId}
+		diff := DirectoryRosterChange{TeamID: team.TeamId, Team: g.Name, Additions: []RosterEntry{}, Removals: []RosterEntry{}, RoleChanges: []RosterRoleChange{}}
+		onTeam := make(map[string]bool, len(current))
+		for _, r := range current {
+			onTeam[r.UserId] = true
+			isLeader, listed := want[r.UserId]
+			switch {
+			case !listed:
+				p.removals = append(p.removals, r)
+				diff.Removals = append(diff.Removals, RosterEntry{UserID: r.UserId, Role: entities.RosterRole(r.IsLeader)})
+			case isLeader != r.IsLeader:
+				p.roleChanges = append(p.roleChanges, entities.Roster{TeamId: team.TeamId, UserId: r.UserId, IsLeader: isLeader})
+				diff.RoleChanges = append(diff.RoleChanges, RosterRoleChange{UserID: r.UserId, From: entities.RosterRole(r.IsLeader), To: entities.RosterRole(isLeader)})
+			}
+		}
+		for _, id := range sortedKeys(want) {
+			if !onTeam[id] {
+				p.additions = append(p.additions, entities.Roster{TeamId: team.TeamId, UserId: id, IsLeader: want[id]})
+				diff.Additions = append(diff.Additions, RosterEntry{UserID: id, Role: entities.RosterRole(want[id])})
+			}
+		}
+		if len(diff.Additions)+len(diff.Removals)+len(diff.RoleChanges) > 0 {
+			plan.rosters = append(plan.rosters, p)
+			report.Rosters = append(report.Rosters, diff)
+		}
+	}
+
+	// Whatever is left was synced before but is no longer exported
+	for _, team := range teams {
+		if _, gone := byExternalID[team.ExternalID]; !gone {
+			continue
+		}
+		change := DirectoryTeamChange{TeamID: team.TeamId, ExternalID: team.ExternalID, Name: team.TeamName}
+		descendants, err := s.teamRepo.DescendantIDs(ctx, team.TeamId)
+		if err != nil {
+			return err
+		}
+		if len(descendants) > 0 {
+			change.Reason = "has sub-teams"
+			report.Teams.Skipped = append(report.Teams.Skipped, change)
+			continue
+		}
+		owns, err := s.teamRepo.OwnsFolders(ctx, team.TeamId)
+		if err != nil {
+			return err
+		}
+		if owns {
+			change.Reason = "owns team folders"
+			report.Teams.Skipped = append(report.Teams.Skipped, change)
+			continue
+		}
+		rosters, err := s.teamRepo.GetTeamMembers(ctx, team.TeamId)
+		if err != nil {
+			return err
+		}
+		diff := DirectoryRosterChange{TeamID: team.TeamId, Team: team.TeamName, Additions: []RosterEntry{}, Removals: []RosterEntry{}, RoleChanges: []RosterRoleChange{}}
+		for _, r := range rosters {
+			diff.Removals = append(diff.Removals, RosterEntry{UserID: r.UserId, Role: entities.RosterRole(r.IsLeader)})
+		}
+		t := team
+		plan.deleteTeams = append(plan.deleteTeams, plannedTeamDeletion{team: &t, rosters: rosters})
+		report.Teams.Deleted = append(report.Teams.Deleted, change)
+		if len(rosters) > 0 {
+			report.Rosters = append(report.Rosters, diff)
+		}
+	}
+	return nil
+}
+
+func (s *directorySyncService) apply(ctx context.Context, plan *directoryPlan) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		users := s.userRepo.WithTx(tx)
+		teams := s.teamRepo.WithTx(tx)
+
+		for _, u := range plan.saveUsers {
+			if err := users.Save(ctx, u); err != nil {
+				return fmt.Errorf("save user %s: %w", u.ID, err)
+			}
+		}
+		for _, p := range plan.createTeams {
+			if err := teams.Create(ctx, p.team); err != nil {
+				return fmt.Errorf("create team %s: %w", p.team.TeamName, err)
+			}
+			for _, r := range p.roster {
+				r.TeamId = p.team.TeamId
+				if err := teams.CreateRoster(ctx, &r, DirectorySyncActor); err != nil {
+					return err
+				}
+			}
+		}
+		for _, team := range plan.renameTeams {
+			if err := teams.Update(ctx, team); err != nil {
+				return fmt.Errorf("rename team %d: %w", team.TeamId, err)
+			}
+		}
+		for _, p := range plan.rosters {
+			for _, r := range p.removals {
+				if err := teams.DeleteRoster(ctx, p.teamID, r.UserId, r.IsLeader, DirectorySyncActor); err != nil {
+					return err
+				}
+			}
+			for _, r := range p.roleChanges {
+				if err := teams.UpdateRosterRole(ctx, p.teamID, r.UserId, r.IsLeader, DirectorySyncActor); err != nil {
+					return err
+				}
+			}
+			for i := range p.additions {
+				if err := teams.CreateRoster(ctx, &p.additions[i], DirectorySyncActor); err != nil {
+					return err
+				}
+			}
+		}
+		for _, d := range plan.deleteTeams {
+			for _, r := range d.rosters {
+				if err := teams.DeleteRoster(ctx, r.TeamId, r.UserId, r.IsLeader, DirectorySyncActor); err != nil {
+					return err
+				}
+			}
+			if err := teams.Delete(ctx, d.team.TeamId); err != nil {
+				return fmt.Errorf("delete team %d: %w", d.team.TeamId, err)
+			}
+		}
+		return nil
+	})
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
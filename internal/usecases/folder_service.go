@@ -1,43 +1,59 @@
 package usecases
 
 import (
+	"context"
 	"errors"
 	"team-service/internal/entities"
 	"team-service/internal/repository"
+	"team-service/pkg/tracing"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FolderService interface {
-	CreateFolder(name, ownerID string) (*entities.Folder, error)
-	GetFolder(id uint, userID string) (*entities.Folder, error)
-	UpdateFolder(id uint, name, userID string) (*entities.Folder, error)
-	DeleteFolder(id uint, userID string) error
+	// CreateFolder charges the owner's quota; role is their global role
+	CreateFolder(ctx context.Context, name, ownerID, role string) (*entities.Folder, error)
+	GetFolder(ctx context.Context, id uint, userID string) (*entities.Folder, error)
+	UpdateFolder(ctx context.Context, id uint, name, userID string) (*entities.Folder, error)
+	DeleteFolder(ctx context.Context, id uint, userID string) error
+
+	// Team-owned folders
+	CreateTeamFolder(ctx context.Context, teamID uint, name, creatorID string) (*entities.Folder, error)
+	ListTeamFolders(ctx context.Context, teamID uint) ([]entities.Folder, error)
 }
 
 type folderService struct {
 	folderRepo repository.FolderRepository
 	noteRepo   repository.NoteRepository
 	shareRepo  repository.ShareRepository
+	teamRepo   repository.TeamRepository
+	quotas     QuotaService
 	db         *gorm.DB
 }
 
-func NewFolderService(folderRepo repository.FolderRepository, noteRepo repository.NoteRepository, shareRepo repository.ShareRepository, db *gorm.DB) FolderService {
+func NewFolderService(folderRepo repository.FolderRepository, noteRepo repository.NoteRepository, shareRepo repository.ShareRepository, teamRepo repository.TeamRepository, quotas QuotaService, db *gorm.DB) FolderService {
 	return &folderService{
 		folderRepo: folderRepo,
 		noteRepo:   noteRepo,
 		shareRepo:  shareRepo,
+		teamRepo:   teamRepo,
+		quotas:     quotas,
 		db:         db,
 	}
 }
 
-func (s *folderService) CreateFolder(name, ownerID string) (*entities.Folder, error) {
+func (s *folderService) CreateFolder(ctx context.Context, name, ownerID, role string) (*entities.Folder, error) {
+	ctx, span := tracing.Start(ctx, "FolderService.CreateFolder")
+	defer span.End()
+
 	folder := &entities.Folder{
-		Name:    name,
-		OwnerID: ownerID,
+		Name:      name,
+		OwnerID:   ownerID,
+		CreatedBy: ownerID,
 	}
 
-	err := s.folderRepo.Create(folder)
+	err := s.create(ctx, folder, ownerID, role)
 	if err != nil {
 		return nil, err
 	}
@@ -45,26 +61,37 @@ func (s *folderService) CreateFolder(name, ownerID string) (*entities.Folder, er
 	return folder, nil
 }
 
-func (s *folderService) GetFolder(id uint, userID string) (*entities.Folder, error) {
-	folder, err := s.folderRepo.GetByIDWithAccess(id, userID)
+func (s *folderService) GetFolder(ctx context.Context, id uint, userID string) (*entities.Folder, error) {
+	ctx, span := tracing.Start(ctx, "FolderService.GetFolder")
+	defer span.End()
+
+	folder, err := s.folderRepo.GetByIDWithAccess(ctx, id, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.getTeamFolder(ctx, id, userID)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return folder, nil
 }
 
-func (s *folderService) UpdateFolder(id uint, name, userID string) (*entities.Folder, error) {
-	folder, err := s.folderRepo.GetByID(id)
+func (s *folderService) UpdateFolder(ctx context.Context, id uint, name, userID string) (*entities.Folder, error) {
+	ctx, span := tracing.Start(ctx, "FolderService.UpdateFolder")
+	defer span.End()
+
+	folder, err := s.folderRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	if folder.OwnerID != userID {
+	if ok, err := s.administers(ctx, folder, userID); err != nil {
+		return nil, err
+	} else if !ok {
 		return nil, errors.New("not authorized or folder not found")
 	}
 
 	folder.Name = name
-	err = s.folderRepo.Update(folder)
+	err = s.folderRepo.Update(ctx, folder)
 	if err != nil {
 		return nil, err
 	}
@@ -72,30 +99,46 @@ func (s *folderService) UpdateFolder(id uint, name, userID string) (*entities.Fo
 	return folder, nil
 }
 
-func (s *folderService) DeleteFolder(id uint, userID string) error {
-	folder, err := s.folderRepo.GetByID(id)
+func (s *folderService) DeleteFolder(ctx context.Context, id uint, userID string) error {
+	ctx, span := tracing.Start(ctx, "FolderService.DeleteFolder")
+	defer span.End()
+
+	folder, err := s.folderRepo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	if folder.OwnerID != userID {
+	if ok, err := s.administers(ctx, folder, userID); err != nil {
+		return err
+	} else if !ok {
 		return errors.New("not authorized or folder not found")
 	}
 
 	// Use transaction to delete folder and all related data
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Delete note shares for all notes in this folder
-		if err := tx.Exec(`
-			DELETE FROM note_shares 
-			WHERE note_id IN (SELECT id FROM notes WHERE folder_id = ?)
-		`, folder.ID).Error; err != nil {
+		folderNoteIDs := tx.Model(&entities.Note{}).Select("id").Where("folder_id = ?", folder.ID)
+		if err := tx.Where("note_id IN (?)", folderNoteIDs).Delete(&entities.NoteShare{}).Error; err != nil {
+			return err
+		}
+
+		// Delete access requests for the folder and its notes
+		if err := tx.Where("(asset_type = ? AND asset_id = ?) OR (asset_type = ? AND asset_id IN (?))",
+			entities.AssetFolder, folder.ID, entities.AssetNote, folderNoteIDs).Delete(&entities.AccessRequest{}).Error; err != nil {
 			return err
 		}
 
-		// Delete all notes in the folder
+		// Delete all notes in the folder, releasing their usage
+		var notes []entities.Note
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("folder_id = ?", folder.ID).Find(&notes).Error; err != nil {
+			return err
+		}
 		if err := tx.Where("folder_id = ?", folder.ID).Delete(&entities.Note{}).Error; err != nil {
 			return err
 		}
+		if err := adjustAll(ctx, s.quotas, tx, noteUsage(notes, true)); err != nil {
+			return err
+		}
 
 		// Delete folder shares
 		if err := tx.Where("folder_id = ?", folder.ID).Delete(&entities.FolderShare{}).Error; err != nil {
@@ -107,6 +150,73 @@ func (s *folderService) DeleteFolder(id uint, userID string) error {
 			return err
 		}
 
-		return nil
+		return s.quotas.Adjust(ctx, tx, folder.OwnerID, folder.TeamID, entities.UsageDelta{Folders: -1})
 	})
 }
+
+// CreateTeamFolder creates a folder owned by the team rather than by its creator
+func (s *folderService) CreateTeamFolder(ctx context.Context, teamID uint, name, creatorID string) (*entities.Folder, error) {
+	ctx, span := tracing.Start(ctx, "FolderService.CreateTeamFolder")
+	defer span.End()
+
+	if _, err := s.teamRepo.GetByID(ctx, teamID); errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTeamNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	folder := &entities.Folder{
+		Name:      name,
+		TeamID:    &teamID,
+		CreatedBy: creatorID,
+	}
+	if err := s.create(ctx, folder, creatorID, ""); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// create stores the folder and counts it against its owner's quota in one transaction
+func (s *folderService) create(ctx context.Context, folder *entities.Folder, actorID, actorRole string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.quotas.Charge(ctx, tx, folder.OwnerID, folder.TeamID, entities.UsageDelta{Folders: 1}, actorID, actorRole); err != nil {
+			return err
+		}
+		return tx.Create(folder).Error
+	})
+}
+
+func (s *folderService) ListTeamFolders(ctx context.Context, teamID uint) ([]entities.Folder, error) {
+	ctx, span := tracing.Start(ctx, "FolderService.ListTeamFolders")
+	defer span.End()
+
+	return s.folderRepo.GetByTeamID(ctx, teamID)
+}
+
+// getTeamFolder returns a team folder to anyone on the roster of its team or of a team above it
+func (s *folderService) getTeamFolder(ctx context.Context, id uint, userID string) (*entities.Folder, error) {
+	folder, err := s.folderRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !folder.IsTeamOwned() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	ok, err := s.teamRepo.IsUserInTeamTree(ctx, userID, *folder.TeamID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return folder, nil
+}
+
+// administers reports whether userID may rename or delete the folder: its owner, or for team
+// folders anyone whose team role grants team:manage
+func (s *folderService) administers(ctx context.Context, folder *entities.Folder, userID string) (bool, error) {
+	if !folder.IsTeamOwned() {
+		return folder.OwnerID == userID, nil
+	}
+	return s.teamRepo.HasPermission(ctx, userID, *folder.TeamID, entities.TeamPermManageTeam)
+}
@@ -0,0 +1,24 @@
+package usecases
+
+import (
+	"path/filepath"
+	"testing"
+
+	"team-service/pkg/db"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// newTestDB opens a migrated SQLite database that lives as long as the test
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	database, err := db.Connect("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close(database) })
+	// Lookups that find nothing are expected; keep them out of the test output
+	database.Logger = gormlogger.Discard
+	return database
+}
@@ -0,0 +1,114 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// idempotencyLockTimeout is how long an unfinished request holds its key before a retry may take it over
+const idempotencyLockTimeout = time.Minute
+
+var (
+	ErrIdempotencyMismatch   = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+type IdempotencyService interface {
+	// Begin claims key for a new request, or returns the completed record to replay
+	Begin(ctx context.Context, userID, key, fingerprint string) (record *entities.IdempotencyRecord, replay bool, err error)
+	Complete(ctx context.Context, record *entities.IdempotencyRecord, status int, contentType, body string) error
+	Release(ctx context.Context, record *entities.IdempotencyRecord) error
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type idempotencyService struct {
+	repo repository.IdempotencyRepository
+	ttl  time.Duration
+}
+
+// NewIdempotencyService keeps responses for ttl after the first request
+func NewIdempotencyService(repo repository.IdempotencyRepository, ttl time.Duration) IdempotencyService {
+	return &idempotencyService{
+		repo: repo,
+		ttl:  ttl,
+	}
+}
+
+func (s *idempotencyService) Begin(ctx context.Context, userID, key, fingerprint string) (*entities.IdempotencyRecord, bool, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Begin")
+	defer span.End()
+
+	// Two attempts: the second follows clearing an expired or abandoned record
+	for attempt := 0; attempt < 2; attempt++ {
+		now := time.Now()
+		record := &entities.IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			Fingerprint: fingerprint,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(s.ttl),
+		}
+		claimed, err := s.repo.Insert(ctx, record)
+		if err != nil {
+			return nil, false, err
+		}
+		if claimed {
+			return record, false, nil
+		}
+
+		existing, err := s.repo.Get(ctx, userID, key)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Deleted between our insert and read; try to claim it again
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		abandoned := existing.Status == 0 && now.Sub(existing.CreatedAt) > idempotencyLockTimeout
+		if now.After(existing.ExpiresAt) || abandoned {
+			if err := s.repo.Delete(ctx, existing.ID); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+
+		if existing.Fingerprint != fingerprint {
+			return nil, false, ErrIdempotencyMismatch
+		}
+		if existing.Status == 0 {
+			return nil, false, ErrIdempotencyInProgress
+		}
+		return existing, true, nil
+	}
+
+	return nil, false, ErrIdempotencyInProgress
+}
+
+func (s *idempotencyService) Complete(ctx context.Context, record *entities.IdempotencyRecord, status int, contentType, body string) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Complete")
+	defer span.End()
+
+	return s.repo.Complete(ctx, record.ID, status, contentType, body)
+}
+
+// Release frees the key after a failure that the client should be able to retry
+func (s *idempotencyService) Release(ctx context.Context, record *entities.IdempotencyRecord) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Release")
+	defer span.End()
+
+	return s.repo.Delete(ctx, record.ID)
+}
+
+func (s *idempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.PurgeExpired")
+	defer span.End()
+
+	return s.repo.DeleteExpired(ctx, time.Now())
+}
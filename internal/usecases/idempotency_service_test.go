@@ -0,0 +1,121 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+)
+
+func TestIdempotencyBegin(t *testing.T) {
+	const fingerprint = "POST /folders\n{}"
+	now := time.Now()
+	tests := []struct {
+		name string
+		// existing is the record a previous request left behind, if any
+		existing *entities.IdempotencyRecord
+		wantErr  error
+		replay   bool
+	}{
+		{name: "new key"},
+		{
+			name:     "completed",
+			existing: &entities.IdempotencyRecord{Fingerprint: fingerprint, Status: 201, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+			replay:   true,
+		},
+		{
+			name:     "completed with another request",
+			existing: &entities.IdempotencyRecord{Fingerprint: "POST /folders\n{\"name\":\"x\"}", Status: 201, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+			wantErr:  ErrIdempotencyMismatch,
+		},
+		{
+			name:     "in flight",
+			existing: &entities.IdempotencyRecord{Fingerprint: fingerprint, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+			wantErr:  ErrIdempotencyInProgress,
+		},
+		{
+			// The first request died before completing; a retry takes the key over
+			name:     "abandoned",
+			existing: &entities.IdempotencyRecord{Fingerprint: fingerprint, CreatedAt: now.Add(-2 * idempotencyLockTimeout), ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			name:     "abandoned with another request",
+			existing: &entities.IdempotencyRecord{Fingerprint: "other", CreatedAt: now.Add(-2 * idempotencyLockTimeout), ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			name:     "expired",
+			existing: &entities.IdempotencyRecord{Fingerprint: "other", Status: 201, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			database := newTestDB(t)
+			service := NewIdempotencyService(repository.NewIdempotencyRepository(database), time.Hour)
+			if tt.existing != nil {
+				tt.existing.UserID, tt.existing.Key = "u1", "k1"
+				if err := database.Create(tt.existing).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			record, replay, err := service.Begin(ctx, "u1", "k1", fingerprint)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Begin = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if replay != tt.replay {
+				t.Fatalf("Begin replay = %v, want %v", replay, tt.replay)
+			}
+			if replay {
+				if record.ID != tt.existing.ID || record.Status != tt.existing.Status {
+					t.Errorf("replayed record %+v, want %+v", record, tt.existing)
+				}
+				return
+			}
+			// The caller owns a fresh claim on the key
+			if record.Status != 0 || record.Fingerprint != fingerprint {
+				t.Errorf("claimed record %+v", record)
+			}
+			var count int64
+			database.Model(&entities.IdempotencyRecord{}).Where("user_id = ? AND idempotency_key = ?", "u1", "k1").Count(&count)
+			if count != 1 {
+				t.Errorf("%d records for the key, want 1", count)
+			}
+		})
+	}
+}
+
+func TestIdempotencyCompleteAndRelease(t *testing.T) {
+	ctx := context.Background()
+	service := NewIdempotencyService(repository.NewIdempotencyRepository(newTestDB(t)), time.Hour)
+
+	record, _, err := service.Begin(ctx, "u1", "k1", "f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A server error releases the key so the retry runs again
+	if err := service.Release(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+	record, replay, err := service.Begin(ctx, "u1", "k1", "f")
+	if err != nil || replay {
+		t.Fatalf("Begin after release = %v, replay %v", err, replay)
+	}
+
+	if err := service.Complete(ctx, record, 201, "application/json", `{"id":1}`); err != nil {
+		t.Fatal(err)
+	}
+	replayed, replay, err := service.Begin(ctx, "u1", "k1", "f")
+	if err != nil || !replay {
+		t.Fatalf("Begin after completion = %v, replay %v", err, replay)
+	}
+	if replayed.Status != 201 || replayed.ContentType != "application/json" || replayed.Body != `{"id":1}` {
+		t.Errorf("replayed %+v", replayed)
+	}
+}
@@ -0,0 +1,315 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultInvitationLifetime = 7 * 24 * time.Hour
+	maxInvitationLifetime     = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidInvitation    = errors.New("invalid invitation request")
+	ErrInvitationNotFound   = errors.New("invitation not found")
+	ErrInvitationNotPending = errors.New("invitation is no longer pending")
+	ErrInvitationExists     = errors.New("a pending invitation already exists for this invitee")
+)
+
+type InvitationService interface {
+	Invite(ctx context.Context, teamID uint, inviterID, inviteeID, inviteeEmail, role string, expiresInDays int, inviterPermissions []string) (*entities.TeamInvitation, string, error)
+	ListTeamInvitations(ctx context.Context, teamID uint) ([]entities.TeamInvitation, error)
+	Rescind(ctx context.Context, teamID, invitationID uint) error
+	Inbox(ctx context.Context, userID string) ([]entities.TeamInvitation, error)
+	Accept(ctx context.Context, invitationID uint, userID, token string) (*entities.TeamInvitation, error)
+	Decline(ctx context.Context, invitationID uint, userID, token string) (*entities.TeamInvitation, error)
+}
+
+type invitationService struct {
+	invitationRepo repository.InvitationRepository
+	teamRepo       repository.TeamRepository
+	userRepo       repository.UserRepository
+	db             *gorm.DB
+}
+
+func NewInvitationService(invitationRepo repository.InvitationRepository, teamRepo repository.TeamRepository, userRepo repository.UserRepository, db *gorm.DB) InvitationService {
+	return &invitationService{
+		invitationRepo: invitationRepo,
+		teamRepo:       teamRepo,
+		userRepo:       userRepo,
+		db:             db,
+	}
+}
+
+// Invite creates a pending invitation and returns it with its single-use token, which is not stored.
+// inviterPermissions are the inviter's own permissions on the team; the invited role may not
+// grant more.
+func (s *invitationService) Invite(ctx context.Context, teamID uint, inviterID, inviteeID, inviteeEmail, role string, expiresInDays int, inviterPermissions []string) (*entities.TeamInvitation, string, error) {
+	ctx, span := tracing.Start(ctx, "InvitationService.Invite", attribute.Int64("team.id", int64(teamID)))
+	defer span.End()
+
+	inviteeID = strings.TrimSpace(inviteeID)
+	inviteeEmail = strings.TrimSpace(inviteeEmail)
+	role = strings.ToUpper(strings.TrimSpace(role))
+	if role == "" {
+		role = "MEMBER"
+	}
+
+	v := &ValidationError{}
+	if (inviteeID == "") == (inviteeEmail == "") {
+		v.add("userId", "exactly one of userId or email is required")
+	}
+	if inviteeEmail != "" && !strings.Contains(inviteeEmail, "@") {
+		v.add("email", "is not a valid email address")
+	}
+	if inviteeID != "" && inviteeID == inviterID {
+		v.add("userId", "you cannot invite yourself")
+	}
+	if role != "MEMBER" && role != "MANAGER" {
+		v.add("role", "must be MEMBER or MANAGER")
+	}
+	lifetime := defaultInvitationLifetime
+	if expiresInDays > 0 {
+		lifetime = time.Duration(expiresInDays) * 24 * time.Hour
+	}
+	if lifetime > maxInvitationLifetime {
+		v.add("expiresInDays", "must be at most %d", int(maxInvitationLifetime.Hours()/24))
+	}
+	if err := v.err(); err != nil {
+		return nil, "", err
+	}
+	if granted, _ := entities.BuiltinRolePermissions(role); !isSubset(granted, inviterPermissions) {
+		return nil, "", ErrPermissionEscalation
+	}
+
+	if _, err := s.teamRepo.GetByID(ctx, teamID); errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", fmt.Errorf("%w: team not found", ErrInvalidInvitation)
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	if inviteeID != "" {
+		onTeam, err := s.teamRepo.IsUserMemberOfTeam(ctx, inviteeID, teamID)
+		if err != nil {
+			return nil, "", err
+		}
+		if onTeam {
+			return nil, "", ErrAlreadyOnTeam
+		}
+	}
+
+	now := time.Now()
+	pending, err := s.invitationRepo.HasPending(ctx, teamID, inviteeID, inviteeEmail, now)
+	if err != nil {
+		return nil, "", err
+	}
+	if pending {
+		return nil, "", ErrInvitationExists
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	token := entities.InvitationTokenPrefix + hex.EncodeToString(secret)
+
+	invitation := &entities.TeamInvitation{
+		TeamID:       teamID,
+		InviteeID:    inviteeID,
+		InviteeEmail: inviteeEmail,
+		Role:         role,
+		InvitedBy:    inviterID,
+		TokenHash:    hashToken(token),
+		Status:       entities.InvitationPending,
+		ExpiresAt:    now.Add(lifetime),
+	}
+	if err := s.invitationRepo.Create(ctx, invitation); err != nil {
+		return nil, "", err
+	}
+
+	metrics.Invitations.WithLabelValues("sent").Inc()
+	return invitation, token, nil
+}
+
+func (s *invitationService) ListTeamInvitations(ctx context.Context, teamID uint) ([]entities.TeamInvitation, error) {
+	ctx, span := tracing.Start(ctx, "InvitationService.ListTeamInvitations", attribute.Int64("team.id", int64(teamID)))
+	defer span.End()
+
+	invitations, err := s.invitationRepo.ListByTeam(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return withEffectiveStatus(invitations), nil
+}
+
+func (s *invitationService) Rescind(ctx context.Context, teamID, invitationID uint) error {
+	ctx, span := tracing.Start(ctx, "InvitationService.Rescind", attribute.Int64("team.id", int64(teamID)))
+	defer span.End()
+
+	invitation, err := s.invitationRepo.GetByID(ctx, invitationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && invitation.TeamID != teamID) {
+		return ErrInvitationNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.invitationRepo.Respond(ctx, invitation.ID, entities.InvitationRescinded, "", time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvitationNotPending
+	}
+
+	metrics.Invitations.WithLabelValues("rescinded").Inc()
+	return nil
+}
+
+// Inbox lists pending invitations addressed to the user, by ID or by their directory email
+func (s *invitationService) Inbox(ctx context.Context, userID string) ([]entities.TeamInvitation, error) {
+	ctx, span := tracing.Start(ctx, "InvitationService.Inbox")
+	defer span.End()
+
+	email, err := s.directoryEmail(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.invitationRepo.ListPendingForInvitee(ctx, userID, email, time.Now())
+}
+
+// Accept puts the user on the roster and consumes the invitation in one transaction
+func (s *invitationService) Accept(ctx context.Context, invitationID uint, userID, token string) (*entities.TeamInvitation, error) {
+	ctx, span := tracing.Start(ctx, "InvitationService.Accept")
+	defer span.End()
+
+	invitation, err := s.authorize(ctx, invitationID, userID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ok, err := s.invitationRepo.WithTx(tx).Respond(ctx, invitation.ID, entities.InvitationAccepted, userID, now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvitationNotPending
+		}
+
+		roster := &entities.Roster{
+			TeamId:   invitation.TeamID,
+			UserId:   userID,
+			IsLeader: invitation.Role == "MANAGER",
+		}
+		if err := s.teamRepo.WithTx(tx).CreateRoster(ctx, roster, userID); errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrAlreadyOnTeam
+		} else if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.Status = entities.InvitationAccepted
+	invitation.AcceptedBy = userID
+	invitation.RespondedAt = &now
+	metrics.Invitations.WithLabelValues("accepted").Inc()
+	metrics.RosterChanges.WithLabelValues("add", strings.ToLower(invitation.Role)).Inc()
+	return invitation, nil
+}
+
+func (s *invitationService) Decline(ctx context.Context, invitationID uint, userID, token string) (*entities.TeamInvitation, error) {
+	ctx, span := tracing.Start(ctx, "InvitationService.Decline")
+	defer span.End()
+
+	invitation, err := s.authorize(ctx, invitationID, userID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ok, err := s.invitationRepo.Respond(ctx, invitation.ID, entities.InvitationDeclined, "", now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvitationNotPending
+	}
+
+	invitation.Status = entities.InvitationDeclined
+	invitation.RespondedAt = &now
+	metrics.Invitations.WithLabelValues("declined").Inc()
+	return invitation, nil
+}
+
+// authorize checks the caller may respond to the invitation. Invitations addressed to a user ID
+// can only be answered by that user; email invitations need the token or a matching directory email.
+// Invitations the caller may not see are reported as not found.
+func (s *invitationService) authorize(ctx context.Context, invitationID uint, userID, token string) (*entities.TeamInvitation, error) {
+	invitation, err := s.invitationRepo.GetByID(ctx, invitationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := false
+	switch {
+	case invitation.InviteeID != "":
+		allowed = invitation.InviteeID == userID
+	case token != "":
+		allowed = subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(invitation.TokenHash)) == 1
+	default:
+		email, err := s.directoryEmail(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		allowed = email != "" && strings.EqualFold(email, invitation.InviteeEmail)
+	}
+	if !allowed {
+		return nil, ErrInvitationNotFound
+	}
+
+	if status := invitation.EffectiveStatus(time.Now()); status != entities.InvitationPending {
+		return nil, fmt.Errorf("%w: invitation is %s", ErrInvitationNotPending, status)
+	}
+	return invitation, nil
+}
+
+func (s *invitationService) directoryEmail(ctx context.Context, userID string) (string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return user.Email, nil
+}
+
+func withEffectiveStatus(invitations []entities.TeamInvitation) []entities.TeamInvitation {
+	now := time.Now()
+	for i := range invitations {
+		invitations[i].Status = invitations[i].EffectiveStatus(now)
+	}
+	return invitations
+}
@@ -1,79 +1,128 @@
 package usecases
 
 import (
+	"context"
 	"errors"
 	"team-service/internal/entities"
 	"team-service/internal/repository"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type NoteService interface {
-	CreateNote(title, body string, folderID uint, userID string) (*entities.Note, error)
-	GetNote(id uint, userID string) (*entities.Note, error)
-	UpdateNote(id uint, title, body, userID string) (*entities.Note, error)
-	DeleteNote(id uint, userID string) error
+	// CreateNote and UpdateNote charge the owner's quota; role is the caller's global role
+	CreateNote(ctx context.Context, title, body string, folderID uint, userID, role string) (*entities.Note, error)
+	GetNote(ctx context.Context, id uint, userID string) (*entities.Note, error)
+	UpdateNote(ctx context.Context, id uint, title, body, userID, role string) (*entities.Note, error)
+	DeleteNote(ctx context.Context, id uint, userID string) error
 }
 
 type noteService struct {
 	noteRepo   repository.NoteRepository
 	folderRepo repository.FolderRepository
 	shareRepo  repository.ShareRepository
+	teamRepo   repository.TeamRepository
+	quotas     QuotaService
 	db         *gorm.DB
 }
 
-func NewNoteService(noteRepo repository.NoteRepository, folderRepo repository.FolderRepository, shareRepo repository.ShareRepository, db *gorm.DB) NoteService {
+func NewNoteService(noteRepo repository.NoteRepository, folderRepo repository.FolderRepository, shareRepo repository.ShareRepository, teamRepo repository.TeamRepository, quotas QuotaService, db *gorm.DB) NoteService {
 	return &noteService{
 		noteRepo:   noteRepo,
 		folderRepo: folderRepo,
 		shareRepo:  shareRepo,
+		teamRepo:   teamRepo,
+		quotas:     quotas,
 		db:         db,
 	}
 }
 
-func (s *noteService) CreateNote(title, body string, folderID uint, userID string) (*entities.Note, error) {
-	// Check if user owns the folder
-	folder, err := s.folderRepo.GetByID(folderID)
+func (s *noteService) CreateNote(ctx context.Context, title, body string, folderID uint, userID, role string) (*entities.Note, error) {
+	ctx, span := tracing.Start(ctx, "NoteService.CreateNote")
+	defer span.End()
+
+	// Check if user owns the folder, or may write to the team's folder
+	folder, err := s.folderRepo.GetByID(ctx, folderID)
 	if err != nil {
 		return nil, err
 	}
 
-	if folder.OwnerID != userID {
-		return nil, errors.New("folder not found or access denied")
-	}
-
 	note := &entities.Note{
-		Title:    title,
-		Body:     body,
-		FolderID: folderID,
-		OwnerID:  userID,
+		Title:     title,
+		Body:      body,
+		FolderID:  folderID,
+		OwnerID:   userID,
+		CreatedBy: userID,
+	}
+	if folder.IsTeamOwned() {
+		ok, err := s.teamRepo.HasPermission(ctx, userID, *folder.TeamID, entities.TeamPermWriteAssets)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("folder not found or access denied")
+		}
+		// Notes in a team folder belong to the team, like the folder itself
+		note.OwnerID = ""
+		note.TeamID = folder.TeamID
+	} else if folder.OwnerID != userID {
+		return nil, errors.New("folder not found or access denied")
 	}
 
-	err = s.noteRepo.Create(note)
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		delta := entities.UsageDelta{Notes: 1, Bytes: int64(len(body))}
+		if err := s.quotas.Charge(ctx, tx, note.OwnerID, note.TeamID, delta, userID, role); err != nil {
+			return err
+		}
+		return tx.Create(note).Error
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	metrics.NotesCreated.Inc()
 	return note, nil
 }
 
-func (s *noteService) GetNote(id uint, userID string) (*entities.Note, error) {
-	note, err := s.noteRepo.GetByIDWithAccess(id, userID)
+func (s *noteService) GetNote(ctx context.Context, id uint, userID string) (*entities.Note, error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetNote")
+	defer span.End()
+
+	note, err := s.noteRepo.GetByIDWithAccess(ctx, id, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.getTeamNote(ctx, id, userID)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return note, nil
 }
 
-func (s *noteService) UpdateNote(id uint, title, body, userID string) (*entities.Note, error) {
-	note, err := s.noteRepo.GetByID(id)
+func (s *noteService) UpdateNote(ctx context.Context, id uint, title, body, userID, role string) (*entities.Note, error) {
+	ctx, span := tracing.Start(ctx, "NoteService.UpdateNote")
+	defer span.End()
+
+	note, err := s.noteRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check ownership or write access
-	if note.OwnerID != userID {
-		share, err := s.shareRepo.GetNoteShare(note.ID, userID)
+	if note.IsTeamOwned() {
+		ok, err := s.teamRepo.HasPermission(ctx, userID, *note.TeamID, entities.TeamPermWriteAssets)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if share, err := s.shareRepo.GetNoteShare(ctx, note.ID, userID); err != nil || share.Access != "write" {
+				return nil, errors.New("write permission required")
+			}
+		}
+	} else if note.OwnerID != userID {
+		share, err := s.shareRepo.GetNoteShare(ctx, note.ID, userID)
 		if err != nil {
 			return nil, errors.New("access denied")
 		}
@@ -82,10 +131,20 @@ func (s *noteService) UpdateNote(id uint, title, body, userID string) (*entities
 		}
 	}
 
-	note.Title = title
-	note.Body = body
+	// The size change is measured against the body as it is inside the transaction
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(note, note.ID).Error; err != nil {
+			return err
+		}
+		delta := entities.UsageDelta{Bytes: int64(len(body) - len(note.Body))}
+		if err := s.quotas.Charge(ctx, tx, note.OwnerID, note.TeamID, delta, userID, role); err != nil {
+			return err
+		}
 
-	err = s.noteRepo.Update(note)
+		note.Title = title
+		note.Body = body
+		return tx.Save(note).Error
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -93,28 +152,64 @@ func (s *noteService) UpdateNote(id uint, title, body, userID string) (*entities
 	return note, nil
 }
 
-func (s *noteService) DeleteNote(id uint, userID string) error {
-	note, err := s.noteRepo.GetByID(id)
+func (s *noteService) DeleteNote(ctx context.Context, id uint, userID string) error {
+	ctx, span := tracing.Start(ctx, "NoteService.DeleteNote")
+	defer span.End()
+
+	note, err := s.noteRepo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	if note.OwnerID != userID {
+	if note.IsTeamOwned() {
+		ok, err := s.teamRepo.HasPermission(ctx, userID, *note.TeamID, entities.TeamPermWriteAssets)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("only the team's writers can delete the note")
+		}
+	} else if note.OwnerID != userID {
 		return errors.New("only owner can delete the note")
 	}
 
 	// Use transaction to delete note and all related shares
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		// Delete note shares
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Delete note shares and access requests
 		if err := tx.Where("note_id = ?", note.ID).Delete(&entities.NoteShare{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("asset_type = ? AND asset_id = ?", entities.AssetNote, note.ID).Delete(&entities.AccessRequest{}).Error; err != nil {
+			return err
+		}
 
-		// Delete the note
+		// Delete the note and release the usage of the body as it is inside the transaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(note, note.ID).Error; err != nil {
+			return err
+		}
 		if err := tx.Delete(&entities.Note{}, note.ID).Error; err != nil {
 			return err
 		}
-
-		return nil
+		delta := entities.UsageDelta{Notes: -1, Bytes: -int64(len(note.Body))}
+		return s.quotas.Adjust(ctx, tx, note.OwnerID, note.TeamID, delta)
 	})
 }
+
+// getTeamNote returns a team note to anyone on the roster of its team or of a team above it
+func (s *noteService) getTeamNote(ctx context.Context, id uint, userID string) (*entities.Note, error) {
+	note, err := s.noteRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !note.IsTeamOwned() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	ok, err := s.teamRepo.IsUserInTeamTree(ctx, userID, *note.TeamID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return note, nil
+}
@@ -0,0 +1,242 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
+
+	"gorm.io/gorm"
+)
+
+// Quota resources, as reported in QuotaExceededError
+const (
+	QuotaResourceNotes   = "notes"
+	QuotaResourceBytes   = "bytes"
+	QuotaResourceFolders = "folders"
+)
+
+// ErrQuotaExceeded is wrapped by every QuotaExceededError
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaExceededError names the counter that would pass its limit
+type QuotaExceededError struct {
+	Scope     string `json:"scope"`
+	SubjectID string `json:"subjectId"`
+	Resource  string `json:"resource"`
+	Limit     int64  `json:"limit"`
+	Usage     int64  `json:"usage"`
+	Requested int64  `json:"requested"`
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded for %s %s: %d in use, %d more requested, limit %d",
+		e.Resource, e.Scope, e.SubjectID, e.Usage, e.Requested, e.Limit)
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// QuotaPolicy holds the limits for users, by their global role, and for teams. Teams without
+// their own entry get TeamDefault; roles without an entry are unlimited.
+type QuotaPolicy struct {
+	Roles       map[string]entities.QuotaLimits
+	TeamDefault entities.QuotaLimits
+	Teams       map[uint]entities.QuotaLimits
+}
+
+// UsageReport is a subject's counters next to the limits that apply to it
+type UsageReport struct {
+	*entities.Usage
+	Limits entities.QuotaLimits `json:"limits"`
+}
+
+// defaultQuotaRole applies to owners who are not in the user directory
+const defaultQuotaRole = "MEMBER"
+
+// QuotaService keeps usage counters and enforces quotas. Charge and Adjust run inside the
+// caller's transaction, so the counters move together with the notes and folders they count.
+type QuotaService interface {
+	// Charge applies delta to the counters of the asset owner: the team for team-owned assets,
+	// otherwise the user. Growth past a limit fails with a QuotaExceededError.
+	Charge(ctx context.Context, tx *gorm.DB, ownerID string, teamID *uint, delta entities.UsageDelta, actorID, actorRole string) error
+	// Adjust applies delta without enforcing any limit, e.g. when an ADMIN moves assets
+	Adjust(ctx context.Context, tx *gorm.DB, ownerID string, teamID *uint, delta entities.UsageDelta) error
+
+	UserUsage(ctx context.Context, userID, role string) (*UsageReport, error)
+	TeamUsage(ctx context.Context, teamID uint) (*UsageReport, error)
+}
+
+type quotaService struct {
+	usageRepo repository.UsageRepository
+	userRepo  repository.UserRepository
+	policy    QuotaPolicy
+}
+
+func NewQuotaService(usageRepo repository.UsageRepository, userRepo repository.UserRepository, policy QuotaPolicy) QuotaService {
+	return &quotaService{
+		usageRepo: usageRepo,
+		userRepo:  userRepo,
+		policy:    policy,
+	}
+}
+
+func (s *quotaService) Charge(ctx context.Context, tx *gorm.DB, ownerID string, teamID *uint, delta entities.UsageDelta, actorID, actorRole string) error {
+	ctx, span := tracing.Start(ctx, "QuotaService.Charge")
+	defer span.End()
+
+	scope, subjectID := usageSubject(ownerID, teamID)
+	limits, err := s.limits(ctx, scope, ownerID, teamID, actorID, actorRole)
+	if err != nil {
+		return err
+	}
+
+	repo := s.usageRepo.WithTx(tx)
+	ok, err := repo.Charge(ctx, scope, subjectID, delta, limits)
+	if err != nil || ok {
+		return err
+	}
+
+	usage, err := repo.Get(ctx, scope, subjectID)
+	if err != nil {
+		return err
+	}
+	exceeded := exceededQuota(usage, delta, limits)
+	metrics.QuotaRejections.WithLabelValues(scope, exceeded.Resource).Inc()
+	return exceeded
+}
+
+func (s *quotaService) Adjust(ctx context.Context, tx *gorm.DB, ownerID string, teamID *uint, delta entities.UsageDelta) error {
+	ctx, span := tracing.Start(ctx, "QuotaService.Adjust")
+	defer span.End()
+
+	scope, subjectID := usageSubject(ownerID, teamID)
+	return s.usageRepo.WithTx(tx).Adjust(ctx, scope, subjectID, delta)
+}
+
+func (s *quotaService) UserUsage(ctx context.Context, userID, role string) (*UsageReport, error) {
+	ctx, span := tracing.Start(ctx, "QuotaService.UserUsage")
+	defer span.End()
+
+	usage, err := s.usageRepo.Get(ctx, entities.UsageScopeUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &UsageReport{Usage: usage, Limits: s.policy.Roles[role]}, nil
+}
+
+func (s *quotaService) TeamUsage(ctx context.Context, teamID uint) (*UsageReport, error) {
+	ctx, span := tracing.Start(ctx, "QuotaService.TeamUsage")
+	defer span.End()
+
+	_, subjectID := usageSubject("", &teamID)
+	usage, err := s.usageRepo.Get(ctx, entities.UsageScopeTeam, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	return &UsageReport{Usage: usage, Limits: s.teamLimits(teamID)}, nil
+}
+
+// limits resolves the quota of the asset owner. A user's limits follow their global role: the
+// actor's own when they are the owner, otherwise the owner's role in the user directory.
+func (s *quotaService) limits(ctx context.Context, scope, ownerID string, teamID *uint, actorID, actorRole string) (entities.QuotaLimits, error) {
+	if scope == entities.UsageScopeTeam {
+		return s.teamLimits(*teamID), nil
+	}
+	role := actorRole
+	if ownerID != actorID {
+		user, err := s.userRepo.GetByID(ctx, ownerID)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			role = defaultQuotaRole
+		case err != nil:
+			return entities.QuotaLimits{}, err
+		default:
+			role = user.Role
+		}
+	}
+	return s.policy.Roles[role], nil
+}
+
+func (s *quotaService) teamLimits(teamID uint) entities.QuotaLimits {
+	if limits, ok := s.policy.Teams[teamID]; ok {
+		return limits
+	}
+	return s.policy.TeamDefault
+}
+
+// usageSubject names the counters an asset is charged to
+func usageSubject(ownerID string, teamID *uint) (string, string) {
+	if teamID != nil {
+		return entities.UsageScopeTeam, strconv.FormatUint(uint64(*teamID), 10)
+	}
+	return entities.UsageScopeUser, ownerID
+}
+
+// exceededQuota reports the first counter that delta pushes past its limit
+func exceededQuota(usage *entities.Usage, delta entities.UsageDelta, limits entities.QuotaLimits) *QuotaExceededError {
+	err := &QuotaExceededError{Scope: usage.Scope, SubjectID: usage.SubjectID}
+	switch {
+	case delta.Notes > 0 && limits.MaxNotes > 0 && usage.Notes+delta.Notes > limits.MaxNotes:
+		err.Resource, err.Limit, err.Usage, err.Requested = QuotaResourceNotes, limits.MaxNotes, usage.Notes, delta.Notes
+	case delta.Folders > 0 && limits.MaxFolders > 0 && usage.Folders+delta.Folders > limits.MaxFolders:
+		err.Resource, err.Limit, err.Usage, err.Requested = QuotaResourceFolders, limits.MaxFolders, usage.Folders, delta.Folders
+	default:
+		err.Resource, err.Limit, err.Usage, err.Requested = QuotaResourceBytes, limits.MaxBytes, usage.Bytes, delta.Bytes
+	}
+	return err
+}
+
+// usageOwner identifies whose counters an asset is charged to, in a form usable as a map key
+type usageOwner struct {
+	ownerID string
+	teamID  uint
+	team    bool
+}
+
+func ownerOf(ownerID string, teamID *uint) usageOwner {
+	if teamID != nil {
+		return usageOwner{teamID: *teamID, team: true}
+	}
+	return usageOwner{ownerID: ownerID}
+}
+
+func (o usageOwner) teamIDPtr() *uint {
+	if !o.team {
+		return nil
+	}
+	id := o.teamID
+	return &id
+}
+
+// noteUsage sums the usage of notes per owner, negated when releasing them
+func noteUsage(notes []entities.Note, release bool) map[usageOwner]entities.UsageDelta {
+	sign := int64(1)
+	if release {
+		sign = -1
+	}
+	usage := make(map[usageOwner]entities.UsageDelta)
+	for _, n := range notes {
+		key := ownerOf(n.OwnerID, n.TeamID)
+		d := usage[key]
+		d.Notes += sign
+		d.Bytes += sign * int64(len(n.Body))
+		usage[key] = d
+	}
+	return usage
+}
+
+// adjustAll applies a delta per owner, without enforcing limits
+func adjustAll(ctx context.Context, quotas QuotaService, tx *gorm.DB, usage map[usageOwner]entities.UsageDelta) error {
+	for owner, delta := range usage {
+		if err := quotas.Adjust(ctx, tx, owner.ownerID, owner.teamIDPtr(), delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"team-service/internal/entities"
+)
+
+func TestTeamHistoryAsOf(t *testing.T) {
+	ctx := context.Background()
+	service, teamRepo, database := newTestTeamService(t)
+	team := addTeam(t, database, "history", nil)
+	day := func(d int) time.Time { return time.Date(2026, time.March, d, 9, 0, 0, 0, time.UTC) }
+	left := func(d int) *time.Time { at := day(d); return &at }
+
+	// ada joined on the 1st and was made manager on the 10th; alan was on the team from the
+	// 5th to the 20th and came back on the 25th
+	for _, interval := range []entities.RosterInterval{
+		{TeamID: team, UserID: "ada", Role: entities.RosterRoleMember, JoinedAt: day(1), LeftAt: left(10)},
+		{TeamID: team, UserID: "ada", Role: entities.RosterRoleManager, JoinedAt: day(10)},
+		{TeamID: team, UserID: "alan", Role: entities.RosterRoleMember, JoinedAt: day(5), LeftAt: left(20)},
+		{TeamID: team, UserID: "alan", Role: entities.RosterRoleMember, JoinedAt: day(25)},
+	} {
+		interval := interval
+		if err := database.Create(&interval).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want []string
+	}{
+		{"before anyone joined", day(1).Add(-time.Second), nil},
+		{"the instant of joining", day(1), []string{"ada:MEMBER"}},
+		{"both on the team", day(7), []string{"ada:MEMBER", "alan:MEMBER"}},
+		// The role change closes one interval and opens the next at the same instant
+		{"the instant of a role change", day(10), []string{"ada:MANAGER", "alan:MEMBER"}},
+		{"the instant of leaving", day(20), []string{"ada:MANAGER"}},
+		{"between stints", day(22), []string{"ada:MANAGER"}},
+		{"after rejoining", day(26), []string{"ada:MANAGER", "alan:MEMBER"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := tt.at
+			intervals, err := service.TeamHistory(ctx, team, &at)
+			if err != nil {
+				t.Fatalf("TeamHistory: %v", err)
+			}
+			var got []string
+			for _, i := range intervals {
+				got = append(got, i.UserID+":"+i.Role)
+			}
+			sort.Strings(got)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("roster as of %v = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+
+	all, err := service.TeamHistory(ctx, team, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Errorf("full history has %d intervals, want 4", len(all))
+	}
+	// Team assets as of an instant are looked up through the same intervals
+	users, err := teamRepo.GetUsersByTeamIDsAt(ctx, []uint{team}, day(22))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(users) != "[ada]" {
+		t.Errorf("users on the team as of the 22nd = %v, want [ada]", users)
+	}
+	alan, err := service.UserTeamHistory(ctx, "alan", left(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alan) != 1 || alan[0].TeamID != team {
+		t.Errorf("alan's teams as of the 7th = %+v", alan)
+	}
+}
+
+// TestRosterChangesRecordHistory checks that roster writes open and close intervals so past
+// rosters can be read back
+func TestRosterChangesRecordHistory(t *testing.T) {
+	ctx := context.Background()
+	service, teamRepo, database := newTestTeamService(t)
+	team := addTeam(t, database, "recorded", nil)
+	// Interval boundaries are taken from the clock; step past them so instants fall cleanly
+	// on one side
+	tick := func() time.Time {
+		time.Sleep(10 * time.Millisecond)
+		at := time.Now()
+		time.Sleep(10 * time.Millisecond)
+		return at
+	}
+
+	before := tick()
+	if err := teamRepo.CreateRoster(ctx, &entities.Roster{TeamId: team, UserId: "grace"}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	asMember := tick()
+	if err := teamRepo.SetRosterRole(ctx, team, "grace", entities.RosterRoleManager, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	asManager := tick()
+	if err := teamRepo.DeleteRoster(ctx, team, "grace", true, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	after := tick()
+
+	for _, tt := range []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{"before joining", before, ""},
+		{"as a member", asMember, entities.RosterRoleMember},
+		{"as a manager", asManager, entities.RosterRoleManager},
+		{"after removal", after, ""},
+	} {
+		at := tt.at
+		intervals, err := service.TeamHistory(ctx, team, &at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if len(intervals) == 1 {
+			got = intervals[0].Role
+		} else if len(intervals) > 1 {
+			t.Fatalf("%s: %d intervals cover one instant: %+v", tt.name, len(intervals), intervals)
+		}
+		if got != tt.want {
+			t.Errorf("%s: role %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	intervals, err := service.TeamHistory(ctx, team, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range intervals {
+		if i.LeftAt == nil {
+			t.Errorf("interval %+v is still open after the user left", i)
+		}
+	}
+}
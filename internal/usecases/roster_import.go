@@ -0,0 +1,155 @@
+package usecases
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"team-service/internal/entities"
+)
+
+// maxRosterImportRows bounds a single import so it fits in one transaction
+const maxRosterImportRows = 5000
+
+// RosterCSVHeader is the column order used by roster exports
+var RosterCSVHeader = []string{"userId", "name", "role"}
+
+// RosterEntry is one line of an imported or exported roster. Name is filled in from the user
+// directory; the name column of an imported file is not applied.
+type RosterEntry struct {
+	UserID string `json:"userId"`
+	Name   string `json:"name,omitempty"`
+	Role   string `json:"role"`
+}
+
+// RosterRoleChange is a user who stays on the team with a different role
+type RosterRoleChange struct {
+	UserID string `json:"userId"`
+	Name   string `json:"name,omitempty"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// RosterDiff is what an import changes, or would change on a dry run
+type RosterDiff struct {
+	DryRun      bool               `json:"dryRun"`
+	Additions   []RosterEntry      `json:"additions"`
+	Removals    []RosterEntry      `json:"removals"`
+	RoleChanges []RosterRoleChange `json:"roleChanges"`
+	Unchanged   int                `json:"unchanged"`
+}
+
+// ParseRosterCSV reads a roster with a header row naming the userId and role columns, in any
+// order; role defaults to MEMBER. Roles other than MEMBER and MANAGER name custom team roles.
+// Other columns, such as the name column of an export, are ignored so exports can be
+// re-imported. Every problem is reported with its line number.
+func ParseRosterCSV(r io.Reader) ([]RosterEntry, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	// Short rows are reported per line below instead of aborting the whole parse
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, &ValidationError{Problems: []FieldError{{Line: 1, Field: "header", Message: "the file is empty"}}}
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		columns[strings.ToLower(name)] = i
+	}
+	userCol, ok := columns["userid"]
+	if !ok {
+		return nil, &ValidationError{Problems: []FieldError{{Line: 1, Field: "header", Message: "a userId column is required"}}}
+	}
+	roleCol, hasRole := columns["role"]
+
+	v := &ValidationError{}
+	var entries []RosterEntry
+	seen := make(map[string]int)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, csvError(err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		if len(entries) >= maxRosterImportRows {
+			v.addLine(line, "file", "at most %d rows can be imported at once", maxRosterImportRows)
+			break
+		}
+
+		if len(record) != len(header) {
+			v.addLine(line, "file", "expected %d columns, found %d", len(header), len(record))
+			continue
+		}
+
+		entry := RosterEntry{
+			UserID: strings.TrimSpace(record[userCol]),
+			Role:   entities.RosterRoleMember,
+		}
+		if hasRole {
+			if role := strings.TrimSpace(record[roleCol]); role != "" {
+				entry.Role = normalizeRosterRole(role)
+			}
+		}
+
+		switch {
+		case entry.UserID == "":
+			v.addLine(line, "userId", "is required")
+		case seen[entry.UserID] != 0:
+			v.addLine(line, "userId", "%q is already listed on line %d", entry.UserID, seen[entry.UserID])
+		default:
+			seen[entry.UserID] = line
+		}
+		if _, builtin := entities.BuiltinRolePermissions(entry.Role); !builtin && !entities.IsValidTeamRoleName(entry.Role) {
+			v.addLine(line, "role", "must be MEMBER, MANAGER or the name of a team role")
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// normalizeRosterRole upper-cases the built-in roles and lower-cases custom role names
+func normalizeRosterRole(role string) string {
+	if upper := strings.ToUpper(role); upper == entities.RosterRoleManager || upper == entities.RosterRoleMember {
+		return upper
+	}
+	return strings.ToLower(role)
+}
+
+// WriteRosterCSV writes entries with the export header
+func WriteRosterCSV(w io.Writer, entries []RosterEntry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(RosterCSVHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := writer.Write([]string{e.UserID, e.Name, e.Role}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvError turns a malformed-CSV error into a validation problem on the offending line
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &ValidationError{Problems: []FieldError{{Line: parseErr.StartLine, Field: "file", Message: parseErr.Err.Error()}}}
+	}
+	return fmt.Errorf("read roster: %w", err)
+}
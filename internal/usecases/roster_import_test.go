@@ -0,0 +1,245 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// seedRoster creates a root team with custom roles "editor" (assets:write) and "auditor"
+// (assets:view) and puts users on it with the given roles
+func seedRoster(t *testing.T, teamRepo repository.TeamRepository, database *gorm.DB, roster map[string]string) uint {
+	t.Helper()
+	ctx := context.Background()
+	team := addTeam(t, database, "imported", nil)
+	for name, perms := range map[string][]string{
+		"editor":  {entities.TeamPermWriteAssets},
+		"auditor": {entities.TeamPermViewAssets},
+	} {
+		if err := database.Create(&entities.TeamRole{TeamID: team, Name: name, Permissions: perms}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for userID, role := range roster {
+		if err := teamRepo.CreateRoster(ctx, &entities.Roster{TeamId: team, UserId: userID, Role: role}, "seed"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return team
+}
+
+// rosterOf lists the team's roster as sorted "user:role" pairs
+func rosterOf(t *testing.T, teamRepo repository.TeamRepository, teamID uint) []string {
+	t.Helper()
+	rosters, err := teamRepo.GetTeamMembers(context.Background(), teamID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range rosters {
+		got = append(got, r.UserId+":"+r.Role)
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestImportRosterDiff(t *testing.T) {
+	ctx := context.Background()
+	service, teamRepo, database := newTestTeamService(t)
+	team := seedRoster(t, teamRepo, database, map[string]string{
+		"lead":  entities.RosterRoleManager,
+		"ada":   entities.RosterRoleMember,
+		"alan":  entities.RosterRoleMember,
+		"grace": "editor",
+	})
+	before := rosterOf(t, teamRepo, team)
+	entries := []RosterEntry{
+		{UserID: "lead", Role: entities.RosterRoleManager},
+		{UserID: "ada", Role: entities.RosterRoleManager},
+		{UserID: "grace", Role: entities.RosterRoleMember},
+		{UserID: "linus", Role: "editor"},
+	}
+	check := func(diff *RosterDiff) {
+		t.Helper()
+		if fmt.Sprint(diff.Additions) != fmt.Sprint([]RosterEntry{{UserID: "linus", Role: "editor"}}) {
+			t.Errorf("additions = %+v", diff.Additions)
+		}
+		if fmt.Sprint(diff.Removals) != fmt.Sprint([]RosterEntry{{UserID: "alan", Role: entities.RosterRoleMember}}) {
+			t.Errorf("removals = %+v", diff.Removals)
+		}
+		changes := []RosterRoleChange{
+			{UserID: "ada", From: entities.RosterRoleMember, To: entities.RosterRoleManager},
+			{UserID: "grace", From: "editor", To: entities.RosterRoleMember},
+		}
+		if fmt.Sprint(diff.RoleChanges) != fmt.Sprint(changes) {
+			t.Errorf("role changes = %+v, want %+v", diff.RoleChanges, changes)
+		}
+		if diff.Unchanged != 1 {
+			t.Errorf("unchanged = %d, want 1", diff.Unchanged)
+		}
+	}
+
+	diff, err := service.ImportRoster(ctx, team, entries, "lead", entities.TeamPermissions, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if !diff.DryRun {
+		t.Error("dry run diff is not marked as one")
+	}
+	check(diff)
+	if after := rosterOf(t, teamRepo, team); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Errorf("dry run changed the roster from %v to %v", before, after)
+	}
+
+	diff, err = service.ImportRoster(ctx, team, entries, "lead", entities.TeamPermissions, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	check(diff)
+	want := []string{"ada:MANAGER", "grace:MEMBER", "lead:MANAGER", "linus:editor"}
+	if after := rosterOf(t, teamRepo, team); fmt.Sprint(after) != fmt.Sprint(want) {
+		t.Errorf("roster after import = %v, want %v", after, want)
+	}
+
+	// Importing the same file again changes nothing
+	diff, err = service.ImportRoster(ctx, team, entries, "lead", entities.TeamPermissions, false)
+	if err != nil {
+		t.Fatalf("second import: %v", err)
+	}
+	if n := len(diff.Additions) + len(diff.Removals) + len(diff.RoleChanges); n != 0 || diff.Unchanged != len(entries) {
+		t.Errorf("second import diff = %+v, want no changes", diff)
+	}
+}
+
+func TestImportRosterChecksPermissions(t *testing.T) {
+	// The importer holds roster:manage and assets:write, like a custom "roster-admin" role
+	importer := []string{entities.TeamPermManageRoster, entities.TeamPermWriteAssets}
+	current := map[string]string{
+		"lead":  entities.RosterRoleManager,
+		"ada":   entities.RosterRoleMember,
+		"grace": "auditor",
+	}
+	unchanged := []RosterEntry{
+		{UserID: "lead", Role: entities.RosterRoleManager},
+		{UserID: "ada", Role: entities.RosterRoleMember},
+		{UserID: "grace", Role: "auditor"},
+	}
+	with := func(change func(entries []RosterEntry) []RosterEntry) []RosterEntry {
+		return change(append([]RosterEntry(nil), unchanged...))
+	}
+
+	var validation *ValidationError
+	tests := []struct {
+		name    string
+		entries []RosterEntry
+		// escalates or invalid, or neither when the import is allowed
+		escalates, invalid bool
+	}{
+		{name: "add a member", entries: with(func(e []RosterEntry) []RosterEntry {
+			return append(e, RosterEntry{UserID: "linus", Role: entities.RosterRoleMember})
+		})},
+		{name: "add a role within the importer's permissions", entries: with(func(e []RosterEntry) []RosterEntry {
+			return append(e, RosterEntry{UserID: "linus", Role: "editor"})
+		})},
+		{name: "add a manager", escalates: true, entries: with(func(e []RosterEntry) []RosterEntry {
+			return append(e, RosterEntry{UserID: "linus", Role: entities.RosterRoleManager})
+		})},
+		{name: "promote to manager", escalates: true, entries: with(func(e []RosterEntry) []RosterEntry {
+			e[1].Role = entities.RosterRoleManager
+			return e
+		})},
+		{name: "grant a role beyond the importer's permissions", escalates: true, entries: with(func(e []RosterEntry) []RosterEntry {
+			e[1].Role = "auditor"
+			return e
+		})},
+		{name: "take away a role beyond the importer's permissions", escalates: true, entries: with(func(e []RosterEntry) []RosterEntry {
+			e[2].Role = entities.RosterRoleMember
+			return e
+		})},
+		{name: "remove a holder of a role beyond the importer's permissions", escalates: true, entries: with(func(e []RosterEntry) []RosterEntry {
+			return e[:2]
+		})},
+		{name: "no manager left on a root team", invalid: true, entries: with(func(e []RosterEntry) []RosterEntry {
+			return e[1:]
+		})},
+		{name: "undefined role", invalid: true, entries: with(func(e []RosterEntry) []RosterEntry {
+			return append(e, RosterEntry{UserID: "linus", Role: "wizard"})
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, dryRun := range []bool{true, false} {
+				ctx := context.Background()
+				service, teamRepo, database := newTestTeamService(t)
+				team := seedRoster(t, teamRepo, database, current)
+				before := rosterOf(t, teamRepo, team)
+
+				_, err := service.ImportRoster(ctx, team, tt.entries, "importer", importer, dryRun)
+				switch {
+				case tt.escalates && !errors.Is(err, ErrPermissionEscalation):
+					t.Fatalf("dry run %v: ImportRoster = %v, want ErrPermissionEscalation", dryRun, err)
+				case tt.invalid && !errors.As(err, &validation):
+					t.Fatalf("dry run %v: ImportRoster = %v, want a validation error", dryRun, err)
+				case !tt.escalates && !tt.invalid && err != nil:
+					t.Fatalf("dry run %v: ImportRoster: %v", dryRun, err)
+				}
+				if err != nil {
+					if after := rosterOf(t, teamRepo, team); fmt.Sprint(after) != fmt.Sprint(before) {
+						t.Errorf("rejected import changed the roster from %v to %v", before, after)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseRosterCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []RosterEntry
+		invalid bool
+	}{
+		{
+			name: "export with names",
+			csv:  "userId,name,role\nada,Ada,manager\nalan,Alan,MEMBER\ngrace,Grace,Editor\n",
+			want: []RosterEntry{{UserID: "ada", Role: "MANAGER"}, {UserID: "alan", Role: "MEMBER"}, {UserID: "grace", Role: "editor"}},
+		},
+		{
+			name: "columns in any order, role defaults to MEMBER",
+			csv:  "\ufeffRole, UserID\n,ada\nmanager,alan\n",
+			want: []RosterEntry{{UserID: "ada", Role: "MEMBER"}, {UserID: "alan", Role: "MANAGER"}},
+		},
+		{name: "no userId column", csv: "name,role\nAda,MEMBER\n", invalid: true},
+		{name: "empty file", csv: "", invalid: true},
+		{name: "duplicate user", csv: "userId\nada\nada\n", invalid: true},
+		{name: "short row", csv: "userId,role\nada\n", invalid: true},
+		{name: "bad role name", csv: "userId,role\nada,Not A Role\n", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ParseRosterCSV(strings.NewReader(tt.csv))
+			if tt.invalid {
+				var validation *ValidationError
+				if !errors.As(err, &validation) {
+					t.Fatalf("ParseRosterCSV = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRosterCSV: %v", err)
+			}
+			if fmt.Sprint(entries) != fmt.Sprint(tt.want) {
+				t.Errorf("entries = %+v, want %+v", entries, tt.want)
+			}
+		})
+	}
+}
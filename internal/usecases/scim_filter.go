@@ -0,0 +1,133 @@
+package usecases
+
+import (
+	"net/http"
+	"strings"
+	"team-service/internal/repository"
+)
+
+// scimUserAttributes maps SCIM user attribute paths, lower-cased, onto searchable fields
+var scimUserAttributes = map[string]string{
+	"id":             "id",
+	"username":       "userName",
+	"externalid":     "externalId",
+	"displayname":    "displayName",
+	"name.formatted": "displayName",
+	"emails":         "email",
+	"emails.value":   "email",
+	"active":         "active",
+}
+
+// scimGroupAttributes maps SCIM group attribute paths, lower-cased, onto searchable fields
+var scimGroupAttributes = map[string]string{
+	"id":          "id",
+	"displayname": "displayName",
+	"externalid":  "externalId",
+}
+
+// parseSCIMFilter supports the filters identity providers send when reconciling: one or more
+// "attribute op value" comparisons joined by "and", with the eq, ne, co, sw, ew and pr operators.
+// "or", grouping and value paths are rejected with invalidFilter.
+func parseSCIMFilter(filter string, attributes map[string]string) ([]repository.AttrFilter, error) {
+	tokens, err := tokenizeSCIMFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var filters []repository.AttrFilter
+	for i := 0; i < len(tokens); {
+		if len(filters) > 0 {
+			if !strings.EqualFold(tokens[i], "and") {
+				return nil, invalidSCIMFilter("only \"and\" can join comparisons")
+			}
+			i++
+		}
+		if i+1 >= len(tokens) {
+			return nil, invalidSCIMFilter("expected \"attribute operator value\"")
+		}
+
+		field, ok := attributes[strings.ToLower(stripSCIMSchema(tokens[i]))]
+		if !ok {
+			return nil, invalidSCIMFilter("cannot filter on " + tokens[i])
+		}
+		op := strings.ToLower(tokens[i+1])
+		if op == repository.FilterPresent {
+			filters = append(filters, repository.AttrFilter{Field: field, Op: op})
+			i += 2
+			continue
+		}
+
+		switch op {
+		case repository.FilterEq, repository.FilterNe, repository.FilterCo, repository.FilterSw, repository.FilterEw:
+		default:
+			return nil, invalidSCIMFilter("unsupported operator " + tokens[i+1])
+		}
+		if i+2 >= len(tokens) {
+			return nil, invalidSCIMFilter("missing value for " + tokens[i])
+		}
+		filters = append(filters, repository.AttrFilter{Field: field, Op: op, Value: unquoteSCIMValue(tokens[i+2])})
+		i += 3
+	}
+	return filters, nil
+}
+
+// tokenizeSCIMFilter splits on spaces outside double-quoted strings, keeping the quotes
+func tokenizeSCIMFilter(filter string) ([]string, error) {
+	var tokens []string
+	var current strings.Builder
+	inQuotes, escaped := false, false
+	for _, r := range filter {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case inQuotes && r == '\\':
+			current.WriteRune(r)
+			escaped = true
+		case r == '"':
+			current.WriteRune(r)
+			inQuotes = !inQuotes
+		case !inQuotes && (r == '(' || r == ')' || r == '[' || r == ']'):
+			return nil, invalidSCIMFilter("grouping and value paths are not supported")
+		case !inQuotes && r == ' ':
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inQuotes {
+		return nil, invalidSCIMFilter("unterminated string")
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	if len(tokens) == 0 {
+		return nil, invalidSCIMFilter("filter is empty")
+	}
+	return tokens, nil
+}
+
+// stripSCIMSchema drops a schema URN prefix from a fully qualified attribute path
+func stripSCIMSchema(attr string) string {
+	if strings.HasPrefix(strings.ToLower(attr), "urn:") {
+		if i := strings.LastIndex(attr, ":"); i >= 0 {
+			return attr[i+1:]
+		}
+	}
+	return attr
+}
+
+func unquoteSCIMValue(v string) string {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		v = v[1 : len(v)-1]
+		v = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(v)
+	}
+	return v
+}
+
+func invalidSCIMFilter(detail string) *SCIMError {
+	return &SCIMError{Status: http.StatusBadRequest, ScimType: "invalidFilter", Detail: detail}
+}
@@ -0,0 +1,1074 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SCIM schema URNs (RFC 7643, RFC 7644)
+const (
+	SCIMSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// SCIMActor is recorded as the actor of roster changes made through provisioning
+const SCIMActor = "scim"
+
+const (
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+)
+
+// SCIMError is a protocol error, rendered with the SCIM error schema
+type SCIMError struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+func scimError(status int, scimType, format string, args ...interface{}) *SCIMError {
+	return &SCIMError{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+// SCIMMeta carries resource metadata
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// SCIMName is the structured name of a SCIM user
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// SCIMMultiValue is an entry of a multi-valued attribute such as emails or members
+type SCIMMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMUser is a directory user. The id is the user ID, which is also the userName.
+type SCIMUser struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	ExternalID  string           `json:"externalId,omitempty"`
+	UserName    string           `json:"userName"`
+	Name        *SCIMName        `json:"name,omitempty"`
+	DisplayName string           `json:"displayName,omitempty"`
+	Emails      []SCIMMultiValue `json:"emails,omitempty"`
+	Active      *bool            `json:"active,omitempty"`
+	Meta        *SCIMMeta        `json:"meta,omitempty"`
+}
+
+// SCIMGroup is a team; its members are the team's roster
+type SCIMGroup struct {
+	Schemas     []string          `json:"schemas"`
+	ID          string            `json:"id,omitempty"`
+	ExternalID  string            `json:"externalId,omitempty"`
+	DisplayName string            `json:"displayName"`
+	Members     *[]SCIMMultiValue `json:"members,omitempty"`
+	Meta        *SCIMMeta         `json:"meta,omitempty"`
+}
+
+// SCIMListResponse is a page of query results
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// SCIMQuery holds the list parameters of a query; StartIndex is 1-based
+type SCIMQuery struct {
+	Filter     string
+	StartIndex int
+	Count      *int
+}
+
+// SCIMPatch is a PatchOp request
+type SCIMPatch struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+// SCIMPatchOperation is one add, remove or replace operation
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type SCIMService interface {
+	ListUsers(ctx context.Context, query SCIMQuery) (*SCIMListResponse, error)
+	GetUser(ctx context.Context, id string) (*SCIMUser, error)
+	CreateUser(ctx context.Context, user SCIMUser) (*SCIMUser, error)
+	ReplaceUser(ctx context.Context, id string, user SCIMUser) (*SCIMUser, error)
+	PatchUser(ctx context.Context, id string, patch SCIMPatch) (*SCIMUser, error)
+	// DeleteUser deactivates the user and removes them from every team. The directory entry
+	// is kept so membership history still resolves and token claims cannot reactivate them.
+	// Inactive users are gone as far as GetUser and DeleteUser are concerned; PUT and PATCH
+	// still find them so they can be reactivated.
+	DeleteUser(ctx context.Context, id string) error
+
+	ListGroups(ctx context.Context, query SCIMQuery, withMembers bool) (*SCIMListResponse, error)
+	GetGroup(ctx context.Context, id string, withMembers bool) (*SCIMGroup, error)
+	CreateGroup(ctx context.Context, group SCIMGroup) (*SCIMGroup, error)
+	ReplaceGroup(ctx context.Context, id string, group SCIMGroup) (*SCIMGroup, error)
+	PatchGroup(ctx context.Context, id string, patch SCIMPatch) (*SCIMGroup, error)
+	DeleteGroup(ctx context.Context, id string) error
+}
+
+type scimService struct {
+	userRepo       repository.UserRepository
+	teamRepo       repository.TeamRepository
+	sessionService SessionService
+	db             *gorm.DB
+}
+
+// NewSCIMService provisions directory users and teams on behalf of an identity provider
+func NewSCIMService(userRepo repository.UserRepository, teamRepo repository.TeamRepository, sessionService SessionService, db *gorm.DB) SCIMService {
+	return &scimService{
+		userRepo:       userRepo,
+		teamRepo:       teamRepo,
+		sessionService: sessionService,
+		db:             db,
+	}
+}
+
+func (s *scimService) ListUsers(ctx context.Context, query SCIMQuery) (*SCIMListResponse, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.ListUsers")
+	defer span.End()
+
+	var filters []repository.AttrFilter
+	if strings.TrimSpace(query.Filter) != "" {
+		var err error
+		if filters, err = parseSCIMFilter(query.Filter, scimUserAttributes); err != nil {
+			return nil, err
+		}
+	}
+	startIndex, count := scimPage(query)
+
+	users, total, err := s.userRepo.Search(ctx, filters, count, startIndex-1)
+	if errors.Is(err, repository.ErrUnsupportedFilter) {
+		return nil, invalidSCIMFilter(err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]SCIMUser, 0, len(users))
+	for i := range users {
+		resources = append(resources, *toSCIMUser(&users[i]))
+	}
+	return scimList(total, startIndex, resources, len(resources)), nil
+}
+
+func (s *scimService) GetUser(ctx context.Context, id string) (*SCIMUser, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.GetUser")
+	defer span.End()
+
+	user, err := s.getActiveUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return toSCIMUser(user), nil
+}
+
+func (s *scimService) CreateUser(ctx context.Context, in SCIMUser) (*SCIMUser, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.CreateUser")
+	defer span.End()
+
+	id := strings.TrimSpace(in.UserName)
+	if id == "" {
+		return nil, scimError(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+	if _, err := s.userRepo.GetByID(ctx, id); err == nil {
+		return nil, scimError(http.StatusConflict, "uniqueness", "user %s already exists", id)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	user := &entities.User{ID: id, Role: "MEMBER", Active: true, Source: entities.UserSourceSCIM}
+	applySCIMUser(user, in)
+	active := user.Active
+	if err := s.userRepo.Save(ctx, user); err != nil {
+		return nil, err
+	}
+	// Active has a database default of true, which the insert applies to a false value too
+	if !active {
+		user.Active = false
+		if err := s.userRepo.Save(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	metrics.SCIMOperations.WithLabelValues("user", "create").Inc()
+	return toSCIMUser(user), nil
+}
+
+func (s *scimService) ReplaceUser(ctx context.Context, id string, in SCIMUser) (*SCIMUser, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.ReplaceUser")
+	defer span.End()
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if in.UserName != "" && in.UserName != user.ID {
+		return nil, scimError(http.StatusBadRequest, "mutability", "userName cannot be changed")
+	}
+
+	// PUT replaces every attribute, so anything the request leaves out is cleared
+	user.Name, user.GivenName, user.FamilyName, user.Email, user.ExternalID = "", "", "", "", ""
+	if in.Active == nil {
+		user.Active = true
+	}
+	applySCIMUser(user, in)
+	return s.saveUser(ctx, user, "replace")
+}
+
+func (s *scimService) PatchUser(ctx context.Context, id string, patch SCIMPatch) (*SCIMUser, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.PatchUser")
+	defer span.End()
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(patch.Operations) == 0 {
+		return nil, scimError(http.StatusBadRequest, "invalidValue", "Operations must not be empty")
+	}
+
+	for _, op := range patch.Operations {
+		if err := patchUser(user, op); err != nil {
+			return nil, err
+		}
+	}
+	return s.saveUser(ctx, user, "patch")
+}
+
+func (s *scimService) DeleteUser(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "SCIMService.DeleteUser")
+	defer span.End()
+
+	user, err := s.getActiveUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	rosters, err := s.teamRepo.GetRostersByUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Deactivate first so a failure part-way leaves the user locked out rather than half removed
+	user.Active = false
+	if err := s.userRepo.Save(ctx, user); err != nil {
+		return err
+	}
+	s.sessionService.ForgetUser(id)
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := s.teamRepo.WithTx(tx)
+		for _, r := range rosters {
+			// Rows removed meanwhile are already gone, which is all this asks for
+			err := repo.DeleteRoster(ctx, r.TeamId, r.UserId, r.IsLeader, SCIMActor)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rosters {
+		metrics.RosterChanges.WithLabelValues("remove", roleLabel(r.Role)).Inc()
+	}
+	metrics.SCIMOperations.WithLabelValues("user", "delete").Inc()
+	return nil
+}
+
+func (s *scimService) ListGroups(ctx context.Context, query SCIMQuery, withMembers bool) (*SCIMListResponse, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.ListGroups")
+	defer span.End()
+
+	var filters []repository.AttrFilter
+	if strings.TrimSpace(query.Filter) != "" {
+		var err error
+		if filters, err = parseSCIMFilter(query.Filter, scimGroupAttributes); err != nil {
+			return nil, err
+		}
+	}
+	startIndex, count := scimPage(query)
+
+	teams, total, err := s.teamRepo.Search(ctx, filters, count, startIndex-1)
+	if errors.Is(err, repository.ErrUnsupportedFilter) {
+		return nil, invalidSCIMFilter(err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]SCIMGroup, 0, len(teams))
+	for i := range teams {
+		group, err := s.toSCIMGroup(ctx, &teams[i], withMembers)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, *group)
+	}
+	return scimList(total, startIndex, resources, len(resources)), nil
+}
+
+func (s *scimService) GetGroup(ctx context.Context, id string, withMembers bool) (*SCIMGroup, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.GetGroup")
+	defer span.End()
+
+	team, err := s.getGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toSCIMGroup(ctx, team, withMembers)
+}
+
+// CreateGroup creates a root team. Identity providers do not say who leads a group, so the
+// team starts without managers; members are added with the member role.
+func (s *scimService) CreateGroup(ctx context.Context, in SCIMGroup) (*SCIMGroup, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.CreateGroup")
+	defer span.End()
+
+	name := strings.TrimSpace(in.DisplayName)
+	if name == "" {
+		return nil, scimError(http.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+	var members []string
+	if in.Members != nil {
+		var err error
+		if members, err = s.memberIDs(ctx, *in.Members); err != nil {
+			return nil, err
+		}
+	}
+
+	team := &entities.Team{
+		TeamName:         name,
+		CreatedBy:        SCIMActor,
+		ExternalID:       in.ExternalID,
+		MembershipPolicy: entities.MembershipRequest,
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := s.teamRepo.WithTx(tx)
+		if err := repo.Create(ctx, team); err != nil {
+			return err
+		}
+		for _, userID := range members {
+			if err := repo.CreateRoster(ctx, &entities.Roster{TeamId: team.TeamId, UserId: userID}, SCIMActor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.TeamsCreated.Inc()
+	metrics.RosterChanges.WithLabelValues("add", "member").Add(float64(len(members)))
+	metrics.SCIMOperations.WithLabelValues("group", "create").Inc()
+	return s.toSCIMGroup(ctx, team, true)
+}
+
+// ReplaceGroup renames the team and, when members are given, syncs the roster to them.
+// Users who stay on the team keep their role.
+func (s *scimService) ReplaceGroup(ctx context.Context, id string, in SCIMGroup) (*SCIMGroup, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.ReplaceGroup")
+	defer span.End()
+
+	team, err := s.getGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(in.DisplayName)
+	if name == "" {
+		return nil, scimError(http.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+	team.TeamName, team.ExternalID = name, in.ExternalID
+
+	var members []string
+	if in.Members != nil {
+		if members, err = s.memberIDs(ctx, *in.Members); err != nil {
+			return nil, err
+		}
+	}
+	return s.saveGroup(ctx, team, func(current map[string]bool) map[string]bool {
+		if in.Members == nil {
+			return current
+		}
+		return toSet(members)
+	}, "replace")
+}
+
+func (s *scimService) PatchGroup(ctx context.Context, id string, patch SCIMPatch) (*SCIMGroup, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.PatchGroup")
+	defer span.End()
+
+	team, err := s.getGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(patch.Operations) == 0 {
+		return nil, scimError(http.StatusBadRequest, "invalidValue", "Operations must not be empty")
+	}
+
+	// Member changes are collected first and applied to the current roster in one transaction
+	var changes []func(map[string]bool)
+	for _, op := range patch.Operations {
+		change, err := s.patchGroup(ctx, team, op)
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			changes = append(changes, change)
+		}
+	}
+
+	return s.saveGroup(ctx, team, func(current map[string]bool) map[string]bool {
+		for _, change := range changes {
+			change(current)
+		}
+		return current
+	}, "patch")
+}
+
+// DeleteGroup deletes the team and its roster. Teams with sub-teams cannot be deleted.
+func (s *scimService) DeleteGroup(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "SCIMService.DeleteGroup")
+	defer span.End()
+
+	team, err := s.getGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+	descendants, err := s.teamRepo.DescendantIDs(ctx, team.TeamId)
+	if err != nil {
+		return err
+	}
+	if len(descendants) > 0 {
+		return scimError(http.StatusConflict, "", "group %s has sub-teams; move or delete them first", id)
+	}
+	owns, err := s.teamRepo.OwnsFolders(ctx, team.TeamId)
+	if err != nil {
+		return err
+	}
+	if owns {
+		return scimError(http.StatusConflict, "", "group %s owns team folders; transfer them first", id)
+	}
+	rosters, err := s.teamRepo.GetTeamMembers(ctx, team.TeamId)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := s.teamRepo.WithTx(tx)
+		for _, r := range rosters {
+			// Rows removed meanwhile are already gone, which is all this asks for
+			err := repo.DeleteRoster(ctx, r.TeamId, r.UserId, r.IsLeader, SCIMActor)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+		return repo.Delete(ctx, team.TeamId)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rosters {
+		metrics.RosterChanges.WithLabelValues("remove", roleLabel(r.Role)).Inc()
+	}
+	metrics.SCIMOperations.WithLabelValues("group", "delete").Inc()
+	return nil
+}
+
+func (s *scimService) getUser(ctx context.Context, id string) (*entities.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, scimError(http.StatusNotFound, "", "user %s not found", id)
+	}
+	return user, err
+}
+
+// getActiveUser treats inactive users, which includes deleted ones, as not found
+func (s *scimService) getActiveUser(ctx context.Context, id string) (*entities.User, error) {
+	user, err := s.getUser(ctx, id)
+	if err == nil && !user.Active {
+		return nil, scimError(http.StatusNotFound, "", "user %s not found", id)
+	}
+	return user, err
+}
+
+func (s *scimService) saveUser(ctx context.Context, user *entities.User, action string) (*SCIMUser, error) {
+	if err := s.userRepo.Save(ctx, user); err != nil {
+		return nil, err
+	}
+	// Deactivation and profile changes apply from this replica's next request
+	s.sessionService.ForgetUser(user.ID)
+
+	metrics.SCIMOperations.WithLabelValues("user", action).Inc()
+	return toSCIMUser(user), nil
+}
+
+func (s *scimService) getGroup(ctx context.Context, id string) (*entities.Team, error) {
+	teamID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, scimError(http.StatusNotFound, "", "group %s not found", id)
+	}
+	team, err := s.teamRepo.GetByID(ctx, uint(teamID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, scimError(http.StatusNotFound, "", "group %s not found", id)
+	}
+	return team, err
+}
+
+// saveGroup updates the team and brings its roster in line with the member set members returns.
+// Identity providers only say who belongs to a group: members who stay keep their role, and
+// managers missing from the group stay on the team, so a root team never loses its last
+// manager through provisioning. Managers are removed in the app or by deleting the user.
+func (s *scimService) saveGroup(ctx context.Context, team *entities.Team, members func(current map[string]bool) map[string]bool, action string) (*SCIMGroup, error) {
+	var added []string
+	var removed []entities.Roster
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := s.teamRepo.WithTx(tx)
+		if err := repo.LockTeams(ctx, []uint{team.TeamId}); err != nil {
+			return err
+		}
+		rosters, err := repo.LockRoster(ctx, team.TeamId)
+		if err != nil {
+			return err
+		}
+		current := make(map[string]bool, len(rosters))
+		for _, r := range rosters {
+			current[r.UserId] = true
+		}
+		want := members(copySet(current))
+
+		for userID := range want {
+			if !current[userID] {
+				added = append(added, userID)
+			}
+		}
+		sort.Strings(added)
+		if err := s.requireUsers(ctx, added); err != nil {
+			return err
+		}
+
+		if err := repo.Update(ctx, team); err != nil {
+			return err
+		}
+		for _, r := range rosters {
+			if want[r.UserId] || r.Role == entities.RosterRoleManager {
+				continue
+			}
+			if err := repo.DeleteRoster(ctx, r.TeamId, r.UserId, r.IsLeader, SCIMActor); err != nil {
+				return err
+			}
+			removed = append(removed, r)
+		}
+		for _, userID := range added {
+			roster := &entities.Roster{TeamId: team.TeamId, UserId: userID, Role: entities.RosterRoleMember}
+			if err := repo.CreateRoster(ctx, roster, SCIMActor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range removed {
+		metrics.RosterChanges.WithLabelValues("remove", roleLabel(r.Role)).Inc()
+	}
+	metrics.RosterChanges.WithLabelValues("add", "member").Add(float64(len(added)))
+	metrics.SCIMOperations.WithLabelValues("group", action).Inc()
+	return s.toSCIMGroup(ctx, team, true)
+}
+
+// memberIDs validates member references; every member must already be provisioned
+func (s *scimService) memberIDs(ctx context.Context, members []SCIMMultiValue) ([]string, error) {
+	seen := make(map[string]bool, len(members))
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		id := strings.TrimSpace(m.Value)
+		if id == "" {
+			return nil, scimError(http.StatusBadRequest, "invalidValue", "member value is required")
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if err := s.requireUsers(ctx, ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (s *scimService) requireUsers(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	users, err := s.userRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(users))
+	for _, u := range users {
+		known[u.ID] = true
+	}
+	for _, id := range ids {
+		if !known[id] {
+			return scimError(http.StatusBadRequest, "invalidValue", "member %s is not a provisioned user", id)
+		}
+	}
+	return nil
+}
+
+func (s *scimService) toSCIMGroup(ctx context.Context, team *entities.Team, withMembers bool) (*SCIMGroup, error) {
+	id := strconv.FormatUint(uint64(team.TeamId), 10)
+	group := &SCIMGroup{
+		Schemas:     []string{SCIMSchemaGroup},
+		ID:          id,
+		ExternalID:  team.ExternalID,
+		DisplayName: team.TeamName,
+		Meta: &SCIMMeta{
+			ResourceType: "Group",
+			Created:      team.CreatedAt,
+			LastModified: team.UpdatedAt,
+			Location:     "/scim/v2/Groups/" + id,
+		},
+	}
+	if !withMembers {
+		return group, nil
+	}
+
+	rosters, err := s.teamRepo.GetTeamMembers(ctx, team.TeamId)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rosters))
+	for _, r := range rosters {
+		ids = append(ids, r.UserId)
+	}
+	users, err := s.userRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(users))
+	for _, u := range users {
+		names[u.ID] = u.Name
+	}
+
+	sort.Strings(ids)
+	members := make([]SCIMMultiValue, 0, len(ids))
+	for _, userID := range ids {
+		members = append(members, SCIMMultiValue{Value: userID, Display: names[userID]})
+	}
+	group.Members = &members
+	return group, nil
+}
+
+// patchGroup applies attribute operations to team and returns the member change, if any
+func (s *scimService) patchGroup(ctx context.Context, team *entities.Team, op SCIMPatchOperation) (func(map[string]bool), error) {
+	kind := strings.ToLower(op.Op)
+	path := strings.TrimSpace(op.Path)
+	attr := strings.ToLower(stripSCIMSchema(path))
+
+	if path == "" {
+		if kind == "remove" {
+			return nil, scimError(http.StatusBadRequest, "noTarget", "remove requires a path")
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return nil, scimError(http.StatusBadRequest, "invalidValue", "value must be an object when path is omitted")
+		}
+		var changes []func(map[string]bool)
+		for key, value := range values {
+			change, err := s.patchGroup(ctx, team, SCIMPatchOperation{Op: op.Op, Path: key, Value: value})
+			if err != nil {
+				return nil, err
+			}
+			if change != nil {
+				changes = append(changes, change)
+			}
+		}
+		return func(set map[string]bool) {
+			for _, change := range changes {
+				change(set)
+			}
+		}, nil
+	}
+
+	// members[value eq "user"] addresses a single member
+	if strings.HasPrefix(attr, "members[") {
+		if kind != "remove" {
+			return nil, scimError(http.StatusBadRequest, "invalidPath", "only remove supports a member filter")
+		}
+		userID, ok := parseMemberPath(path)
+		if !ok {
+			return nil, scimError(http.StatusBadRequest, "invalidPath", "unsupported path %s", path)
+		}
+		return func(set map[string]bool) { delete(set, userID) }, nil
+	}
+
+	switch attr {
+	case "displayname":
+		if kind == "remove" {
+			return nil, scimError(http.StatusBadRequest, "mutability", "displayName is required")
+		}
+		name, err := patchString(op)
+		if err != nil {
+			return nil, err
+		}
+		if name = strings.TrimSpace(name); name == "" {
+			return nil, scimError(http.StatusBadRequest, "invalidValue", "displayName is required")
+		}
+		team.TeamName = name
+		return nil, nil
+	case "externalid":
+		if kind == "remove" {
+			team.ExternalID = ""
+			return nil, nil
+		}
+		externalID, err := patchString(op)
+		if err != nil {
+			return nil, err
+		}
+		team.ExternalID = externalID
+		return nil, nil
+	case "members":
+		var members []SCIMMultiValue
+		if len(op.Value) > 0 && string(op.Value) != "null" {
+			if err := json.Unmarshal(op.Value, &members); err != nil {
+				return nil, scimError(http.StatusBadRequest, "invalidValue", "members must be an array of {\"value\": ...}")
+			}
+		}
+		var ids []string
+		if kind != "remove" {
+			var err error
+			if ids, err = s.memberIDs(ctx, members); err != nil {
+				return nil, err
+			}
+		} else {
+			for _, m := range members {
+				ids = append(ids, strings.TrimSpace(m.Value))
+			}
+		}
+
+		switch kind {
+		case "add":
+			return func(set map[string]bool) {
+				for _, id := range ids {
+					set[id] = true
+				}
+			}, nil
+		case "replace":
+			return func(set map[string]bool) {
+				for id := range set {
+					delete(set, id)
+				}
+				for _, id := range ids {
+					set[id] = true
+				}
+			}, nil
+		case "remove":
+			// Without a value every member is removed
+			return func(set map[string]bool) {
+				if len(members) == 0 {
+					for id := range set {
+						delete(set, id)
+					}
+					return
+				}
+				for _, id := range ids {
+					delete(set, id)
+				}
+			}, nil
+		}
+		return nil, scimError(http.StatusBadRequest, "invalidSyntax", "unsupported op %s", op.Op)
+	}
+	return nil, scimError(http.StatusBadRequest, "invalidPath", "unsupported path %s", path)
+}
+
+// patchUser applies one operation to user
+func patchUser(user *entities.User, op SCIMPatchOperation) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return scimError(http.StatusBadRequest, "invalidSyntax", "unsupported op %s", op.Op)
+	}
+	path := strings.TrimSpace(op.Path)
+
+	if path == "" {
+		if kind == "remove" {
+			return scimError(http.StatusBadRequest, "noTarget", "remove requires a path")
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return scimError(http.StatusBadRequest, "invalidValue", "value must be an object when path is omitted")
+		}
+		for key, value := range values {
+			if err := patchUser(user, SCIMPatchOperation{Op: op.Op, Path: key, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	attr := strings.ToLower(stripSCIMSchema(path))
+	if kind == "remove" {
+		switch attr {
+		case "displayname", "name.formatted":
+			user.Name = ""
+		case "name":
+			user.Name, user.GivenName, user.FamilyName = "", "", ""
+		case "name.givenname":
+			user.GivenName = ""
+		case "name.familyname":
+			user.FamilyName = ""
+		case "emails", "emails.value":
+			user.Email = ""
+		case "externalid":
+			user.ExternalID = ""
+		default:
+			return scimError(http.StatusBadRequest, "invalidPath", "cannot remove %s", path)
+		}
+		return nil
+	}
+
+	switch attr {
+	case "active":
+		active, err := patchBool(op)
+		if err != nil {
+			return err
+		}
+		user.Active = active
+	case "username":
+		userName, err := patchString(op)
+		if err != nil {
+			return err
+		}
+		if userName != user.ID {
+			return scimError(http.StatusBadRequest, "mutability", "userName cannot be changed")
+		}
+	case "displayname", "name.formatted":
+		return patchStringInto(op, &user.Name)
+	case "name.givenname":
+		return patchStringInto(op, &user.GivenName)
+	case "name.familyname":
+		return patchStringInto(op, &user.FamilyName)
+	case "externalid":
+		return patchStringInto(op, &user.ExternalID)
+	case "name":
+		var name SCIMName
+		if err := json.Unmarshal(op.Value, &name); err != nil {
+			return scimError(http.StatusBadRequest, "invalidValue", "name must be an object")
+		}
+		applySCIMName(user, &name)
+	case "emails":
+		var emails []SCIMMultiValue
+		if err := json.Unmarshal(op.Value, &emails); err != nil {
+			return scimError(http.StatusBadRequest, "invalidValue", "emails must be an array of {\"value\": ...}")
+		}
+		user.Email = primaryValue(emails)
+	case "emails.value", `emails[type eq "work"].value`, `emails[primary eq true].value`:
+		return patchStringInto(op, &user.Email)
+	default:
+		return scimError(http.StatusBadRequest, "invalidPath", "unsupported path %s", path)
+	}
+	return nil
+}
+
+func toSCIMUser(user *entities.User) *SCIMUser {
+	active := user.Active
+	out := &SCIMUser{
+		Schemas:     []string{SCIMSchemaUser},
+		ID:          user.ID,
+		ExternalID:  user.ExternalID,
+		UserName:    user.ID,
+		DisplayName: user.Name,
+		Active:      &active,
+		Meta: &SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     "/scim/v2/Users/" + user.ID,
+		},
+	}
+	if user.Name != "" || user.GivenName != "" || user.FamilyName != "" {
+		out.Name = &SCIMName{Formatted: user.Name, GivenName: user.GivenName, FamilyName: user.FamilyName}
+	}
+	if user.Email != "" {
+		out.Emails = []SCIMMultiValue{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	return out
+}
+
+// applySCIMUser copies the attributes present in a SCIM user onto user
+func applySCIMUser(user *entities.User, in SCIMUser) {
+	user.ExternalID = in.ExternalID
+	applySCIMName(user, in.Name)
+	if in.DisplayName != "" {
+		user.Name = strings.TrimSpace(in.DisplayName)
+	}
+	if len(in.Emails) > 0 {
+		user.Email = primaryValue(in.Emails)
+	}
+	if in.Active != nil {
+		user.Active = *in.Active
+	}
+}
+
+// applySCIMName sets the given and family names, deriving a display name when none is set
+func applySCIMName(user *entities.User, name *SCIMName) {
+	if name == nil {
+		return
+	}
+	user.GivenName = strings.TrimSpace(name.GivenName)
+	user.FamilyName = strings.TrimSpace(name.FamilyName)
+	switch {
+	case strings.TrimSpace(name.Formatted) != "":
+		user.Name = strings.TrimSpace(name.Formatted)
+	case user.Name == "":
+		user.Name = strings.TrimSpace(user.GivenName + " " + user.FamilyName)
+	}
+}
+
+// primaryValue picks the primary entry of a multi-valued attribute, or the first one
+func primaryValue(values []SCIMMultiValue) string {
+	for _, v := range values {
+		if v.Primary {
+			return strings.TrimSpace(v.Value)
+		}
+	}
+	if len(values) > 0 {
+		return strings.TrimSpace(values[0].Value)
+	}
+	return ""
+}
+
+// parseMemberPath extracts the user from a members[value eq "user"] path
+func parseMemberPath(path string) (string, bool) {
+	open, end := strings.Index(path, "["), strings.LastIndex(path, "]")
+	if open < 0 || end != len(path)-1 {
+		return "", false
+	}
+	filters, err := parseSCIMFilter(path[open+1:end], map[string]string{"value": "value"})
+	if err != nil || len(filters) != 1 || filters[0].Op != repository.FilterEq {
+		return "", false
+	}
+	return filters[0].Value, true
+}
+
+func patchString(op SCIMPatchOperation) (string, error) {
+	var v string
+	if err := json.Unmarshal(op.Value, &v); err != nil {
+		return "", scimError(http.StatusBadRequest, "invalidValue", "%s must be a string", op.Path)
+	}
+	return v, nil
+}
+
+func patchStringInto(op SCIMPatchOperation, dst *string) error {
+	v, err := patchString(op)
+	if err != nil {
+		return err
+	}
+	*dst = strings.TrimSpace(v)
+	return nil
+}
+
+// patchBool accepts JSON booleans and, as some identity providers send them, "True"/"False"
+func patchBool(op SCIMPatchOperation) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(op.Value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(op.Value, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, scimError(http.StatusBadRequest, "invalidValue", "%s must be a boolean", op.Path)
+}
+
+// scimPage clamps the 1-based startIndex and the page size
+func scimPage(query SCIMQuery) (startIndex, count int) {
+	startIndex = query.StartIndex
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count = scimDefaultCount
+	if query.Count != nil {
+		count = *query.Count
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return startIndex, count
+}
+
+func scimList(total int64, startIndex int, resources interface{}, n int) *SCIMListResponse {
+	return &SCIMListResponse{
+		Schemas:      []string{SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: n,
+		Resources:    resources,
+	}
+}
+
+func toSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func copySet(set map[string]bool) map[string]bool {
+	out := make(map[string]bool, len(set))
+	for k := range set {
+		out[k] = true
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSCIMDeletesCountRemovalsByRole(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	teamRepo, userRepo := repository.NewTeamRepository(database), repository.NewUserRepository(database)
+	sessions := NewSessionService(repository.NewSessionRepository(database), userRepo, time.Minute)
+	scim := NewSCIMService(userRepo, teamRepo, sessions, database)
+
+	team := addTeam(t, database, "scim", nil)
+	if err := database.Create(&entities.TeamRole{TeamID: team, Name: "editor", Permissions: []string{entities.TeamPermWriteAssets}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for userID, role := range map[string]string{"lead": entities.RosterRoleManager, "ada": "editor", "alan": entities.RosterRoleMember} {
+		if _, err := scim.CreateUser(ctx, SCIMUser{UserName: userID}); err != nil {
+			t.Fatalf("provision %s: %v", userID, err)
+		}
+		if err := teamRepo.CreateRoster(ctx, &entities.Roster{TeamId: team, UserId: userID, Role: role}, "seed"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removals := func() map[string]float64 {
+		counts := make(map[string]float64)
+		for _, role := range []string{"manager", "member", "custom"} {
+			counts[role] = testutil.ToFloat64(metrics.RosterChanges.WithLabelValues("remove", role))
+		}
+		return counts
+	}
+	expectRemovals := func(before map[string]float64, want map[string]float64) {
+		t.Helper()
+		after := removals()
+		for role := range after {
+			if got := after[role] - before[role]; got != want[role] {
+				t.Errorf("%s removals counted = %v, want %v", role, got, want[role])
+			}
+		}
+	}
+
+	before := removals()
+	if err := scim.DeleteUser(ctx, "ada"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	expectRemovals(before, map[string]float64{"custom": 1})
+
+	before = removals()
+	if err := scim.DeleteGroup(ctx, fmt.Sprint(team)); err != nil {
+		t.Fatalf("DeleteGroup: %v", err)
+	}
+	expectRemovals(before, map[string]float64{"manager": 1, "member": 1})
+}
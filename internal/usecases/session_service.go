@@ -0,0 +1,265 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultRevocationRetention keeps a revoked jti when the caller does not know the token's expiry
+	defaultRevocationRetention = 30 * 24 * time.Hour
+
+	// maxSessionCacheEntries bounds the per-replica cache; stale entries are swept when it fills up
+	maxSessionCacheEntries = 10000
+)
+
+var (
+	ErrSessionRevoked = errors.New("session has been revoked")
+	ErrUserInactive   = errors.New("user is deactivated")
+	ErrInvalidSession = errors.New("invalid session request")
+)
+
+type SessionService interface {
+	ValidateSession(ctx context.Context, userID, role, jti string, issuedAt time.Time) (string, error)
+	RevokeToken(ctx context.Context, jti, userID, reason, revokedBy string, expiresAt time.Time) error
+	RevokeUserSessions(ctx context.Context, userID, revokedBy string) (time.Time, error)
+	PurgeExpiredRevocations(ctx context.Context) (int64, error)
+	ForgetUser(userID string)
+}
+
+// principalEntry caches what the directory and watermark tables say about a user
+type principalEntry struct {
+	user       *entities.User
+	validAfter time.Time
+	fetchedAt  time.Time
+}
+
+type revocationEntry struct {
+	revoked   bool
+	fetchedAt time.Time
+}
+
+type sessionService struct {
+	sessionRepo repository.SessionRepository
+	userRepo    repository.UserRepository
+	cacheTTL    time.Duration
+
+	mu         sync.Mutex
+	principals map[string]principalEntry
+	revoked    map[string]revocationEntry
+}
+
+// NewSessionService checks credentials against revocations and the user directory.
+// Lookups are cached for cacheTTL, which bounds how long another replica may accept a revoked session.
+func NewSessionService(sessionRepo repository.SessionRepository, userRepo repository.UserRepository, cacheTTL time.Duration) SessionService {
+	return &sessionService{
+		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+		cacheTTL:    cacheTTL,
+		principals:  make(map[string]principalEntry),
+		revoked:     make(map[string]revocationEntry),
+	}
+}
+
+// ValidateSession returns the role the caller should act with. Users in the directory must be
+// active and their persisted role replaces the claimed one; users absent from it keep their claims.
+func (s *sessionService) ValidateSession(ctx context.Context, userID, role, jti string, issuedAt time.Time) (string, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.ValidateSession")
+	defer span.End()
+
+	if jti != "" {
+		revoked, err := s.isRevoked(ctx, jti)
+		if err != nil {
+			return "", err
+		}
+		if revoked {
+			metrics.SessionsRejected.WithLabelValues("revoked").Inc()
+			return "", ErrSessionRevoked
+		}
+	}
+
+	principal, err := s.principal(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	// Tokens without iat cannot prove they were issued after the watermark
+	if !principal.validAfter.IsZero() && (issuedAt.IsZero() || issuedAt.Before(principal.validAfter)) {
+		metrics.SessionsRejected.WithLabelValues("revoked").Inc()
+		return "", ErrSessionRevoked
+	}
+
+	if principal.user != nil {
+		if !principal.user.Active {
+			metrics.SessionsRejected.WithLabelValues("inactive").Inc()
+			return "", ErrUserInactive
+		}
+		if principal.user.Role != "" {
+			role = principal.user.Role
+		}
+	}
+
+	return role, nil
+}
+
+func (s *sessionService) RevokeToken(ctx context.Context, jti, userID, reason, revokedBy string, expiresAt time.Time) error {
+	ctx, span := tracing.Start(ctx, "SessionService.RevokeToken")
+	defer span.End()
+
+	jti = strings.TrimSpace(jti)
+	if jti == "" {
+		return fmt.Errorf("%w: jti is required", ErrInvalidSession)
+	}
+
+	now := time.Now()
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(defaultRevocationRetention)
+	}
+
+	err := s.sessionRepo.RevokeToken(ctx, &entities.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		Reason:    reason,
+		RevokedBy: revokedBy,
+		RevokedAt: now,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.revoked[jti] = revocationEntry{revoked: true, fetchedAt: now}
+	s.mu.Unlock()
+
+	metrics.SessionsRevoked.WithLabelValues("token").Inc()
+	return nil
+}
+
+// RevokeUserSessions invalidates every token issued to the user up to now
+func (s *sessionService) RevokeUserSessions(ctx context.Context, userID, revokedBy string) (time.Time, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.RevokeUserSessions")
+	defer span.End()
+
+	if strings.TrimSpace(userID) == "" {
+		return time.Time{}, fmt.Errorf("%w: user ID is required", ErrInvalidSession)
+	}
+
+	now := time.Now()
+	// iat has whole-second precision, so a token issued later in this second must not be
+	// compared against the fraction
+	validAfter := now.Truncate(time.Second)
+	err := s.sessionRepo.SetWatermark(ctx, &entities.SessionWatermark{
+		UserID:     userID,
+		ValidAfter: validAfter,
+		UpdatedBy:  revokedBy,
+		UpdatedAt:  now,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	s.ForgetUser(userID)
+
+	metrics.SessionsRevoked.WithLabelValues("user").Inc()
+	return validAfter, nil
+}
+
+// ForgetUser drops the cached directory entry so changes to the user apply on the next request
+func (s *sessionService) ForgetUser(userID string) {
+	s.mu.Lock()
+	delete(s.principals, userID)
+	s.mu.Unlock()
+}
+
+func (s *sessionService) PurgeExpiredRevocations(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.PurgeExpiredRevocations")
+	defer span.End()
+
+	return s.sessionRepo.PurgeExpiredRevocations(ctx, time.Now())
+}
+
+func (s *sessionService) isRevoked(ctx context.Context, jti string) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.revoked[jti]
+	s.mu.Unlock()
+	if ok && now.Sub(entry.fetchedAt) < s.cacheTTL {
+		return entry.revoked, nil
+	}
+
+	revoked, err := s.sessionRepo.IsTokenRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	if len(s.revoked) >= maxSessionCacheEntries {
+		sweep(s.revoked, func(e revocationEntry) bool { return now.Sub(e.fetchedAt) >= s.cacheTTL })
+	}
+	s.revoked[jti] = revocationEntry{revoked: revoked, fetchedAt: now}
+	s.mu.Unlock()
+
+	return revoked, nil
+}
+
+func (s *sessionService) principal(ctx context.Context, userID string) (principalEntry, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.principals[userID]
+	s.mu.Unlock()
+	if ok && now.Sub(entry.fetchedAt) < s.cacheTTL {
+		return entry, nil
+	}
+
+	entry = principalEntry{fetchedAt: now}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return principalEntry{}, err
+	}
+	entry.user = user
+
+	watermark, err := s.sessionRepo.GetWatermark(ctx, userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return principalEntry{}, err
+	}
+	if watermark != nil {
+		// Watermarks stored before they were truncated still carry fractions of a second
+		entry.validAfter = watermark.ValidAfter.Truncate(time.Second)
+	}
+
+	s.mu.Lock()
+	if len(s.principals) >= maxSessionCacheEntries {
+		sweep(s.principals, func(e principalEntry) bool { return now.Sub(e.fetchedAt) >= s.cacheTTL })
+	}
+	s.principals[userID] = entry
+	s.mu.Unlock()
+
+	return entry, nil
+}
+
+// sweep drops stale cache entries, or everything if none are stale
+func sweep[V any](m map[string]V, stale func(V) bool) {
+	before := len(m)
+	for k, v := range m {
+		if stale(v) {
+			delete(m, k)
+		}
+	}
+	if len(m) == before {
+		clear(m)
+	}
+}
@@ -0,0 +1,67 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+)
+
+func TestRevokeUserSessionsAtIATPrecision(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	sessionRepo := repository.NewSessionRepository(database)
+	sessions := NewSessionService(sessionRepo, repository.NewUserRepository(database), time.Minute)
+
+	validAfter, err := sessions.RevokeUserSessions(ctx, "u1", "admin")
+	if err != nil {
+		t.Fatalf("RevokeUserSessions: %v", err)
+	}
+	if validAfter.Nanosecond() != 0 {
+		t.Errorf("watermark %v has a fraction of a second; iat cannot express it", validAfter)
+	}
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		revoked  bool
+	}{
+		// A login right after the revocation, within the same second
+		{"issued in the revocation's second", validAfter.Truncate(time.Second), false},
+		{"issued after", validAfter.Truncate(time.Second).Add(time.Second), false},
+		{"issued before", validAfter.Truncate(time.Second).Add(-time.Second), true},
+		{"no iat", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := sessions.ValidateSession(ctx, "u1", "MEMBER", "", tt.issuedAt)
+			if revoked := errors.Is(err, ErrSessionRevoked); revoked != tt.revoked || (err != nil && !revoked) {
+				t.Errorf("ValidateSession = %v, want revoked %v", err, tt.revoked)
+			}
+		})
+	}
+}
+
+func TestWatermarkWithFractionIsComparedInSeconds(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	sessionRepo := repository.NewSessionRepository(database)
+	issuedAt := time.Now().Truncate(time.Second)
+	// Watermarks written before truncation carry nanoseconds
+	err := sessionRepo.SetWatermark(ctx, &entities.SessionWatermark{
+		UserID:     "u1",
+		ValidAfter: issuedAt.Add(500 * time.Millisecond),
+		UpdatedAt:  time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := NewSessionService(sessionRepo, repository.NewUserRepository(database), time.Minute)
+	if _, err := sessions.ValidateSession(ctx, "u1", "MEMBER", "", issuedAt); err != nil {
+		t.Errorf("token issued in the watermark's second: %v", err)
+	}
+}
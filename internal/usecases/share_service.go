@@ -1,173 +1,366 @@
 package usecases
 
 import (
+	"context"
 	"errors"
 	"team-service/internal/entities"
 	"team-service/internal/repository"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 )
 
 type ShareService interface {
-	ShareFolder(folderID uint, targetUserID, access, ownerID string) error
-	RevokeFolderShare(folderID uint, targetUserID, ownerID string) error
-	ShareNote(noteID uint, targetUserID, access, ownerID string) error
-	RevokeNoteShare(noteID uint, targetUserID, ownerID string) error
-	GetTeamAssets(teamID uint) (map[string]interface{}, error)
-	GetUserAssets(userID string) (map[string]interface{}, error)
+	// ShareFolder and ShareNote check the sharing policies first. A nil expiresAt asks for a
+	// share that never expires, which a max share duration shortens to the longest it allows.
+	// A write share that only a write_requires_manager policy stops is not made but held as a
+	// pending access request for the managers to approve, which is returned.
+	ShareFolder(ctx context.Context, folderID uint, targetUserID, access, ownerID string, expiresAt *time.Time) (*entities.AccessRequest, error)
+	RevokeFolderShare(ctx context.Context, folderID uint, targetUserID, ownerID string) error
+	ShareNote(ctx context.Context, noteID uint, targetUserID, access, ownerID string, expiresAt *time.Time) (*entities.AccessRequest, error)
+	// ShareApproved makes the share an access request asks for within tx, the transaction that
+	// decides the request, as sharerID. approverID is the manager approving a held share, or empty.
+	ShareApproved(ctx context.Context, tx *gorm.DB, request *entities.AccessRequest, sharerID, approverID string) error
+	RevokeNoteShare(ctx context.Context, noteID uint, targetUserID, ownerID string) error
+	GetTeamAssets(ctx context.Context, teamID uint, includeDescendants bool, asOf *time.Time) (map[string]interface{}, error)
+	GetUserAssets(ctx context.Context, userID string) (map[string]interface{}, error)
+	// PurgeExpiredShares deletes shares that have expired; they already grant nothing
+	PurgeExpiredShares(ctx context.Context) (int64, error)
 }
 
 type shareService struct {
-	shareRepo  repository.ShareRepository
-	folderRepo repository.FolderRepository
-	noteRepo   repository.NoteRepository
-	teamRepo   repository.TeamRepository
-	db         *gorm.DB
+	shareRepo         repository.ShareRepository
+	folderRepo        repository.FolderRepository
+	noteRepo          repository.NoteRepository
+	teamRepo          repository.TeamRepository
+	accessRequestRepo repository.AccessRequestRepository
+	policies          SharingPolicyService
+	db                *gorm.DB
 }
 
-func NewShareService(shareRepo repository.ShareRepository, folderRepo repository.FolderRepository, noteRepo repository.NoteRepository, teamRepo repository.TeamRepository, db *gorm.DB) ShareService {
+func NewShareService(shareRepo repository.ShareRepository, folderRepo repository.FolderRepository, noteRepo repository.NoteRepository, teamRepo repository.TeamRepository, accessRequestRepo repository.AccessRequestRepository, policies SharingPolicyService, db *gorm.DB) ShareService {
 	return &shareService{
-		shareRepo:  shareRepo,
-		folderRepo: folderRepo,
-		noteRepo:   noteRepo,
-		teamRepo:   teamRepo,
-		db:         db,
+		shareRepo:         shareRepo,
+		folderRepo:        folderRepo,
+		noteRepo:          noteRepo,
+		teamRepo:          teamRepo,
+		accessRequestRepo: accessRequestRepo,
+		policies:          policies,
+		db:                db,
 	}
 }
 
-func (s *shareService) ShareFolder(folderID uint, targetUserID, access, ownerID string) error {
+func (s *shareService) ShareFolder(ctx context.Context, folderID uint, targetUserID, access, ownerID string, expiresAt *time.Time) (*entities.AccessRequest, error) {
+	ctx, span := tracing.Start(ctx, "ShareService.ShareFolder")
+	defer span.End()
+
+	return s.share(ctx, entities.AssetFolder, folderID, targetUserID, access, ownerID, expiresAt)
+}
+
+func (s *shareService) ShareNote(ctx context.Context, noteID uint, targetUserID, access, ownerID string, expiresAt *time.Time) (*entities.AccessRequest, error) {
+	ctx, span := tracing.Start(ctx, "ShareService.ShareNote")
+	defer span.End()
+
+	return s.share(ctx, entities.AssetNote, noteID, targetUserID, access, ownerID, expiresAt)
+}
+
+func (s *shareService) ShareApproved(ctx context.Context, tx *gorm.DB, request *entities.AccessRequest, sharerID, approverID string) error {
+	ctx, span := tracing.Start(ctx, "ShareService.ShareApproved",
+		attribute.String("asset.type", request.AssetType), attribute.Int64("asset.id", int64(request.AssetID)))
+	defer span.End()
+
+	created, err := s.shareAsset(ctx, tx, request, sharerID, approverID)
+	if err != nil {
+		return err
+	}
+
+	if created {
+		metrics.SharesCreated.WithLabelValues(request.AssetType, request.Access).Inc()
+	}
+	return nil
+}
+
+// share makes a share directly, or holds it for the managers, in one transaction so the
+// policies it passed still hold when it is written
+func (s *shareService) share(ctx context.Context, assetType string, assetID uint, targetUserID, access, ownerID string, expiresAt *time.Time) (*entities.AccessRequest, error) {
+	request := &entities.AccessRequest{
+		AssetType:   assetType,
+		AssetID:     assetID,
+		RequesterID: targetUserID,
+		Access:      access,
+		ExpiresAt:   expiresAt,
+	}
+	var created, held bool
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		created, err = s.shareAsset(ctx, tx, request, ownerID, "")
+		if needsManagerApproval(err) {
+			held = true
+			return s.holdForManager(ctx, tx, request, ownerID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if held {
+		metrics.AccessRequests.WithLabelValues("held").Inc()
+		return request, nil
+	}
+	if created {
+		metrics.SharesCreated.WithLabelValues(assetType, access).Inc()
+	}
+	return nil, nil
+}
+
+// holdForManager keeps a write share that needs a team manager as a pending access request
+// for the managers to decide
+func (s *shareService) holdForManager(ctx context.Context, tx *gorm.DB, request *entities.AccessRequest, sharerID string) error {
+	request.SharedBy = sharerID
+	request.Status = entities.AccessRequestPending
+	// The target's own pending request on the asset blocks a held share as well
+	if err := s.accessRequestRepo.WithTx(tx).Create(ctx, request); errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrAccessRequestExists
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// shareAsset makes the share a request describes within tx and reports whether it is new
+func (s *shareService) shareAsset(ctx context.Context, tx *gorm.DB, request *entities.AccessRequest, sharerID, approverID string) (bool, error) {
+	if request.AssetType == entities.AssetFolder {
+		return s.shareFolder(ctx, tx, request.AssetID, request.RequesterID, request.Access, sharerID, approverID, request.ExpiresAt)
+	}
+	return s.shareNote(ctx, tx, request.AssetID, request.RequesterID, request.Access, sharerID, approverID, request.ExpiresAt)
+}
+
+func (s *shareService) shareFolder(ctx context.Context, tx *gorm.DB, folderID uint, targetUserID, access, ownerID, approverID string, expiresAt *time.Time) (bool, error) {
 	if targetUserID == ownerID {
-		return errors.New("cannot share folder with yourself")
+		return false, errors.New("cannot share folder with yourself")
 	}
 
-	folder, err := s.folderRepo.GetByID(folderID)
+	folder, err := s.folderRepo.WithTx(tx).GetByID(ctx, folderID)
 	if err != nil {
-		return errors.New("folder not found")
+		return false, errors.New("folder not found")
 	}
 
-	if folder.OwnerID != ownerID {
-		return errors.New("only the owner can share this folder")
+	if ok, err := s.administers(ctx, s.teamRepo.WithTx(tx), folder.OwnerID, folder.TeamID, ownerID); err != nil {
+		return false, err
+	} else if !ok {
+		return false, errors.New("only the owner can share this folder")
 	}
 
-	// Transaction: upsert folder share + upsert note shares
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		// Handle folder share
-		existingShare, err := s.shareRepo.GetFolderShare(folderID, targetUserID)
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-			return err
-		}
+	expiresAt, err = s.policies.Evaluate(ctx, tx, ShareCheck{
+		OwnerID:      folder.OwnerID,
+		TeamID:       folder.TeamID,
+		TargetUserID: targetUserID,
+		Access:       access,
+		ActorID:      ownerID,
+		ApproverID:   approverID,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		return false, err
+	}
 
-		if existingShare != nil {
-			existingShare.Access = access
-			if err := s.shareRepo.UpdateFolderShare(existingShare); err != nil {
-				return err
-			}
-		} else {
-			newShare := &entities.FolderShare{
-				FolderID: folderID,
-				UserID:   targetUserID,
-				Access:   access,
-			}
-			if err := s.shareRepo.CreateFolderShare(newShare); err != nil {
-				return err
-			}
+	// Upsert folder share + upsert note shares
+	shares := s.shareRepo.WithTx(tx)
+	created := false
+	existingShare, err := shares.GetFolderShare(ctx, folderID, targetUserID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	if existingShare != nil {
+		existingShare.Access = access
+		existingShare.ExpiresAt = expiresAt
+		if err := shares.UpdateFolderShare(ctx, existingShare); err != nil {
+			return false, err
+		}
+	} else {
+		newShare := &entities.FolderShare{
+			FolderID:  folderID,
+			UserID:    targetUserID,
+			Access:    access,
+			ExpiresAt: expiresAt,
+		}
+		if err := shares.CreateFolderShare(ctx, newShare); err != nil {
+			return false, err
 		}
+		created = true
+	}
 
-		// Share all notes in the folder
-		notes, err := s.noteRepo.GetByFolderID(folderID)
-		if err != nil {
-			return err
+	// Share all notes in the folder
+	notes, err := s.noteRepo.WithTx(tx).GetByFolderID(ctx, folderID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, note := range notes {
+		existingNoteShare, err := shares.GetNoteShare(ctx, note.ID, targetUserID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, err
 		}
 
-		for _, note := range notes {
-			existingNoteShare, err := s.shareRepo.GetNoteShare(note.ID, targetUserID)
-			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-				return err
+		if existingNoteShare != nil {
+			existingNoteShare.Access = access
+			existingNoteShare.ExpiresAt = expiresAt
+			if err := shares.UpdateNoteShare(ctx, existingNoteShare); err != nil {
+				return false, err
 			}
-
-			if existingNoteShare != nil {
-				existingNoteShare.Access = access
-				if err := s.shareRepo.UpdateNoteShare(existingNoteShare); err != nil {
-					return err
-				}
-			} else {
-				newNoteShare := &entities.NoteShare{
-					NoteID: note.ID,
-					UserID: targetUserID,
-					Access: access,
-				}
-				if err := s.shareRepo.CreateNoteShare(newNoteShare); err != nil {
-					return err
-				}
+		} else {
+			newNoteShare := &entities.NoteShare{
+				NoteID:    note.ID,
+				UserID:    targetUserID,
+				Access:    access,
+				ExpiresAt: expiresAt,
+			}
+			if err := shares.CreateNoteShare(ctx, newNoteShare); err != nil {
+				return false, err
 			}
 		}
+	}
 
-		return nil
-	})
+	return created, nil
 }
 
-func (s *shareService) RevokeFolderShare(folderID uint, targetUserID, ownerID string) error {
-	folder, err := s.folderRepo.GetByID(folderID)
+func (s *shareService) RevokeFolderShare(ctx context.Context, folderID uint, targetUserID, ownerID string) error {
+	ctx, span := tracing.Start(ctx, "ShareService.RevokeFolderShare")
+	defer span.End()
+
+	folder, err := s.folderRepo.GetByID(ctx, folderID)
 	if err != nil {
 		return errors.New("folder not found")
 	}
 
-	if folder.OwnerID != ownerID {
+	if ok, err := s.administers(ctx, s.teamRepo, folder.OwnerID, folder.TeamID, ownerID); err != nil {
+		return err
+	} else if !ok {
 		return errors.New("only the folder owner can revoke access")
 	}
 
-	return s.shareRepo.DeleteFolderShare(folderID, targetUserID)
+	if err := s.shareRepo.DeleteFolderShare(ctx, folderID, targetUserID); err != nil {
+		return err
+	}
+
+	metrics.SharesRevoked.WithLabelValues("folder").Inc()
+	return nil
 }
 
-func (s *shareService) ShareNote(noteID uint, targetUserID, access, ownerID string) error {
-	note, err := s.noteRepo.GetByID(noteID)
+func (s *shareService) shareNote(ctx context.Context, tx *gorm.DB, noteID uint, targetUserID, access, ownerID, approverID string, expiresAt *time.Time) (bool, error) {
+	note, err := s.noteRepo.WithTx(tx).GetByID(ctx, noteID)
 	if err != nil {
-		return errors.New("note not found")
+		return false, errors.New("note not found")
+	}
+
+	if ok, err := s.administers(ctx, s.teamRepo.WithTx(tx), note.OwnerID, note.TeamID, ownerID); err != nil {
+		return false, err
+	} else if !ok {
+		return false, errors.New("only owner can share the note")
 	}
 
-	if note.OwnerID != ownerID {
-		return errors.New("only owner can share the note")
+	expiresAt, err = s.policies.Evaluate(ctx, tx, ShareCheck{
+		OwnerID:      note.OwnerID,
+		TeamID:       note.TeamID,
+		TargetUserID: targetUserID,
+		Access:       access,
+		ActorID:      ownerID,
+		ApproverID:   approverID,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		return false, err
 	}
 
-	existingShare, err := s.shareRepo.GetNoteShare(noteID, targetUserID)
+	shares := s.shareRepo.WithTx(tx)
+	existingShare, err := shares.GetNoteShare(ctx, noteID, targetUserID)
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return err
+		return false, err
 	}
 
 	if existingShare != nil {
 		existingShare.Access = access
-		return s.shareRepo.UpdateNoteShare(existingShare)
-	} else {
-		newShare := &entities.NoteShare{
-			NoteID: noteID,
-			UserID: targetUserID,
-			Access: access,
-		}
-		return s.shareRepo.CreateNoteShare(newShare)
+		existingShare.ExpiresAt = expiresAt
+		return false, shares.UpdateNoteShare(ctx, existingShare)
+	}
+	newShare := &entities.NoteShare{
+		NoteID:    noteID,
+		UserID:    targetUserID,
+		Access:    access,
+		ExpiresAt: expiresAt,
 	}
+	if err := shares.CreateNoteShare(ctx, newShare); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-func (s *shareService) RevokeNoteShare(noteID uint, targetUserID, ownerID string) error {
-	note, err := s.noteRepo.GetByID(noteID)
+func (s *shareService) RevokeNoteShare(ctx context.Context, noteID uint, targetUserID, ownerID string) error {
+	ctx, span := tracing.Start(ctx, "ShareService.RevokeNoteShare")
+	defer span.End()
+
+	note, err := s.noteRepo.GetByID(ctx, noteID)
 	if err != nil {
 		return errors.New("note not found")
 	}
 
-	if note.OwnerID != ownerID {
+	if ok, err := s.administers(ctx, s.teamRepo, note.OwnerID, note.TeamID, ownerID); err != nil {
+		return err
+	} else if !ok {
 		return errors.New("only owner can revoke access")
 	}
 
-	return s.shareRepo.DeleteNoteShare(noteID, targetUserID)
+	if err := s.shareRepo.DeleteNoteShare(ctx, noteID, targetUserID); err != nil {
+		return err
+	}
+
+	metrics.SharesRevoked.WithLabelValues("note").Inc()
+	return nil
 }
 
-func (s *shareService) GetTeamAssets(teamID uint) (map[string]interface{}, error) {
-	userIds, err := s.teamRepo.GetUsersByTeamID(teamID)
+// GetTeamAssets collects the assets of everyone on the team's roster, and on the rosters of all
+// its sub-teams when includeDescendants is set. With asOf the rosters are taken from membership
+// history at that instant; the assets themselves are their current state.
+func (s *shareService) GetTeamAssets(ctx context.Context, teamID uint, includeDescendants bool, asOf *time.Time) (map[string]interface{}, error) {
+	ctx, span := tracing.Start(ctx, "ShareService.GetTeamAssets", attribute.Int64("team.id", int64(teamID)))
+	defer span.End()
+
+	teamIds := []uint{teamID}
+	if includeDescendants {
+		descendants, err := s.teamRepo.DescendantIDs(ctx, teamID)
+		if err != nil {
+			return nil, errors.New("failed to fetch sub-teams")
+		}
+		teamIds = append(teamIds, descendants...)
+	}
+
+	var userIds []string
+	var err error
+	if asOf != nil {
+		userIds, err = s.teamRepo.GetUsersByTeamIDsAt(ctx, teamIds, *asOf)
+	} else {
+		userIds, err = s.teamRepo.GetUsersByTeamIDs(ctx, teamIds)
+	}
 	if err != nil {
 		return nil, errors.New("failed to fetch team members")
 	}
 
+	// Team-owned assets are reported whoever is on the roster now
+	var teamFolders []entities.Folder
+	var teamNotes []entities.Note
+	s.db.WithContext(ctx).Where("team_id IN ?", teamIds).Find(&teamFolders)
+	s.db.WithContext(ctx).Where("team_id IN ?", teamIds).Find(&teamNotes)
+
 	if len(userIds) == 0 {
 		return map[string]interface{}{
+			"teamIds":       teamIds,
+			"teamFolders":   teamFolders,
+			"teamNotes":     teamNotes,
 			"ownedFolders":  []entities.Folder{},
 			"sharedFolders": []entities.Folder{},
 			"ownedNotes":    []entities.Note{},
@@ -181,23 +374,28 @@ func (s *shareService) GetTeamAssets(teamID uint) (map[string]interface{}, error
 	var sharedNotes []entities.Note
 
 	// Get owned assets
-	s.db.Where("owner_id IN ?", userIds).Find(&ownedFolders)
-	s.db.Where("owner_id IN ?", userIds).Find(&ownedNotes)
+	s.db.WithContext(ctx).Where("owner_id IN ?", userIds).Find(&ownedFolders)
+	s.db.WithContext(ctx).Where("owner_id IN ?", userIds).Find(&ownedNotes)
 
 	// Get shared assets
-	s.db.Model(&entities.Folder{}).
+	s.db.WithContext(ctx).Model(&entities.Folder{}).
 		Joins("JOIN folder_shares fs ON fs.folder_id = folders.id").
 		Where("fs.user_id IN ?", userIds).
+		Where("fs.expires_at IS NULL OR fs.expires_at > ?", time.Now()).
 		Select("folders.*, fs.access").
 		Find(&sharedFolders)
 
-	s.db.Model(&entities.Note{}).
+	s.db.WithContext(ctx).Model(&entities.Note{}).
 		Joins("JOIN note_shares ns ON ns.note_id = notes.id").
 		Where("ns.user_id IN ?", userIds).
+		Where("ns.expires_at IS NULL OR ns.expires_at > ?", time.Now()).
 		Select("notes.*, ns.access").
 		Find(&sharedNotes)
 
 	return map[string]interface{}{
+		"teamIds":       teamIds,
+		"teamFolders":   teamFolders,
+		"teamNotes":     teamNotes,
 		"ownedFolders":  ownedFolders,
 		"sharedFolders": sharedFolders,
 		"ownedNotes":    ownedNotes,
@@ -205,29 +403,34 @@ func (s *shareService) GetTeamAssets(teamID uint) (map[string]interface{}, error
 	}, nil
 }
 
-func (s *shareService) GetUserAssets(userID string) (map[string]interface{}, error) {
+func (s *shareService) GetUserAssets(ctx context.Context, userID string) (map[string]interface{}, error) {
+	ctx, span := tracing.Start(ctx, "ShareService.GetUserAssets")
+	defer span.End()
+
 	var ownedFolders []entities.Folder
 	var sharedFolders []entities.Folder
 	var ownedNotes []entities.Note
 	var sharedNotes []entities.Note
 
 	// Folders owned by user
-	s.db.Where("owner_id = ?", userID).Find(&ownedFolders)
+	s.db.WithContext(ctx).Where("owner_id = ?", userID).Find(&ownedFolders)
 
 	// Notes owned by user
-	s.db.Where("owner_id = ?", userID).Find(&ownedNotes)
+	s.db.WithContext(ctx).Where("owner_id = ?", userID).Find(&ownedNotes)
 
 	// Folders shared to user
-	s.db.Model(&entities.Folder{}).
+	s.db.WithContext(ctx).Model(&entities.Folder{}).
 		Joins("JOIN folder_shares ON folders.id = folder_shares.folder_id").
 		Where("folder_shares.user_id = ?", userID).
+		Where("folder_shares.expires_at IS NULL OR folder_shares.expires_at > ?", time.Now()).
 		Select("folders.*, folder_shares.access").
 		Find(&sharedFolders)
 
 	// Notes shared to user
-	s.db.Model(&entities.Note{}).
+	s.db.WithContext(ctx).Model(&entities.Note{}).
 		Joins("JOIN note_shares ON notes.id = note_shares.note_id").
 		Where("note_shares.user_id = ?", userID).
+		Where("note_shares.expires_at IS NULL OR note_shares.expires_at > ?", time.Now()).
 		Select("notes.*, note_shares.access").
 		Find(&sharedNotes)
 
@@ -238,3 +441,19 @@ func (s *shareService) GetUserAssets(userID string) (map[string]interface{}, err
 		"sharedNotes":   sharedNotes,
 	}, nil
 }
+
+func (s *shareService) PurgeExpiredShares(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "ShareService.PurgeExpiredShares")
+	defer span.End()
+
+	return s.shareRepo.DeleteExpired(ctx, time.Now())
+}
+
+// administers reports whether userID may share an asset: its owner, or for team-owned assets
+// anyone whose team role grants assets:share
+func (s *shareService) administers(ctx context.Context, teams repository.TeamRepository, ownerID string, teamID *uint, userID string) (bool, error) {
+	if teamID == nil {
+		return ownerID == userID, nil
+	}
+	return teams.HasPermission(ctx, userID, *teamID, entities.TeamPermShare)
+}
@@ -0,0 +1,351 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSharingPolicyViolation is wrapped by every SharingPolicyError
+	ErrSharingPolicyViolation = errors.New("share violates a sharing policy")
+	ErrSharingPolicyNotFound  = errors.New("sharing policy not found")
+)
+
+// maxShareDaysLimit bounds the longest share duration a policy can set
+const maxShareDaysLimit = 3650
+
+// PolicyViolation names a rule a share broke and the policy that holds it
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	TeamID  uint   `json:"teamId,omitempty"` // omitted for the global policy
+	Message string `json:"message"`
+}
+
+// SharingPolicyError lists every rule a share broke
+type SharingPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *SharingPolicyError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Message
+	}
+	return "sharing policy violation: " + strings.Join(msgs, "; ")
+}
+
+func (e *SharingPolicyError) Unwrap() error {
+	return ErrSharingPolicyViolation
+}
+
+// ShareCheck describes a share about to be made
+type ShareCheck struct {
+	// OwnerID and TeamID are the asset's owner, as on the folder or note
+	OwnerID      string
+	TeamID       *uint
+	TargetUserID string
+	Access       string
+	ActorID      string
+	// ApproverID is a manager who approved a share held back by write_requires_manager; either
+	// they or the actor satisfy that rule
+	ApproverID string
+	ExpiresAt  *time.Time
+}
+
+type SharingPolicyService interface {
+	ListPolicies(ctx context.Context) ([]entities.SharingPolicy, error)
+	// GetPolicy returns a team's policy, or the global one for GlobalSharingPolicy
+	GetPolicy(ctx context.Context, teamID uint) (*entities.SharingPolicy, error)
+	// SetPolicy replaces the rules of a team's policy, or of the global one, creating it if needed
+	SetPolicy(ctx context.Context, teamID uint, rules entities.SharingPolicy, actorID string) (*entities.SharingPolicy, error)
+	DeletePolicy(ctx context.Context, teamID uint) error
+
+	// Evaluate checks a share against the global policy and the policies of the teams governing
+	// the asset: the owning team or, for personal assets, the owner's teams, and every team
+	// above those. It returns the expiry the share gets, which is the requested one or, when
+	// none was asked for, the latest one every max share duration allows. It reads within tx,
+	// the transaction that makes the share.
+	Evaluate(ctx context.Context, tx *gorm.DB, check ShareCheck) (*time.Time, error)
+}
+
+type sharingPolicyService struct {
+	policyRepo repository.SharingPolicyRepository
+	teamRepo   repository.TeamRepository
+	userRepo   repository.UserRepository
+}
+
+func NewSharingPolicyService(policyRepo repository.SharingPolicyRepository, teamRepo repository.TeamRepository, userRepo repository.UserRepository) SharingPolicyService {
+	return &sharingPolicyService{
+		policyRepo: policyRepo,
+		teamRepo:   teamRepo,
+		userRepo:   userRepo,
+	}
+}
+
+func (s *sharingPolicyService) ListPolicies(ctx context.Context) ([]entities.SharingPolicy, error) {
+	ctx, span := tracing.Start(ctx, "SharingPolicyService.ListPolicies")
+	defer span.End()
+
+	return s.policyRepo.List(ctx)
+}
+
+func (s *sharingPolicyService) GetPolicy(ctx context.Context, teamID uint) (*entities.SharingPolicy, error) {
+	ctx, span := tracing.Start(ctx, "SharingPolicyService.GetPolicy")
+	defer span.End()
+
+	policy, err := s.policyRepo.Get(ctx, teamID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSharingPolicyNotFound
+	}
+	return policy, err
+}
+
+func (s *sharingPolicyService) SetPolicy(ctx context.Context, teamID uint, rules entities.SharingPolicy, actorID string) (*entities.SharingPolicy, error) {
+	ctx, span := tracing.Start(ctx, "SharingPolicyService.SetPolicy")
+	defer span.End()
+
+	v := &ValidationError{}
+	if rules.MaxShareDays < 0 || rules.MaxShareDays > maxShareDaysLimit {
+		v.add("maxShareDays", "must be between 0 and %d", maxShareDaysLimit)
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	if teamID != entities.GlobalSharingPolicy {
+		if _, err := s.teamRepo.GetByID(ctx, teamID); errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	policy := &entities.SharingPolicy{
+		TeamID:               teamID,
+		WithinTeams:          rules.WithinTeams,
+		DirectoryUsersOnly:   rules.DirectoryUsersOnly,
+		WriteRequiresManager: rules.WriteRequiresManager,
+		MaxShareDays:         rules.MaxShareDays,
+		UpdatedBy:            actorID,
+	}
+	if err := s.policyRepo.Save(ctx, policy); err != nil {
+		return nil, err
+	}
+	return s.policyRepo.Get(ctx, teamID)
+}
+
+func (s *sharingPolicyService) DeletePolicy(ctx context.Context, teamID uint) error {
+	ctx, span := tracing.Start(ctx, "SharingPolicyService.DeletePolicy")
+	defer span.End()
+
+	err := s.policyRepo.Delete(ctx, teamID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSharingPolicyNotFound
+	}
+	return err
+}
+
+func (s *sharingPolicyService) Evaluate(ctx context.Context, tx *gorm.DB, check ShareCheck) (*time.Time, error) {
+	ctx, span := tracing.Start(ctx, "SharingPolicyService.Evaluate")
+	defer span.End()
+
+	now := time.Now()
+	if check.ExpiresAt != nil && !check.ExpiresAt.After(now) {
+		v := &ValidationError{}
+		v.add("expiresAt", "must be in the future")
+		return nil, v.err()
+	}
+
+	teamRepo := s.teamRepo.WithTx(tx)
+	ownTeams, teamIDs, err := governingTeams(ctx, teamRepo, check.OwnerID, check.TeamID)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := s.policyRepo.WithTx(tx).ListForTeams(ctx, append(teamIDs, entities.GlobalSharingPolicy))
+	if err != nil {
+		return nil, err
+	}
+
+	// Each fact is looked up once, and only if a policy needs it
+	within := once(func() (bool, error) {
+		if check.TeamID != nil {
+			return teamRepo.IsUserInTeamTree(ctx, check.TargetUserID, *check.TeamID)
+		}
+		return sharesTeam(ctx, teamRepo, check.OwnerID, check.TargetUserID)
+	})
+	inDirectory := once(func() (bool, error) {
+		user, err := s.userRepo.WithTx(tx).GetByID(ctx, check.TargetUserID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return err == nil && user.Active, err
+	})
+
+	var violations []PolicyViolation
+	violate := func(p entities.SharingPolicy, rule, format string, args ...interface{}) {
+		violations = append(violations, PolicyViolation{Rule: rule, TeamID: p.TeamID, Message: fmt.Sprintf(format, args...)})
+	}
+	var latest *time.Time
+	for _, p := range policies {
+		if p.WithinTeams {
+			ok, err := within()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				violate(p, entities.SharingRuleWithinTeams, "%s is not on a team with the owner", check.TargetUserID)
+			}
+		}
+		if p.DirectoryUsersOnly {
+			ok, err := inDirectory()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				violate(p, entities.SharingRuleDirectoryUsersOnly, "%s is not an active user in the directory", check.TargetUserID)
+			}
+		}
+		if p.WriteRequiresManager && check.Access == "write" {
+			ok, err := grantsWrite(ctx, teamRepo, p, ownTeams, check.ActorID)
+			if err == nil && !ok && check.ApproverID != "" {
+				ok, err = grantsWrite(ctx, teamRepo, p, ownTeams, check.ApproverID)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				violate(p, entities.SharingRuleWriteRequiresManager, "write access can only be granted by a team manager")
+			}
+		}
+		if p.MaxShareDays > 0 {
+			limit := now.AddDate(0, 0, p.MaxShareDays)
+			if check.ExpiresAt != nil && check.ExpiresAt.After(limit) {
+				violate(p, entities.SharingRuleMaxShareDuration, "shares may last at most %d days", p.MaxShareDays)
+			}
+			if latest == nil || limit.Before(*latest) {
+				latest = &limit
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		for _, v := range violations {
+			metrics.SharingPolicyViolations.WithLabelValues(v.Rule).Inc()
+		}
+		return nil, &SharingPolicyError{Violations: violations}
+	}
+	if check.ExpiresAt != nil {
+		return check.ExpiresAt, nil
+	}
+	return latest, nil
+}
+
+// grantsWrite reports whether the user satisfies a write_requires_manager rule. A team's rule is
+// satisfied by its managers, the global rule by managers of the teams owning the asset.
+func grantsWrite(ctx context.Context, teamRepo repository.TeamRepository, p entities.SharingPolicy, ownTeams []uint, userID string) (bool, error) {
+	if p.TeamID != entities.GlobalSharingPolicy {
+		return teamRepo.HasPermission(ctx, userID, p.TeamID, entities.TeamPermManageTeam)
+	}
+	for _, teamID := range ownTeams {
+		ok, err := teamRepo.HasPermission(ctx, userID, teamID, entities.TeamPermManageTeam)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// needsManagerApproval reports whether err only says a write share needs a team manager, which
+// their approval resolves
+func needsManagerApproval(err error) bool {
+	var policyErr *SharingPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	for _, v := range policyErr.Violations {
+		if v.Rule != entities.SharingRuleWriteRequiresManager {
+			return false
+		}
+	}
+	return true
+}
+
+// governingTeams returns the teams that own the asset, which is the owning team or the owner's
+// teams, and those teams together with every team above them
+func governingTeams(ctx context.Context, teamRepo repository.TeamRepository, ownerID string, teamID *uint) ([]uint, []uint, error) {
+	var own []uint
+	if teamID != nil {
+		own = []uint{*teamID}
+	} else {
+		rosters, err := teamRepo.GetRostersByUser(ctx, ownerID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, r := range rosters {
+			own = append(own, r.TeamId)
+		}
+	}
+
+	seen := make(map[uint]bool)
+	var all []uint
+	for _, id := range own {
+		ancestors, err := teamRepo.AncestorIDs(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, t := range append([]uint{id}, ancestors...) {
+			if !seen[t] {
+				seen[t] = true
+				all = append(all, t)
+			}
+		}
+	}
+	return own, all, nil
+}
+
+// sharesTeam reports whether two users are on the roster of a common team
+func sharesTeam(ctx context.Context, teamRepo repository.TeamRepository, userID, otherID string) (bool, error) {
+	if userID == otherID {
+		return true, nil
+	}
+	rosters, err := teamRepo.GetRostersByUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	teams := make(map[uint]bool, len(rosters))
+	for _, r := range rosters {
+		teams[r.TeamId] = true
+	}
+	otherRosters, err := teamRepo.GetRostersByUser(ctx, otherID)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range otherRosters {
+		if teams[r.TeamId] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// once wraps a lookup so it runs at most once
+func once(lookup func() (bool, error)) func() (bool, error) {
+	var done, result bool
+	var err error
+	return func() (bool, error) {
+		if !done {
+			result, err = lookup()
+			done = true
+		}
+		return result, err
+	}
+}
@@ -0,0 +1,215 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+)
+
+func TestEvaluateSharingPolicies(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDB(t)
+	teamRepo := repository.NewTeamRepository(database)
+	service := NewSharingPolicyService(repository.NewSharingPolicyRepository(database), teamRepo, repository.NewUserRepository(database))
+
+	// org > eng; boss manages org, lead manages eng, owner and peer are on eng
+	chain := addChain(t, database, "org", nil, 2)
+	org, eng := chain[0], chain[1]
+	for _, r := range []entities.Roster{
+		{TeamId: org, UserId: "boss", Role: entities.RosterRoleManager},
+		{TeamId: eng, UserId: "lead", Role: entities.RosterRoleManager},
+		{TeamId: eng, UserId: "owner", Role: entities.RosterRoleMember},
+		{TeamId: eng, UserId: "peer", Role: entities.RosterRoleMember},
+	} {
+		if err := teamRepo.CreateRoster(ctx, &r, "seed"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"peer", "gone"} {
+		if err := database.Create(&entities.User{ID: id, Role: "MEMBER"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Model(&entities.User{}).Where("id = ?", "gone").Update("active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	days := func(n int) *time.Time {
+		at := time.Now().AddDate(0, 0, n)
+		return &at
+	}
+	personal := func(target, access, actor string) ShareCheck {
+		return ShareCheck{OwnerID: "owner", TargetUserID: target, Access: access, ActorID: actor}
+	}
+
+	tests := []struct {
+		name      string
+		policies  []entities.SharingPolicy
+		check     ShareCheck
+		wantRules []string // sorted
+		wantDays  int      // expiry granted, in days from now; 0 for none
+	}{
+		{
+			name:  "no policies",
+			check: personal("stranger", "write", "owner"),
+		},
+		{
+			name:     "within teams, target shares a team with the owner",
+			policies: []entities.SharingPolicy{{TeamID: eng, WithinTeams: true}},
+			check:    personal("peer", "read", "owner"),
+		},
+		{
+			name:      "within teams, target on no team with the owner",
+			policies:  []entities.SharingPolicy{{TeamID: eng, WithinTeams: true}},
+			check:     personal("stranger", "read", "owner"),
+			wantRules: []string{entities.SharingRuleWithinTeams},
+		},
+		{
+			name:     "within teams, team asset shared with a member of a team above",
+			policies: []entities.SharingPolicy{{TeamID: eng, WithinTeams: true}},
+			check:    ShareCheck{OwnerID: "lead", TeamID: &eng, TargetUserID: "boss", Access: "read", ActorID: "lead"},
+		},
+		{
+			name:     "directory users only, active user",
+			policies: []entities.SharingPolicy{{DirectoryUsersOnly: true}},
+			check:    personal("peer", "read", "owner"),
+		},
+		{
+			name:      "directory users only, deactivated user",
+			policies:  []entities.SharingPolicy{{DirectoryUsersOnly: true}},
+			check:     personal("gone", "read", "owner"),
+			wantRules: []string{entities.SharingRuleDirectoryUsersOnly},
+		},
+		{
+			name:      "every broken rule is listed",
+			policies:  []entities.SharingPolicy{{DirectoryUsersOnly: true}, {TeamID: org, WithinTeams: true}},
+			check:     personal("stranger", "read", "owner"),
+			wantRules: []string{entities.SharingRuleDirectoryUsersOnly, entities.SharingRuleWithinTeams},
+		},
+		{
+			name:     "write requires manager, read share",
+			policies: []entities.SharingPolicy{{TeamID: eng, WriteRequiresManager: true}},
+			check:    personal("peer", "read", "owner"),
+		},
+		{
+			name:      "write requires manager, member grants write",
+			policies:  []entities.SharingPolicy{{TeamID: eng, WriteRequiresManager: true}},
+			check:     personal("peer", "write", "owner"),
+			wantRules: []string{entities.SharingRuleWriteRequiresManager},
+		},
+		{
+			name:     "write requires manager, manager grants write",
+			policies: []entities.SharingPolicy{{TeamID: eng, WriteRequiresManager: true}},
+			check:    personal("peer", "write", "lead"),
+		},
+		{
+			name:     "write requires manager, manager approves",
+			policies: []entities.SharingPolicy{{TeamID: eng, WriteRequiresManager: true}},
+			check:    ShareCheck{OwnerID: "owner", TargetUserID: "peer", Access: "write", ActorID: "owner", ApproverID: "lead"},
+		},
+		{
+			name:      "write requires manager, member approves",
+			policies:  []entities.SharingPolicy{{TeamID: eng, WriteRequiresManager: true}},
+			check:     ShareCheck{OwnerID: "owner", TargetUserID: "peer", Access: "write", ActorID: "owner", ApproverID: "peer"},
+			wantRules: []string{entities.SharingRuleWriteRequiresManager},
+		},
+		{
+			name:     "write requires manager on a team above, its manager grants write",
+			policies: []entities.SharingPolicy{{TeamID: org, WriteRequiresManager: true}},
+			check:    personal("peer", "write", "boss"),
+		},
+		{
+			name:     "global write requires manager, a manager of the owner's team grants write",
+			policies: []entities.SharingPolicy{{WriteRequiresManager: true}},
+			check:    personal("peer", "write", "lead"),
+		},
+		{
+			name:      "global write requires manager, member grants write",
+			policies:  []entities.SharingPolicy{{WriteRequiresManager: true}},
+			check:     personal("peer", "write", "owner"),
+			wantRules: []string{entities.SharingRuleWriteRequiresManager},
+		},
+		{
+			name:     "max share duration shortens a share that never expires to the tightest limit",
+			policies: []entities.SharingPolicy{{MaxShareDays: 10}, {TeamID: eng, MaxShareDays: 30}},
+			check:    personal("peer", "read", "owner"),
+			wantDays: 10,
+		},
+		{
+			name:     "max share duration keeps a shorter expiry",
+			policies: []entities.SharingPolicy{{MaxShareDays: 10}},
+			check:    ShareCheck{OwnerID: "owner", TargetUserID: "peer", Access: "read", ActorID: "owner", ExpiresAt: days(5)},
+			wantDays: 5,
+		},
+		{
+			name:      "max share duration rejects a longer expiry",
+			policies:  []entities.SharingPolicy{{TeamID: org, MaxShareDays: 10}},
+			check:     ShareCheck{OwnerID: "owner", TargetUserID: "peer", Access: "read", ActorID: "owner", ExpiresAt: days(20)},
+			wantRules: []string{entities.SharingRuleMaxShareDuration},
+		},
+		{
+			name:     "policies of unrelated teams do not apply",
+			policies: []entities.SharingPolicy{{TeamID: addTeam(t, database, "sales", nil), WithinTeams: true}},
+			check:    personal("stranger", "read", "owner"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := database.Where("1 = 1").Delete(&entities.SharingPolicy{}).Error; err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range tt.policies {
+				if _, err := service.SetPolicy(ctx, p.TeamID, p, "admin"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expiresAt, err := service.Evaluate(ctx, database, tt.check)
+			var policyErr *SharingPolicyError
+			switch {
+			case errors.As(err, &policyErr):
+				var rules []string
+				for _, v := range policyErr.Violations {
+					rules = append(rules, v.Rule)
+				}
+				sort.Strings(rules)
+				if fmt.Sprint(rules) != fmt.Sprint(tt.wantRules) {
+					t.Errorf("violated %v, want %v", rules, tt.wantRules)
+				}
+				return
+			case err != nil:
+				t.Fatalf("Evaluate: %v", err)
+			case len(tt.wantRules) > 0:
+				t.Fatalf("Evaluate allowed the share, want %v violated", tt.wantRules)
+			}
+
+			switch {
+			case tt.wantDays == 0 && expiresAt != nil:
+				t.Errorf("expiry = %v, want none", expiresAt)
+			case tt.wantDays > 0 && (expiresAt == nil || expiresAt.Sub(*days(tt.wantDays)).Abs() > time.Minute):
+				t.Errorf("expiry = %v, want %d days from now", expiresAt, tt.wantDays)
+			}
+		})
+	}
+}
+
+func TestEvaluateRejectsPastExpiry(t *testing.T) {
+	database := newTestDB(t)
+	service := NewSharingPolicyService(repository.NewSharingPolicyRepository(database),
+		repository.NewTeamRepository(database), repository.NewUserRepository(database))
+
+	past := time.Now().Add(-time.Minute)
+	_, err := service.Evaluate(context.Background(), database, ShareCheck{
+		OwnerID: "owner", TargetUserID: "peer", Access: "read", ActorID: "owner", ExpiresAt: &past,
+	})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Evaluate = %v, want a validation error", err)
+	}
+}
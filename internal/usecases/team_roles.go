@@ -0,0 +1,244 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"team-service/internal/entities"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
+
+	"gorm.io/gorm"
+)
+
+// maxTeamRoleDescriptionLength bounds the free-text description of a custom role
+const maxTeamRoleDescriptionLength = 200
+
+func (s *teamService) ListRoles(ctx context.Context, teamID uint) ([]entities.TeamRole, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.ListRoles")
+	defer span.End()
+
+	if _, err := s.getTeam(ctx, teamID); err != nil {
+		return nil, err
+	}
+	return s.roleRepo.ListByTeam(ctx, teamID)
+}
+
+func (s *teamService) CreateRole(ctx context.Context, teamID uint, name, description string, permissions []string, actorID string, actorPermissions []string) (*entities.TeamRole, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.CreateRole")
+	defer span.End()
+
+	if _, err := s.getTeam(ctx, teamID); err != nil {
+		return nil, err
+	}
+	role := &entities.TeamRole{
+		TeamID:      teamID,
+		Name:        strings.TrimSpace(name),
+		Description: strings.TrimSpace(description),
+		Permissions: permissions,
+		CreatedBy:   actorID,
+	}
+	if err := validateTeamRole(role); err != nil {
+		return nil, err
+	}
+	if !isSubset(role.Permissions, actorPermissions) {
+		return nil, ErrPermissionEscalation
+	}
+
+	if err := s.roleRepo.Create(ctx, role); errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrTeamRoleExists
+	} else if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// UpdateRole replaces a role's description and permissions. Members holding the role pick up
+// the new permissions on their next request.
+func (s *teamService) UpdateRole(ctx context.Context, teamID uint, name, description string, permissions []string, actorPermissions []string) (*entities.TeamRole, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.UpdateRole")
+	defer span.End()
+
+	role, err := s.getRole(ctx, teamID, name)
+	if err != nil {
+		return nil, err
+	}
+	// Editing a role is taking its old permissions away as much as granting the new ones
+	if !isSubset(role.Permissions, actorPermissions) {
+		return nil, ErrPermissionEscalation
+	}
+
+	role.Description = strings.TrimSpace(description)
+	role.Permissions = permissions
+	if err := validateTeamRole(role); err != nil {
+		return nil, err
+	}
+	if !isSubset(role.Permissions, actorPermissions) {
+		return nil, ErrPermissionEscalation
+	}
+	if err := s.roleRepo.Update(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// DeleteRole removes a role nobody on the team holds any more
+func (s *teamService) DeleteRole(ctx context.Context, teamID uint, name string) error {
+	ctx, span := tracing.Start(ctx, "TeamService.DeleteRole")
+	defer span.End()
+
+	role, err := s.getRole(ctx, teamID, name)
+	if err != nil {
+		return err
+	}
+	holders, err := s.teamRepo.CountRosterWithRole(ctx, teamID, role.Name)
+	if err != nil {
+		return err
+	}
+	if holders > 0 {
+		return ErrTeamRoleInUse
+	}
+	return s.roleRepo.Delete(ctx, role.ID)
+}
+
+// AssignRole switches a user on the roster to a built-in or custom role. The caller must hold
+// every permission of both the old and the new role, and a root team keeps at least one manager.
+func (s *teamService) AssignRole(ctx context.Context, teamID uint, userID, role, actorID string, actorPermissions []string) error {
+	ctx, span := tracing.Start(ctx, "TeamService.AssignRole")
+	defer span.End()
+
+	team, err := s.getTeam(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	roster, err := s.teamRepo.GetRosterByTeamAndUser(ctx, teamID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotOnTeam
+	} else if err != nil {
+		return err
+	}
+
+	role = normalizeRosterRole(strings.TrimSpace(role))
+	granted, err := s.rolePermissions(ctx, teamID, role)
+	if err != nil {
+		return err
+	}
+	if roster.Role == role {
+		return nil
+	}
+	current, err := s.rolePermissions(ctx, teamID, roster.Role)
+	if errors.Is(err, ErrTeamRoleNotFound) {
+		current = nil
+	} else if err != nil {
+		return err
+	}
+	if !isSubset(granted, actorPermissions) || !isSubset(current, actorPermissions) {
+		return ErrPermissionEscalation
+	}
+
+	if roster.Role == entities.RosterRoleManager && team.ParentTeamID == nil {
+		managers, err := s.teamRepo.CountRosterWithRole(ctx, teamID, entities.RosterRoleManager)
+		if err != nil {
+			return err
+		}
+		if managers <= 1 {
+			v := &ValidationError{}
+			v.add("role", "a root team must keep at least one MANAGER")
+			return v.err()
+		}
+	}
+
+	if err := s.teamRepo.SetRosterRole(ctx, teamID, userID, role, actorID); err != nil {
+		return err
+	}
+
+	metrics.RosterChanges.WithLabelValues("remove", roleLabel(roster.Role)).Inc()
+	metrics.RosterChanges.WithLabelValues("add", roleLabel(role)).Inc()
+	return nil
+}
+
+// rolePermissions resolves a built-in role or one defined on the team
+func (s *teamService) rolePermissions(ctx context.Context, teamID uint, name string) ([]string, error) {
+	if perms, ok := entities.BuiltinRolePermissions(name); ok {
+		return perms, nil
+	}
+	role, err := s.getRole(ctx, teamID, name)
+	if err != nil {
+		return nil, err
+	}
+	return role.Permissions, nil
+}
+
+// requireRole fails with ErrPermissionEscalation unless actorPermissions cover every permission
+// of role. A custom role that no longer exists grants nothing.
+func (s *teamService) requireRole(ctx context.Context, teamID uint, role string, actorPermissions []string) error {
+	perms, err := s.rolePermissions(ctx, teamID, role)
+	if errors.Is(err, ErrTeamRoleNotFound) {
+		perms = nil
+	} else if err != nil {
+		return err
+	}
+	if !isSubset(perms, actorPermissions) {
+		return ErrPermissionEscalation
+	}
+	return nil
+}
+
+func (s *teamService) getRole(ctx context.Context, teamID uint, name string) (*entities.TeamRole, error) {
+	if _, err := s.getTeam(ctx, teamID); err != nil {
+		return nil, err
+	}
+	role, err := s.roleRepo.Get(ctx, teamID, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTeamRoleNotFound
+	}
+	return role, err
+}
+
+// validateTeamRole checks the name and description and de-duplicates the permissions
+func validateTeamRole(role *entities.TeamRole) error {
+	v := &ValidationError{}
+	if !entities.IsValidTeamRoleName(role.Name) {
+		v.add("name", "must be 2-32 lower-case letters, digits or dashes, starting with a letter")
+	}
+	if len(role.Description) > maxTeamRoleDescriptionLength {
+		v.add("description", "must be at most %d characters", maxTeamRoleDescriptionLength)
+	}
+	if len(role.Permissions) == 0 {
+		v.add("permissions", "at least one permission is required")
+	}
+
+	seen := make(map[string]bool, len(role.Permissions))
+	perms := make([]string, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		if !entities.IsValidTeamPermission(p) {
+			v.add("permissions", "unknown permission %q", p)
+			continue
+		}
+		if !seen[p] {
+			seen[p] = true
+			perms = append(perms, p)
+		}
+	}
+	role.Permissions = perms
+	return v.err()
+}
+
+// isSubset reports whether every permission in perms is also in held
+func isSubset(perms, held []string) bool {
+	set := toSet(held)
+	for _, p := range perms {
+		if !set[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// roleLabel keeps the role label of roster metrics bounded: custom roles are counted together
+func roleLabel(role string) string {
+	if _, ok := entities.BuiltinRolePermissions(role); ok {
+		return strings.ToLower(role)
+	}
+	return "custom"
+}
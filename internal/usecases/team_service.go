@@ -1,91 +1,918 @@
 package usecases
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"team-service/internal/entities"
 	"team-service/internal/repository"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 type TeamService interface {
-	CreateTeam(teamName string, managers []entities.Manager, members []entities.Member) (map[string]interface{}, error)
-	AddMember(teamID uint, memberID string) error
-	DeleteMember(teamID uint, memberID string) error
-	AddManager(teamID uint, managerID string) error
-	DeleteManager(teamID uint, managerID string) error
+	CreateTeam(ctx context.Context, teamName string, managers []entities.Manager, members []entities.Member, creatorID, creatorRole string) (map[string]interface{}, error)
+	AddMember(ctx context.Context, teamID uint, memberID, actorID string) error
+
+	// actorPermissions are the caller's own permissions on the team; nobody can add or remove
+	// holders of a role granting more than they hold themselves.
+	DeleteMember(ctx context.Context, teamID uint, memberID, actorID string, actorPermissions []string) error
+	AddManager(ctx context.Context, teamID uint, managerID, actorID string, actorPermissions []string) error
+	DeleteManager(ctx context.Context, teamID uint, managerID, actorID string, actorPermissions []string) error
+
+	// Membership policy and join requests
+	GetSettings(ctx context.Context, teamID uint) (*entities.Team, error)
+	SetMembershipPolicy(ctx context.Context, teamID uint, policy string) (*entities.Team, error)
+	RequestToJoin(ctx context.Context, teamID uint, userID, message string) (*entities.JoinRequest, error)
+	ListJoinRequests(ctx context.Context, teamID uint, status string) ([]entities.JoinRequest, error)
+	DecideJoinRequest(ctx context.Context, teamID, requestID uint, deciderID string, approve bool) (*entities.JoinRequest, error)
+
+	// Org tree
+	CreateSubTeam(ctx context.Context, parentID uint, teamName string, managers []entities.Manager, members []entities.Member, creatorID string, creatorPermissions []string) (map[string]interface{}, error)
+	MoveTeam(ctx context.Context, teamID uint, newParentID *uint, callerID, callerRole string) (*entities.Team, error)
+	ListAncestors(ctx context.Context, teamID uint) ([]entities.Team, error)
+	ListDescendants(ctx context.Context, teamID uint) ([]entities.Team, error)
+
+	// Membership history; a non-nil at keeps only the intervals covering that instant
+	TeamHistory(ctx context.Context, teamID uint, at *time.Time) ([]entities.RosterInterval, error)
+	UserTeamHistory(ctx context.Context, userID string, at *time.Time) ([]entities.RosterInterval, error)
+
+	// Bulk roster import and export
+	ImportRoster(ctx context.Context, teamID uint, entries []RosterEntry, actorID string, actorPermissions []string, dryRun bool) (*RosterDiff, error)
+	ExportRoster(ctx context.Context, teamID uint) ([]RosterEntry, error)
+
+	// Custom roles. actorPermissions are the caller's own permissions on the team; nobody can
+	// define or hand out a role granting more than they hold themselves.
+	ListRoles(ctx context.Context, teamID uint) ([]entities.TeamRole, error)
+	CreateRole(ctx context.Context, teamID uint, name, description string, permissions []string, actorID string, actorPermissions []string) (*entities.TeamRole, error)
+	UpdateRole(ctx context.Context, teamID uint, name, description string, permissions []string, actorPermissions []string) (*entities.TeamRole, error)
+	DeleteRole(ctx context.Context, teamID uint, name string) error
+	AssignRole(ctx context.Context, teamID uint, userID, role, actorID string, actorPermissions []string) error
 }
 
+// ErrAlreadyOnTeam is returned when a roster change would list a user on a team twice
+var ErrAlreadyOnTeam = errors.New("user is already on the team")
+
+var (
+	ErrTeamNotFound            = errors.New("team not found")
+	ErrInvalidMembershipPolicy = errors.New("membership policy must be open, request or invite")
+	ErrJoinNotAllowed          = errors.New("this team only accepts new members by invitation")
+	ErrJoinRequestExists       = errors.New("a pending join request already exists for this team")
+	ErrJoinRequestNotFound     = errors.New("join request not found")
+	ErrJoinRequestNotPending   = errors.New("join request has already been decided")
+	ErrTeamCycle               = errors.New("a team cannot be moved under itself or one of its sub-teams")
+	ErrTeamTooDeep             = fmt.Errorf("org tree cannot be deeper than %d levels", repository.MaxTeamDepth)
+	ErrTeamMoveForbidden       = errors.New("moving a team requires managing both its current and its new parent")
+	ErrTeamRoleNotFound        = errors.New("team role not found")
+	ErrTeamRoleExists          = errors.New("a role with this name already exists on the team")
+	ErrTeamRoleInUse           = errors.New("the role is still assigned to members of the team")
+	ErrPermissionEscalation    = errors.New("you cannot grant permissions you do not hold on this team")
+	ErrNotOnTeam               = errors.New("user is not on the team")
+	ErrRosterChanged           = errors.New("the roster changed during the import; retry it")
+)
+
+// maxJoinRequestMessageLength bounds the note a requester can leave for the managers
+const maxJoinRequestMessageLength = 500
+
+// maxTeamNameLength bounds team names so they fit comfortably in listings
+const maxTeamNameLength = 100
+
 type teamService struct {
-	teamRepo repository.TeamRepository
+	teamRepo        repository.TeamRepository
+	joinRequestRepo repository.JoinRequestRepository
+	userRepo        repository.UserRepository
+	roleRepo        repository.TeamRoleRepository
+	db              *gorm.DB
 }
 
-func NewTeamService(teamRepo repository.TeamRepository) TeamService {
+func NewTeamService(teamRepo repository.TeamRepository, joinRequestRepo repository.JoinRequestRepository, userRepo repository.UserRepository, roleRepo repository.TeamRoleRepository, db *gorm.DB) TeamService {
 	return &teamService{
-		teamRepo: teamRepo,
+		teamRepo:        teamRepo,
+		joinRequestRepo: joinRequestRepo,
+		userRepo:        userRepo,
+		roleRepo:        roleRepo,
+		db:              db,
 	}
 }
 
-func (s *teamService) CreateTeam(teamName string, managers []entities.Manager, members []entities.Member) (map[string]interface{}, error) {
-	team := &entities.Team{
-		TeamName: teamName,
+func (s *teamService) CreateTeam(ctx context.Context, teamName string, managers []entities.Manager, members []entities.Member, creatorID, creatorRole string) (map[string]interface{}, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.CreateTeam")
+	defer span.End()
+
+	teamName = strings.TrimSpace(teamName)
+	managers, err := validateNewTeam(teamName, managers, members, creatorID, creatorRole, true)
+	if err != nil {
+		return nil, err
 	}
 
-	err := s.teamRepo.Create(team)
+	return s.createTeam(ctx, &entities.Team{TeamName: teamName, CreatedBy: creatorID}, managers, members)
+}
+
+// CreateSubTeam creates a team below parentID. Managers of the parent already manage the new
+// team, so it may be created without managers of its own; naming some requires holding every
+// MANAGER permission.
+func (s *teamService) CreateSubTeam(ctx context.Context, parentID uint, teamName string, managers []entities.Manager, members []entities.Member, creatorID string, creatorPermissions []string) (map[string]interface{}, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.CreateSubTeam")
+	defer span.End()
+
+	teamName = strings.TrimSpace(teamName)
+	managers, err := validateNewTeam(teamName, managers, members, creatorID, "", false)
 	if err != nil {
 		return nil, err
 	}
+	if granted, _ := entities.BuiltinRolePermissions(entities.RosterRoleManager); len(managers) > 0 && !isSubset(granted, creatorPermissions) {
+		return nil, ErrPermissionEscalation
+	}
 
-	// Add managers to roster
-	for _, m := range managers {
-		roster := &entities.Roster{
-			TeamId:   team.TeamId,
-			UserId:   m.ManagerId,
-			IsLeader: true,
-		}
-		s.teamRepo.CreateRoster(roster)
+	if _, err := s.getTeam(ctx, parentID); err != nil {
+		return nil, err
 	}
+	ancestors, err := s.teamRepo.AncestorIDs(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	// The parent's level plus the new team's own
+	if len(ancestors)+2 > repository.MaxTeamDepth {
+		return nil, ErrTeamTooDeep
+	}
+
+	return s.createTeam(ctx, &entities.Team{TeamName: teamName, CreatedBy: creatorID, ParentTeamID: &parentID}, managers, members)
+}
 
-	// Add members to roster
-	for _, m := range members {
-		roster := &entities.Roster{
-			TeamId:   team.TeamId,
-			UserId:   m.MemberId,
-			IsLeader: false,
+func (s *teamService) createTeam(ctx context.Context, team *entities.Team, managers []entities.Manager, members []entities.Member) (map[string]interface{}, error) {
+	team.MembershipPolicy = entities.MembershipRequest
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := s.teamRepo.WithTx(tx)
+		if err := repo.Create(ctx, team); err != nil {
+			return err
+		}
+
+		for _, m := range managers {
+			if err := repo.CreateRoster(ctx, &entities.Roster{TeamId: team.TeamId, UserId: m.ManagerId, IsLeader: true}, team.CreatedBy); err != nil {
+				return err
+			}
+		}
+		for _, m := range members {
+			if err := repo.CreateRoster(ctx, &entities.Roster{TeamId: team.TeamId, UserId: m.MemberId, IsLeader: false}, team.CreatedBy); err != nil {
+				return err
+			}
 		}
-		s.teamRepo.CreateRoster(roster)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	metrics.TeamsCreated.Inc()
+	metrics.RosterChanges.WithLabelValues("add", "manager").Add(float64(len(managers)))
+	metrics.RosterChanges.WithLabelValues("add", "member").Add(float64(len(members)))
 	return map[string]interface{}{
-		"teamId":   team.TeamId,
-		"teamName": team.TeamName,
-		"managers": managers,
-		"members":  members,
+		"teamId":           team.TeamId,
+		"teamName":         team.TeamName,
+		"createdBy":        team.CreatedBy,
+		"parentTeamId":     team.ParentTeamID,
+		"membershipPolicy": team.MembershipPolicy,
+		"managers":         managers,
+		"members":          members,
 	}, nil
 }
 
-func (s *teamService) AddMember(teamID uint, memberID string) error {
+// validateNewTeam checks the whole roster before anything is written and returns the
+// managers list, with a MANAGER creator added when they did not list themselves
+func validateNewTeam(teamName string, managers []entities.Manager, members []entities.Member, creatorID, creatorRole string, requireManager bool) ([]entities.Manager, error) {
+	v := &ValidationError{}
+
+	if teamName == "" {
+		v.add("teamName", "is required")
+	} else if len(teamName) > maxTeamNameLength {
+		v.add("teamName", "must be at most %d characters", maxTeamNameLength)
+	}
+
+	seen := make(map[string]string)
+	for i, m := range managers {
+		field := fmt.Sprintf("managers[%d].managerId", i)
+		id := strings.TrimSpace(m.ManagerId)
+		switch {
+		case id == "":
+			v.add(field, "is required")
+		case seen[id] != "":
+			v.add(field, "%q is already listed as %s", id, seen[id])
+		default:
+			seen[id] = field
+		}
+		managers[i].ManagerId = id
+	}
+
+	creatorIsManager := creatorRole == "MANAGER"
+	for i, m := range members {
+		field := fmt.Sprintf("members[%d].memberId", i)
+		id := strings.TrimSpace(m.MemberId)
+		switch {
+		case id == "":
+			v.add(field, "is required")
+		case seen[id] != "":
+			v.add(field, "%q is already listed as %s", id, seen[id])
+		case creatorIsManager && id == creatorID:
+			v.add(field, "the creating manager joins the team as a manager and cannot also be a member")
+		default:
+			seen[id] = field
+		}
+		members[i].MemberId = id
+	}
+
+	if creatorIsManager && seen[creatorID] == "" {
+		managers = append([]entities.Manager{{ManagerId: creatorID}}, managers...)
+	}
+	if requireManager && len(managers) == 0 {
+		v.add("managers", "at least one manager is required")
+	}
+
+	return managers, v.err()
+}
+
+func (s *teamService) AddMember(ctx context.Context, teamID uint, memberID, actorID string) error {
+	ctx, span := tracing.Start(ctx, "TeamService.AddMember")
+	defer span.End()
+
 	roster := &entities.Roster{
 		TeamId:   teamID,
 		UserId:   memberID,
 		IsLeader: false,
 	}
-	return s.teamRepo.CreateRoster(roster)
+	if err := s.teamRepo.CreateRoster(ctx, roster, actorID); errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrAlreadyOnTeam
+	} else if err != nil {
+		return err
+	}
+
+	metrics.RosterChanges.WithLabelValues("add", "member").Inc()
+	return nil
 }
 
-func (s *teamService) DeleteMember(teamID uint, memberID string) error {
-	return s.teamRepo.DeleteRoster(teamID, memberID, false)
+// DeleteMember removes a user holding MEMBER or a custom role. The caller must hold every
+// permission of that role.
+func (s *teamService) DeleteMember(ctx context.Context, teamID uint, memberID, actorID string, actorPermissions []string) error {
+	ctx, span := tracing.Start(ctx, "TeamService.DeleteMember")
+	defer span.End()
+
+	roster, err := s.teamRepo.GetRosterByTeamAndUser(ctx, teamID, memberID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && roster.IsLeader) {
+		return ErrNotOnTeam
+	} else if err != nil {
+		return err
+	}
+	if err := s.requireRole(ctx, teamID, roster.Role, actorPermissions); err != nil {
+		return err
+	}
+
+	if err := s.teamRepo.DeleteRoster(ctx, teamID, memberID, false, actorID); errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotOnTeam
+	} else if err != nil {
+		return err
+	}
+
+	metrics.RosterChanges.WithLabelValues("remove", roleLabel(roster.Role)).Inc()
+	return nil
 }
 
-func (s *teamService) AddManager(teamID uint, managerID string) error {
+func (s *teamService) AddManager(ctx context.Context, teamID uint, managerID, actorID string, actorPermissions []string) error {
+	ctx, span := tracing.Start(ctx, "TeamService.AddManager")
+	defer span.End()
+
+	if err := s.requireRole(ctx, teamID, entities.RosterRoleManager, actorPermissions); err != nil {
+		return err
+	}
+
 	roster := &entities.Roster{
 		TeamId:   teamID,
 		UserId:   managerID,
 		IsLeader: true,
 	}
-	return s.teamRepo.CreateRoster(roster)
+	if err := s.teamRepo.CreateRoster(ctx, roster, actorID); errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrAlreadyOnTeam
+	} else if err != nil {
+		return err
+	}
+
+	metrics.RosterChanges.WithLabelValues("add", "manager").Inc()
+	return nil
+}
+
+func (s *teamService) DeleteManager(ctx context.Context, teamID uint, managerID, actorID string, actorPermissions []string) error {
+	ctx, span := tracing.Start(ctx, "TeamService.DeleteManager")
+	defer span.End()
+
+	if err := s.requireRole(ctx, teamID, entities.RosterRoleManager, actorPermissions); err != nil {
+		return err
+	}
+
+	if err := s.teamRepo.DeleteRoster(ctx, teamID, managerID, true, actorID); errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotOnTeam
+	} else if err != nil {
+		return err
+	}
+
+	metrics.RosterChanges.WithLabelValues("remove", "manager").Inc()
+	return nil
+}
+
+func (s *teamService) GetSettings(ctx context.Context, teamID uint) (*entities.Team, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.GetSettings")
+	defer span.End()
+
+	return s.getTeam(ctx, teamID)
+}
+
+func (s *teamService) SetMembershipPolicy(ctx context.Context, teamID uint, policy string) (*entities.Team, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.SetMembershipPolicy")
+	defer span.End()
+
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	if !entities.IsValidMembershipPolicy(policy) {
+		return nil, ErrInvalidMembershipPolicy
+	}
+
+	team, err := s.getTeam(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	team.MembershipPolicy = policy
+	if err := s.teamRepo.Update(ctx, team); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// RequestToJoin applies the team's membership policy: open teams add the user straight away
+// (recorded as an approved request), request-only teams queue the request for a manager and
+// invite-only teams refuse it
+func (s *teamService) RequestToJoin(ctx context.Context, teamID uint, userID, message string) (*entities.JoinRequest, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.RequestToJoin")
+	defer span.End()
+
+	message = strings.TrimSpace(message)
+	if len(message) > maxJoinRequestMessageLength {
+		v := &ValidationError{}
+		v.add("message", "must be at most %d characters", maxJoinRequestMessageLength)
+		return nil, v.err()
+	}
+
+	team, err := s.getTeam(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if team.MembershipPolicy == entities.MembershipInviteOnly {
+		return nil, ErrJoinNotAllowed
+	}
+
+	onTeam, err := s.teamRepo.IsUserMemberOfTeam(ctx, userID, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if onTeam {
+		return nil, ErrAlreadyOnTeam
+	}
+
+	request := &entities.JoinRequest{
+		TeamID:  teamID,
+		UserID:  userID,
+		Message: message,
+		Status:  entities.JoinRequestPending,
+	}
+
+	if team.MembershipPolicy == entities.MembershipOpen {
+		now := time.Now()
+		request.Status = entities.JoinRequestApproved
+		request.DecidedAt = &now
+		err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := s.joinRequestRepo.WithTx(tx).Create(ctx, request); err != nil {
+				return err
+			}
+			return s.addToRoster(ctx, s.teamRepo.WithTx(tx), teamID, userID, userID)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		metrics.JoinRequests.WithLabelValues("joined").Inc()
+		metrics.RosterChanges.WithLabelValues("add", "member").Inc()
+		return request, nil
+	}
+
+	pending, err := s.joinRequestRepo.HasPending(ctx, teamID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrJoinRequestExists
+	}
+	// The partial unique index catches a concurrent duplicate that slipped past the check
+	if err := s.joinRequestRepo.Create(ctx, request); errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrJoinRequestExists
+	} else if err != nil {
+		return nil, err
+	}
+
+	metrics.JoinRequests.WithLabelValues("requested").Inc()
+	return request, nil
 }
 
-func (s *teamService) DeleteManager(teamID uint, managerID string) error {
-	return s.teamRepo.DeleteRoster(teamID, managerID, true)
+func (s *teamService) ListJoinRequests(ctx context.Context, teamID uint, status string) ([]entities.JoinRequest, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.ListJoinRequests")
+	defer span.End()
+
+	return s.joinRequestRepo.ListByTeam(ctx, teamID, status)
+}
+
+// DecideJoinRequest approves or rejects a pending request; approval adds the requester to the
+// roster as a member in the same transaction
+func (s *teamService) DecideJoinRequest(ctx context.Context, teamID, requestID uint, deciderID string, approve bool) (*entities.JoinRequest, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.DecideJoinRequest")
+	defer span.End()
+
+	request, err := s.joinRequestRepo.GetByID(ctx, requestID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && request.TeamID != teamID) {
+		return nil, ErrJoinRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := entities.JoinRequestRejected
+	if approve {
+		status = entities.JoinRequestApproved
+	}
+
+	now := time.Now()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ok, err := s.joinRequestRepo.WithTx(tx).Decide(ctx, request.ID, status, deciderID, now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrJoinRequestNotPending
+		}
+		if !approve {
+			return nil
+		}
+		return s.addToRoster(ctx, s.teamRepo.WithTx(tx), teamID, request.UserID, deciderID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	request.Status = status
+	request.DecidedBy = deciderID
+	request.DecidedAt = &now
+	metrics.JoinRequests.WithLabelValues(status).Inc()
+	if approve {
+		metrics.RosterChanges.WithLabelValues("add", "member").Inc()
+	}
+	return request, nil
+}
+
+// MoveTeam re-parents a team, or makes it a root team when newParentID is nil. Unless the caller
+// is an ADMIN they must manage the team's current parent and the new one, so a sub-team cannot
+// detach itself from its org or attach itself somewhere it does not belong.
+func (s *teamService) MoveTeam(ctx context.Context, teamID uint, newParentID *uint, callerID, callerRole string) (*entities.Team, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.MoveTeam")
+	defer span.End()
+
+	var team *entities.Team
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := s.teamRepo.WithTx(tx)
+
+		// Lock the team and the new parent's chain before checking for cycles. Otherwise a
+		// concurrent move could put the new parent below this team between check and update.
+		ancestors, err := lockChain(ctx, repo, teamID, newParentID)
+		if err != nil {
+			return err
+		}
+
+		team, err = repo.GetByID(ctx, teamID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTeamNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, parentID := range []*uint{team.ParentTeamID, newParentID} {
+			if parentID == nil || callerRole == "ADMIN" {
+				continue
+			}
+			ok, err := repo.HasPermission(ctx, callerID, *parentID, entities.TeamPermManageTeam)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return ErrTeamMoveForbidden
+			}
+		}
+
+		if newParentID != nil {
+			if *newParentID == teamID || containsID(ancestors, teamID) {
+				return ErrTeamCycle
+			}
+			if _, err := repo.GetByID(ctx, *newParentID); errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTeamNotFound
+			} else if err != nil {
+				return err
+			}
+
+			descendants, err := repo.DescendantIDs(ctx, teamID)
+			if err != nil {
+				return err
+			}
+			height, err := subtreeHeight(ctx, repo, teamID, descendants)
+			if err != nil {
+				return err
+			}
+			// The new parent's level plus every level of the moved subtree
+			if len(ancestors)+1+height > repository.MaxTeamDepth {
+				return ErrTeamTooDeep
+			}
+		}
+
+		team.ParentTeamID = newParentID
+		return repo.Update(ctx, team)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// lockChain locks the team, the new parent and every ancestor of the new parent, and returns
+// those ancestors. The chain is read again after each round of locks, as it may have changed
+// before the locks were held, until every team on it is locked.
+func lockChain(ctx context.Context, repo repository.TeamRepository, teamID uint, newParentID *uint) ([]uint, error) {
+	lock := []uint{teamID}
+	if newParentID != nil {
+		lock = append(lock, *newParentID)
+	}
+	locked := make(map[uint]bool)
+	for {
+		if err := repo.LockTeams(ctx, lock); err != nil {
+			return nil, err
+		}
+		for _, id := range lock {
+			locked[id] = true
+		}
+		if newParentID == nil {
+			return nil, nil
+		}
+
+		ancestors, err := repo.AncestorIDs(ctx, *newParentID)
+		if err != nil {
+			return nil, err
+		}
+		lock = lock[:0]
+		for _, id := range ancestors {
+			if !locked[id] {
+				lock = append(lock, id)
+			}
+		}
+		if len(lock) == 0 {
+			return ancestors, nil
+		}
+	}
+}
+
+func (s *teamService) ListAncestors(ctx context.Context, teamID uint) ([]entities.Team, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.ListAncestors")
+	defer span.End()
+
+	ids, err := s.teamRepo.AncestorIDs(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return teamsInOrder(ctx, s.teamRepo, ids)
+}
+
+func (s *teamService) ListDescendants(ctx context.Context, teamID uint) ([]entities.Team, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.ListDescendants")
+	defer span.End()
+
+	ids, err := s.teamRepo.DescendantIDs(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return teamsInOrder(ctx, s.teamRepo, ids)
+}
+
+func (s *teamService) TeamHistory(ctx context.Context, teamID uint, at *time.Time) ([]entities.RosterInterval, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.TeamHistory")
+	defer span.End()
+
+	if _, err := s.getTeam(ctx, teamID); err != nil {
+		return nil, err
+	}
+	return s.teamRepo.ListRosterIntervals(ctx, repository.RosterIntervalFilter{TeamID: teamID, At: at})
+}
+
+func (s *teamService) UserTeamHistory(ctx context.Context, userID string, at *time.Time) ([]entities.RosterInterval, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.UserTeamHistory")
+	defer span.End()
+
+	return s.teamRepo.ListRosterIntervals(ctx, repository.RosterIntervalFilter{UserID: userID, At: at})
+}
+
+// ImportRoster makes the team's roster match entries: users missing from the file are removed,
+// new ones added and changed roles switched, all in one transaction. A dry run only reports
+// the diff. Root teams must keep at least one manager; sub-teams are managed from above.
+// Custom roles must already be defined on the team, and the caller must hold every permission
+// of each role granted or taken away.
+func (s *teamService) ImportRoster(ctx context.Context, teamID uint, entries []RosterEntry, actorID string, actorPermissions []string, dryRun bool) (*RosterDiff, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.ImportRoster")
+	defer span.End()
+
+	if dryRun {
+		team, err := s.getTeam(ctx, teamID)
+		if err != nil {
+			return nil, err
+		}
+		current, err := s.teamRepo.GetTeamMembers(ctx, teamID)
+		if err != nil {
+			return nil, err
+		}
+		return s.planRoster(ctx, team, current, entries, actorPermissions, true)
+	}
+
+	var diff *RosterDiff
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := s.teamRepo.WithTx(tx)
+
+		// The diff is computed from the locked roster, so roster changes made meanwhile wait
+		// for the import instead of being overwritten by a stale diff
+		if err := repo.LockTeams(ctx, []uint{teamID}); err != nil {
+			return err
+		}
+		team, err := repo.GetByID(ctx, teamID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTeamNotFound
+		}
+		if err != nil {
+			return err
+		}
+		current, err := repo.LockRoster(ctx, teamID)
+		if err != nil {
+			return err
+		}
+		if diff, err = s.planRoster(ctx, team, current, entries, actorPermissions, false); err != nil {
+			return err
+		}
+		return applyRosterDiff(ctx, repo, teamID, diff, actorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range diff.Removals {
+		metrics.RosterChanges.WithLabelValues("remove", roleLabel(e.Role)).Inc()
+	}
+	for _, c := range diff.RoleChanges {
+		metrics.RosterChanges.WithLabelValues("remove", roleLabel(c.From)).Inc()
+		metrics.RosterChanges.WithLabelValues("add", roleLabel(c.To)).Inc()
+	}
+	for _, e := range diff.Additions {
+		metrics.RosterChanges.WithLabelValues("add", roleLabel(e.Role)).Inc()
+	}
+	return diff, nil
+}
+
+// planRoster validates entries against the team and diffs them with its current roster. Names
+// in the diff come from the user directory. Every role the diff grants or takes away must be
+// covered by actorPermissions.
+func (s *teamService) planRoster(ctx context.Context, team *entities.Team, current []entities.Roster, entries []RosterEntry, actorPermissions []string, dryRun bool) (*RosterDiff, error) {
+	diff := &RosterDiff{
+		DryRun:      dryRun,
+		Additions:   []RosterEntry{},
+		Removals:    []RosterEntry{},
+		RoleChanges: []RosterRoleChange{},
+	}
+	existing := make(map[string]entities.Roster, len(current))
+	for _, r := range current {
+		existing[r.UserId] = r
+	}
+	roles, err := s.roleRepo.ListByTeam(ctx, team.TeamId)
+	if err != nil {
+		return nil, err
+	}
+	defined := make(map[string][]string, len(roles))
+	for _, role := range roles {
+		defined[role.Name] = role.Permissions
+	}
+	// A custom role that no longer exists grants nothing
+	held := func(role string) bool {
+		perms, ok := entities.BuiltinRolePermissions(role)
+		if !ok {
+			perms = defined[role]
+		}
+		return isSubset(perms, actorPermissions)
+	}
+
+	ids := make([]string, 0, len(entries)+len(current))
+	for _, e := range entries {
+		ids = append(ids, e.UserID)
+	}
+	for _, r := range current {
+		ids = append(ids, r.UserId)
+	}
+	names, err := s.userNames(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &ValidationError{}
+	wanted := make(map[string]bool, len(entries))
+	managers := 0
+	escalates := false
+	for _, e := range entries {
+		wanted[e.UserID] = true
+		if e.Role == entities.RosterRoleManager {
+			managers++
+		}
+		if _, builtin := entities.BuiltinRolePermissions(e.Role); !builtin {
+			if _, ok := defined[e.Role]; !ok {
+				v.add("role", "%s: role %q is not defined on this team", e.UserID, e.Role)
+			}
+		}
+		r, ok := existing[e.UserID]
+		switch {
+		case !ok:
+			diff.Additions = append(diff.Additions, RosterEntry{UserID: e.UserID, Name: names[e.UserID], Role: e.Role})
+			escalates = escalates || !held(e.Role)
+		case r.Role != e.Role:
+			diff.RoleChanges = append(diff.RoleChanges, RosterRoleChange{UserID: e.UserID, Name: names[e.UserID], From: r.Role, To: e.Role})
+			escalates = escalates || !held(r.Role) || !held(e.Role)
+		default:
+			diff.Unchanged++
+		}
+	}
+	for _, r := range current {
+		if !wanted[r.UserId] {
+			diff.Removals = append(diff.Removals, RosterEntry{UserID: r.UserId, Name: names[r.UserId], Role: r.Role})
+			escalates = escalates || !held(r.Role)
+		}
+	}
+
+	if team.ParentTeamID == nil && managers == 0 {
+		v.add("role", "the roster must list at least one MANAGER")
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	if escalates {
+		return nil, ErrPermissionEscalation
+	}
+	return diff, nil
+}
+
+// applyRosterDiff makes the changes of a diff computed from the locked roster. Every change must
+// hit exactly the row the diff saw; anything else means the roster changed underneath.
+func applyRosterDiff(ctx context.Context, repo repository.TeamRepository, teamID uint, diff *RosterDiff, actorID string) error {
+	for _, e := range diff.Removals {
+		err := repo.DeleteRoster(ctx, teamID, e.UserID, e.Role == entities.RosterRoleManager, actorID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %s is no longer on the team", ErrRosterChanged, e.UserID)
+		} else if err != nil {
+			return err
+		}
+	}
+	for _, c := range diff.RoleChanges {
+		err := repo.SetRosterRole(ctx, teamID, c.UserID, c.To, actorID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %s is no longer on the team", ErrRosterChanged, c.UserID)
+		} else if err != nil {
+			return err
+		}
+	}
+	for _, e := range diff.Additions {
+		roster := &entities.Roster{TeamId: teamID, UserId: e.UserID, Role: e.Role}
+		if err := repo.CreateRoster(ctx, roster, actorID); errors.Is(err, gorm.ErrDuplicatedKey) {
+			return fmt.Errorf("%w: %s was added to the team", ErrRosterChanged, e.UserID)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportRoster lists the team's roster with names from the user directory, managers first
+func (s *teamService) ExportRoster(ctx context.Context, teamID uint) ([]RosterEntry, error) {
+	ctx, span := tracing.Start(ctx, "TeamService.ExportRoster")
+	defer span.End()
+
+	if _, err := s.getTeam(ctx, teamID); err != nil {
+		return nil, err
+	}
+	rosters, err := s.teamRepo.GetTeamMembers(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(rosters))
+	for i, r := range rosters {
+		ids[i] = r.UserId
+	}
+	names, err := s.userNames(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]RosterEntry, 0, len(rosters))
+	for _, leaders := range []bool{true, false} {
+		for _, r := range rosters {
+			if r.IsLeader == leaders {
+				entries = append(entries, RosterEntry{UserID: r.UserId, Name: names[r.UserId], Role: r.Role})
+			}
+		}
+	}
+	return entries, nil
+}
+
+// userNames maps user IDs to their names in the user directory; users missing from it are left out
+func (s *teamService) userNames(ctx context.Context, ids []string) (map[string]string, error) {
+	users, err := s.userRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(users))
+	for _, u := range users {
+		names[u.ID] = u.Name
+	}
+	return names, nil
+}
+
+// teamsInOrder loads teams keeping the order of ids
+func teamsInOrder(ctx context.Context, repo repository.TeamRepository, ids []uint) ([]entities.Team, error) {
+	teams, err := repo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]entities.Team, len(teams))
+	for _, t := range teams {
+		byID[t.TeamId] = t
+	}
+	ordered := make([]entities.Team, 0, len(ids))
+	for _, id := range ids {
+		if t, ok := byID[id]; ok {
+			ordered = append(ordered, t)
+		}
+	}
+	return ordered, nil
+}
+
+// subtreeHeight counts the levels from teamID down to its deepest descendant, teamID included
+func subtreeHeight(ctx context.Context, repo repository.TeamRepository, teamID uint, descendants []uint) (int, error) {
+	teams, err := teamsInOrder(ctx, repo, descendants)
+	if err != nil {
+		return 0, err
+	}
+	// descendants come shallowest first, so every parent is seen before its children
+	depth := map[uint]int{teamID: 1}
+	height := 1
+	for _, t := range teams {
+		if t.ParentTeamID == nil {
+			continue
+		}
+		depth[t.TeamId] = depth[*t.ParentTeamID] + 1
+		if depth[t.TeamId] > height {
+			height = depth[t.TeamId]
+		}
+	}
+	return height, nil
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *teamService) getTeam(ctx context.Context, teamID uint) (*entities.Team, error) {
+	team, err := s.teamRepo.GetByID(ctx, teamID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTeamNotFound
+	}
+	return team, err
+}
+
+func (s *teamService) addToRoster(ctx context.Context, repo repository.TeamRepository, teamID uint, userID, actorID string) error {
+	err := repo.CreateRoster(ctx, &entities.Roster{TeamId: teamID, UserId: userID, IsLeader: false}, actorID)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrAlreadyOnTeam
+	}
+	return err
 }
 
 // Helper function to parse string to uint
@@ -0,0 +1,143 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+func newTestTeamService(t *testing.T) (TeamService, repository.TeamRepository, *gorm.DB) {
+	t.Helper()
+	database := newTestDB(t)
+	teamRepo := repository.NewTeamRepository(database)
+	service := NewTeamService(teamRepo, repository.NewJoinRequestRepository(database), repository.NewUserRepository(database),
+		repository.NewTeamRoleRepository(database), database)
+	return service, teamRepo, database
+}
+
+// addTeam creates a team below parent, or a root team for a nil parent
+func addTeam(t *testing.T, database *gorm.DB, name string, parent *uint) uint {
+	t.Helper()
+	team := &entities.Team{TeamName: name, ParentTeamID: parent}
+	if err := database.Create(team).Error; err != nil {
+		t.Fatal(err)
+	}
+	return team.TeamId
+}
+
+// addChain creates a chain of n teams, each below the previous one, and returns their IDs
+// from the top down
+func addChain(t *testing.T, database *gorm.DB, prefix string, parent *uint, n int) []uint {
+	t.Helper()
+	ids := make([]uint, 0, n)
+	for i := 0; i < n; i++ {
+		id := addTeam(t, database, fmt.Sprintf("%s-%d", prefix, i+1), parent)
+		ids = append(ids, id)
+		parent = &ids[len(ids)-1]
+	}
+	return ids
+}
+
+func TestMoveTeamRejectsCycles(t *testing.T) {
+	ctx := context.Background()
+	service, teamRepo, database := newTestTeamService(t)
+	// root > a > b > c
+	chain := addChain(t, database, "org", nil, 4)
+	root, a, b, c := chain[0], chain[1], chain[2], chain[3]
+
+	tests := []struct {
+		name    string
+		team    uint
+		parent  uint
+		wantErr error
+	}{
+		{"under itself", a, a, ErrTeamCycle},
+		{"under its child", a, b, ErrTeamCycle},
+		{"under its grandchild", a, c, ErrTeamCycle},
+		{"root under a descendant", root, c, ErrTeamCycle},
+		{"under an unknown team", b, 9999, ErrTeamNotFound},
+		{"under its grandparent", c, a, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := tt.parent
+			_, err := service.MoveTeam(ctx, tt.team, &parent, "admin", "ADMIN")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MoveTeam(%d under %d) = %v, want %v", tt.team, tt.parent, err, tt.wantErr)
+			}
+		})
+	}
+
+	ancestors, err := teamRepo.AncestorIDs(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint{a, root}; fmt.Sprint(ancestors) != fmt.Sprint(want) {
+		t.Errorf("ancestors of the moved team = %v, want %v", ancestors, want)
+	}
+
+	// Moving to the top level never forms a cycle
+	if _, err := service.MoveTeam(ctx, a, nil, "admin", "ADMIN"); err != nil {
+		t.Fatalf("MoveTeam to the top level: %v", err)
+	}
+	if ancestors, _ := teamRepo.AncestorIDs(ctx, c); fmt.Sprint(ancestors) != fmt.Sprint([]uint{a}) {
+		t.Errorf("ancestors after moving a to the top level = %v, want [%d]", ancestors, a)
+	}
+}
+
+func TestMoveTeamLimitsDepth(t *testing.T) {
+	ctx := context.Background()
+	service, _, database := newTestTeamService(t)
+	deep := addChain(t, database, "deep", nil, repository.MaxTeamDepth)
+	// A team with one sub-team: moving it adds two levels below its new parent
+	subtree := addChain(t, database, "moved", nil, 2)
+
+	tests := []struct {
+		name    string
+		parent  uint
+		wantErr error
+	}{
+		{"deepest level", deep[len(deep)-1], ErrTeamTooDeep},
+		{"sub-team would pass the limit", deep[len(deep)-2], ErrTeamTooDeep},
+		{"sub-team lands on the last level", deep[len(deep)-3], nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := tt.parent
+			_, err := service.MoveTeam(ctx, subtree[0], &parent, "admin", "ADMIN")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MoveTeam = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMoveTeamNeedsManageOnBothParents(t *testing.T) {
+	ctx := context.Background()
+	service, teamRepo, database := newTestTeamService(t)
+	from, to := addTeam(t, database, "from", nil), addTeam(t, database, "to", nil)
+	child := addTeam(t, database, "child", &from)
+	manage := func(userID string, teamID uint) {
+		t.Helper()
+		roster := &entities.Roster{TeamId: teamID, UserId: userID, IsLeader: true, Role: entities.RosterRoleManager}
+		if err := teamRepo.CreateRoster(ctx, roster, "admin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manage("both", from)
+	manage("both", to)
+	manage("source-only", from)
+
+	if _, err := service.MoveTeam(ctx, child, &to, "source-only", "MANAGER"); !errors.Is(err, ErrTeamMoveForbidden) {
+		t.Errorf("move by a manager of the old parent only = %v, want ErrTeamMoveForbidden", err)
+	}
+	if _, err := service.MoveTeam(ctx, child, &to, "both", "MANAGER"); err != nil {
+		t.Errorf("move by a manager of both parents: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"team-service/internal/entities"
+	"team-service/internal/repository"
+	"team-service/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTokenLifetime = 90 * 24 * time.Hour
+	maxTokenLifetime     = 365 * 24 * time.Hour
+
+	// lastUsedResolution limits last-used bookkeeping to one write per token per minute
+	lastUsedResolution = time.Minute
+)
+
+var (
+	ErrInvalidAPIToken = errors.New("invalid, expired or revoked API token")
+	ErrTokenNotFound   = errors.New("token not found")
+	ErrInvalidToken    = errors.New("invalid token request")
+)
+
+type TokenService interface {
+	CreatePersonalToken(ctx context.Context, userID, role, name string, scopes []string, expiresInDays int) (*entities.APIToken, string, error)
+	ListPersonalTokens(ctx context.Context, userID string) ([]entities.APIToken, error)
+	RevokePersonalToken(ctx context.Context, id uint, userID string) error
+	CreateServiceKey(ctx context.Context, adminID, name, principalID, role string, scopes []string, expiresInDays int) (*entities.APIToken, string, error)
+	ListServiceKeys(ctx context.Context) ([]entities.APIToken, error)
+	RevokeServiceKey(ctx context.Context, id uint) error
+	AuthenticateAPIKey(ctx context.Context, raw string) (*entities.APIToken, error)
+}
+
+type tokenService struct {
+	tokenRepo repository.APITokenRepository
+}
+
+func NewTokenService(tokenRepo repository.APITokenRepository) TokenService {
+	return &tokenService{
+		tokenRepo: tokenRepo,
+	}
+}
+
+func (s *tokenService) CreatePersonalToken(ctx context.Context, userID, role, name string, scopes []string, expiresInDays int) (*entities.APIToken, string, error) {
+	ctx, span := tracing.Start(ctx, "TokenService.CreatePersonalToken")
+	defer span.End()
+
+	return s.create(ctx, entities.TokenKindPersonal, entities.PersonalTokenPrefix, userID, userID, role, name, scopes, expiresInDays)
+}
+
+func (s *tokenService) ListPersonalTokens(ctx context.Context, userID string) ([]entities.APIToken, error) {
+	ctx, span := tracing.Start(ctx, "TokenService.ListPersonalTokens")
+	defer span.End()
+
+	return s.tokenRepo.ListByUser(ctx, userID, entities.TokenKindPersonal)
+}
+
+func (s *tokenService) RevokePersonalToken(ctx context.Context, id uint, userID string) error {
+	ctx, span := tracing.Start(ctx, "TokenService.RevokePersonalToken")
+	defer span.End()
+
+	token, err := s.tokenRepo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTokenNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// Someone else's token is reported as missing so IDs cannot be probed
+	if token.Kind != entities.TokenKindPersonal || token.UserID != userID {
+		return ErrTokenNotFound
+	}
+
+	return s.tokenRepo.Revoke(ctx, token.ID, time.Now())
+}
+
+func (s *tokenService) CreateServiceKey(ctx context.Context, adminID, name, principalID, role string, scopes []string, expiresInDays int) (*entities.APIToken, string, error) {
+	ctx, span := tracing.Start(ctx, "TokenService.CreateServiceKey")
+	defer span.End()
+
+	if principalID == "" {
+		principalID = "svc-" + strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", "-"))
+	}
+	if role == "" {
+		role = "MEMBER"
+	}
+	if role != "MEMBER" && role != "MANAGER" {
+		return nil, "", fmt.Errorf("%w: service keys can act as MEMBER or MANAGER, not %q", ErrInvalidToken, role)
+	}
+
+	return s.create(ctx, entities.TokenKindService, entities.ServiceKeyPrefix, principalID, adminID, role, name, scopes, expiresInDays)
+}
+
+func (s *tokenService) ListServiceKeys(ctx context.Context) ([]entities.APIToken, error) {
+	ctx, span := tracing.Start(ctx, "TokenService.ListServiceKeys")
+	defer span.End()
+
+	return s.tokenRepo.ListByKind(ctx, entities.TokenKindService)
+}
+
+func (s *tokenService) RevokeServiceKey(ctx context.Context, id uint) error {
+	ctx, span := tracing.Start(ctx, "TokenService.RevokeServiceKey")
+	defer span.End()
+
+	token, err := s.tokenRepo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && token.Kind != entities.TokenKindService) {
+		return ErrTokenNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.tokenRepo.Revoke(ctx, token.ID, time.Now())
+}
+
+func (s *tokenService) AuthenticateAPIKey(ctx context.Context, raw string) (*entities.APIToken, error) {
+	ctx, span := tracing.Start(ctx, "TokenService.AuthenticateAPIKey")
+	defer span.End()
+
+	token, err := s.tokenRepo.GetByHash(ctx, hashToken(raw))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !token.IsActive(now) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedResolution {
+		if err := s.tokenRepo.TouchLastUsed(ctx, token.ID, now); err != nil {
+			return nil, err
+		}
+		token.LastUsedAt = &now
+	}
+
+	return token, nil
+}
+
+func (s *tokenService) create(ctx context.Context, kind, prefix, userID, createdBy, role, name string, scopes []string, expiresInDays int) (*entities.APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("%w: name is required", ErrInvalidToken)
+	}
+
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	lifetime := defaultTokenLifetime
+	if expiresInDays > 0 {
+		lifetime = time.Duration(expiresInDays) * 24 * time.Hour
+	}
+	if lifetime > maxTokenLifetime {
+		return nil, "", fmt.Errorf("%w: tokens may not live longer than %d days", ErrInvalidToken, int(maxTokenLifetime.Hours()/24))
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	raw := prefix + hex.EncodeToString(secret)
+
+	token := &entities.APIToken{
+		Name:      name,
+		Kind:      kind,
+		UserID:    userID,
+		Role:      role,
+		Prefix:    raw[:len(prefix)+8],
+		TokenHash: hashToken(raw),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return nil, "", err
+	}
+
+	return token, raw, nil
+}
+
+// normalizeScopes validates and de-duplicates requested scopes
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidToken)
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	var out []string
+	for _, scope := range scopes {
+		valid := false
+		for _, v := range entities.ValidScopes {
+			if scope == v {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: unknown scope %q (valid: %s)", ErrInvalidToken, scope, strings.Join(entities.ValidScopes, ", "))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			out = append(out, scope)
+		}
+	}
+	return out, nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
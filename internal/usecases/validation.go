@@ -0,0 +1,47 @@
+package usecases
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes a problem with one field or list entry of a request.
+// Line is set for problems in uploaded files and counts from 1, header included.
+type FieldError struct {
+	Line    int    `json:"line,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every problem found before anything was written
+type ValidationError struct {
+	Problems []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		if p.Line > 0 {
+			msgs[i] = fmt.Sprintf("line %d: %s: %s", p.Line, p.Field, p.Message)
+		} else {
+			msgs[i] = fmt.Sprintf("%s: %s", p.Field, p.Message)
+		}
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Problems = append(e.Problems, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *ValidationError) addLine(line int, field, format string, args ...interface{}) {
+	e.Problems = append(e.Problems, FieldError{Line: line, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns nil when no problems were recorded
+func (e *ValidationError) err() error {
+	if len(e.Problems) == 0 {
+		return nil
+	}
+	return e
+}
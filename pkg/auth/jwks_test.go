@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// signingKey is a generated key pair published under kid
+type signingKey struct {
+	kid     string
+	private interface{}
+	jwk     jwk
+}
+
+func newRSAKey(t *testing.T, kid string) signingKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingKey{kid: kid, private: key, jwk: jwk{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}
+}
+
+func newECKey(t *testing.T, kid string) signingKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coordinate := func(n *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, 32)))
+	}
+	return signingKey{kid: kid, private: key, jwk: jwk{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   coordinate(key.X),
+		Y:   coordinate(key.Y),
+	}}
+}
+
+func jwksDocument(t *testing.T, keys ...signingKey) []byte {
+	t.Helper()
+	set := jwkSet{}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, k.jwk)
+	}
+	raw, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func writeJWKS(t *testing.T, path string, keys ...signingKey) {
+	t.Helper()
+	if err := os.WriteFile(path, jwksDocument(t, keys...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// allowRefresh lets the next lookup of an unknown kid reload the source, as if
+// minRefreshInterval had passed since the last attempt
+func allowRefresh(ks *KeySet) {
+	ks.mu.Lock()
+	ks.lastAttempt = time.Now().Add(-minRefreshInterval)
+	ks.mu.Unlock()
+}
+
+func TestKeySetRotation(t *testing.T) {
+	ctx := context.Background()
+	old, current := newRSAKey(t, "2026-01"), newECKey(t, "2026-02")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, old)
+
+	ks := NewFileKeySet(path, time.Hour)
+	if err := ks.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if _, err := ks.Key(ctx, old.kid); err != nil {
+		t.Fatalf("Key(%s): %v", old.kid, err)
+	}
+	if _, err := ks.Key(ctx, current.kid); !errors.Is(err, errUnknownKey) {
+		t.Fatalf("Key(%s) before rotation = %v, want errUnknownKey", current.kid, err)
+	}
+
+	// The identity provider publishes the new key next to the old one
+	writeJWKS(t, path, old, current)
+	if _, err := ks.Key(ctx, current.kid); !errors.Is(err, errUnknownKey) {
+		t.Errorf("Key(%s) reloaded within minRefreshInterval of the last attempt: %v", current.kid, err)
+	}
+	allowRefresh(ks)
+	key, err := ks.Key(ctx, current.kid)
+	if err != nil {
+		t.Fatalf("Key(%s) after rotation: %v", current.kid, err)
+	}
+	if _, ok := key.(*ecdsa.PublicKey); !ok {
+		t.Errorf("Key(%s) = %T, want *ecdsa.PublicKey", current.kid, key)
+	}
+	if _, err := ks.Key(ctx, old.kid); err != nil {
+		t.Errorf("Key(%s) during rotation: %v", old.kid, err)
+	}
+
+	// Once the old key is retired it goes away with the next reload
+	writeJWKS(t, path, current)
+	ks.mu.Lock()
+	ks.fetchedAt = time.Now().Add(-2 * time.Hour)
+	ks.mu.Unlock()
+	allowRefresh(ks)
+	if _, err := ks.Key(ctx, old.kid); !errors.Is(err, errUnknownKey) {
+		t.Errorf("Key(%s) after retirement = %v, want errUnknownKey", old.kid, err)
+	}
+}
+
+func TestKeySetRefreshIsRateLimited(t *testing.T) {
+	ctx := context.Background()
+	key := newRSAKey(t, "k1")
+	var fetches atomic.Int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(jwksDocument(t, key))
+	}))
+	defer server.Close()
+
+	ks := NewURLKeySet(server.URL, time.Hour)
+	if err := ks.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// A flood of tokens with made-up kids must not turn into a flood of fetches
+	for i := 0; i < 20; i++ {
+		if _, err := ks.Key(ctx, "unknown"); !errors.Is(err, errUnknownKey) {
+			t.Fatalf("Key(unknown) = %v, want errUnknownKey", err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("%d fetches for unknown kids within minRefreshInterval, want just the first load", n)
+	}
+
+	allowRefresh(ks)
+	ks.Key(ctx, "unknown")
+	ks.Key(ctx, "unknown")
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("%d fetches after minRefreshInterval passed, want one more", n)
+	}
+
+	// An outage after the cache expires keeps serving the keys already known,
+	failing.Store(true)
+	ks.mu.Lock()
+	ks.fetchedAt = time.Now().Add(-2 * time.Hour)
+	ks.mu.Unlock()
+	allowRefresh(ks)
+	if _, err := ks.Key(ctx, key.kid); err != nil {
+		t.Errorf("Key(%s) during an outage: %v", key.kid, err)
+	}
+	// while lookups of keys it never had report the failed load
+	allowRefresh(ks)
+	if _, err := ks.Key(ctx, "unknown"); err == nil || !strings.Contains(err.Error(), "load JWKS") {
+		t.Errorf("Key(unknown) during an outage = %v, want the load error", err)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, ecKey := newRSAKey(t, "rsa"), newECKey(t, "ec")
+	encryption := newRSAKey(t, "enc")
+	encryption.jwk.Use = "enc"
+	offCurve := ecKey
+	offCurve.jwk.Y = offCurve.jwk.X
+	unknownCurve := ecKey
+	unknownCurve.jwk.Crv = "P-192"
+	symmetric := signingKey{jwk: jwk{Kty: "oct", Kid: "hs"}}
+
+	tests := []struct {
+		name    string
+		keys    []signingKey
+		kids    []string
+		wantErr string
+	}{
+		{"rsa and ec", []signingKey{rsaKey, ecKey}, []string{"rsa", "ec"}, ""},
+		{"encryption keys are skipped", []signingKey{rsaKey, encryption}, []string{"rsa"}, ""},
+		{"only encryption keys", []signingKey{encryption}, nil, "no signature keys"},
+		{"point not on curve", []signingKey{offCurve}, nil, "not on curve"},
+		{"unsupported curve", []signingKey{unknownCurve}, nil, "unsupported curve"},
+		{"symmetric key", []signingKey{symmetric}, nil, "unsupported key type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := parseJWKS(jwksDocument(t, tt.keys...))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseJWKS = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseJWKS: %v", err)
+			}
+			if len(keys) != len(tt.kids) {
+				t.Errorf("parseJWKS returned %d keys, want %d", len(keys), len(tt.kids))
+			}
+			for _, kid := range tt.kids {
+				if _, ok := keys[kid]; !ok {
+					t.Errorf("parseJWKS is missing %q", kid)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"team-service/pkg/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the access token claims the service relies on
+type Claims struct {
+	UserID string `json:"userId"`
+	Role   string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// Verifier validates access tokens signed with an HMAC secret or with keys from a JWKS
+type Verifier struct {
+	parser *jwt.Parser
+	secret []byte
+	keys   *KeySet
+}
+
+// NewVerifier builds a verifier for the configured mode. In jwks mode the key set is
+// loaded once up front so a misconfigured source fails at startup.
+func NewVerifier(ctx context.Context, cfg config.AuthConfig) (*Verifier, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(cfg.Algorithms),
+		jwt.WithLeeway(cfg.ClockSkew),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	v := &Verifier{parser: jwt.NewParser(opts...)}
+
+	switch cfg.Mode {
+	case "hmac":
+		v.secret = []byte(cfg.AccessTokenSecret)
+	case "jwks":
+		if cfg.JWKSURL != "" {
+			v.keys = NewURLKeySet(cfg.JWKSURL, cfg.JWKSCacheTTL)
+		} else {
+			v.keys = NewFileKeySet(cfg.JWKSFile, cfg.JWKSCacheTTL)
+		}
+		if err := v.keys.Refresh(ctx); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported auth mode %q", cfg.Mode)
+	}
+
+	return v, nil
+}
+
+// Verify checks the signature and the exp, nbf, iss and aud claims
+func (v *Verifier) Verify(ctx context.Context, tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if v.keys == nil {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return v.secret, nil
+		}
+
+		if strings.HasPrefix(token.Method.Alg(), "HS") {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token header has no kid")
+		}
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
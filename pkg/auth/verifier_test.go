@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"team-service/pkg/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerifierJWKS(t *testing.T) {
+	rsaKey, ecKey := newRSAKey(t, "rsa-1"), newECKey(t, "ec-1")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaKey, ecKey)
+
+	cfg := config.AuthConfig{
+		Mode:         "jwks",
+		JWKSFile:     path,
+		JWKSCacheTTL: time.Hour,
+		Algorithms:   []string{"RS256", "ES256"},
+		Issuer:       "https://idp.example.com",
+		Audience:     "team-service",
+		ClockSkew:    30 * time.Second,
+	}
+	verifier, err := NewVerifier(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	// Without an allow-list only the HS check stands between a forged token and the verifier
+	permissive := cfg
+	permissive.Algorithms = nil
+	permissiveVerifier, err := NewVerifier(context.Background(), permissive)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+
+	publicPEM, err := x509.MarshalPKIXPublicKey(&rsaKey.private.(*rsa.PrivateKey).PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicPEM})
+
+	now := time.Now()
+	valid := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    cfg.Issuer,
+			Audience:  jwt.ClaimStrings{cfg.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		}
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.RegisteredClaims) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, Claims{UserID: "u1", Role: "MEMBER", RegisteredClaims: claims})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign %s: %v", method.Alg(), err)
+		}
+		return signed
+	}
+	with := func(change func(*jwt.RegisteredClaims)) jwt.RegisteredClaims {
+		claims := valid()
+		change(&claims)
+		return claims
+	}
+	rsaPrivate, ecPrivate := rsaKey.private.(*rsa.PrivateKey), ecKey.private.(*ecdsa.PrivateKey)
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		token    string
+		ok       bool
+	}{
+		{"RS256", verifier, sign(jwt.SigningMethodRS256, rsaKey.kid, rsaPrivate, valid()), true},
+		{"ES256", verifier, sign(jwt.SigningMethodES256, ecKey.kid, ecPrivate, valid()), true},
+		{"kid of another key", verifier, sign(jwt.SigningMethodRS256, ecKey.kid, rsaPrivate, valid()), false},
+		{"unknown kid", verifier, sign(jwt.SigningMethodRS256, "rsa-0", rsaPrivate, valid()), false},
+		{"no kid", verifier, sign(jwt.SigningMethodRS256, "", rsaPrivate, valid()), false},
+		{"HS256 keyed with the public key", verifier, sign(jwt.SigningMethodHS256, rsaKey.kid, publicPEM, valid()), false},
+		{"HS256 without an algorithm allow-list", permissiveVerifier, sign(jwt.SigningMethodHS256, rsaKey.kid, publicPEM, valid()), false},
+		{"alg none", permissiveVerifier, sign(jwt.SigningMethodNone, rsaKey.kid, jwt.UnsafeAllowNoneSignatureType, valid()), false},
+		{"RS384 outside the allow-list", verifier, sign(jwt.SigningMethodRS384, rsaKey.kid, rsaPrivate, valid()), false},
+		{"wrong issuer", verifier, sign(jwt.SigningMethodRS256, rsaKey.kid, rsaPrivate, with(func(c *jwt.RegisteredClaims) {
+			c.Issuer = "https://evil.example.com"
+		})), false},
+		{"no issuer", verifier, sign(jwt.SigningMethodRS256, rsaKey.kid, rsaPrivate, with(func(c *jwt.RegisteredClaims) {
+			c.Issuer = ""
+		})), false},
+		{"wrong audience", verifier, sign(jwt.SigningMethodRS256, rsaKey.kid, rsaPrivate, with(func(c *jwt.RegisteredClaims) {
+			c.Audience = jwt.ClaimStrings{"other-service"}
+		})), false},
+		{"one of several audiences", verifier, sign(jwt.SigningMethodRS256, rsaKey.kid, rsaPrivate, with(func(c *jwt.RegisteredClaims) {
+			c.Audience = jwt.ClaimStrings{"other-service", cfg.Audience}
+		})), true},
+		{"not valid yet", verifier, sign(jwt.SigningMethodRS256, rsaKey.kid, rsaPrivate, with(func(c *jwt.RegisteredClaims) {
+			c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute))
+		})), false},
+		{"not valid yet within clock skew", verifier, sign(jwt.SigningMethodRS256, rsaKey.kid, rsaPrivate, with(func(c *jwt.RegisteredClaims) {
+			c.NotBefore = jwt.NewNumericDate(now.Add(10 * time.Second))
+		})), true},
+		{"expired", verifier, sign(jwt.SigningMethodRS256, rsaKey.kid, rsaPrivate, with(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+		})), false},
+		{"no expiry", verifier, sign(jwt.SigningMethodRS256, rsaKey.kid, rsaPrivate, with(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = nil
+		})), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.verifier.Verify(context.Background(), tt.token)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if claims.UserID != "u1" {
+					t.Errorf("userId = %q, want u1", claims.UserID)
+				}
+				return
+			}
+			if err == nil {
+				t.Error("Verify accepted the token")
+			}
+		})
+	}
+}
+
+func TestVerifierHMAC(t *testing.T) {
+	cfg := config.AuthConfig{Mode: "hmac", AccessTokenSecret: "secret", Algorithms: []string{"HS256"}}
+	verifier, err := NewVerifier(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	rsaPrivate := newRSAKey(t, "rsa").private.(*rsa.PrivateKey)
+	claims := Claims{UserID: "u1", RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+		ok     bool
+	}{
+		{"shared secret", jwt.SigningMethodHS256, []byte("secret"), true},
+		{"other secret", jwt.SigningMethodHS256, []byte("guess"), false},
+		{"RS256", jwt.SigningMethodRS256, rsaPrivate, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.NewWithClaims(tt.method, claims).SignedString(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := verifier.Verify(context.Background(), token); (err == nil) != tt.ok {
+				t.Errorf("Verify = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
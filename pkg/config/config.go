@@ -0,0 +1,627 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is where the service looks for its configuration file
+const DefaultPath = "configs/config.yaml"
+
+const redacted = "[REDACTED]"
+
+// Config is the typed view of configs/config.yaml
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Logging     LoggingConfig     `yaml:"logging"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	SCIM        SCIMConfig        `yaml:"scim"`
+	Quotas      QuotaConfig       `yaml:"quotas"`
+	// DirectorySync is only read by cmd/sync-directory
+	DirectorySync DirectorySyncConfig `yaml:"directory_sync"`
+}
+
+// ServerConfig holds HTTP listener settings
+type ServerConfig struct {
+	Port              string        `yaml:"port"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	// TrustedProxies lists the proxy IPs or CIDRs whose X-Forwarded-For is believed when
+	// resolving the client IP; with none the peer address is the client
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// DatabaseConfig holds the DSN and connection pool settings
+type DatabaseConfig struct {
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+}
+
+// AuthConfig holds token verification settings.
+// Mode "jwks" verifies asymmetric tokens against a JWKS file or URL; "hmac" uses the shared secret.
+type AuthConfig struct {
+	Mode              string        `yaml:"mode"`
+	AccessTokenSecret string        `yaml:"access_token_secret"`
+	JWKSFile          string        `yaml:"jwks_file"`
+	JWKSURL           string        `yaml:"jwks_url"`
+	JWKSCacheTTL      time.Duration `yaml:"jwks_cache_ttl"`
+	Algorithms        []string      `yaml:"algorithms"`
+	Issuer            string        `yaml:"issuer"`
+	Audience          string        `yaml:"audience"`
+	ClockSkew         time.Duration `yaml:"clock_skew"`
+	SessionCacheTTL   time.Duration `yaml:"session_cache_ttl"`
+}
+
+// LoggingConfig holds logger settings
+type LoggingConfig struct {
+	Level        string         `yaml:"level"`
+	Format       string         `yaml:"format"`
+	Outputs      []string       `yaml:"outputs"`
+	File         FileSinkConfig `yaml:"file"`
+	RedactFields []string       `yaml:"redact_fields"`
+}
+
+// FileSinkConfig holds settings for the rotating log file sink
+type FileSinkConfig struct {
+	Path       string `yaml:"path"`
+	MaxSizeMB  int    `yaml:"max_size_mb"`
+	MaxBackups int    `yaml:"max_backups"`
+	MaxAgeDays int    `yaml:"max_age_days"`
+	Compress   bool   `yaml:"compress"`
+}
+
+// MetricsConfig controls the Prometheus endpoint. It is served either on its own
+// listener (ListenAddr) or on the API listener behind a bearer token.
+type MetricsConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	ListenAddr string `yaml:"listen_addr"`
+	Path       string `yaml:"path"`
+	Token      string `yaml:"token"`
+}
+
+// TracingConfig controls OpenTelemetry span export
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	Exporter    string  `yaml:"exporter"` // otlp or stdout
+	Endpoint    string  `yaml:"endpoint"` // OTLP/HTTP collector host:port
+	Insecure    bool    `yaml:"insecure"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// RateLimitConfig holds token bucket limits per route group. Groups without an
+// entry use the "default" group.
+type RateLimitConfig struct {
+	Enabled bool                       `yaml:"enabled"`
+	Store   string                     `yaml:"store"` // memory
+	Groups  map[string]RateLimitPolicy `yaml:"groups"`
+}
+
+// RateLimitPolicy refills RequestsPerMinute tokens per minute into a bucket holding at most Burst
+type RateLimitPolicy struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst"`
+}
+
+// IdempotencyConfig controls how long responses to Idempotency-Key requests are kept for replay
+type IdempotencyConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// SCIMConfig controls the /scim/v2 provisioning endpoint, which is only served when a token is set
+type SCIMConfig struct {
+	Token string `yaml:"token"`
+}
+
+// QuotaConfig limits what users, by global role, and teams may store. Roles without an entry,
+// and limits left at 0, are unlimited. Teams without an entry in Teams use TeamDefault.
+type QuotaConfig struct {
+	Roles       map[string]QuotaLimitsConfig `yaml:"roles"`
+	TeamDefault QuotaLimitsConfig            `yaml:"team_default"`
+	Teams       map[uint]QuotaLimitsConfig   `yaml:"teams"`
+}
+
+// QuotaLimitsConfig caps the notes, note body bytes and folders of one user or team
+type QuotaLimitsConfig struct {
+	MaxNotes   int64 `yaml:"max_notes"`
+	MaxBytes   int64 `yaml:"max_bytes"`
+	MaxFolders int64 `yaml:"max_folders"`
+}
+
+// DirectorySyncConfig maps LDIF export attributes onto directory users, teams and rosters
+type DirectorySyncConfig struct {
+	UserObjectClasses  []string            `yaml:"user_object_classes"`
+	GroupObjectClasses []string            `yaml:"group_object_classes"`
+	Attributes         DirectoryAttributes `yaml:"attributes"`
+	// RoleMap maps values of the role attribute, case-insensitively, to ADMIN, MANAGER or MEMBER
+	RoleMap     map[string]string `yaml:"role_map"`
+	DefaultRole string            `yaml:"default_role"`
+	// MaxRemovals aborts a run that would deactivate or downgrade users, delete teams and
+	// remove or downgrade roster entries more than this many times in total
+	MaxRemovals int `yaml:"max_removals"`
+}
+
+// DirectoryAttributes names the LDAP attributes read for each directory field
+type DirectoryAttributes struct {
+	UserID     string `yaml:"user_id"`
+	Name       string `yaml:"name"`
+	GivenName  string `yaml:"given_name"`
+	FamilyName string `yaml:"family_name"`
+	Email      string `yaml:"email"`
+	Role       string `yaml:"role"`
+	// ExternalID identifies users and groups across renames; the DN is used when it is missing
+	ExternalID string `yaml:"external_id"`
+
+	GroupName string `yaml:"group_name"`
+	// GroupMembers hold member DNs (member, uniqueMember) or user IDs (memberUid)
+	GroupMembers  []string `yaml:"group_members"`
+	GroupManagers []string `yaml:"group_managers"`
+}
+
+// Default returns the configuration used for any value not set in the file or environment
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:              ":8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Auth: AuthConfig{
+			Mode:            "hmac",
+			JWKSCacheTTL:    10 * time.Minute,
+			ClockSkew:       30 * time.Second,
+			SessionCacheTTL: 30 * time.Second,
+		},
+		Logging: LoggingConfig{
+			Level:   "info",
+			Format:  "json",
+			Outputs: []string{"stdout"},
+			File: FileSinkConfig{
+				Path:       "logs/app.log",
+				MaxSizeMB:  100,
+				MaxBackups: 5,
+				MaxAgeDays: 30,
+			},
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+			Path:    "/metrics",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "otlp",
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			ServiceName: "team-service",
+			SampleRatio: 1,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Store:   "memory",
+			Groups: map[string]RateLimitPolicy{
+				"client":  {RequestsPerMinute: 1200, Burst: 200},
+				"default": {RequestsPerMinute: 300, Burst: 60},
+				"sharing": {RequestsPerMinute: 30, Burst: 10},
+				"assets":  {RequestsPerMinute: 20, Burst: 5},
+				"tokens":  {RequestsPerMinute: 10, Burst: 5},
+				"scim":    {RequestsPerMinute: 600, Burst: 100},
+			},
+		},
+		Idempotency: IdempotencyConfig{
+			TTL: 24 * time.Hour,
+		},
+		Quotas: QuotaConfig{
+			Roles: map[string]QuotaLimitsConfig{
+				"MEMBER":  {MaxNotes: 5000, MaxBytes: 50 << 20, MaxFolders: 500},
+				"MANAGER": {MaxNotes: 10000, MaxBytes: 100 << 20, MaxFolders: 1000},
+			},
+			TeamDefault: QuotaLimitsConfig{MaxNotes: 20000, MaxBytes: 200 << 20, MaxFolders: 1000},
+		},
+		DirectorySync: DirectorySyncConfig{
+			UserObjectClasses:  []string{"inetOrgPerson", "person", "user"},
+			GroupObjectClasses: []string{"groupOfNames", "groupOfUniqueNames", "posixGroup", "group"},
+			Attributes: DirectoryAttributes{
+				UserID:        "uid",
+				Name:          "cn",
+				GivenName:     "givenName",
+				FamilyName:    "sn",
+				Email:         "mail",
+				ExternalID:    "entryUUID",
+				GroupName:     "cn",
+				GroupMembers:  []string{"member", "uniqueMember", "memberUid"},
+				GroupManagers: []string{"owner"},
+			},
+			DefaultRole: "MEMBER",
+			MaxRemovals: 25,
+		},
+	}
+}
+
+// Load reads the YAML file at path, expands ${ENV} references, applies
+// environment overrides and defaults, and validates the result.
+// A missing file is not an error so the service can run from the environment alone.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read config %s: %w", path, err)
+	}
+	if err == nil {
+		if err := yaml.Unmarshal([]byte(expandEnv(string(raw))), &cfg); err != nil {
+			return nil, fmt.Errorf("parse config %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	cfg.applyDefaults()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// envRef matches a ${VAR} reference
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} references with the environment variable. Any other "$" is kept
+// as written, so values such as "pa$$word" survive.
+func expandEnv(raw string) string {
+	return envRef.ReplaceAllStringFunc(raw, func(ref string) string {
+		return os.Getenv(ref[2 : len(ref)-1])
+	})
+}
+
+// applyEnv lets environment variables override values from the file
+func (c *Config) applyEnv() error {
+	setString(&c.Server.Port, "PORT")
+	setString(&c.Database.DSN, "DATABASE_DSN")
+	setString(&c.Auth.AccessTokenSecret, "ACCESS_TOKEN_SECRET")
+	setString(&c.Auth.Mode, "AUTH_MODE")
+	setString(&c.Auth.JWKSFile, "AUTH_JWKS_FILE")
+	setString(&c.Auth.JWKSURL, "AUTH_JWKS_URL")
+	setString(&c.Auth.Issuer, "AUTH_ISSUER")
+	setString(&c.Auth.Audience, "AUTH_AUDIENCE")
+	setString(&c.Logging.Level, "LOG_LEVEL")
+	setString(&c.Logging.Format, "LOG_FORMAT")
+	setString(&c.Logging.File.Path, "LOG_FILE")
+	setString(&c.Metrics.ListenAddr, "METRICS_LISTEN_ADDR")
+	setString(&c.Metrics.Token, "METRICS_TOKEN")
+	setString(&c.SCIM.Token, "SCIM_TOKEN")
+	setString(&c.Tracing.Exporter, "TRACING_EXPORTER")
+	setString(&c.Tracing.Endpoint, "OTEL_EXPORTER_OTLP_ENDPOINT")
+	if v := os.Getenv("TRACING_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("TRACING_ENABLED must be a boolean: %w", err)
+		}
+		c.Tracing.Enabled = enabled
+	}
+	if v := os.Getenv("RATE_LIMIT_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("RATE_LIMIT_ENABLED must be a boolean: %w", err)
+		}
+		c.RateLimit.Enabled = enabled
+	}
+	if v := os.Getenv("LOG_OUTPUTS"); v != "" {
+		c.Logging.Outputs = strings.Split(v, ",")
+	}
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		c.Server.TrustedProxies = strings.Split(v, ",")
+	}
+
+	if err := setInt(&c.Database.MaxOpenConns, "DATABASE_MAX_OPEN_CONNS"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Database.MaxIdleConns, "DATABASE_MAX_IDLE_CONNS"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// applyDefaults fills values the file explicitly left empty
+func (c *Config) applyDefaults() {
+	def := Default()
+	if c.Server.Port == "" {
+		c.Server.Port = def.Server.Port
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		c.Server.ShutdownTimeout = def.Server.ShutdownTimeout
+	}
+	if !strings.Contains(c.Server.Port, ":") {
+		c.Server.Port = ":" + c.Server.Port
+	}
+	if c.Logging.Level == "" {
+		c.Logging.Level = def.Logging.Level
+	}
+	if c.Logging.Format == "" {
+		c.Logging.Format = def.Logging.Format
+	}
+	if len(c.Logging.Outputs) == 0 {
+		c.Logging.Outputs = def.Logging.Outputs
+	}
+	if c.Logging.File.Path == "" {
+		c.Logging.File.Path = def.Logging.File.Path
+	}
+	if c.Auth.Mode == "" {
+		c.Auth.Mode = def.Auth.Mode
+	}
+	c.Auth.Mode = strings.ToLower(c.Auth.Mode)
+	if len(c.Auth.Algorithms) == 0 {
+		if c.Auth.Mode == "hmac" {
+			c.Auth.Algorithms = []string{"HS256"}
+		} else {
+			c.Auth.Algorithms = []string{"RS256", "ES256"}
+		}
+	}
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = def.Tracing.ServiceName
+	}
+	if c.Tracing.Exporter == "" {
+		c.Tracing.Exporter = def.Tracing.Exporter
+	}
+	// OTEL_EXPORTER_OTLP_ENDPOINT is conventionally a URL; the exporter wants host:port
+	c.Tracing.Endpoint = strings.TrimPrefix(strings.TrimPrefix(c.Tracing.Endpoint, "http://"), "https://")
+	if c.Metrics.Path == "" {
+		c.Metrics.Path = def.Metrics.Path
+	}
+	if c.RateLimit.Store == "" {
+		c.RateLimit.Store = def.RateLimit.Store
+	}
+	if c.RateLimit.Groups == nil {
+		c.RateLimit.Groups = map[string]RateLimitPolicy{}
+	}
+	for _, group := range []string{"client", "default"} {
+		if _, ok := c.RateLimit.Groups[group]; !ok {
+			c.RateLimit.Groups[group] = def.RateLimit.Groups[group]
+		}
+	}
+	if c.DirectorySync.DefaultRole == "" {
+		c.DirectorySync.DefaultRole = def.DirectorySync.DefaultRole
+	}
+	c.DirectorySync.DefaultRole = strings.ToUpper(c.DirectorySync.DefaultRole)
+	for value, role := range c.DirectorySync.RoleMap {
+		c.DirectorySync.RoleMap[value] = strings.ToUpper(strings.TrimSpace(role))
+	}
+	roles := make(map[string]QuotaLimitsConfig, len(c.Quotas.Roles))
+	for role, limits := range c.Quotas.Roles {
+		roles[strings.ToUpper(strings.TrimSpace(role))] = limits
+	}
+	c.Quotas.Roles = roles
+	c.Logging.Level = strings.ToLower(c.Logging.Level)
+	c.Logging.Format = strings.ToLower(c.Logging.Format)
+	for i, out := range c.Logging.Outputs {
+		c.Logging.Outputs[i] = strings.ToLower(strings.TrimSpace(out))
+	}
+}
+
+// Validate reports every missing or invalid setting at once
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Database.DSN == "" {
+		problems = append(problems, "database.dsn is required (or set DATABASE_DSN)")
+	}
+	switch c.Auth.Mode {
+	case "hmac":
+		if c.Auth.AccessTokenSecret == "" {
+			problems = append(problems, "auth.access_token_secret is required in hmac mode (or set ACCESS_TOKEN_SECRET)")
+		}
+	case "jwks":
+		if c.Auth.JWKSFile == "" && c.Auth.JWKSURL == "" {
+			problems = append(problems, "auth.jwks_file or auth.jwks_url is required in jwks mode")
+		}
+		for _, alg := range c.Auth.Algorithms {
+			if strings.HasPrefix(strings.ToUpper(alg), "HS") {
+				problems = append(problems, fmt.Sprintf("auth.algorithms entry %q is symmetric and not allowed in jwks mode", alg))
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("auth.mode %q must be hmac or jwks", c.Auth.Mode))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				problems = append(problems, fmt.Sprintf("server.trusted_proxies entry %q must be an IP address or CIDR", proxy))
+			}
+		}
+	}
+	if c.Auth.ClockSkew < 0 {
+		problems = append(problems, "auth.clock_skew must not be negative")
+	}
+	if c.Auth.SessionCacheTTL < 0 {
+		problems = append(problems, "auth.session_cache_ttl must not be negative")
+	}
+	switch c.Logging.Level {
+	case "trace", "debug", "info", "warn", "error", "fatal", "panic", "disabled":
+	default:
+		problems = append(problems, fmt.Sprintf("logging.level %q is not a valid level", c.Logging.Level))
+	}
+	switch c.Logging.Format {
+	case "json", "console":
+	default:
+		problems = append(problems, fmt.Sprintf("logging.format %q must be json or console", c.Logging.Format))
+	}
+	for _, out := range c.Logging.Outputs {
+		if out != "stdout" && out != "file" {
+			problems = append(problems, fmt.Sprintf("logging.outputs entry %q must be stdout or file", out))
+		}
+	}
+	if c.Metrics.Enabled && c.Metrics.ListenAddr == "" && c.Metrics.Token == "" {
+		problems = append(problems, "metrics must be served on metrics.listen_addr or protected by metrics.token")
+	}
+	if c.Tracing.Enabled {
+		switch c.Tracing.Exporter {
+		case "otlp":
+			if c.Tracing.Endpoint == "" {
+				problems = append(problems, "tracing.endpoint is required for the otlp exporter")
+			}
+		case "stdout":
+		default:
+			problems = append(problems, fmt.Sprintf("tracing.exporter %q must be otlp or stdout", c.Tracing.Exporter))
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			problems = append(problems, "tracing.sample_ratio must be between 0 and 1")
+		}
+	}
+	if c.RateLimit.Enabled {
+		if c.RateLimit.Store != "memory" {
+			problems = append(problems, fmt.Sprintf("rate_limit.store %q must be memory", c.RateLimit.Store))
+		}
+		for name, policy := range c.RateLimit.Groups {
+			if policy.RequestsPerMinute <= 0 || policy.Burst <= 0 {
+				problems = append(problems, fmt.Sprintf("rate_limit.groups.%s needs positive requests_per_minute and burst", name))
+			}
+		}
+	}
+	if c.Idempotency.TTL <= 0 {
+		problems = append(problems, "idempotency.ttl must be positive")
+	}
+	if c.SCIM.Token != "" && len(c.SCIM.Token) < 32 {
+		problems = append(problems, "scim.token must be at least 32 characters")
+	}
+	if c.DirectorySync.Attributes.UserID == "" {
+		problems = append(problems, "directory_sync.attributes.user_id is required")
+	}
+	for value, role := range c.DirectorySync.RoleMap {
+		if !isDirectoryRole(role) {
+			problems = append(problems, fmt.Sprintf("directory_sync.role_map entry %q must map to ADMIN, MANAGER or MEMBER", value))
+		}
+	}
+	if !isDirectoryRole(c.DirectorySync.DefaultRole) {
+		problems = append(problems, "directory_sync.default_role must be ADMIN, MANAGER or MEMBER")
+	}
+	if c.DirectorySync.MaxRemovals < 0 {
+		problems = append(problems, "directory_sync.max_removals must not be negative")
+	}
+	for role, limits := range c.Quotas.Roles {
+		if !isDirectoryRole(role) {
+			problems = append(problems, fmt.Sprintf("quotas.roles entry %q must be ADMIN, MANAGER or MEMBER", role))
+		}
+		if limits.negative() {
+			problems = append(problems, fmt.Sprintf("quotas.roles.%s limits must not be negative", role))
+		}
+	}
+	if c.Quotas.TeamDefault.negative() {
+		problems = append(problems, "quotas.team_default limits must not be negative")
+	}
+	for teamID, limits := range c.Quotas.Teams {
+		if limits.negative() {
+			problems = append(problems, fmt.Sprintf("quotas.teams.%d limits must not be negative", teamID))
+		}
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		problems = append(problems, "database pool sizes must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Redacted returns a copy that is safe to print, with secrets and DSN passwords masked
+func (c Config) Redacted() Config {
+	if c.Auth.AccessTokenSecret != "" {
+		c.Auth.AccessTokenSecret = redacted
+	}
+	if c.Metrics.Token != "" {
+		c.Metrics.Token = redacted
+	}
+	if c.SCIM.Token != "" {
+		c.SCIM.Token = redacted
+	}
+	c.Database.DSN = redactDSN(c.Database.DSN)
+	return c
+}
+
+// YAML renders the configuration as YAML
+func (c Config) YAML() (string, error) {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// redactDSN masks the password of URL and keyword/value style DSNs
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+			return u.String()
+		}
+		return dsn
+	}
+
+	fields := strings.Fields(dsn)
+	for i, f := range fields {
+		if strings.HasPrefix(strings.ToLower(f), "password=") {
+			fields[i] = "password=" + redacted
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+func (l QuotaLimitsConfig) negative() bool {
+	return l.MaxNotes < 0 || l.MaxBytes < 0 || l.MaxFolders < 0
+}
+
+func isDirectoryRole(role string) bool {
+	switch role {
+	case "ADMIN", "MANAGER", "MEMBER":
+		return true
+	}
+	return false
+}
+
+func setString(dst *string, key string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		*dst = v
+	}
+}
+
+func setInt(dst *int, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s must be an integer: %w", key, err)
+	}
+	*dst = n
+	return nil
+}
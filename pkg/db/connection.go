@@ -1,17 +1,95 @@
 package db
 
 import (
+	"fmt"
 	"log"
+	"strings"
 	"team-service/internal/entities"
+	"team-service/pkg/config"
+	"team-service/pkg/metrics"
+	"team-service/pkg/tracing"
+	"time"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// DialectorFactory builds a gorm dialector from a DSN
+type DialectorFactory func(dsn string) gorm.Dialector
+
+// drivers maps DSN schemes to the dialector used to open them
+var drivers = map[string]DialectorFactory{
+	"postgres":   postgres.Open,
+	"postgresql": postgres.Open,
+	"sqlite": func(dsn string) gorm.Dialector {
+		return sqlite.Open(sqlitePath(dsn))
+	},
+	"file": sqlite.Open,
+}
+
+// RegisterDriver makes a storage backend available under the given DSN scheme
+func RegisterDriver(scheme string, factory DialectorFactory) {
+	drivers[strings.ToLower(scheme)] = factory
+}
+
+// Dialector selects the storage backend from the DSN scheme.
+// Keyword/value Postgres DSNs ("host=... user=...") have no scheme and fall back to Postgres.
+func Dialector(dsn string) (gorm.Dialector, error) {
+	scheme := "postgres"
+	if idx := strings.Index(dsn, ":"); idx > 0 && !strings.Contains(dsn[:idx], "=") {
+		scheme = strings.ToLower(dsn[:idx])
+	}
+	if dsn == ":memory:" {
+		scheme = "sqlite"
+	}
+
+	factory, ok := drivers[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database scheme %q", scheme)
+	}
+	return factory(dsn), nil
+}
+
+// sqlitePath strips the sqlite:// or sqlite: prefix so the remainder can be passed to the driver
+func sqlitePath(dsn string) string {
+	path := strings.TrimPrefix(dsn, "sqlite://")
+	path = strings.TrimPrefix(path, "sqlite:")
+	if path == "" || path == ":memory:" {
+		// A shared cache keeps every pooled connection on the same in-memory database
+		return "file::memory:?cache=shared"
+	}
+	return path
+}
+
 // Connect establishes a database connection
 func Connect(dsn string) (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	dialector, err := Dialector(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// TranslateError maps unique violations to gorm.ErrDuplicatedKey on every backend
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := schemaVersionBeforeMigration(db)
 	if err != nil {
+		log.Printf("Failed to read schema version: %v", err)
+		return nil, err
+	}
+	if applied > SchemaVersion {
+		// Migrations only add tables and columns, so this build can still start and serve, as
+		// replicas of the previous release do during a rolling deploy
+		log.Printf("Database schema version %d is newer than this build's %d", applied, SchemaVersion)
+	} else if applied < SchemaVersion {
+		log.Printf("Migrating database schema from version %d to %d", applied, SchemaVersion)
+	}
+
+	if err := dedupeRosters(db); err != nil {
+		log.Printf("Failed to remove duplicate roster entries: %v", err)
 		return nil, err
 	}
 
@@ -21,30 +99,160 @@ func Connect(dsn string) (*gorm.DB, error) {
 		&entities.Note{},
 		&entities.FolderShare{},
 		&entities.NoteShare{},
-		// &entities.Team{},
-		// &entities.Roster{},
-		// &entities.User{},
+		&entities.Team{},
+		&entities.Roster{},
+		&entities.User{},
+		&entities.APIToken{},
+		&entities.RevokedToken{},
+		&entities.SessionWatermark{},
+		&entities.AuditLog{},
+		&entities.IdempotencyRecord{},
+		&entities.TeamInvitation{},
+		&entities.JoinRequest{},
+		&entities.RosterInterval{},
+		&entities.TeamRole{},
+		&entities.Usage{},
+		&entities.AccessRequest{},
+		&entities.SharingPolicy{},
 	)
 	if err != nil {
 		log.Printf("Failed to migrate database: %v", err)
 		return nil, err
 	}
 
+	if err := backfillRosterRoles(db); err != nil {
+		log.Printf("Failed to backfill roster roles: %v", err)
+		return nil, err
+	}
+	if err := backfillRosterIntervals(db); err != nil {
+		log.Printf("Failed to backfill roster history: %v", err)
+		return nil, err
+	}
+	if err := backfillUsage(db); err != nil {
+		log.Printf("Failed to backfill usage counters: %v", err)
+		return nil, err
+	}
+
+	if err := recordSchemaVersion(db); err != nil {
+		log.Printf("Failed to record schema version: %v", err)
+		return nil, err
+	}
+
 	return db, nil
 }
 
-// SetupDatabase initializes the database connection and runs migrations
-func SetupDatabase(dsn string) (*gorm.DB, error) {
-	if dsn == "" {
-		log.Fatal("DATABASE_DSN is not set in environment variables")
+// SetupDatabase initializes the database connection, sizes the pool and runs migrations
+func SetupDatabase(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	db, err := Connect(cfg.DSN)
+	if err != nil {
+		log.Printf("Failed to connect to database: %v", err)
+		return nil, err
 	}
 
-	db, err := Connect(dsn)
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		return nil, err
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Printf("Failed to connect to database: %v", err)
 		return nil, err
 	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
-	log.Println("Database connected and migrated successfully")
+	log.Printf("Database connected and migrated successfully (%s)", db.Dialector.Name())
 	return db, nil
 }
+
+// dedupeRosters removes duplicate (team, user) roster rows left by older versions so the
+// unique index can be created. A manager row wins over a member row for the same user, then the
+// oldest row. It only has work to do before the index exists, and logs every row it removes.
+func dedupeRosters(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&entities.Roster{}) || db.Migrator().HasIndex(&entities.Roster{}, "idx_roster_team_user") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rows []entities.Roster
+		if err := tx.Select(`"rosterId", "teamId", "userId", "isLeader"`).
+			Where(`EXISTS (SELECT 1 FROM "Rosters" r2
+				WHERE r2."teamId" = "Rosters"."teamId" AND r2."userId" = "Rosters"."userId" AND r2."rosterId" <> "Rosters"."rosterId")`).
+			Order(`"teamId", "userId", "isLeader" DESC, "rosterId"`).
+			Find(&rows).Error; err != nil {
+			return err
+		}
+
+		// Rows are sorted so the one to keep comes first for each (team, user)
+		var remove []uint
+		for i, row := range rows {
+			if i > 0 && rows[i-1].TeamId == row.TeamId && rows[i-1].UserId == row.UserId {
+				log.Printf("Removing duplicate roster entry %d (team %d, user %s, leader %t)",
+					row.RosterId, row.TeamId, row.UserId, row.IsLeader)
+				remove = append(remove, row.RosterId)
+			}
+		}
+		if len(remove) == 0 {
+			return nil
+		}
+		if err := tx.Where(`"rosterId" IN ?`, remove).Delete(&entities.Roster{}).Error; err != nil {
+			return err
+		}
+		log.Printf("Removed %d duplicate roster entries before creating the unique roster index", len(remove))
+		return nil
+	})
+}
+
+// backfillRosterRoles names the role of roster rows written before custom roles, when the
+// isLeader flag was the only role a roster row had
+func backfillRosterRoles(db *gorm.DB) error {
+	return db.Exec(`UPDATE "Rosters" SET role = CASE WHEN "isLeader" THEN ? ELSE ? END
+		WHERE role = '' OR role IS NULL`,
+		entities.RosterRoleManager, entities.RosterRoleMember).Error
+}
+
+// backfillRosterIntervals opens a history interval for roster rows that predate membership
+// history. Their real join date is unknown, so history for them starts at the migration.
+func backfillRosterIntervals(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO roster_intervals (team_id, user_id, role, joined_at, added_by)
+		SELECT r."teamId", r."userId", CASE WHEN r."isLeader" THEN ? ELSE ? END, ?, ''
+		FROM "Rosters" r
+		WHERE NOT EXISTS (
+			SELECT 1 FROM roster_intervals i
+			WHERE i.team_id = r."teamId" AND i.user_id = r."userId" AND i.left_at IS NULL)`,
+		entities.RosterRoleManager, entities.RosterRoleMember, time.Now()).Error
+}
+
+// backfillUsage counts the notes and folders that predate usage counters. It only runs while
+// no counters exist; from then on the counters move with every write.
+func backfillUsage(db *gorm.DB) error {
+	var counters int64
+	if err := db.Model(&entities.Usage{}).Count(&counters).Error; err != nil {
+		return err
+	}
+	if counters > 0 {
+		return nil
+	}
+
+	// Quotas count bytes, not characters
+	bodyBytes := "OCTET_LENGTH(body)"
+	if db.Dialector.Name() == "sqlite" {
+		bodyBytes = "LENGTH(CAST(body AS BLOB))"
+	}
+	subject := `CASE WHEN team_id IS NULL THEN ? ELSE ? END AS scope,
+		CASE WHEN team_id IS NULL THEN owner_id ELSE CAST(team_id AS TEXT) END AS subject_id`
+	return db.Exec(`INSERT INTO usage_counters (scope, subject_id, notes, bytes, folders, updated_at)
+		SELECT scope, subject_id, SUM(notes), SUM(bytes), SUM(folders), ?
+		FROM (
+			SELECT `+subject+`, 1 AS notes, COALESCE(`+bodyBytes+`, 0) AS bytes, 0 AS folders FROM notes
+			UNION ALL
+			SELECT `+subject+`, 0, 0, 1 FROM folders
+		) assets
+		GROUP BY scope, subject_id`,
+		time.Now(),
+		entities.UsageScopeUser, entities.UsageScopeTeam,
+		entities.UsageScopeUser, entities.UsageScopeTeam).Error
+}
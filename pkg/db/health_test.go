@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestCheckReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		ready   bool
+	}{
+		{"never migrated", 0, false},
+		{"behind", SchemaVersion - 1, false},
+		{"current", SchemaVersion, true},
+		// A newer release migrated the database during a rolling deploy
+		{"ahead", SchemaVersion + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "health.db")), &gorm.Config{Logger: gormlogger.Discard})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { Close(database) })
+			if err := database.AutoMigrate(&schemaMigration{}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.version > 0 {
+				if err := database.Create(&schemaMigration{Version: tt.version, AppliedAt: time.Now()}).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = CheckReady(context.Background(), database)
+			if ready := err == nil; ready != tt.ready {
+				t.Errorf("CheckReady at version %d = %v, want ready %v", tt.version, err, tt.ready)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Package ldif reads LDAP Data Interchange Format (RFC 2849) content records, as produced by
+// directory exports such as ldapsearch or slapcat.
+package ldif
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxLineBytes bounds a single (unfolded) line, which is where base64 photos usually end up
+const maxLineBytes = 4 << 20
+
+// Entry is one content record. Attribute names are matched case-insensitively and
+// attribute options such as ";lang-en" or ";binary" are dropped.
+type Entry struct {
+	DN   string
+	Line int // line of the dn, counting from 1
+
+	attrs map[string][]string
+}
+
+// Values returns every value of the attribute
+func (e *Entry) Values(name string) []string {
+	return e.attrs[strings.ToLower(name)]
+}
+
+// Value returns the first value of the attribute, or "" when it is absent
+func (e *Entry) Value(name string) string {
+	if v := e.Values(name); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// HasObjectClass reports whether the entry has any of the object classes
+func (e *Entry) HasObjectClass(classes ...string) bool {
+	for _, have := range e.Values("objectClass") {
+		for _, want := range classes {
+			if strings.EqualFold(have, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseError reports the line of a malformed record
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse reads every content record. Change records (changetype) and values loaded
+// from URLs ("attr:< file://...") are rejected.
+func Parse(r io.Reader) ([]Entry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+
+	var (
+		entries []Entry
+		current *Entry
+		logical string // the line being unfolded
+		start   int    // where the logical line started
+		lineNo  int
+	)
+
+	flush := func() error {
+		if logical == "" {
+			return nil
+		}
+		line := logical
+		logical = ""
+		if strings.HasPrefix(line, "#") {
+			return nil
+		}
+		return addLine(&entries, &current, line, start)
+	}
+
+	for scanner.Scan() {
+		lineNo++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if lineNo == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+
+		switch {
+		case strings.HasPrefix(text, " ") && logical != "":
+			// A folded line continues the previous one without its leading space
+			logical += text[1:]
+		case strings.TrimSpace(text) == "":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if current != nil {
+				entries = append(entries, *current)
+				current = nil
+			}
+		default:
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			logical, start = text, lineNo
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &ParseError{Line: lineNo + 1, Msg: err.Error()}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		entries = append(entries, *current)
+	}
+	return entries, nil
+}
+
+func addLine(entries *[]Entry, current **Entry, line string, lineNo int) error {
+	name, value, err := parseAttrValue(line, lineNo)
+	if err != nil {
+		return err
+	}
+
+	if *current == nil {
+		switch {
+		case name == "version" && len(*entries) == 0:
+			if value != "1" {
+				return &ParseError{Line: lineNo, Msg: fmt.Sprintf("unsupported LDIF version %q", value)}
+			}
+			return nil
+		case name != "dn":
+			return &ParseError{Line: lineNo, Msg: fmt.Sprintf("record must start with dn, found %q", name)}
+		}
+		*current = &Entry{DN: value, Line: lineNo, attrs: make(map[string][]string)}
+		return nil
+	}
+
+	switch name {
+	case "dn":
+		return &ParseError{Line: lineNo, Msg: "missing blank line between records"}
+	case "changetype", "control":
+		return &ParseError{Line: lineNo, Msg: "change records are not supported; export content records only"}
+	}
+	(*current).attrs[name] = append((*current).attrs[name], value)
+	return nil
+}
+
+// parseAttrValue splits "name: value", decoding "name:: base64"
+func parseAttrValue(line string, lineNo int) (string, string, error) {
+	colon := strings.IndexByte(line, ':')
+	if colon <= 0 {
+		return "", "", &ParseError{Line: lineNo, Msg: "expected \"attribute: value\""}
+	}
+	name := strings.ToLower(line[:colon])
+	if semi := strings.IndexByte(name, ';'); semi >= 0 {
+		name = name[:semi]
+	}
+	rest := line[colon+1:]
+
+	switch {
+	case strings.HasPrefix(rest, ":"):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return "", "", &ParseError{Line: lineNo, Msg: fmt.Sprintf("invalid base64 value for %s", name)}
+		}
+		return name, string(decoded), nil
+	case strings.HasPrefix(rest, "<"):
+		return "", "", &ParseError{Line: lineNo, Msg: fmt.Sprintf("values loaded from URLs are not supported (%s)", name)}
+	}
+	return name, strings.TrimLeft(rest, " "), nil
+}
+
+// NormalizeDN lower-cases a DN and drops insignificant spaces around separators so
+// references such as group members can be compared with entry DNs
+func NormalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, rdn := range parts {
+		if eq := strings.IndexByte(rdn, '='); eq >= 0 {
+			rdn = strings.TrimSpace(rdn[:eq]) + "=" + strings.TrimSpace(rdn[eq+1:])
+		}
+		parts[i] = strings.ToLower(strings.TrimSpace(rdn))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,120 @@
+package ldif
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, content string) []Entry {
+	t.Helper()
+	entries, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return entries
+}
+
+func TestParseFoldedLines(t *testing.T) {
+	entries := parse(t, "version: 1\n"+
+		"dn: uid=ada,ou=people,\n"+
+		" dc=example,dc=com\n"+
+		"cn: Ada \n"+
+		" Lovelace\n"+
+		"description: one\n"+
+		"  two\n")
+
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.DN != "uid=ada,ou=people,dc=example,dc=com" {
+		t.Errorf("DN = %q", e.DN)
+	}
+	if e.Line != 2 {
+		t.Errorf("Line = %d, want 2", e.Line)
+	}
+	if got := e.Value("cn"); got != "Ada Lovelace" {
+		t.Errorf("cn = %q, want %q", got, "Ada Lovelace")
+	}
+	// Only the first space of a continuation line is dropped
+	if got := e.Value("description"); got != "one two" {
+		t.Errorf("description = %q, want %q", got, "one two")
+	}
+}
+
+func TestParseBase64Values(t *testing.T) {
+	entries := parse(t, "dn:: dWlkPWrDtnJnLG91PXBlb3BsZQ==\n"+
+		"cn:: SsO2cmcgTcO8bGxlcg==\n"+
+		"description:: IGxlYWRpbmcgc3BhY2U=\n"+
+		"mail: jorg@example.com\n")
+
+	e := entries[0]
+	if e.DN != "uid=jörg,ou=people" {
+		t.Errorf("DN = %q", e.DN)
+	}
+	if got := e.Value("cn"); got != "Jörg Müller" {
+		t.Errorf("cn = %q", got)
+	}
+	if got := e.Value("description"); got != " leading space" {
+		t.Errorf("description = %q", got)
+	}
+
+	_, err := Parse(strings.NewReader("dn: uid=x\ncn:: not base64!\n"))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 2 {
+		t.Errorf("invalid base64: err = %v, want a ParseError on line 2", err)
+	}
+}
+
+func TestParseMultiValuedAttributes(t *testing.T) {
+	entries := parse(t, "# groups\n"+
+		"dn: cn=eng,ou=groups\n"+
+		"objectClass: top\n"+
+		"objectClass: groupOfNames\n"+
+		"member: uid=ada,ou=people\n"+
+		"Member;range=1-2: uid=alan,ou=people\n"+
+		"member:: dWlkPWdyYWNlLG91PXBlb3BsZQ==\n"+
+		"\n"+
+		"dn: cn=ops,ou=groups\n"+
+		"objectClass: groupOfNames\n")
+
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	want := []string{"uid=ada,ou=people", "uid=alan,ou=people", "uid=grace,ou=people"}
+	if got := entries[0].Values("MEMBER"); !reflect.DeepEqual(got, want) {
+		t.Errorf("member = %q, want %q", got, want)
+	}
+	if !entries[0].HasObjectClass("posixGroup", "GROUPOFNAMES") {
+		t.Error("HasObjectClass did not match groupOfNames case-insensitively")
+	}
+	if got := entries[1].Values("member"); got != nil {
+		t.Errorf("second entry member = %q, want none", got)
+	}
+	if entries[1].Line != 9 {
+		t.Errorf("second entry Line = %d, want 9", entries[1].Line)
+	}
+}
+
+func TestParseRejectsChangeRecords(t *testing.T) {
+	for name, content := range map[string]string{
+		"changetype":       "dn: uid=x\nchangetype: delete\n",
+		"url value":        "dn: uid=x\njpegPhoto:< file:///etc/passwd\n",
+		"missing dn":       "cn: x\n",
+		"missing blank":    "dn: uid=x\ndn: uid=y\n",
+		"unknown version":  "version: 2\ndn: uid=x\n",
+		"no attribute sep": "dn: uid=x\njust text\n",
+	} {
+		if _, err := Parse(strings.NewReader(content)); err == nil {
+			t.Errorf("%s: Parse succeeded, want an error", name)
+		}
+	}
+}
+
+func TestNormalizeDN(t *testing.T) {
+	if got, want := NormalizeDN("UID=Ada , OU = People,dc=Example"), "uid=ada,ou=people,dc=example"; got != want {
+		t.Errorf("NormalizeDN = %q, want %q", got, want)
+	}
+}
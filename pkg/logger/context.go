@@ -0,0 +1,31 @@
+package logger
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// contextKey is where the request-scoped logger lives in the gin context
+const contextKey = "logger"
+
+// FromContext returns the request-scoped logger, or the global logger outside a request
+func FromContext(c *gin.Context) *zerolog.Logger {
+	if c != nil {
+		if l, ok := c.Get(contextKey); ok {
+			if reqLogger, ok := l.(*zerolog.Logger); ok {
+				return reqLogger
+			}
+		}
+	}
+	return &Logger
+}
+
+// WithContext stores a request-scoped logger in the gin context
+func WithContext(c *gin.Context, l zerolog.Logger) {
+	c.Set(contextKey, &l)
+}
+
+// AddField attaches a field to every later log line of the current request
+func AddField(c *gin.Context, key, value string) {
+	WithContext(c, FromContext(c).With().Str(key, value).Logger())
+}
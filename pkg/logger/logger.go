@@ -1,22 +1,73 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"team-service/pkg/config"
 
 	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var Logger zerolog.Logger
+var Logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
 
-func SetupLogger() {
-	os.MkdirAll("logs", os.ModePerm)
-
-	file, err := os.OpenFile("/var/log/app/app.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+// SetupLogger builds the global logger from the logging configuration.
+// Every sink receives the same redacted event stream.
+func SetupLogger(cfg config.LoggingConfig) error {
+	level, err := zerolog.ParseLevel(cfg.Level)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+
+	var sinks []io.Writer
+	for _, output := range cfg.Outputs {
+		switch output {
+		case "stdout":
+			sinks = append(sinks, formatted(os.Stdout, cfg.Format))
+		case "file":
+			sink, err := fileSink(cfg.File)
+			if err != nil {
+				return err
+			}
+			sinks = append(sinks, formatted(sink, cfg.Format))
+		default:
+			return fmt.Errorf("unknown log output %q", output)
+		}
+	}
+	if len(sinks) == 0 {
+		sinks = append(sinks, formatted(os.Stdout, cfg.Format))
+	}
+
+	writer := newRedactingWriter(zerolog.MultiLevelWriter(sinks...), cfg.RedactFields)
+	Logger = zerolog.New(writer).Level(level).With().Timestamp().Logger()
+	return nil
+}
+
+// fileSink opens a size-rotated log file, creating its directory if needed
+func fileSink(cfg config.FileSinkConfig) (io.Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("create log directory for %s: %w", cfg.Path, err)
 	}
 
-	multi := zerolog.MultiLevelWriter(os.Stdout, file)
+	sink := &lumberjack.Logger{
+		Filename:   cfg.Path,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+		Compress:   cfg.Compress,
+	}
+	// Surface permission problems at startup instead of on the first write
+	if _, err := sink.Write(nil); err != nil {
+		return nil, fmt.Errorf("open log file %s: %w", cfg.Path, err)
+	}
+	return sink, nil
+}
 
-	Logger = zerolog.New(multi).With().Timestamp().Logger()
+func formatted(w io.Writer, format string) io.Writer {
+	if format == "console" {
+		return zerolog.ConsoleWriter{Out: w, NoColor: w != os.Stdout}
+	}
+	return w
 }
@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+const redactedValue = "[REDACTED]"
+
+// defaultRedactFields are never written to any sink in clear text
+var defaultRedactFields = []string{
+	"authorization",
+	"body",
+	"password",
+	"secret",
+	"token",
+	"access_token",
+	"access_token_secret",
+	"refresh_token",
+}
+
+// redactingWriter masks sensitive fields before events reach the sinks.
+// Events without a sensitive key are passed through untouched.
+type redactingWriter struct {
+	next   zerolog.LevelWriter
+	fields map[string]struct{}
+}
+
+func newRedactingWriter(next zerolog.LevelWriter, extra []string) *redactingWriter {
+	fields := make(map[string]struct{}, len(defaultRedactFields)+len(extra))
+	for _, f := range append(defaultRedactFields, extra...) {
+		fields[strings.ToLower(f)] = struct{}{}
+	}
+	return &redactingWriter{next: next, fields: fields}
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := w.next.Write(w.redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *redactingWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if _, err := w.next.WriteLevel(level, w.redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *redactingWriter) redact(p []byte) []byte {
+	if !w.mentionsSensitiveKey(p) {
+		return p
+	}
+
+	var event map[string]interface{}
+	if err := json.Unmarshal(p, &event); err != nil {
+		return p
+	}
+	w.redactMap(event)
+
+	out, err := json.Marshal(event)
+	if err != nil {
+		return p
+	}
+	return append(out, '\n')
+}
+
+func (w *redactingWriter) redactMap(m map[string]interface{}) {
+	for key, value := range m {
+		if _, ok := w.fields[strings.ToLower(key)]; ok {
+			m[key] = redactedValue
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			w.redactMap(nested)
+		}
+	}
+}
+
+func (w *redactingWriter) mentionsSensitiveKey(p []byte) bool {
+	lower := bytes.ToLower(p)
+	for field := range w.fields {
+		if bytes.Contains(lower, []byte(`"`+field+`":`)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "team_service"
+
+// Registry holds every metric exported on /metrics
+var Registry = prometheus.NewRegistry()
+
+// HTTP metrics, labelled by route template rather than raw path to keep cardinality bounded
+var (
+	HTTPRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by method, route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+)
+
+// Database metrics
+var (
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of gorm statements, by operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	DBQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "gorm statements that returned an error other than record not found.",
+	}, []string{"operation", "table"})
+)
+
+// Domain metrics
+var (
+	SharesCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shares_created_total",
+		Help:      "Shares granted, by asset type (folder, note) and access level.",
+	}, []string{"asset", "access"})
+
+	SharesRevoked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shares_revoked_total",
+		Help:      "Shares revoked, by asset type (folder, note).",
+	}, []string{"asset"})
+
+	NotesCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notes_created_total",
+		Help:      "Notes created.",
+	})
+
+	TeamsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "teams_created_total",
+		Help:      "Teams created.",
+	})
+
+	RosterChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "roster_changes_total",
+		Help:      "Team roster changes, by action (add, remove) and role (manager, member, custom).",
+	}, []string{"action", "role"})
+
+	SessionsRevoked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sessions_revoked_total",
+		Help:      "Access token revocations, by scope (token, user).",
+	}, []string{"scope"})
+
+	SessionsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sessions_rejected_total",
+		Help:      "Verified credentials rejected after verification, by reason (revoked, inactive).",
+	}, []string{"reason"})
+
+	Invitations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "team_invitations_total",
+		Help:      "Team invitation events, by action (sent, accepted, declined, rescinded).",
+	}, []string{"action"})
+
+	JoinRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "team_join_requests_total",
+		Help:      "Team join request events, by action (requested, joined, approved, rejected).",
+	}, []string{"action"})
+
+	SCIMOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scim_operations_total",
+		Help:      "SCIM provisioning changes, by resource (user, group) and action (create, replace, patch, delete).",
+	}, []string{"resource", "action"})
+
+	AccessRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "access_requests_total",
+		Help:      "Share access request events, by action (requested, held for a manager, approved, rejected).",
+	}, []string{"action"})
+
+	SharingPolicyViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sharing_policy_violations_total",
+		Help:      "Shares refused by a sharing policy, by rule.",
+	}, []string{"rule"})
+
+	QuotaRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quota_rejections_total",
+		Help:      "Writes refused by a quota, by scope (user, team) and resource (notes, bytes, folders).",
+	}, []string{"scope", "resource"})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected with 429, by rate limit group.",
+	}, []string{"group"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestsTotal,
+		HTTPRequestDuration,
+		HTTPRequestsInFlight,
+		DBQueryDuration,
+		DBQueryErrors,
+		SharesCreated,
+		SharesRevoked,
+		NotesCreated,
+		TeamsCreated,
+		RosterChanges,
+		SessionsRevoked,
+		SessionsRejected,
+		RateLimited,
+		Invitations,
+		JoinRequests,
+		SCIMOperations,
+		QuotaRejections,
+		AccessRequests,
+		SharingPolicyViolations,
+	)
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"team-service/pkg/config"
+	"team-service/pkg/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientLimitKeysOnTrustedClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		proxies []string
+		// limited reports whether a second request from the same peer with a different
+		// X-Forwarded-For is rejected
+		limited bool
+	}{
+		{"no trusted proxies", nil, true},
+		{"peer is a trusted proxy", []string{"10.0.0.0/8"}, false},
+		{"peer is not a trusted proxy", []string{"192.168.0.1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(ratelimit.NewMemoryStore(), config.RateLimitConfig{
+				Enabled: true,
+				Groups:  map[string]config.RateLimitPolicy{ClientGroup: {RequestsPerMinute: 1, Burst: 1}},
+			})
+			r := gin.New()
+			if err := r.SetTrustedProxies(tt.proxies); err != nil {
+				t.Fatal(err)
+			}
+			r.Use(limiter.Client())
+			r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			var codes []int
+			for _, forwarded := range []string{"203.0.113.1", "203.0.113.2"} {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = "10.1.2.3:40000"
+				req.Header.Set("X-Forwarded-For", forwarded)
+				rec := httptest.NewRecorder()
+				r.ServeHTTP(rec, req)
+				codes = append(codes, rec.Code)
+			}
+			if codes[0] != http.StatusOK {
+				t.Fatalf("first request: status %d", codes[0])
+			}
+			if limited := codes[1] == http.StatusTooManyRequests; limited != tt.limited {
+				t.Errorf("second request: status %d, want limited %v", codes[1], tt.limited)
+			}
+		})
+	}
+}
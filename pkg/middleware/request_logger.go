@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"team-service/pkg/logger"
+	"team-service/pkg/tracing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// RequestLogger assigns a request ID, stores a request-scoped logger in the
+// gin context and logs one line per completed request
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = newRequestID()
+		}
+		c.Set("requestId", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		logCtx := logger.Logger.With().
+			Str("requestId", requestID).
+			Str("route", route)
+		if traceID, spanID := tracing.IDs(c.Request.Context()); traceID != "" {
+			logCtx = logCtx.Str("traceId", traceID).Str("spanId", spanID)
+		}
+		logger.WithContext(c, logCtx.Logger())
+
+		c.Next()
+
+		status := c.Writer.Status()
+		event := logger.FromContext(c).Info()
+		switch {
+		case status >= 500:
+			event = logger.FromContext(c).Error()
+		case status >= 400:
+			event = logger.FromContext(c).Warn()
+		}
+		if len(c.Errors) > 0 {
+			event = event.Str("errors", c.Errors.String())
+		}
+		event.
+			Str("method", c.Request.Method).
+			Str("path", c.Request.URL.Path).
+			Int("status", status).
+			Int("size", c.Writer.Size()).
+			Str("clientIp", c.ClientIP()).
+			Dur("latency", time.Since(start)).
+			Msg("Request completed")
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}